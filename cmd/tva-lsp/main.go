@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tvm/internal/lsp"
+)
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// runCommand serves the Language Server Protocol over stdin and stdout until the client exits, and returns the
+// process exit code
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var includePaths []string
+	flags := flag.NewFlagSet("tva-lsp", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Func("I", "directory to search for included files (may be repeated)", func(path string) error {
+		includePaths = append(includePaths, path)
+		return nil
+	})
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tva-lsp [-I dir]...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := lsp.NewServer(includePaths...).Serve(stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "tva-lsp: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frame frames JSON-RPC messages the way an LSP client sends them
+func frame(messages ...string) string {
+	framed := ""
+	for _, message := range messages {
+		framed += fmt.Sprintf("Content-Length: %v\r\n\r\n%v", len(message), message)
+	}
+
+	return framed
+}
+
+func TestRunCommand_ServesUntilTheClientExits(t *testing.T) {
+	stdin := frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"untitled:a.tva","languageId":"tva","version":1,"text":"bogus\n"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	require.Equal(t, 0, runCommand(nil, strings.NewReader(stdin), stdout, stderr), stderr.String())
+	assert.Contains(t, stdout.String(), `"name":"tva-lsp"`)
+	assert.Contains(t, stdout.String(), `"message":"unknown instruction 'bogus'"`)
+	assert.Contains(t, stdout.String(), `{"jsonrpc":"2.0","id":2,"result":null}`)
+}
+
+func TestRunCommand_FailsWhenTheClientLeavesEarly(t *testing.T) {
+	stdin := frame(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand(nil, strings.NewReader(stdin), &bytes.Buffer{}, stderr))
+	assert.Equal(t, "tva-lsp: the client closed the connection without exiting\n", stderr.String())
+	assert.Equal(t, 2, runCommand([]string{"extra"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tvm/internal/assembler"
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// buildOptions holds the flags accepted by `tva build`
+type buildOptions struct {
+	outputPath   string
+	includePaths []string
+	wordSize     string
+	overflow     string
+	objects      bool
+	listingPath  string
+	debugInfo    bool
+	optimize     bool
+}
+
+// buildProgram implements `tva build`: it assembles one or more TVA files, one after another, into a single TVM
+// program, or with -c assembles each of them into its own object file for tvl to link
+func buildProgram(args []string, stdout, stderr io.Writer) int {
+	options := buildOptions{}
+	flags := flag.NewFlagSet("tva build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tva build [flags] file.tva...")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&options.outputPath, "o", "", "file to write the program to (default: the first file with a .tvm extension, or .tvo with -c)")
+	flags.Func("I", "directory to search for included files (may be repeated)", func(path string) error {
+		options.includePaths = append(options.includePaths, path)
+		return nil
+	})
+	flags.StringVar(&options.wordSize, "word-size", "32", "word size the program is built for (32, 64 or big)")
+	flags.StringVar(&options.overflow, "overflow", "wrap", "overflow mode the program is built for (wrap, saturate or fault)")
+	flags.BoolVar(&options.objects, "c", false, "assemble each file into a relocatable object file instead of a program")
+	flags.StringVar(&options.listingPath, "listing", "", "file to write a listing of the program to, with its symbol table and cross-reference")
+	flags.BoolVar(&options.debugInfo, "g", false, "embed debug information mapping the program's addresses back to its source and labels")
+	flags.BoolVar(&options.optimize, "O", false, "run the peephole optimizer over the program's instructions")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 || (options.objects && (options.listingPath != "" || options.debugInfo || options.outputPath != "" && flags.NArg() > 1)) {
+		flags.Usage()
+		return 2
+	}
+
+	wordFormat, err := parseWordFormat(options.wordSize, options.overflow)
+	if err != nil {
+		fmt.Fprintf(stderr, "tva: %v\n", err)
+		return 2
+	}
+
+	if options.objects {
+		return buildObjects(flags.Args(), options, wordFormat, stderr)
+	}
+
+	tvaAssembler := assembler.NewAssemblerFromFiles(flags.Args()...)
+	tvaAssembler.SetIncludePaths(options.includePaths...)
+	tvaAssembler.SetWordFormat(wordFormat)
+	tvaAssembler.SetOptimization(options.optimize)
+
+	program, err := tvaAssembler.Assemble()
+	if err != nil {
+		fmt.Fprintf(stderr, "tva: %v\n", err)
+		return 1
+	}
+
+	outputPath := options.outputPath
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(flags.Arg(0), filepath.Ext(flags.Arg(0))) + ".tvm"
+	}
+
+	var debug *tvm.SourceMap
+	if options.debugInfo {
+		sourceMap := tvaAssembler.SourceMap()
+		debug = &sourceMap
+	}
+
+	if err := writeProgram(outputPath, program, wordFormat, debug); err != nil {
+		fmt.Fprintf(stderr, "tva: %v\n", err)
+		return 1
+	}
+
+	if options.listingPath != "" {
+		if err := os.WriteFile(options.listingPath, []byte(tvaAssembler.Listing().Detailed()), 0o644); err != nil {
+			fmt.Fprintf(stderr, "tva: %v\n", err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// buildObjects assembles each of the files provided into an object file named after it, or after the output path
+// if there is only one
+func buildObjects(paths []string, options buildOptions, wordFormat tvm.WordFormat, stderr io.Writer) int {
+	for _, path := range paths {
+		tvaAssembler := assembler.NewAssemblerFromFiles(path)
+		tvaAssembler.SetIncludePaths(options.includePaths...)
+		tvaAssembler.SetWordFormat(wordFormat)
+		tvaAssembler.SetOptimization(options.optimize)
+
+		object, err := tvaAssembler.AssembleObject()
+		if err != nil {
+			fmt.Fprintf(stderr, "tva: %v\n", err)
+			return 1
+		}
+
+		outputPath := options.outputPath
+		if outputPath == "" {
+			outputPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".tvo"
+		}
+
+		if err := writeObject(outputPath, object); err != nil {
+			fmt.Fprintf(stderr, "tva: %v\n", err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func writeObject(path string, object linker.Object) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := linker.WriteObject(file, object); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeProgram writes a plain TVM file for programs built for the default word format without debug information,
+// and a sectioned image recording the word format and debug information otherwise
+func writeProgram(path string, program []int, wordFormat tvm.WordFormat, debug *tvm.SourceMap) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if wordFormat == (tvm.WordFormat{}) && debug == nil {
+		err = tvm.WriteProgram(file, program)
+	} else {
+		image := tvm.Image{
+			Sections:   []tvm.Section{{Name: "program", Start: 0, Permissions: tvm.MemoryPermissionAll, Words: program}},
+			WordFormat: wordFormat,
+			Debug:      debug,
+		}
+
+		err = tvm.WriteImage(file, image)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func parseWordFormat(size, overflow string) (tvm.WordFormat, error) {
+	wordSize, err := tvm.ParseWordSize(size)
+	if err != nil {
+		return tvm.WordFormat{}, err
+	}
+
+	overflowMode, err := tvm.ParseOverflow(overflow)
+	if err != nil {
+		return tvm.WordFormat{}, err
+	}
+
+	return tvm.WordFormat{Size: wordSize, Overflow: overflowMode}, nil
+}
@@ -1,9 +1,33 @@
-package tva
+package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
+const usage = `usage: tva <command> [arguments]
+
+commands:
+  build  assemble TVA files into a TVM program
+`
+
 func main() {
-	fmt.Println("hello, world!")
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand dispatches to the subcommand named by the first argument and returns the process exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "build":
+		return buildProgram(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "tva: unknown command '%v'\n%v", args[0], usage)
+		return 2
+	}
 }
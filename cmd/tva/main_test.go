@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// runBuiltProgram loads the program at the path provided and runs it, returning its last output
+func runBuiltProgram(t *testing.T, path string) (int, tvm.WordFormat) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	image, err := tvm.ReadImage(file)
+	require.NoError(t, err)
+
+	machine, err := tvm.NewTsvetokVirtualMachineFromImage(image)
+	require.NoError(t, err)
+
+	output := &tvm.MockOutputInterface{}
+	machine.SetOutputInterface(output)
+	require.NoError(t, machine.Execute())
+	require.NotNil(t, output.LastNumberReceived)
+
+	return *output.LastNumberReceived, machine.GetWordFormat()
+}
+
+func TestBuild_AssemblesSeveralFilesIntoOneProgram(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(directory, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "main.tva"), []byte(".include \"square.tva\"\nmov 7, r0\njmp square\nreturn: out r0\nhlt\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "lib", "square.tva"), []byte(".macro square x\n\tmlt \\x, \\x, \\x\n.endm\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "routines.tva"), []byte("square: square r0\njmp return\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{
+		"build", "-I", filepath.Join(directory, "lib"),
+		filepath.Join(directory, "main.tva"), filepath.Join(directory, "routines.tva"),
+	}, &bytes.Buffer{}, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	output, wordFormat := runBuiltProgram(t, filepath.Join(directory, "main.tvm"))
+	assert.Equal(t, 49, output)
+	assert.Equal(t, tvm.WordFormat{}, wordFormat)
+}
+
+func TestBuild_RecordsTheWordFormatInTheImage(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "big.tva")
+	output := filepath.Join(directory, "out.tvm")
+	require.NoError(t, os.WriteFile(source, []byte("out 5000000000\nhlt\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{"build", "-o", output, source}, &bytes.Buffer{}, stderr))
+	assert.Contains(t, stderr.String(), "literal '5000000000' does not fit in a 32-bit word")
+
+	code := runCommand([]string{"build", "-o", output, "--word-size", "64", "--overflow", "fault", source}, &bytes.Buffer{}, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	value, wordFormat := runBuiltProgram(t, output)
+	assert.Equal(t, 5000000000, value)
+	assert.Equal(t, tvm.WordFormat{Size: tvm.WordSize64, Overflow: tvm.OverflowFault}, wordFormat)
+}
+
+func TestBuild_ReportsAssemblyErrors(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "broken.tva")
+	require.NoError(t, os.WriteFile(source, []byte("hlt\nbogus\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{"build", source}, &bytes.Buffer{}, stderr))
+	assert.Equal(t, "tva: unknown instruction 'bogus'\nerror on line '2' of '"+source+"'\n", stderr.String())
+}
+
+func TestBuild_AssemblesEachFileIntoAnObject(t *testing.T) {
+	directory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "main.tva"), []byte(".extern square\njmp square\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "square.tva"), []byte(".global square\nsquare: mlt r0, r0, r0\nhlt\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{"build", "-c", filepath.Join(directory, "main.tva"), filepath.Join(directory, "square.tva")}, &bytes.Buffer{}, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	for name, symbols := range map[string][]string{"main.tvo": {}, "square.tvo": {"square"}} {
+		file, err := os.Open(filepath.Join(directory, name))
+		require.NoError(t, err)
+		defer file.Close()
+
+		object, err := linker.ReadObject(file)
+		require.NoError(t, err)
+
+		exported := []string{}
+		for _, symbol := range object.Symbols {
+			if symbol.Exported {
+				exported = append(exported, symbol.Name)
+			}
+		}
+
+		assert.Equal(t, symbols, exported, name)
+	}
+}
+
+func TestBuild_RejectsBadArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"explode"},
+		{"build"},
+		{"build", "--word-size", "16", "a.tva"},
+		{"build", "--overflow", "explode", "a.tva"},
+		{"build", "-c", "-o", "out.tvo", "a.tva", "b.tva"},
+	} {
+		assert.Equal(t, 2, runCommand(args, &bytes.Buffer{}, &bytes.Buffer{}), "args: %v", args)
+	}
+}
+
+func TestBuild_WritesAListing(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "main.tva")
+	listing := filepath.Join(directory, "main.lst")
+	require.NoError(t, os.WriteFile(source, []byte("loop: out 1\njmp loop\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	require.Equal(t, 0, runCommand([]string{"build", "--listing", listing, source}, &bytes.Buffer{}, stderr), stderr.String())
+
+	contents, err := os.ReadFile(listing)
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "     0  104 1                    out i            1  loop: out 1\n")
+	assert.Contains(t, string(contents), "loop             "+source+":1")
+
+	assert.Equal(t, 2, runCommand([]string{"build", "-c", "--listing", listing, source}, &bytes.Buffer{}, &bytes.Buffer{}))
+}
+
+func TestBuild_EmbedsDebugInformation(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "main.tva")
+	output := filepath.Join(directory, "main.tvm")
+	require.NoError(t, os.WriteFile(source, []byte("start: mov 1, r0\nloop: div 1, 0, r0\nhlt\n"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	require.Equal(t, 0, runCommand([]string{"build", "-g", source}, &bytes.Buffer{}, stderr), stderr.String())
+
+	file, err := os.Open(output)
+	require.NoError(t, err)
+	defer file.Close()
+
+	image, err := tvm.ReadImage(file)
+	require.NoError(t, err)
+	require.NotNil(t, image.Debug)
+	assert.Equal(t, map[string]int{"start": 0, "loop": 4}, image.Debug.Labels)
+
+	machine, err := tvm.NewTsvetokVirtualMachineFromImage(image)
+	require.NoError(t, err)
+	assert.EqualError(t, machine.Execute(), source+":2:7: attempted to divide by zero (pc 4 in loop)")
+
+	assert.Equal(t, 2, runCommand([]string{"build", "-c", "-g", source}, &bytes.Buffer{}, &bytes.Buffer{}))
+}
+
+func TestBuild_OptimizesWithO(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "main.tva")
+	require.NoError(t, os.WriteFile(source, []byte("add 2, 3, r0\nmov r0, r0\njmp print\nprint: out r0\nhlt\n"), 0o644))
+
+	size := func(path string) int {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+
+		image, err := tvm.ReadImage(file)
+		require.NoError(t, err)
+		return image.MemorySize()
+	}
+
+	for _, args := range [][]string{{"-o", filepath.Join(directory, "plain.tvm")}, {"-O", "-o", filepath.Join(directory, "optimized.tvm")}} {
+		stderr := &bytes.Buffer{}
+		require.Equal(t, 0, runCommand(append(append([]string{"build"}, args...), source), &bytes.Buffer{}, stderr), stderr.String())
+	}
+
+	output, _ := runBuiltProgram(t, filepath.Join(directory, "optimized.tvm"))
+	assert.Equal(t, 5, output)
+	assert.Equal(t, 14, size(filepath.Join(directory, "plain.tvm")))
+	assert.Equal(t, 7, size(filepath.Join(directory, "optimized.tvm")))
+}
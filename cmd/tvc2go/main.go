@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"tvm/internal/translator"
+	tvm "tvm/internal/virtual_machine"
+)
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand translates the program named in args and returns the process exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tvc2go", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	packageName := flags.String("package", "program", "name of the generated Go package")
+	outputPath := flags.String("o", "", "file to write the generated code to (default stdout)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvc2go [-package name] [-o out.go] program.tvm")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	programPath := flags.Arg(0)
+	file, err := os.Open(programPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvc2go: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	image, err := tvm.ReadImage(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvc2go: could not read program '%v': %v\n", programPath, err)
+		return 1
+	}
+
+	// Sections are laid out exactly as the TVM would load them. Their permissions are not enforced by translated code
+	machine, err := tvm.NewTsvetokVirtualMachineFromImage(image)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvc2go: could not load program '%v': %v\n", programPath, err)
+		return 1
+	}
+
+	source, err := translator.Translate(machine.CopyMemory(), machine.GetWordFormat(), *packageName, filepath.Base(programPath))
+	if err != nil {
+		fmt.Fprintf(stderr, "tvc2go: %v\n", err)
+		return 1
+	}
+
+	if *outputPath == "" {
+		_, err = stdout.Write(source)
+	} else {
+		err = os.WriteFile(*outputPath, source, 0o644)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "tvc2go: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+func writeProgram(t *testing.T, program []int) string {
+	path := filepath.Join(t.TempDir(), "program.tvm")
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tvm.WriteProgram(buffer, program))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	return path
+}
+
+func TestRunCommand_WritesTheTranslatedPackage(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runCommand([]string{"-package", "echo", writeProgram(t, []int{203, 0, 204, 0, 9})}, stdout, stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "// Code generated by tvc2go from program.tvm. DO NOT EDIT.")
+	assert.Contains(t, stdout.String(), "package echo")
+	assert.Contains(t, stdout.String(), "func Run(in Input, out Output) error")
+}
+
+func TestRunCommand_WritesToTheOutputFile(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "program.go")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runCommand([]string{"-o", output, writeProgram(t, []int{9})}, stdout, stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	assert.Empty(t, stdout.String())
+
+	source, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(source), "package program")
+}
+
+func TestRunCommand_RejectsBadArguments(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 2, runCommand([]string{}, stdout, stderr))
+	assert.Equal(t, 1, runCommand([]string{filepath.Join(t.TempDir(), "missing.tvm")}, stdout, stderr))
+	assert.Equal(t, 1, runCommand([]string{"-package", "not-a-name", writeProgram(t, []int{9})}, stdout, stderr))
+}
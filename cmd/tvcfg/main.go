@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tvm/internal/assembler"
+	"tvm/internal/cfg"
+	tvm "tvm/internal/virtual_machine"
+)
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand prints the control-flow graph of the program named in args, either TVA files assembled together as a
+// single program or a TVM image, and returns the process exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	var includePaths []string
+	flags := flag.NewFlagSet("tvcfg", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Func("I", "directory to search for included files (may be repeated)", func(path string) error {
+		includePaths = append(includePaths, path)
+		return nil
+	})
+	format := flags.String("format", "text", "output format (text, dot or mermaid)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvcfg [-I dir]... [-format text|dot|mermaid] main.tva routines.tva...\n       tvcfg [-format text|dot|mermaid] program.tvm")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *format != "text" && *format != "dot" && *format != "mermaid" {
+		fmt.Fprintf(stderr, "tvcfg: unknown format '%v'\n", *format)
+		return 2
+	}
+
+	graph, err := buildGraph(flags.Args(), includePaths)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvcfg: %v\n", err)
+		return 1
+	}
+
+	switch *format {
+	case "dot":
+		fmt.Fprint(stdout, graph.DOT())
+	case "mermaid":
+		fmt.Fprint(stdout, graph.Mermaid())
+	default:
+		writeSummary(stdout, graph)
+	}
+
+	return 0
+}
+
+// buildGraph assembles the TVA files provided, or reads the TVM image if a single file that is not TVA is provided,
+// and builds its graph
+func buildGraph(paths, includePaths []string) (*cfg.Graph, error) {
+	if len(paths) > 1 || filepath.Ext(paths[0]) == ".tva" {
+		tvaAssembler := assembler.NewAssemblerFromFiles(paths...)
+		tvaAssembler.SetIncludePaths(includePaths...)
+		return cfg.FromAssembler(tvaAssembler)
+	}
+
+	file, err := os.Open(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := tvm.ReadImage(file)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not read program '%v'", paths[0]))
+	}
+
+	return cfg.FromImage(image), nil
+}
+
+// writeSummary lists every block with its successors, then the loops and unreachable blocks
+func writeSummary(w io.Writer, graph *cfg.Graph) {
+	for _, block := range graph.Blocks {
+		fmt.Fprintf(w, "%v: %v-%v\n", block.Name(), block.Start(), block.End()-1)
+		for _, edge := range block.Successors {
+			fmt.Fprintf(w, "\t-> %v (%v)\n", edge.To.Name(), edge.Kind)
+		}
+	}
+
+	for _, loop := range graph.Loops() {
+		fmt.Fprintf(w, "loop %v: %v\n", loop.Header.Name(), blockNames(loop.Blocks))
+	}
+
+	if unreachable := graph.Unreachable(); len(unreachable) > 0 {
+		fmt.Fprintf(w, "unreachable: %v\n", blockNames(unreachable))
+	}
+}
+
+func blockNames(blocks []*cfg.Block) string {
+	names := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		names = append(names, block.Name())
+	}
+
+	return strings.Join(names, ", ")
+}
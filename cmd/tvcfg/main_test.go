@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+const countdown = `	in r0
+loop:
+	out r0
+	sub r0, 1, r0
+	jit r0, loop
+	hlt
+	out 1
+`
+
+func writeSource(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "main.tva")
+	require.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+	return path
+}
+
+func TestRunCommand_SummarizesTheGraph(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	assert.Equal(t, 0, runCommand([]string{writeSource(t, countdown)}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, `address 0: 0-1
+	-> loop (fall-through)
+loop: 2-10
+	-> loop (jump)
+	-> address 11 (fall-through)
+address 11: 11-11
+address 12: 12-13
+loop loop: loop
+unreachable: address 12
+`, stdout.String())
+}
+
+func TestRunCommand_ExportsDOTAndMermaid(t *testing.T) {
+	path := writeSource(t, countdown)
+
+	stdout := &bytes.Buffer{}
+	assert.Equal(t, 0, runCommand([]string{"-format", "dot", path}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, `digraph cfg {
+	node [shape=box, fontname="monospace"];
+	b0 [label="address 0\l0: in r0\l"];
+	b1 [label="loop:\l2: out r0\l4: add r0, -1, r0\l8: jit r0, 2\l", peripheries=2];
+	b2 [label="address 11\l11: hlt\l"];
+	b3 [label="address 12\l12: out 1\l", style=filled, fillcolor=lightgrey, fontcolor=grey40];
+	b0 -> b1;
+	b1 -> b1 [style=bold];
+	b1 -> b2;
+}
+`, stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, runCommand([]string{"-format", "mermaid", path}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, `flowchart TD
+    b0["address 0<br/>0: in r0"]
+    b1["loop:<br/>2: out r0<br/>4: add r0, -1, r0<br/>8: jit r0, 2"]
+    b2["address 11<br/>11: hlt"]
+    b3["address 12<br/>12: out 1"]
+    b0 --> b1
+    b1 ==> b1
+    b1 --> b2
+    classDef loop stroke-width:3px
+    classDef unreachable fill:#ddd,color:#777
+    class b1 loop
+    class b3 unreachable
+`, stdout.String())
+}
+
+func TestRunCommand_ReadsImages(t *testing.T) {
+	// jit 1, 4; hlt; .word 0; 4: out 7; jit 1, la (unreachable data after the hlt is never decoded)
+	image := tvm.Image{Sections: []tvm.Section{{Name: "program", Permissions: tvm.MemoryPermissionRead, Words: []int{1106, 1, 4, 9, 104, 7, 2106, 1, 13}}}}
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tvm.WriteImage(buffer, image))
+	path := filepath.Join(t.TempDir(), "program.tvm")
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	stdout := &bytes.Buffer{}
+	assert.Equal(t, 0, runCommand([]string{path}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, `address 0: 0-2
+	-> address 4 (jump)
+address 3: 3-3
+address 4: 4-8
+	-> address 3 (return)
+`, stdout.String())
+}
+
+func TestRunCommand_RejectsBadArguments(t *testing.T) {
+	path := writeSource(t, "hlt\n")
+
+	for _, args := range [][]string{{}, {"-format", "svg", path}} {
+		assert.Equal(t, 2, runCommand(args, &bytes.Buffer{}, &bytes.Buffer{}), "args: %v", args)
+	}
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{writeSource(t, "jit 1, nowhere\n")}, &bytes.Buffer{}, stderr))
+	assert.Contains(t, stderr.String(), "tvcfg: ")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffOperation is a line of a diff: kept (' '), removed ('-') or added ('+')
+type diffOperation struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the changes that turn before into after in the unified diff format, as `diff -u` shows them
+// between path.orig and path
+func unifiedDiff(path, before, after string) string {
+	operations := diffLines(splitLines(before), splitLines(after))
+
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "diff -u %v.orig %v\n--- %v.orig\n+++ %v\n", path, path, path, path)
+
+	// oldLine and newLine count the lines of before and after up to the current operation
+	oldLine, newLine := 0, 0
+	for start := 0; start < len(operations); {
+		if operations[start].kind == ' ' {
+			oldLine, newLine = oldLine+1, newLine+1
+			start++
+			continue
+		}
+
+		// A hunk runs from diffContext lines before the change to diffContext lines after the last change that is
+		// no more than twice that many lines from the next
+		first := max(start-diffContext, 0)
+		end := start
+		for unchanged := 0; end < len(operations) && unchanged <= 2*diffContext; end++ {
+			if operations[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+
+		for end > start && operations[end-1].kind == ' ' {
+			end--
+		}
+
+		end = min(end+diffContext, len(operations))
+
+		hunkOld, hunkNew := oldLine-(start-first), newLine-(start-first)
+		oldCount, newCount := 0, 0
+		for _, operation := range operations[first:end] {
+			if operation.kind != '+' {
+				oldCount++
+			}
+
+			if operation.kind != '-' {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(builder, "@@ -%v +%v @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		for _, operation := range operations[first:end] {
+			fmt.Fprintf(builder, "%c%v\n", operation.kind, operation.line)
+		}
+
+		oldLine, newLine = hunkOld+oldCount, hunkNew+newCount
+		start = end
+	}
+
+	return builder.String()
+}
+
+// hunkRange returns the range of lines of a hunk header, given the number of lines before the hunk and in it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%v,0", before)
+	}
+
+	return fmt.Sprintf("%v,%v", before+1, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit from before to after, found through their longest common subsequence
+func diffLines(before, after []string) []diffOperation {
+	// common[i][j] is the length of the longest common subsequence of before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	operations := make([]diffOperation, 0, len(before)+len(after))
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			operations = append(operations, diffOperation{' ', before[i]})
+			i, j = i+1, j+1
+		case i < len(before) && (j == len(after) || common[i+1][j] >= common[i][j+1]):
+			operations = append(operations, diffOperation{'-', before[i]})
+			i++
+		default:
+			operations = append(operations, diffOperation{'+', after[j]})
+			j++
+		}
+	}
+
+	return operations
+}
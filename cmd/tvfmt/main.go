@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"tvm/internal/format"
+	"tvm/internal/syntax"
+)
+
+// standardInput is the name source read from stdin is reported under
+const standardInput = "<standard input>"
+
+// formatOptions holds the flags accepted by tvfmt
+type formatOptions struct {
+	list  bool
+	diff  bool
+	write bool
+}
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// runCommand formats the TVA files and directories named in args, or stdin if there are none, and returns the
+// process exit code
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	options := formatOptions{}
+	flags := flag.NewFlagSet("tvfmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&options.list, "l", false, "list files whose formatting differs from tvfmt's instead of printing them")
+	flags.BoolVar(&options.diff, "d", false, "print diffs instead of formatted files")
+	flags.BoolVar(&options.write, "w", false, "write the formatted source back to each file instead of printing it")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvfmt [-l] [-d] [-w] [path...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if options.write {
+			fmt.Fprintln(stderr, "tvfmt: cannot use -w with standard input")
+			return 2
+		}
+
+		source, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "tvfmt: %v\n", err)
+			return 1
+		}
+
+		return formatSource(standardInput, source, options, stdout, stderr)
+	}
+
+	code := 0
+	for _, path := range flags.Args() {
+		paths, err := sourceFiles(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "tvfmt: %v\n", err)
+			code = 1
+			continue
+		}
+
+		for _, path := range paths {
+			source, err := os.ReadFile(path)
+			if err == nil {
+				if result := formatSource(path, source, options, stdout, stderr); result != 0 {
+					code = result
+				}
+
+				continue
+			}
+
+			fmt.Fprintf(stderr, "tvfmt: %v\n", err)
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// sourceFiles returns the path provided if it is a file, and every .tva file below it if it is a directory
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var paths []string
+	err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && filepath.Ext(path) == ".tva" {
+			paths = append(paths, path)
+		}
+
+		return err
+	})
+
+	return paths, err
+}
+
+// formatSource formats the source of a single file and reports it as the options ask
+func formatSource(path string, source []byte, options formatOptions, stdout, stderr io.Writer) int {
+	formatted, err := format.Source(string(source), path)
+	if err != nil {
+		var errs syntax.ErrorList
+		if !errors.As(err, &errs) {
+			fmt.Fprintf(stderr, "tvfmt: %v\n", err)
+			return 1
+		}
+
+		for _, syntaxErr := range errs {
+			fmt.Fprintf(stderr, "%v: %v\n", syntaxErr.Position, syntaxErr.Message)
+		}
+
+		return 1
+	}
+
+	changed := formatted != string(source)
+	if options.list && changed {
+		fmt.Fprintln(stdout, path)
+	}
+
+	if options.diff && changed {
+		fmt.Fprint(stdout, unifiedDiff(path, string(source), formatted))
+	}
+
+	if options.write && changed {
+		info, err := os.Stat(path)
+		if err == nil {
+			err = os.WriteFile(path, []byte(formatted), info.Mode().Perm())
+		}
+
+		if err != nil {
+			fmt.Fprintf(stderr, "tvfmt: %v\n", err)
+			return 1
+		}
+	}
+
+	if !options.list && !options.diff && !options.write {
+		fmt.Fprint(stdout, formatted)
+	}
+
+	return 0
+}
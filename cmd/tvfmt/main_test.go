@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unformatted = "start: in r0\nout r0\nhlt\n"
+
+const formatted = "start:\n\tin  r0\n\tout r0\n\thlt\n"
+
+func TestRunCommand_FormatsStandardInput(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := runCommand(nil, strings.NewReader(unformatted), stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, formatted, stdout.String())
+}
+
+func TestRunCommand_ListsAndRewritesFilesThatAreNotFormatted(t *testing.T) {
+	directory := t.TempDir()
+	messy, tidy := filepath.Join(directory, "messy.tva"), filepath.Join(directory, "lib", "tidy.tva")
+	require.NoError(t, os.MkdirAll(filepath.Dir(tidy), 0o755))
+	require.NoError(t, os.WriteFile(messy, []byte(unformatted), 0o644))
+	require.NoError(t, os.WriteFile(tidy, []byte(formatted), 0o644))
+
+	stdout := &bytes.Buffer{}
+	require.Equal(t, 0, runCommand([]string{"-l", directory}, strings.NewReader(""), stdout, &bytes.Buffer{}))
+	assert.Equal(t, messy+"\n", stdout.String())
+
+	require.Equal(t, 0, runCommand([]string{"-w", messy}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}))
+	contents, err := os.ReadFile(messy)
+	require.NoError(t, err)
+	assert.Equal(t, formatted, string(contents))
+}
+
+func TestRunCommand_PrintsDiffs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.tva")
+	require.NoError(t, os.WriteFile(path, []byte("\tout 1\n\tout 2\n\tout 3\n\tout 4\nout 5\n\tout 6\n\tout 7\n\tout 8\n\tout 9\n"), 0o644))
+
+	stdout := &bytes.Buffer{}
+	require.Equal(t, 0, runCommand([]string{"-d", path}, strings.NewReader(""), stdout, &bytes.Buffer{}))
+	assert.Equal(t, "diff -u "+path+".orig "+path+"\n--- "+path+".orig\n+++ "+path+"\n"+
+		"@@ -2,7 +2,7 @@\n \tout 2\n \tout 3\n \tout 4\n-out 5\n+\tout 5\n \tout 6\n \tout 7\n \tout 8\n", stdout.String())
+}
+
+func TestRunCommand_ReportsSyntaxErrors(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand(nil, strings.NewReader("out 1\nout (1\n"), &bytes.Buffer{}, stderr))
+	assert.Equal(t, "<standard input>:2:7: invalid expression '(1': missing ')'\n", stderr.String())
+
+	assert.Equal(t, 2, runCommand([]string{"-w"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand links the object files named in args into a program and returns the process exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tvl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	outputPath := flags.String("o", "", "file to write the program to (default: the first object with a .tvm extension)")
+	keepUnreferenced := flags.Bool("keep-unreferenced", false, "keep routines that nothing refers to")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvl [-o program.tvm] [-keep-unreferenced] main.tvo object.tvo...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	objects := make([]linker.Object, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		object, err := readObject(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "tvl: %v\n", err)
+			return 1
+		}
+
+		objects = append(objects, object)
+	}
+
+	objectLinker := linker.NewLinker(objects...)
+	objectLinker.SetKeepUnreferenced(*keepUnreferenced)
+
+	image, err := objectLinker.Link()
+	if err != nil {
+		fmt.Fprintf(stderr, "tvl: %v\n", err)
+		return 1
+	}
+
+	if *outputPath == "" {
+		*outputPath = strings.TrimSuffix(flags.Arg(0), filepath.Ext(flags.Arg(0))) + ".tvm"
+	}
+
+	if err := writeImage(*outputPath, image); err != nil {
+		fmt.Fprintf(stderr, "tvl: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// readObject reads the object file at the path provided, naming the object after it
+func readObject(path string) (linker.Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return linker.Object{}, err
+	}
+	defer file.Close()
+
+	object, err := linker.ReadObject(file)
+	if err != nil {
+		return linker.Object{}, errors.Join(err, fmt.Errorf("could not read object '%v'", path))
+	}
+
+	object.Name = path
+	return object, nil
+}
+
+// writeImage writes a plain TVM file for programs linked for the default word format, and a sectioned image
+// recording the word format otherwise
+func writeImage(path string, image tvm.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if image.WordFormat == (tvm.WordFormat{}) {
+		err = tvm.WriteProgram(file, image.Sections[0].Words)
+	} else {
+		err = tvm.WriteImage(file, image)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/assembler"
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// writeObject assembles the source provided into an object file in the directory provided, returning its path
+func writeObject(t *testing.T, directory, name, source string) string {
+	object, err := assembler.NewAssemblerFromString(source).AssembleObject()
+	require.NoError(t, err)
+
+	path := filepath.Join(directory, name)
+	buffer := &bytes.Buffer{}
+	require.NoError(t, linker.WriteObject(buffer, object))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	return path
+}
+
+func TestRunCommand_LinksObjectsIntoAProgram(t *testing.T) {
+	directory := t.TempDir()
+	main := writeObject(t, directory, "main.tvo", ".extern square\n.global back\nmov 7, r0\njmp square\nback: out r0\nhlt\n")
+	library := writeObject(t, directory, "library.tvo", ".global cube, square\n.extern back\ncube: mlt r0, r0, r1\nmlt r0, r1, r0\njmp back\nsquare: mlt r0, r0, r0\njmp back\n")
+
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{main, library}, &bytes.Buffer{}, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	file, err := os.Open(filepath.Join(directory, "main.tvm"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	program, err := tvm.ReadProgram(file)
+	require.NoError(t, err)
+	assert.Len(t, program, 4+3+2+1+4+3, "cube should have been stripped")
+
+	output := &tvm.MockOutputInterface{}
+	machine := tvm.NewTsvetokVirtualMachine(program)
+	machine.SetOutputInterface(output)
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, 49, *output.LastNumberReceived)
+}
+
+func TestRunCommand_ReportsLinkErrors(t *testing.T) {
+	directory := t.TempDir()
+	main := writeObject(t, directory, "main.tvo", ".extern square\njmp square\n")
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{"-o", filepath.Join(directory, "out.tvm"), main}, &bytes.Buffer{}, stderr))
+	assert.Equal(t, "tvl: undefined symbol 'square' imported by '"+main+"'\n", stderr.String())
+}
+
+func TestRunCommand_RejectsBadArguments(t *testing.T) {
+	assert.Equal(t, 2, runCommand([]string{}, &bytes.Buffer{}, &bytes.Buffer{}))
+	assert.Equal(t, 2, runCommand([]string{"-explode"}, &bytes.Buffer{}, &bytes.Buffer{}))
+
+	notAnObject := filepath.Join(t.TempDir(), "program.tvm")
+	require.NoError(t, os.WriteFile(notAnObject, []byte("TVM"), 0o644))
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{notAnObject}, &bytes.Buffer{}, stderr))
+	assert.Contains(t, stderr.String(), "missing 'TVO' header")
+}
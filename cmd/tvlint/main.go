@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tvm/internal/assembler"
+	"tvm/internal/lint"
+)
+
+func main() {
+	os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// runCommand lints the TVA files named in args, assembled together as a single program, and returns the process
+// exit code: 0 if no rule found anything, 1 if one did or the program does not assemble
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	var includePaths []string
+	config := lint.Config{Disabled: map[string]bool{}}
+	flags := flag.NewFlagSet("tvlint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Func("I", "directory to search for included files (may be repeated)", func(path string) error {
+		includePaths = append(includePaths, path)
+		return nil
+	})
+	flags.Func("disable", "comma-separated rules to skip", func(names string) error {
+		for _, name := range strings.Split(names, ",") {
+			config.Disabled[strings.TrimSpace(name)] = true
+		}
+
+		return nil
+	})
+	only := flags.String("only", "", "comma-separated rules to run, skipping every other rule")
+	listRules := flags.Bool("rules", false, "list the rules and exit")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvlint [-I dir]... [-disable rule,...] [-only rule,...] [-rules] main.tva routines.tva...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *listRules {
+		for _, rule := range lint.Rules() {
+			fmt.Fprintf(stdout, "%-24v %v\n", rule.Name, rule.Description)
+		}
+
+		return 0
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *only != "" {
+		enabled := map[string]bool{}
+		for _, name := range strings.Split(*only, ",") {
+			enabled[strings.TrimSpace(name)] = true
+			config.Disabled[strings.TrimSpace(name)] = false
+		}
+
+		for _, rule := range lint.Rules() {
+			if !enabled[rule.Name] {
+				config.Disabled[rule.Name] = true
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(stderr, "tvlint: %v\n", err)
+		return 2
+	}
+
+	tvaAssembler := assembler.NewAssemblerFromFiles(flags.Args()...)
+	tvaAssembler.SetIncludePaths(includePaths...)
+
+	diagnostics, err := lint.Lint(tvaAssembler, config)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvlint: %v\n", err)
+		return 1
+	}
+
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintln(stdout, diagnostic)
+	}
+
+	if len(diagnostics) > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSource(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "main.tva")
+	require.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+	return path
+}
+
+func TestRunCommand_ReportsDiagnostics(t *testing.T) {
+	path := writeSource(t, "add 1, 2, la\nhlt\nout 1\n")
+
+	stdout := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{path}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, path+":1:1: add writes to $la, which only jit may set (write-la)\n"+path+":3:1: unreachable code after hlt (unreachable)\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 1, runCommand([]string{"-only", "unreachable", path}, stdout, &bytes.Buffer{}))
+	assert.Equal(t, path+":3:1: unreachable code after hlt (unreachable)\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, runCommand([]string{"-disable", "write-la,unreachable", path}, stdout, &bytes.Buffer{}))
+	assert.Empty(t, stdout.String())
+}
+
+func TestRunCommand_RejectsBadArguments(t *testing.T) {
+	path := writeSource(t, "hlt\n")
+
+	for _, args := range [][]string{{}, {"-disable", "bogus", path}, {"-only", "write-la,bogus", path}} {
+		assert.Equal(t, 2, runCommand(args, &bytes.Buffer{}, &bytes.Buffer{}), "args: %v", args)
+	}
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 1, runCommand([]string{writeSource(t, "bogus 1\n")}, &bytes.Buffer{}, stderr))
+	assert.Contains(t, stderr.String(), "tvlint: ")
+
+	stdout := &bytes.Buffer{}
+	assert.Equal(t, 0, runCommand([]string{"-rules"}, stdout, &bytes.Buffer{}))
+	assert.Contains(t, stdout.String(), "data-as-code")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+const debugHelp = `commands:
+  fault                 show the fault that stopped the machine
+  regs                  show the register file
+  pc                    show the program counter
+  mem <addr> [count]    show count words of memory starting at addr (default 8)
+  where <addr>          show the source location and label of addr
+  trace                 show the instructions executed leading up to the fault
+  help                  show this message
+  quit                  leave the debugger
+
+addresses may also be given as labels when the program was built with debug information (tva build -g)
+`
+
+// defaultMemoryWords is how many words `mem` shows when no count is given
+const defaultMemoryWords = 8
+
+// debugCore implements `tvm debug`: a post-mortem debugger that reads commands from stdin and answers them from
+// the core file provided
+func debugCore(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tvm debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	corePath := flags.String("core", "", "core file written by 'tvm run --core'")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvm debug --core core.json")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *corePath == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := os.Open(*corePath)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+
+	core, err := tvm.ReadCoreDump(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: could not read core file '%v': %v\n", *corePath, err)
+		return 1
+	}
+
+	session := &postMortemSession{core, stdout}
+	session.showFault()
+
+	scanner := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, "(tvm) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return 0
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return 0
+		}
+
+		if err := session.runCommand(fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(stdout, "error: %v\n", err)
+		}
+	}
+}
+
+// postMortemSession answers debugger commands about a single core dump
+type postMortemSession struct {
+	core tvm.CoreDump
+	out  io.Writer
+}
+
+func (p *postMortemSession) runCommand(command string, args []string) error {
+	switch command {
+	case "fault":
+		p.showFault()
+	case "regs":
+		p.showRegisters()
+	case "pc":
+		fmt.Fprintf(p.out, "pc = %v%v\n", p.core.State.ProgramCounter, p.describe(p.core.State.ProgramCounter))
+	case "mem":
+		return p.showMemory(args)
+	case "where":
+		return p.showLocation(args)
+	case "trace":
+		p.showTrace()
+	case "help":
+		fmt.Fprint(p.out, debugHelp)
+	default:
+		return fmt.Errorf("unknown command '%v' (try 'help')", command)
+	}
+
+	return nil
+}
+
+func (p *postMortemSession) showFault() {
+	fmt.Fprintf(p.out, "fault at pc %v: %v\n", p.core.State.ProgramCounter, p.core.Fault)
+}
+
+func (p *postMortemSession) showRegisters() {
+	for register, value := range p.core.State.Registers {
+		fmt.Fprintf(p.out, "$%-3v = %v\n", tvm.RegisterName(register), wordAt(value, p.core.State.WideRegisters, register))
+	}
+}
+
+func (p *postMortemSession) showMemory(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: mem <addr> [count]")
+	}
+
+	start, err := p.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+
+	count := defaultMemoryWords
+	if len(args) == 2 {
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 0 {
+			return fmt.Errorf("invalid count '%v'", args[1])
+		}
+	}
+
+	memory := p.core.State.Memory
+	if start < 0 || start >= len(memory) {
+		return fmt.Errorf("address '%v' is outside of memory (memory is of size '%v')", start, len(memory))
+	}
+
+	for address := start; address < start+count && address < len(memory); address++ {
+		marker := " "
+		if address == p.core.State.ProgramCounter {
+			marker = ">"
+		}
+
+		word := wordAt(memory[address], p.core.State.WideMemory, address)
+		fmt.Fprintf(p.out, "%v %6v: %v%v\n", marker, address, word, p.labelsAt(address))
+	}
+
+	return nil
+}
+
+func (p *postMortemSession) showTrace() {
+	if len(p.core.Trace) == 0 {
+		fmt.Fprintln(p.out, "no trace recorded")
+		return
+	}
+
+	for _, entry := range p.core.Trace {
+		fmt.Fprintf(p.out, "%6v: %v%v\n", entry.ProgramCounter, entry.Instruction, p.describe(entry.ProgramCounter))
+		for _, warning := range entry.Warnings {
+			fmt.Fprintf(p.out, "        warning: %v\n", warning)
+		}
+	}
+}
+
+func (p *postMortemSession) showLocation(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: where <addr>")
+	}
+
+	address, err := p.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+
+	if p.core.Debug == nil {
+		return fmt.Errorf("no debug information (build the program with 'tva build -g')")
+	}
+
+	description := p.core.Debug.Describe(address)
+	if description == "" {
+		description = "unknown"
+	}
+
+	fmt.Fprintf(p.out, "%v: %v\n", address, description)
+	return nil
+}
+
+// parseAddress parses an address written as a number or, with debug information, as a label
+func (p *postMortemSession) parseAddress(text string) (int, error) {
+	if address, err := strconv.Atoi(text); err == nil {
+		return address, nil
+	}
+
+	if p.core.Debug != nil {
+		if address, isLabel := p.core.Debug.Labels[text]; isLabel {
+			return address, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid address '%v'", text)
+}
+
+// describe returns the source location and label of an address, set off for appending to a line, or an empty
+// string if the core dump has no debug information about it
+func (p *postMortemSession) describe(address int) string {
+	if p.core.Debug == nil {
+		return ""
+	}
+
+	if description := p.core.Debug.Describe(address); description != "" {
+		return "  # " + description
+	}
+
+	return ""
+}
+
+// labelsAt returns the labels at an address, set off for appending to a line, or an empty string if there are none
+func (p *postMortemSession) labelsAt(address int) string {
+	if p.core.Debug == nil {
+		return ""
+	}
+
+	var labels []string
+	for name, labelAddress := range p.core.Debug.Labels {
+		if labelAddress == address {
+			labels = append(labels, name+":")
+		}
+	}
+
+	if len(labels) == 0 {
+		return ""
+	}
+
+	sort.Strings(labels)
+	return "  # " + strings.Join(labels, " ")
+}
+
+// wordAt returns the word provided, or the wide word that replaces it when it is too wide for an int (see
+// WordSizeBig)
+func wordAt(value int, wide map[int]*big.Int, index int) any {
+	if word, isWide := wide[index]; isWide {
+		return word
+	}
+
+	return value
+}
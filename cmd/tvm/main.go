@@ -1,10 +1,36 @@
 package main
 
 import (
-	tvm "tvm/internal/virtual_machine"
+	"fmt"
+	"io"
+	"os"
 )
 
+const usage = `usage: tvm <command> [arguments]
+
+commands:
+  run    execute a TVM program or resume a saved machine state
+  debug  inspect a core file written by 'tvm run --core'
+`
+
 func main() {
-	machine := tvm.NewTsvetokVirtualMachine([]int{9})
-	machine.Execute()
+	os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// runCommand dispatches to the subcommand named by the first argument and returns the process exit code
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "run":
+		return runProgram(args[1:], stdin, stdout, stderr)
+	case "debug":
+		return debugCore(args[1:], stdin, stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "tvm: unknown command '%v'\n%v", args[0], usage)
+		return 2
+	}
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tvm "tvm/internal/virtual_machine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countdownProgram reads a number and outputs it, decrementing, until it reaches zero
+var countdownProgram = []int{203, 0, 204, 0, 21201, 0, -1, 0, 21205, 0, 0, 5, 1206, 5, 18, 1106, 1, 2, 9}
+
+func writeProgram(t *testing.T, program []int) string {
+	path := filepath.Join(t.TempDir(), "program.tvm")
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tvm.WriteProgram(buffer, program))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	return path
+}
+
+func TestRun_ExecutesProgramWithStandardStreams(t *testing.T) {
+	for _, engine := range []string{"interpreter", "compiled"} {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		code := runCommand([]string{"run", "--engine", engine, writeProgram(t, countdownProgram)}, strings.NewReader("3\n"), stdout, stderr)
+
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "3\n2\n1\n", stdout.String())
+	}
+}
+
+func TestRun_SavesAndResumesMachineState(t *testing.T) {
+	for _, format := range []string{"binary", "json"} {
+		t.Run(format, func(t *testing.T) {
+			statePath := filepath.Join(t.TempDir(), "state.snap")
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := runCommand([]string{"run", "--max-instructions", "4", "--save", statePath, "--save-format", format, writeProgram(t, countdownProgram)}, strings.NewReader("3"), stdout, stderr)
+
+			assert.Equal(t, 1, code)
+			assert.Contains(t, stderr.String(), "instruction limit")
+			assert.Equal(t, "3\n", stdout.String())
+
+			stdout.Reset()
+			code = runCommand([]string{"run", "--max-instructions", "0", "--resume", statePath}, strings.NewReader(""), stdout, stderr)
+			assert.Equal(t, 0, code, stderr.String())
+			assert.Equal(t, "2\n1\n", stdout.String())
+		})
+	}
+}
+
+func TestRun_ResumedMachineKeepsSavedLimits(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.snap")
+	code := runCommand([]string{"run", "--max-instructions", "4", "--save", statePath, writeProgram(t, countdownProgram)}, strings.NewReader("3"), &bytes.Buffer{}, &bytes.Buffer{})
+	require.Equal(t, 1, code)
+
+	stderr := &bytes.Buffer{}
+	code = runCommand([]string{"run", "--resume", statePath}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "instruction limit")
+}
+
+func TestRun_AppliesWordFormatFlags(t *testing.T) {
+	// Reads n and outputs n squared
+	program := writeProgram(t, []int{203, 0, 22202, 0, 0, 0, 204, 0, 9})
+
+	for _, tc := range []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{}, 0, "1410065408\n"},
+		{[]string{"--overflow", "saturate"}, 0, "2147483647\n"},
+		{[]string{"--overflow", "fault"}, 1, "tvm: mlt overflowed a 32-bit word with '10000000000'\n"},
+		{[]string{"--word-size", "64", "--overflow", "fault"}, 0, "10000000000\n"},
+		{[]string{"--word-size", "big", "--engine", "compiled"}, 0, "10000000000\n"},
+	} {
+		stdout := &bytes.Buffer{}
+		code := runCommand(append(append([]string{"run"}, tc.args...), program), strings.NewReader("100000"), stdout, stdout)
+
+		assert.Equal(t, tc.code, code, "args: %v", tc.args)
+		assert.Equal(t, tc.expected, stdout.String(), "args: %v", tc.args)
+	}
+}
+
+func TestRun_RejectsBadArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"explode"},
+		{"run"},
+		{"run", "--resume", "a.snap", "b.tvm"},
+		{"run", "--save-format", "yaml", "b.tvm"},
+		{"run", "--engine", "jit", "b.tvm"},
+		{"run", "--word-size", "16", "b.tvm"},
+		{"run", "--overflow", "explode", "b.tvm"},
+	} {
+		assert.Equal(t, 2, runCommand(args, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}), "args: %v", args)
+	}
+}
+
+func TestRun_WritesCoreFileOnFaultForPostMortemDebugging(t *testing.T) {
+	corePath := filepath.Join(t.TempDir(), "core.json")
+	faultingProgram := []int{1101, 5, 6, 0, 21101, 2, 3, 6, 10001, 0, 0, 0, 9}
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{"run", "--core", corePath, writeProgram(t, faultingProgram)}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+	require.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "core written")
+
+	stdout := &bytes.Buffer{}
+	commands := "regs\nmem 0 2\ntrace\nbogus\nquit\n"
+	code = runCommand([]string{"debug", "--core", corePath}, strings.NewReader(commands), stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	output := stdout.String()
+	assert.Contains(t, output, "fault at pc 8: invalid output parameter for add operation")
+	assert.Contains(t, output, "$t1  = 5")
+	assert.Contains(t, output, "     0: 11\n")
+	assert.Contains(t, output, "     4: [21101 2 3 6]")
+	assert.Contains(t, output, "     8: [10001 0 0 0]")
+	assert.Contains(t, output, "unknown command 'bogus'")
+}
+
+func TestRun_ShowsWideWordsFromCoreFiles(t *testing.T) {
+	// Squares n into $r0, squares that into address 20, then faults on an immediate output
+	program := make([]int, 21)
+	copy(program, []int{203, 0, 22202, 0, 0, 0, 2202, 0, 0, 20, 10001, 0, 0, 0})
+	corePath := filepath.Join(t.TempDir(), "core.json")
+	args := []string{"run", "--word-size", "big", "--core", corePath, writeProgram(t, program)}
+	code := runCommand(args, strings.NewReader("10000000000"), &bytes.Buffer{}, &bytes.Buffer{})
+	require.Equal(t, 1, code)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code = runCommand([]string{"debug", "--core", corePath}, strings.NewReader("regs\nmem 20 1\n"), stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	assert.Contains(t, stdout.String(), "= 100000000000000000000\n")
+	assert.Contains(t, stdout.String(), "    20: 10000000000000000000000000000000000000000\n")
+}
+
+func TestRun_ResolvesAddressesThroughDebugInformation(t *testing.T) {
+	debug := tvm.SourceMap{}
+	debug.Add(0, 4, tvm.SourceLocation{File: "loop.tva", Line: 1, Column: 8})
+	debug.Add(4, 8, tvm.SourceLocation{File: "loop.tva", Line: 2, Column: 7})
+	debug.AddLabel("start", 0)
+	debug.AddLabel("loop", 4)
+	image := tvm.Image{
+		Sections: []tvm.Section{{Name: "program", Permissions: tvm.MemoryPermissionAll, Words: []int{21101, 0, 1, 0, 21110, 1, 0, 0}}},
+		Debug:    &debug,
+	}
+
+	directory := t.TempDir()
+	path, corePath := filepath.Join(directory, "program.tvm"), filepath.Join(directory, "core.json")
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tvm.WriteImage(buffer, image))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{"run", "--core", corePath, path}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+	require.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "tvm: loop.tva:2:7: attempted to divide by zero (pc 4 in loop)")
+
+	stdout := &bytes.Buffer{}
+	code = runCommand([]string{"debug", "--core", corePath}, strings.NewReader("pc\ntrace\nwhere start+1\nwhere 2\nmem loop 1\n"), stdout, stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	output := stdout.String()
+	assert.Contains(t, output, "pc = 4  # loop.tva:2:7 in loop\n")
+	assert.Contains(t, output, "     0: [21101 0 1 0]  # loop.tva:1:8 in start\n")
+	assert.Contains(t, output, "error: invalid address 'start+1'")
+	assert.Contains(t, output, "2: loop.tva:1:8 in start+2\n")
+	assert.Contains(t, output, ">      4: 21110  # loop:\n")
+}
+
+func TestRun_DoesNotWriteCoreFileOnSuccess(t *testing.T) {
+	corePath := filepath.Join(t.TempDir(), "core.json")
+	code := runCommand([]string{"run", "--core", corePath, writeProgram(t, []int{9})}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	require.Equal(t, 0, code)
+
+	_, err := os.Stat(corePath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRun_EnforcesSectionPermissionsFromImages(t *testing.T) {
+	image := tvm.Image{Sections: []tvm.Section{
+		{Name: "code", Start: 0, Permissions: tvm.MemoryPermissionRead | tvm.MemoryPermissionExecute, Words: []int{1101, 1, 2, 0, 9}},
+	}}
+
+	path := filepath.Join(t.TempDir(), "program.tvm")
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tvm.WriteImage(buffer, image))
+	require.NoError(t, os.WriteFile(path, buffer.Bytes(), 0o644))
+
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{"run", path}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "protection fault at pc '0': write of address '0' in region 'code' (r-x)")
+}
+
+func TestRun_ReportsSelfModifyingCode(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	code := runCommand([]string{"run", "--detect-smc", writeProgram(t, []int{104, 0, 1, 0, 0, 0, 9})}, strings.NewReader(""), &bytes.Buffer{}, stderr)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "tvm: warning: self-modifying write at pc 2: address 0 changed from 104 to 208\n", stderr.String())
+}
+
+func TestRun_ChecksTheCallingConvention(t *testing.T) {
+	program := writeProgram(t, []int{21101, 5, 0, 1, 1106, 1, 10, 104, 5, 9, 21101, 7, 0, 1, 2106, 1, 13})
+
+	stderr := &bytes.Buffer{}
+	assert.Equal(t, 0, runCommand([]string{"run", "--check-calls", program}, strings.NewReader(""), &bytes.Buffer{}, stderr))
+	assert.Equal(t, "tvm: warning: calling convention broken at pc 14: routine at 10 returned with $r1 changed from 5 to 7 (called from pc 4)\n", stderr.String())
+
+	stderr.Reset()
+	assert.Equal(t, 0, runCommand([]string{"run", program}, strings.NewReader(""), &bytes.Buffer{}, stderr))
+	assert.Empty(t, stderr.String())
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// defaultTraceDepth is how many recently executed instructions a core file contains unless told otherwise
+const defaultTraceDepth = 32
+
+// runOptions holds the flags accepted by `tvm run`
+type runOptions struct {
+	resumePath      string
+	savePath        string
+	saveFormat      string
+	corePath        string
+	traceDepth      int
+	detectSMC       bool
+	checkCalls      bool
+	engine          string
+	wordSize        string
+	overflow        string
+	maxInstructions int
+	timeout         time.Duration
+	maxMemory       int
+	maxOutputs      int
+	maxInputs       int
+}
+
+// runProgram implements `tvm run`: it loads a program (or resumes a saved machine state), executes it with the
+// process's standard input and output as the machine's input and output, and optionally saves the machine's
+// state once execution stops
+func runProgram(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	options := runOptions{}
+	flags := flag.NewFlagSet("tvm run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: tvm run [flags] program.tvm\n       tvm run [flags] --resume state.snap")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&options.resumePath, "resume", "", "resume execution from a saved machine state instead of a program")
+	flags.StringVar(&options.savePath, "save", "", "save the machine state to this file once execution stops")
+	flags.StringVar(&options.saveFormat, "save-format", "binary", "format of the saved machine state (binary or json)")
+	flags.StringVar(&options.corePath, "core", "", "write a core file to this path if execution fails")
+	flags.IntVar(&options.traceDepth, "trace-depth", defaultTraceDepth, "number of recently executed instructions kept for core files")
+	flags.BoolVar(&options.detectSMC, "detect-smc", false, "report writes into instructions that have already been executed or decoded")
+	flags.BoolVar(&options.checkCalls, "check-calls", false, "report routines that return with $r0 to $r4 changed, and reads of $t registers a call may have changed")
+	flags.StringVar(&options.engine, "engine", "interpreter", "execution engine (interpreter or compiled)")
+	flags.StringVar(&options.wordSize, "word-size", "", "word size (32, 64 or big; defaults to the program's or saved state's)")
+	flags.StringVar(&options.overflow, "overflow", "", "overflow mode (wrap, saturate or fault; defaults to the program's or saved state's)")
+	flags.IntVar(&options.maxInstructions, "max-instructions", 0, "maximum number of instructions to execute (0 is unlimited)")
+	flags.DurationVar(&options.timeout, "timeout", 0, "maximum wall-clock execution time (0 is unlimited)")
+	flags.IntVar(&options.maxMemory, "max-memory", 0, "maximum number of memory words (0 is unlimited)")
+	flags.IntVar(&options.maxOutputs, "max-outputs", 0, "maximum number of outputs (0 is unlimited)")
+	flags.IntVar(&options.maxInputs, "max-inputs", 0, "maximum number of input reads (0 is unlimited)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if (options.resumePath == "") == (flags.NArg() == 0) || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	saveFormat, err := parseStateFormat(options.saveFormat)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 2
+	}
+
+	engine, err := parseEngine(options.engine)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 2
+	}
+
+	overrideWordFormat, err := parseWordFormatFlags(options)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 2
+	}
+
+	machine, err := loadMachine(options.resumePath, flags.Arg(0), options.maxMemory)
+	if err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 1
+	}
+
+	if err := machine.SetWordFormat(overrideWordFormat(machine.GetWordFormat())); err != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", err)
+		return 1
+	}
+
+	applyLimitFlags(machine, flags, options)
+	if options.corePath != "" {
+		machine.SetTraceDepth(options.traceDepth)
+	}
+
+	machine.SetSelfModificationDetection(options.detectSMC)
+	machine.SetConventionChecking(options.checkCalls)
+	machine.SetEngine(engine)
+
+	machine.SetInputInterface(tvm.NewReaderInputInterface(stdin))
+	machine.SetOutputInterface(tvm.NewWriterOutputInterface(stdout))
+
+	executionErr := machine.Execute()
+
+	for _, modification := range machine.SelfModifications() {
+		fmt.Fprintf(stderr, "tvm: warning: %v\n", modification)
+	}
+
+	for _, violation := range machine.ConventionViolations() {
+		fmt.Fprintf(stderr, "tvm: warning: %v\n", violation)
+	}
+
+	if options.savePath != "" {
+		if err := saveMachine(machine, options.savePath, saveFormat); err != nil {
+			fmt.Fprintf(stderr, "tvm: %v\n", err)
+			return 1
+		}
+	}
+
+	if executionErr != nil {
+		fmt.Fprintf(stderr, "tvm: %v\n", executionErr)
+
+		if options.corePath != "" {
+			if err := writeCore(machine.CoreDump(executionErr), options.corePath); err != nil {
+				fmt.Fprintf(stderr, "tvm: could not write core file: %v\n", err)
+			} else {
+				fmt.Fprintf(stderr, "tvm: core written to '%v'\n", options.corePath)
+			}
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
+// loadMachine creates a machine from the saved state at resumePath if one was given, or from the program (a plain
+// or sectioned TVM image) at programPath otherwise. Images needing more than maxMemory words are refused before
+// their memory is allocated
+func loadMachine(resumePath, programPath string, maxMemory int) (*tvm.TsvetokVirtualMachine, error) {
+	if resumePath != "" {
+		file, err := os.Open(resumePath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		state, err := tvm.ReadMachineState(file)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("could not read machine state '%v'", resumePath))
+		}
+
+		return tvm.NewTsvetokVirtualMachineFromState(state)
+	}
+
+	file, err := os.Open(programPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := tvm.ReadImage(file)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not read program '%v'", programPath))
+	}
+
+	if maxMemory > 0 && image.MemorySize() > maxMemory {
+		return nil, tvm.MemoryLimitExceededErr{Limit: maxMemory, Size: image.MemorySize()}
+	}
+
+	return tvm.NewTsvetokVirtualMachineFromImage(image)
+}
+
+// parseWordFormatFlags parses the word size and overflow flags, returning a function that overrides a machine's
+// word format with whichever of them were provided, so that programs and resumed machines keep their own otherwise
+func parseWordFormatFlags(options runOptions) (func(tvm.WordFormat) tvm.WordFormat, error) {
+	var size tvm.WordSize
+	var overflow tvm.Overflow
+	var err error
+
+	if options.wordSize != "" {
+		if size, err = tvm.ParseWordSize(options.wordSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.overflow != "" {
+		if overflow, err = tvm.ParseOverflow(options.overflow); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(format tvm.WordFormat) tvm.WordFormat {
+		if options.wordSize != "" {
+			format.Size = size
+		}
+
+		if options.overflow != "" {
+			format.Overflow = overflow
+		}
+
+		return format
+	}, nil
+}
+
+// applyLimitFlags overrides the machine's limits with any limit flags that were explicitly provided, so that a
+// resumed machine keeps the limits it was saved with unless told otherwise
+func applyLimitFlags(machine *tvm.TsvetokVirtualMachine, flags *flag.FlagSet, options runOptions) {
+	limits := machine.GetLimits()
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-instructions":
+			limits.MaxInstructions = options.maxInstructions
+		case "timeout":
+			limits.Deadline = time.Time{}
+			if options.timeout > 0 {
+				limits.Deadline = time.Now().Add(options.timeout)
+			}
+		case "max-memory":
+			limits.MaxMemoryWords = options.maxMemory
+		case "max-outputs":
+			limits.MaxOutputs = options.maxOutputs
+		case "max-inputs":
+			limits.MaxInputReads = options.maxInputs
+		}
+	})
+
+	machine.SetLimits(limits)
+}
+
+func parseStateFormat(format string) (tvm.MachineStateFormat, error) {
+	switch format {
+	case "binary":
+		return tvm.MachineStateFormatBinary, nil
+	case "json":
+		return tvm.MachineStateFormatJSON, nil
+	default:
+		return 0, fmt.Errorf("unknown machine state format '%v'", format)
+	}
+}
+
+func parseEngine(engine string) (tvm.Engine, error) {
+	switch engine {
+	case "interpreter":
+		return tvm.EngineInterpreter, nil
+	case "compiled":
+		return tvm.EngineCompiled, nil
+	default:
+		return 0, fmt.Errorf("unknown engine '%v'", engine)
+	}
+}
+
+func saveMachine(machine *tvm.TsvetokVirtualMachine, path string, format tvm.MachineStateFormat) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := tvm.WriteMachineState(file, machine.Snapshot(), format); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeCore(core tvm.CoreDump, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := tvm.WriteCoreDump(file, core); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
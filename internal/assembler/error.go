@@ -0,0 +1,26 @@
+package assembler
+
+import (
+	"fmt"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// LineErr indicates that a line of assembly could not be assembled. Location is where the error is: the statement
+// of the line, or the outermost macro invocation the line was expanded from. Errors in included files are wrapped
+// once for the line in the included file and again for the .include directive, outermost last
+type LineErr struct {
+	Err      error
+	Location tvm.SourceLocation
+
+	// Description names the line and every macro invocation it was expanded from, such as "error on line '2'"
+	Description string
+}
+
+func (l LineErr) Error() string {
+	return fmt.Sprintf("%v\n%v", l.Err, l.Description)
+}
+
+func (l LineErr) Unwrap() error {
+	return l.Err
+}
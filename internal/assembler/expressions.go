@@ -0,0 +1,292 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	"tvm/internal/syntax"
+)
+
+// expression is a constant expression written as an operand or in a .equ or .set directive. Expressions are parsed
+// as soon as they are read, but only evaluated once the address of every label is known
+type expression interface {
+	// evaluate returns the value of the expression, as seen by the line of assembly at the position provided
+	evaluate(symbols *symbolTable, position int) (value, error)
+}
+
+// value is the value of an expression. In relocatable objects (see AssembleObject), the value of a label depends
+// on where the object ends up, so terms counts how many times each label's base is added to number: "" for labels
+// defined in the object, and the label's name for imported ones. Terms are always empty otherwise
+type value struct {
+	number int
+	terms  map[string]int
+}
+
+// constant returns the number of the value, or an error if it depends on where a label ends up
+func (v value) constant(operator string) (int, error) {
+	for _, count := range v.terms {
+		if count != 0 {
+			return 0, fmt.Errorf("cannot apply '%v' to an address that is not known until the program is linked", operator)
+		}
+	}
+
+	return v.number, nil
+}
+
+// relocation returns the symbol the value is relative to ("" for the object's own base) and true if it is relative
+// to one, or an error if it is relative to more than one or to a multiple of one
+func (v value) relocation() (string, bool, error) {
+	symbol, relative := "", false
+	for base, count := range v.terms {
+		switch {
+		case count == 0:
+			continue
+		case count != 1 || relative:
+			return "", false, fmt.Errorf("expression cannot be relocated (it must be a single address plus or minus a constant)")
+		}
+
+		symbol, relative = base, true
+	}
+
+	return symbol, relative, nil
+}
+
+// numberExpression is a literal number
+type numberExpression int
+
+func (n numberExpression) evaluate(*symbolTable, int) (value, error) {
+	return value{number: int(n)}, nil
+}
+
+// symbolExpression is the name of a label or constant
+type symbolExpression string
+
+func (s symbolExpression) evaluate(symbols *symbolTable, position int) (value, error) {
+	return symbols.lookup(string(s), position)
+}
+
+// binaryExpression applies an operator to two expressions
+type binaryExpression struct {
+	operator    string
+	left, right expression
+}
+
+func (b binaryExpression) evaluate(symbols *symbolTable, position int) (value, error) {
+	left, err := b.left.evaluate(symbols, position)
+	if err != nil {
+		return value{}, err
+	}
+
+	right, err := b.right.evaluate(symbols, position)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch b.operator {
+	case "+", "-":
+		sign := 1
+		if b.operator == "-" {
+			sign = -1
+		}
+
+		terms := map[string]int{}
+		for base, count := range left.terms {
+			terms[base] += count
+		}
+
+		for base, count := range right.terms {
+			terms[base] += sign * count
+		}
+
+		return value{left.number + sign*right.number, terms}, nil
+	case "*":
+		if factor, err := right.constant(b.operator); err == nil {
+			return scale(left, factor), nil
+		}
+
+		factor, err := left.constant(b.operator)
+		if err != nil {
+			return value{}, err
+		}
+
+		return scale(right, factor), nil
+	}
+
+	leftNumber, err := left.constant(b.operator)
+	if err != nil {
+		return value{}, err
+	}
+
+	rightNumber, err := right.constant(b.operator)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch b.operator {
+	case "/", "%":
+		if rightNumber == 0 {
+			return value{}, fmt.Errorf("division by zero in expression")
+		}
+
+		if b.operator == "/" {
+			return value{number: leftNumber / rightNumber}, nil
+		}
+
+		return value{number: leftNumber % rightNumber}, nil
+	case "<<", ">>":
+		if rightNumber < 0 || rightNumber > 63 {
+			return value{}, fmt.Errorf("cannot shift by '%v' bits in an expression (expected 0 to 63)", rightNumber)
+		}
+
+		if b.operator == "<<" {
+			return value{number: leftNumber << rightNumber}, nil
+		}
+
+		return value{number: leftNumber >> rightNumber}, nil
+	case "&":
+		return value{number: leftNumber & rightNumber}, nil
+	default:
+		return value{number: leftNumber | rightNumber}, nil
+	}
+}
+
+// scale multiplies a value, terms included, by the factor provided
+func scale(v value, factor int) value {
+	terms := map[string]int{}
+	for base, count := range v.terms {
+		terms[base] = count * factor
+	}
+
+	return value{v.number * factor, terms}
+}
+
+// newExpression converts an expression of the syntax tree into one the assembler can evaluate. Registers, strings
+// and macro parameters (outside of a macro's body) have no value
+func newExpression(node syntax.Expression) (expression, error) {
+	switch node := node.(type) {
+	case *syntax.Number:
+		return numberExpression(node.Value), nil
+	case *syntax.Identifier:
+		if _, isRegister := registerValueMap[node.Name]; isRegister || registerPattern.MatchString(node.Name) {
+			return nil, fmt.Errorf("cannot use register '%v' in an expression", node.Name)
+		}
+
+		if !isLabel(node.Name) {
+			return nil, invalidName("label", node.Name)
+		}
+
+		return symbolExpression(node.Name), nil
+	case *syntax.Paren:
+		return newExpression(node.Inner)
+	case *syntax.Unary:
+		operand, err := newExpression(node.Operand)
+		if err != nil || node.Operator == "+" {
+			return operand, err
+		}
+
+		return binaryExpression{"-", numberExpression(0), operand}, nil
+	case *syntax.Binary:
+		left, err := newExpression(node.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := newExpression(node.Right)
+		if err != nil {
+			return nil, err
+		}
+
+		return binaryExpression{node.Operator, left, right}, nil
+	case *syntax.MacroParameter:
+		return nil, fmt.Errorf("macro parameter '\\%v' used outside of a macro", node.Name)
+	case *syntax.String:
+		return nil, fmt.Errorf("cannot use string %v in an expression", node.Text)
+	default:
+		return nil, fmt.Errorf("unsupported expression")
+	}
+}
+
+// constantDefinition is a definition of a constant with .equ or .set, made at the position provided in the program
+type constantDefinition struct {
+	expression expression
+	position   int
+	line       tsvasmLine
+
+	// redefinable is true for definitions made with .set
+	redefinable bool
+}
+
+// symbolTable holds everything the names in expressions may refer to
+type symbolTable struct {
+	labels map[string]int
+
+	// constants holds every definition of every constant in the order they were made. Constants defined with .equ
+	// have a single one, while constants defined with .set may be redefined
+	constants map[string][]constantDefinition
+	imports   map[string]bool
+
+	// relocatable is true if labels are relative to wherever the program ends up (see value)
+	relocatable bool
+
+	// evaluating lists the constants being evaluated, outermost first, to catch definitions that refer to themselves
+	evaluating []string
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{labels: map[string]int{}, constants: map[string][]constantDefinition{}, imports: map[string]bool{}}
+}
+
+// define records a definition of a constant. Constants defined with .equ cannot be redefined, and no constant may
+// share its name with a label
+func (s *symbolTable) define(name string, definition constantDefinition) error {
+	if _, isLabel := s.labels[name]; isLabel {
+		return fmt.Errorf("'%v' is already defined as a label", name)
+	}
+
+	if previous := s.constants[name]; len(previous) > 0 && (!definition.redefinable || !previous[0].redefinable) {
+		return fmt.Errorf("constant '%v' is already defined on %v", name, describeLine(previous[0].line.file, previous[0].line.lineNumber))
+	}
+
+	s.constants[name] = append(s.constants[name], definition)
+	return nil
+}
+
+// lookup returns the value of the label or constant named, as seen from the position provided: a constant that is
+// redefined has the value of its last definition before the position, or of its first if there is none
+func (s *symbolTable) lookup(name string, position int) (value, error) {
+	if address, isLabel := s.labels[name]; isLabel {
+		if s.relocatable {
+			return value{address, map[string]int{"": 1}}, nil
+		}
+
+		return value{number: address}, nil
+	}
+
+	definitions, isConstant := s.constants[name]
+	if !isConstant {
+		if s.relocatable && s.imports[name] {
+			return value{number: 0, terms: map[string]int{name: 1}}, nil
+		}
+
+		return value{}, fmt.Errorf("undefined label '%v'", name)
+	}
+
+	for index, evaluating := range s.evaluating {
+		if evaluating == name {
+			cycle := append(append([]string{}, s.evaluating[index:]...), name)
+			return value{}, fmt.Errorf("cyclic definition of constant '%v' (%v)", name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	definition := definitions[0]
+	for _, candidate := range definitions {
+		if candidate.position <= position {
+			definition = candidate
+		}
+	}
+
+	s.evaluating = append(s.evaluating, name)
+	defer func() { s.evaluating = s.evaluating[:len(s.evaluating)-1] }()
+
+	return definition.expression.evaluate(s, definition.position)
+}
@@ -0,0 +1,351 @@
+package assembler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"tvm/internal/linker"
+	"tvm/internal/syntax"
+	tvm "tvm/internal/virtual_machine"
+)
+
+const (
+	ParamIndicatorReservedRegister = "r"
+	ParamIndicatorTemporaryRegister = "t"
+	ParamIndicatorMemoryAddress = "$"
+	ParamIndicatorImmediate = "i"
+	ParamLastAddressRegister = "la"
+)
+
+var registerValueMap = map[string]int {
+	"r0": tvm.RegisterReserved0,
+	"r1": tvm.RegisterReserved1,
+	"r2": tvm.RegisterReserved2,
+	"r3": tvm.RegisterReserved3,
+	"r4": tvm.RegisterReserved4,
+	"t0": tvm.RegisterTemporary0,
+	"t1": tvm.RegisterTemporary1,
+	"t2": tvm.RegisterTemporary2,
+	"t3": tvm.RegisterTemporary3,
+	"t4": tvm.RegisterTemporary4,
+	"t5": tvm.RegisterTemporary5,
+	"t6": tvm.RegisterTemporary6,
+	"t7": tvm.RegisterTemporary7,
+	"la": tvm.RegisterLastAddress,
+}
+
+// instructionBuilder represents a single intcode operation. Use toIntcode() to expand it out to its
+// proper instruction values
+type instructionBuilder struct {
+	OpCode int
+	Params []int
+
+	// Expressions maps the index of every parameter that is an expression (other than a plain number) to the
+	// expression. Those parameters are placeholders until resolve() is called once the address of every label is
+	// known
+	Expressions map[int]expression
+
+	// Addresses lists the index of every parameter the assembler wrote that holds an address in the program, which
+	// must move with the program when it is linked (see resolve())
+	Addresses []int
+
+	wordFormat tvm.WordFormat
+}
+
+var (
+	numericPattern  = regexp.MustCompile(`^i?\d[0-9A-Za-z_]*$`)
+	labelPattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	registerPattern = regexp.MustCompile(`^[rt]\d+$`)
+)
+
+// setOperation() converts the operation provided to its proper opcode, or returns an error if the operation
+// does not exist
+func (i *instructionBuilder) setOperation(operation string) error {
+	switch operation {
+	case "add":
+		i.OpCode = 1
+	case "mlt":
+		i.OpCode = 2
+	case "in":
+		i.OpCode = 3
+	case "out":
+		i.OpCode = 4
+	case "seq":
+		i.OpCode = 5
+	case "jit":
+		i.OpCode = 6
+	case "slt":
+		i.OpCode = 7
+	case "hlt":
+		i.OpCode = 9
+	case "div":
+		i.OpCode = 10
+	case "mod":
+		i.OpCode = 11
+	case "and":
+		i.OpCode = 12
+	case "or":
+		i.OpCode = 13
+	case "xor":
+		i.OpCode = 14
+	case "not":
+		i.OpCode = 15
+	case "shl":
+		i.OpCode = 16
+	case "shr":
+		i.OpCode = 17
+	default:
+		return fmt.Errorf("unknown instruction '%v'", operation)
+	}
+
+	return nil
+}
+
+// operand is a parsed parameter: a register, or an expression whose value is either an immediate or the address of
+// the value
+type operand struct {
+	format     tvm.ParamFormat
+	register   int
+	expression expression
+}
+
+// newOperand() converts an operand of the syntax tree: a register, `$expression` for address mode, or an expression
+// for immediate mode, which may be written after the `i` indicator. A register may also be written as an address
+// (`$r0`), as the documentation names them
+func newOperand(node *syntax.Operand) (operand, error) {
+	if identifier, isIdentifier := node.Expression.(*syntax.Identifier); isIdentifier && node.Mode == syntax.OperandAddress && syntax.IsRegisterName(identifier.Name) {
+		return newOperand(&syntax.Operand{Mode: syntax.OperandRegister, Register: identifier.Name})
+	}
+
+	switch node.Mode {
+	case syntax.OperandRegister:
+		registerValue, registerExists := registerValueMap[node.Register]
+		if !registerExists {
+			return operand{}, fmt.Errorf("invalid register param '%v'", node.Register)
+		}
+
+		return operand{format: tvm.ParamFormatRegister, register: registerValue}, nil
+	case syntax.OperandAddress:
+		parsed, err := newExpression(node.Expression)
+		return operand{format: tvm.ParamFormatAddress, expression: parsed}, err
+	default:
+		parsed, err := newExpression(node.Expression)
+		return operand{format: tvm.ParamFormatImmediate, expression: parsed}, err
+	}
+}
+
+// addParam() adds a parameter to this instruction builder given the operand it is written as and where in the
+// instruction it is found. Returns an error if the parameter is malformed
+func (i *instructionBuilder) addParam(node *syntax.Operand, paramIndex int) error {
+	parsed, err := newOperand(node)
+	if err != nil {
+		return err
+	}
+
+	return i.addOperand(parsed, paramIndex)
+}
+
+// addOperand() adds a parsed parameter to this instruction builder. Expressions that are plain numbers are checked
+// against the word format straight away, while any other expression waits for resolve()
+func (i *instructionBuilder) addOperand(parsed operand, paramIndex int) error {
+	err := i.updateOpcodeForParam(parsed.format, paramIndex)
+	if err != nil {
+		return err
+	}
+
+	if parsed.format == tvm.ParamFormatRegister {
+		i.Params = append(i.Params, parsed.register)
+		return nil
+	}
+
+	number, isNumber := parsed.expression.(numberExpression)
+	if !isNumber {
+		if i.Expressions == nil {
+			i.Expressions = map[int]expression{}
+		}
+
+		i.Expressions[len(i.Params)] = parsed.expression
+		i.Params = append(i.Params, 0)
+		return nil
+	}
+
+	paramVal, err := i.fitParam(len(i.Params), int(number))
+	if err != nil {
+		return err
+	}
+
+	// TODO: Do we need to respect the index? Like do an insert?
+	i.Params = append(i.Params, paramVal)
+
+	return nil
+}
+
+// fitParam() checks that the value of the parameter at the index provided fits in a word (see
+// WordFormat.FitLiteral), and that it is not a negative address if the parameter is in address mode
+func (i *instructionBuilder) fitParam(index int, value int) (int, error) {
+	multiplier := 100
+	for range index {
+		multiplier *= 10
+	}
+
+	if tvm.ParamFormat((i.OpCode/multiplier)%10) == tvm.ParamFormatAddress && value < 0 {
+		return 0, fmt.Errorf("address '%v' is negative", value)
+	}
+
+	return i.wordFormat.FitLiteral(value)
+}
+
+// addImmediate() adds an immediate parameter with the value provided, for instructions the assembler writes itself
+// (see pseudoInstructions)
+func (i *instructionBuilder) addImmediate(value int, paramIndex int) error {
+	err := i.updateOpcodeForParam(tvm.ParamFormatImmediate, paramIndex)
+	if err != nil {
+		return err
+	}
+
+	value, err = i.wordFormat.FitLiteral(value)
+	if err != nil {
+		return err
+	}
+
+	i.Params = append(i.Params, value)
+	return nil
+}
+
+// addAddress() adds an immediate parameter holding the address provided, for instructions the assembler writes
+// itself (see pseudoInstructions)
+func (i *instructionBuilder) addAddress(address int, paramIndex int) error {
+	i.Addresses = append(i.Addresses, len(i.Params))
+	return i.addImmediate(address, paramIndex)
+}
+
+// resolve() evaluates every parameter that is an expression, given the position of the instruction's line in the
+// program and the address the instruction starts at, and returns the relocations of the parameters holding
+// addresses if the program is relocatable. Expressions referring to labels imported from another object (see
+// AssembleObject) are left as the offset from the label, for the linker to add the label's address to
+func (i *instructionBuilder) resolve(symbols *symbolTable, position int, start int) ([]linker.Relocation, error) {
+	relocations := make([]linker.Relocation, 0)
+	for index := range i.Params {
+		parsed, isExpression := i.Expressions[index]
+		if !isExpression {
+			continue
+		}
+
+		evaluated, err := parsed.evaluate(symbols, position)
+		if err != nil {
+			return nil, err
+		}
+
+		symbol, relative, err := evaluated.relocation()
+		if err != nil {
+			return nil, err
+		}
+
+		if relative {
+			relocations = append(relocations, linker.Relocation{Offset: start + 1 + index, Symbol: symbol})
+		}
+
+		i.Params[index], err = i.fitParam(index, evaluated.number)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if symbols.relocatable {
+		for _, index := range i.Addresses {
+			relocations = append(relocations, linker.Relocation{Offset: start + 1 + index})
+		}
+	}
+
+	return relocations, nil
+}
+
+// isLabel() returns true if the string provided can be the name of a label. Registers, mnemonics and the immediate
+// indicator cannot be, and labels local to a macro expansion are suffixed with the number of the expansion (see
+// expandMacro)
+func isLabel(name string) bool {
+	name = localLabelSuffixPattern.ReplaceAllString(name, "")
+	if !labelPattern.MatchString(name) || numericPattern.MatchString(name) || registerPattern.MatchString(name) || name == "i" {
+		return false
+	}
+
+	if _, isRegister := registerValueMap[name]; isRegister {
+		return false
+	}
+
+	if _, isPseudoInstruction := pseudoInstructions[name]; isPseudoInstruction {
+		return false
+	}
+
+	return (&instructionBuilder{}).setOperation(name) != nil
+}
+
+// invalidName() returns the error for a name of the kind provided (a label, constant or macro) that isLabel() rejects.
+// `i` is singled out, since the lexer reads it as the immediate indicator wherever it could start an operand such as
+// `i+1`
+func invalidName(kind, name string) error {
+	if name == "i" {
+		return fmt.Errorf("invalid %v name 'i' ('i' is the immediate indicator, so 'i+1' would mean the immediate '+1')", kind)
+	}
+
+	return fmt.Errorf("invalid %v name '%v'", kind, name)
+}
+
+// IsMnemonic returns true if the name provided is the mnemonic of an instruction or of a pseudo-instruction, rather
+// than, say, of a macro
+func IsMnemonic(name string) bool {
+	if _, isPseudoInstruction := pseudoInstructions[name]; isPseudoInstruction {
+		return true
+	}
+
+	return (&instructionBuilder{}).setOperation(name) == nil
+}
+
+// Mnemonics returns the mnemonic of every instruction and pseudo-instruction, in alphabetical order
+func Mnemonics() []string {
+	mnemonics := make([]string, 0, len(pseudoInstructions))
+	for name := range pseudoInstructions {
+		mnemonics = append(mnemonics, name)
+	}
+
+	for opCode := range 100 {
+		if name := tvm.OpcodeMnemonic(opCode); name != "" {
+			mnemonics = append(mnemonics, name)
+		}
+	}
+
+	sort.Strings(mnemonics)
+	return mnemonics
+}
+
+func (i *instructionBuilder) updateOpcodeForParam(paramFormat tvm.ParamFormat, index int) error {
+	if index > 2 {
+		return fmt.Errorf("cannot have more than three params for any operation")
+	}
+
+	multiplier := 100
+	for index > 0 {
+		multiplier *= 10
+		index -= 1
+	}
+
+	i.OpCode += int(paramFormat) * multiplier
+	return nil
+}
+
+// length() returns the number of words the instruction takes up
+func (i *instructionBuilder) length() int {
+	return 1 + len(i.Params)
+}
+
+// toIntcode() returns the sequence of integers that matches the inputs it received
+func (i *instructionBuilder) toIntcode() []int {
+	intcode := []int{i.OpCode}
+
+	for _, p := range i.Params {
+		intcode = append(intcode, p)
+	}
+
+	return intcode
+}
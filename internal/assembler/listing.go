@@ -0,0 +1,179 @@
+package assembler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// Listing shows what every line of an assembled program became, including the real instructions that
+// pseudo-instructions were expanded into
+type Listing struct {
+	Entries []ListingEntry
+
+	// Labels holds the address of every label
+	Labels map[string]int
+
+	// Definitions holds where every label is defined, and References every line that uses it, in program order
+	Definitions map[string]tvm.SourceLocation
+	References  map[string][]tvm.SourceLocation
+}
+
+// ListingEntry is a line of assembly and the instructions it was assembled into
+type ListingEntry struct {
+	File   string
+	Line   int
+	Source string
+
+	// Text is the line as it was written, labels and comment included. Lines expanded from a macro show their
+	// expansion instead, since the line they are listed on is the macro's invocation
+	Text string
+
+	// Pseudo is true if the line is a pseudo-instruction, in which case Instructions is its expansion
+	Pseudo       bool
+	Instructions []ListedInstruction
+}
+
+// ListedInstruction is a single real instruction of a listing
+type ListedInstruction struct {
+	Address  int
+	Words    []int
+	Assembly string
+}
+
+// String formats the listing with one row per instruction: its address, its words, and the line of assembly it
+// came from. The expansion of a pseudo-instruction is shown below it, one real instruction per row
+func (l Listing) String() string {
+	builder := &strings.Builder{}
+	for _, entry := range l.Entries {
+		if !entry.Pseudo {
+			for _, instruction := range entry.Instructions {
+				fmt.Fprintf(builder, "%4d  %-24v %4d  %v\n", instruction.Address, formatWords(instruction.Words), entry.Line, entry.Source)
+			}
+
+			continue
+		}
+
+		fmt.Fprintf(builder, "%4v  %-24v %4d  %v\n", "", "", entry.Line, entry.Source)
+		for _, instruction := range entry.Instructions {
+			fmt.Fprintf(builder, "%4d  %-24v %4v    %v\n", instruction.Address, formatWords(instruction.Words), "", instruction.Assembly)
+		}
+	}
+
+	return builder.String()
+}
+
+// formatWords formats the words of an instruction separated by spaces
+func formatWords(words []int) string {
+	formatted := make([]string, 0, len(words))
+	for _, word := range words {
+		formatted = append(formatted, fmt.Sprint(word))
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// Detailed formats the listing for `tva build --listing`: every instruction with its address, its words, its opcode
+// decoded into its mnemonic and parameter modes (`$` for address, `i` for immediate and `r` for register), and the
+// line it came from as it was written, followed by a symbol table and a cross-reference of where every label is used
+func (l Listing) Detailed() string {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%6v  %-24v %-12v %5v  %v\n", "ADDR", "WORDS", "DECODED", "LINE", "SOURCE")
+
+	file := ""
+	for _, entry := range l.Entries {
+		if entry.File != file {
+			file = entry.File
+			fmt.Fprintf(builder, "; %v\n", file)
+		}
+
+		if entry.Pseudo || len(entry.Instructions) == 0 {
+			fmt.Fprintf(builder, "%6v  %-24v %-12v %5d  %v\n", "", "", "", entry.Line, entry.Text)
+		}
+
+		for index, instruction := range entry.Instructions {
+			line, text := fmt.Sprint(entry.Line), entry.Text
+			if entry.Pseudo {
+				line, text = "", "  "+instruction.Assembly
+			} else if index > 0 {
+				line, text = "", ""
+			}
+
+			words := formatWords(instruction.Words)
+			fmt.Fprintf(builder, "%6d  %-24v %-12v %5v  %v\n", instruction.Address, words, decodeOpcode(instruction.Words[0]), line, text)
+		}
+	}
+
+	names := make([]string, 0, len(l.Labels))
+	for name := range l.Labels {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if l.Labels[names[i]] != l.Labels[names[j]] {
+			return l.Labels[names[i]] < l.Labels[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintf(builder, "\nSYMBOLS\n%6v  %v\n", "ADDR", "NAME")
+	for _, name := range names {
+		fmt.Fprintf(builder, "%6d  %v\n", l.Labels[name], name)
+	}
+
+	sort.Strings(names)
+	fmt.Fprintf(builder, "\nCROSS-REFERENCE\n%-16v %-16v %v\n", "NAME", "DEFINED", "USED")
+	for _, name := range names {
+		used := make([]string, 0, len(l.References[name]))
+		for _, reference := range l.References[name] {
+			used = append(used, describeLocation(reference))
+		}
+
+		if len(used) == 0 {
+			used = append(used, "(unused)")
+		}
+
+		fmt.Fprintf(builder, "%-16v %-16v %v\n", name, describeLocation(l.Definitions[name]), strings.Join(used, ", "))
+	}
+
+	return builder.String()
+}
+
+// decodeOpcode shows the opcode of an instruction as its mnemonic followed by the mode of each of its parameters
+func decodeOpcode(rawOpcode int) string {
+	mnemonic := tvm.OpcodeMnemonic(rawOpcode % 100)
+	if mnemonic == "" {
+		return "?"
+	}
+
+	modes := rawOpcode / 100
+	decoded := []string{mnemonic}
+	for range tvm.InstructionLength(rawOpcode%100) - 1 {
+		switch tvm.ParamFormat(modes % 10) {
+		case tvm.ParamFormatAddress:
+			decoded = append(decoded, "$")
+		case tvm.ParamFormatImmediate:
+			decoded = append(decoded, "i")
+		case tvm.ParamFormatRegister:
+			decoded = append(decoded, "r")
+		default:
+			decoded = append(decoded, "?")
+		}
+
+		modes /= 10
+	}
+
+	return strings.Join(decoded, " ")
+}
+
+// describeLocation describes a location of a listing by line, and file if there is one
+func describeLocation(location tvm.SourceLocation) string {
+	if location.File == "" {
+		return fmt.Sprint(location.Line)
+	}
+
+	return fmt.Sprintf("%v:%v", location.File, location.Line)
+}
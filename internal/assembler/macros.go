@@ -0,0 +1,211 @@
+package assembler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"tvm/internal/syntax"
+)
+
+// maxMacroDepth is how deeply macros may invoke other macros, which stops macros that (directly or not) invoke
+// themselves from expanding forever
+const maxMacroDepth = 64
+
+// localLabelSuffixPattern matches the suffix that makes a label local to a macro expansion
+var localLabelSuffixPattern = regexp.MustCompile(`@\d+$`)
+
+// macro is a sequence of lines defined with `.macro name params...` and `.endm`, which every line invoking it by
+// name is replaced with. Within the body, `\param` stands for the argument given for param, and labels defined in
+// the body are local to each expansion
+type macro struct {
+	name   string
+	params []string
+	body   []tsvasmLine
+	file   string
+	line   int
+}
+
+// macroInvocation is a line that invoked a macro, which the lines of the expansion keep for error reporting
+type macroInvocation struct {
+	name string
+	file string
+	line int
+
+	// column is the column the invocation's mnemonic starts at
+	column int
+}
+
+// expandMacros removes every macro definition from the lines provided and replaces every macro invocation with the
+// macro's expanded body
+func (a *TsvetokAssembler) expandMacros(lines []tsvasmLine) ([]tsvasmLine, error) {
+	macros := map[string]*macro{}
+	remaining := make([]tsvasmLine, 0, len(lines))
+
+	var defining *macro
+	for _, line := range lines {
+		directive := ""
+		if statement, isDirective := line.parsed.Statement.(*syntax.Directive); isDirective {
+			directive = statement.Name
+		}
+
+		switch {
+		case directive == ".macro" && defining != nil:
+			return nil, line.wrapError(fmt.Errorf("macro definitions cannot be nested (macro '%v' is still open)", defining.name))
+		case directive == ".macro":
+			definition, err := a.newMacro(line, macros)
+			if err != nil {
+				return nil, line.wrapError(err)
+			}
+
+			defining = definition
+		case directive == ".endm" && defining == nil:
+			return nil, line.wrapError(fmt.Errorf("'.endm' without '.macro'"))
+		case directive == ".endm":
+			macros[defining.name] = defining
+			defining = nil
+		case defining != nil:
+			defining.body = append(defining.body, line)
+		default:
+			remaining = append(remaining, line)
+		}
+	}
+
+	if defining != nil {
+		return nil, tsvasmLine{file: defining.file, lineNumber: defining.line}.wrapError(fmt.Errorf("macro '%v' is missing '.endm'", defining.name))
+	}
+
+	return a.expandMacroInvocations(remaining, macros, nil)
+}
+
+// newMacro returns the macro that the .macro directive on the line provided starts to define
+func (a *TsvetokAssembler) newMacro(line tsvasmLine, macros map[string]*macro) (*macro, error) {
+	arguments := line.parsed.Statement.(*syntax.Directive).Arguments
+	name := arguments[0].(*syntax.Identifier).Name
+	if !isLabel(name) {
+		return nil, invalidName("macro", name)
+	}
+
+	if _, defined := macros[name]; defined {
+		return nil, fmt.Errorf("macro '%v' is already defined", name)
+	}
+
+	definition := &macro{name: name, file: line.file, line: line.lineNumber}
+	for _, param := range arguments[1:] {
+		definition.params = append(definition.params, param.(*syntax.Identifier).Name)
+	}
+
+	return definition, nil
+}
+
+// expandMacroInvocations replaces every line invoking a macro with its expansion, recursively. invocations are the
+// invocations that produced the lines provided, outermost first
+func (a *TsvetokAssembler) expandMacroInvocations(lines []tsvasmLine, macros map[string]*macro, invocations []macroInvocation) ([]tsvasmLine, error) {
+	expanded := make([]tsvasmLine, 0, len(lines))
+	for _, line := range lines {
+		instruction, isInstruction := line.parsed.Statement.(*syntax.Instruction)
+		if !isInstruction {
+			expanded = append(expanded, line)
+			continue
+		}
+
+		definition, isMacro := macros[instruction.Mnemonic]
+		if !isMacro {
+			expanded = append(expanded, line)
+			continue
+		}
+
+		if labels, hasLabels := line.labelsOnly(); hasLabels {
+			expanded = append(expanded, labels)
+		}
+
+		args := make([]string, 0, len(instruction.Operands))
+		for _, operand := range instruction.Operands {
+			args = append(args, operand.Text)
+		}
+
+		if len(invocations) >= maxMacroDepth {
+			return nil, line.wrapError(fmt.Errorf("macro recursion limit of '%v' exceeded", maxMacroDepth))
+		}
+
+		if len(args) != len(definition.params) {
+			return nil, line.wrapError(fmt.Errorf("macro '%v' expects %v argument(s) but was given %v", definition.name, len(definition.params), len(args)))
+		}
+
+		nested := append(append([]macroInvocation{}, invocations...), macroInvocation{definition.name, line.file, line.lineNumber, instruction.Position.Column})
+		body, err := a.expandMacro(definition, args, nested)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err = a.expandMacroInvocations(body, macros, nested)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded = append(expanded, body...)
+	}
+
+	return expanded, nil
+}
+
+// expandMacro returns the body of a macro with its parameters replaced by the arguments provided and its labels
+// renamed for this expansion. invocations are the invocations that led to this expansion, this one included, and
+// are recorded in every line of the body
+func (a *TsvetokAssembler) expandMacro(definition *macro, args []string, invocations []macroInvocation) ([]tsvasmLine, error) {
+	values := map[string]string{}
+	for index, param := range definition.params {
+		values[param] = args[index]
+	}
+
+	a.macroExpansions++
+	locals := map[string]string{}
+	for _, line := range definition.body {
+		for _, label := range line.parsed.Labels {
+			locals[label.Name] = fmt.Sprintf("%v@%v", label.Name, a.macroExpansions)
+		}
+	}
+
+	body := make([]tsvasmLine, 0, len(definition.body))
+	for _, line := range definition.body {
+		expanded := tsvasmLine{lineNumber: line.lineNumber, file: line.file, invocations: invocations}
+
+		// Only names and parameter references are replaced, so that string and character literals are left alone
+		tokens, _ := syntax.Lex(line.assemblyCode, line.file)
+		code, copied := strings.Builder{}, 0
+		for _, token := range tokens {
+			replacement, replaced := "", false
+			switch token.Kind {
+			case syntax.TokenIdentifier:
+				replacement, replaced = locals[token.Text]
+			case syntax.TokenMacroParameter:
+				value, exists := values[token.Text[1:]]
+				if !exists {
+					return nil, expanded.wrapError(fmt.Errorf("unknown macro parameter '%v'", token.Text))
+				}
+
+				replacement, replaced = value, true
+			}
+
+			if replaced {
+				offset := token.Position.Column - 1
+				code.WriteString(line.assemblyCode[copied:offset])
+				code.WriteString(replacement)
+				copied = offset + len(token.Text)
+			}
+		}
+
+		code.WriteString(line.assemblyCode[copied:])
+		expanded.assemblyCode = code.String()
+
+		parsed, err := syntax.ParseLine(expanded.assemblyCode, line.file, line.lineNumber)
+		if err != nil {
+			return nil, expanded.wrapError(err)
+		}
+
+		expanded.parsed = parsed
+		body = append(body, expanded)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,562 @@
+package assembler
+
+import (
+	"slices"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// SetOptimization turns the peephole optimizer on or off. While it is on, the instructions laid out by the first
+// pass of Assemble are rewritten before their operands are resolved: operations on immediates alone are folded into
+// moves, stores to registers that are overwritten before anything reads them are removed, jumps to unconditional
+// jumps are sent straight on to where those go, and instructions that do nothing are removed, along with jumps to
+// the instruction after them. Labels, and the addresses the assembler writes itself, move with the instructions
+// they point at. Code that is read or written as data through a label is left as it is; programs that refer to
+// their own code by literal addresses are only rewritten in place, since removing instructions would move the code
+// out from under those addresses
+func (a *TsvetokAssembler) SetOptimization(enabled bool) {
+	a.optimization = enabled
+}
+
+// optimizedInstruction is an instruction of the program being optimized
+type optimizedInstruction struct {
+	builder *instructionBuilder
+
+	// entry is the index of the line of assembly the instruction belongs to
+	entry   int
+	address int
+
+	// operands holds the values of the instruction's parameters as far as they are known before the second pass
+	operands []operandValue
+
+	// pinned is true if the words of the instruction are read or written as data, or if something jumps into the
+	// middle of it, so it must be left as it is
+	pinned  bool
+	removed bool
+}
+
+// operandValue is the value of a parameter of an instruction being optimized
+type operandValue struct {
+	format tvm.ParamFormat
+
+	// known is true if the value is a number (or register) known before the second pass, and address is true if
+	// the number is an address in the program, which moves with the instructions around it
+	known   bool
+	address bool
+	number  int
+}
+
+// optimizer rewrites the instructions of the lines provided in place (see SetOptimization)
+type optimizer struct {
+	entries      []assembledLine
+	symbols      *symbolTable
+	instructions []*optimizedInstruction
+
+	// starts maps the address of the start of every instruction to it, and words the address of every word
+	starts map[int]*optimizedInstruction
+	words  map[int]*optimizedInstruction
+	end    int
+
+	// literalAddresses is true if some parameter refers to the program's own code by a literal address rather
+	// than a label, in which case no instruction may move
+	literalAddresses bool
+}
+
+// optimize runs the peephole rules over the instructions of the lines provided until none of them applies, moving
+// labels along with the instructions they point at, and lays the lines out again
+func (a *TsvetokAssembler) optimize(entries []assembledLine, symbols *symbolTable) {
+	o := &optimizer{entries: entries, symbols: symbols}
+	for index, entry := range entries {
+		for _, builder := range entry.builders {
+			o.instructions = append(o.instructions, &optimizedInstruction{builder: builder, entry: index})
+		}
+	}
+
+	// Labels are evaluated as relative to the program while optimizing, which tells addresses apart from numbers
+	relocatable := symbols.relocatable
+	symbols.relocatable = true
+	defer func() { symbols.relocatable = relocatable }()
+
+	rules := []func(*optimizer) bool{
+		(*optimizer).foldConstants,
+		(*optimizer).threadJumps,
+		(*optimizer).removeNoOps,
+		(*optimizer).removeDeadStores,
+	}
+
+	o.layout()
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range rules {
+			if rule(o) {
+				o.relocate()
+				o.layout()
+				changed = true
+			}
+		}
+	}
+
+	for index := range entries {
+		entries[index].builders = nil
+	}
+
+	for _, instruction := range o.instructions {
+		entries[instruction.entry].builders = append(entries[instruction.entry].builders, instruction.builder)
+	}
+
+	address := 0
+	for index := range entries {
+		entries[index].address = address
+		for _, builder := range entries[index].builders {
+			address += builder.length()
+		}
+	}
+}
+
+// layout assigns every instruction its address, evaluates its parameters and decides whether it is pinned
+func (o *optimizer) layout() {
+	o.starts = map[int]*optimizedInstruction{}
+	o.words = map[int]*optimizedInstruction{}
+	address := 0
+	for _, instruction := range o.instructions {
+		instruction.address = address
+		instruction.pinned = false
+		o.starts[address] = instruction
+		for offset := range instruction.builder.length() {
+			o.words[address+offset] = instruction
+		}
+
+		address += instruction.builder.length()
+	}
+
+	o.end = address
+	o.literalAddresses = false
+	for _, instruction := range o.instructions {
+		instruction.operands = make([]operandValue, len(instruction.builder.Params))
+		for index := range instruction.builder.Params {
+			instruction.operands[index] = o.evaluate(instruction, index)
+		}
+	}
+
+	for _, instruction := range o.instructions {
+		for index, operand := range instruction.operands {
+			if !operand.known || operand.format == tvm.ParamFormatRegister {
+				continue
+			}
+
+			jumpTarget := instruction.builder.opCode() == 6 && index == 1 && operand.format == tvm.ParamFormatImmediate
+			if !operand.address {
+				// Literal numbers are addresses in address mode and as jump targets, and may point at code
+				if (operand.format == tvm.ParamFormatAddress || jumpTarget) && operand.number >= 0 && operand.number <= o.end {
+					o.literalAddresses = true
+				}
+
+				continue
+			}
+
+			if target := o.words[operand.number]; target != nil && (!jumpTarget || o.starts[operand.number] == nil) {
+				target.pinned = true
+			}
+		}
+	}
+}
+
+// evaluate returns the value of a parameter of an instruction
+func (o *optimizer) evaluate(instruction *optimizedInstruction, index int) operandValue {
+	builder := instruction.builder
+	operand := operandValue{format: builder.paramFormat(index)}
+	parsed, isExpression := builder.Expressions[index]
+	if !isExpression {
+		operand.known, operand.address, operand.number = true, slices.Contains(builder.Addresses, index), builder.Params[index]
+		return operand
+	}
+
+	evaluated, err := parsed.evaluate(o.symbols, o.entries[instruction.entry].position)
+	if err != nil {
+		return operand
+	}
+
+	symbol, relative, err := evaluated.relocation()
+	if err != nil || relative && symbol != "" {
+		return operand
+	}
+
+	operand.known, operand.address, operand.number = true, relative, evaluated.number
+	return operand
+}
+
+// relocate drops the instructions that were removed, and moves every label, and every address the assembler wrote
+// itself, to where the instruction it pointed at is now. Addresses of removed instructions move to the instruction
+// after them
+func (o *optimizer) relocate() {
+	moved := map[int]int{}
+	address := 0
+	kept := o.instructions[:0]
+	for _, instruction := range o.instructions {
+		for offset := range instruction.builder.length() {
+			moved[instruction.address+offset] = address
+			if !instruction.removed {
+				moved[instruction.address+offset] += offset
+			}
+		}
+
+		if !instruction.removed {
+			kept = append(kept, instruction)
+			address += instruction.builder.length()
+		}
+	}
+
+	moved[o.end] = address
+	move := func(old int) int {
+		if updated, inProgram := moved[old]; inProgram {
+			return updated
+		}
+
+		return old
+	}
+
+	o.instructions = kept
+	for name, old := range o.symbols.labels {
+		o.symbols.labels[name] = move(old)
+	}
+
+	for _, instruction := range o.instructions {
+		for _, index := range instruction.builder.Addresses {
+			instruction.builder.Params[index] = move(instruction.builder.Params[index])
+		}
+	}
+}
+
+// foldConstants replaces `add`, `mlt`, `seq` and `slt` of two immediates with a move of their result, computed as
+// the machine computes it. Instructions the machine would fault on, or whose result is too wide for an int, are kept
+func (o *optimizer) foldConstants() bool {
+	changed := false
+	for _, instruction := range o.instructions {
+		opCode := instruction.builder.opCode()
+		if instruction.pinned || opCode != 1 && opCode != 2 && opCode != 5 && opCode != 7 {
+			continue
+		}
+
+		left, right := instruction.operands[0], instruction.operands[1]
+		if !left.immediate() || !right.immediate() || opCode == 1 && right.number == 0 {
+			continue
+		}
+
+		result, err := instruction.builder.wordFormat.Compute(opCode, left.number, right.number)
+		if err != nil {
+			continue
+		}
+
+		if moved, err := instruction.builder.move(result); err == nil {
+			instruction.builder = moved
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// threadJumps sends jumps to an unconditional jump to an immediate target straight on to where that jump goes, when
+// the code there does not read $la (which then holds the address after the first jump, rather than after the
+// second)
+func (o *optimizer) threadJumps() bool {
+	changed := false
+	for _, instruction := range o.instructions {
+		if instruction.pinned || instruction.builder.opCode() != 6 {
+			continue
+		}
+
+		target, known := instruction.jumpTarget()
+		if !known {
+			continue
+		}
+
+		final := target
+		for visited := map[int]bool{}; ; {
+			next := o.starts[final]
+			if next == nil || next.pinned || visited[final] || !next.alwaysJumps() {
+				break
+			}
+
+			visited[final] = true
+			if final, known = next.jumpTarget(); !known {
+				break
+			}
+		}
+
+		// Chains that loop forever, or that end somewhere the optimizer cannot follow, are left alone
+		if !known || final == target || o.starts[final] != nil && o.starts[final].alwaysJumps() || o.readsLastAddress(final) {
+			continue
+		}
+
+		instruction.builder.setAddress(1, final)
+		changed = true
+	}
+
+	return changed
+}
+
+// removeNoOps removes instructions that copy a register to itself, jumps that never jump, and jumps to the
+// instruction after them when the code there does not read the $la they set
+func (o *optimizer) removeNoOps() bool {
+	if o.literalAddresses {
+		return false
+	}
+
+	changed := false
+	for _, instruction := range o.instructions {
+		if instruction.pinned {
+			continue
+		}
+
+		switch {
+		case instruction.builder.opCode() == 6:
+			condition := instruction.operands[0]
+			target, known := instruction.jumpTarget()
+			never := condition.immediate() && condition.number == 0
+			instruction.removed = never || known && target == instruction.end() && !o.readsLastAddress(target)
+		default:
+			copied := instruction.copiedParam()
+			instruction.removed = copied >= 0 && instruction.writes(instruction.operands[copied].number) &&
+				instruction.operands[copied].format == tvm.ParamFormatRegister
+		}
+
+		changed = changed || instruction.removed
+	}
+
+	return changed
+}
+
+// removeDeadStores removes instructions without side effects whose result is written to a register that the
+// instructions after them overwrite before anything reads it or jumps. Instructions that may fault are kept, since
+// removing them would remove the fault
+func (o *optimizer) removeDeadStores() bool {
+	if o.literalAddresses {
+		return false
+	}
+
+	changed := false
+	for _, instruction := range o.instructions {
+		switch instruction.builder.opCode() {
+		case 1, 2, 5, 7, 12, 13, 14, 15, 16, 17:
+		default:
+			continue
+		}
+
+		output := instruction.operands[instruction.outputParam()]
+		if instruction.pinned || output.format != tvm.ParamFormatRegister || output.number == tvm.RegisterLastAddress || instruction.mayFault() {
+			continue
+		}
+
+		instruction.removed = o.overwritten(output.number, instruction.end())
+		changed = changed || instruction.removed
+	}
+
+	return changed
+}
+
+// overwritten returns true if the code running from the address provided writes to the register provided before
+// reading it or jumping
+func (o *optimizer) overwritten(register, address int) bool {
+	for {
+		instruction := o.starts[address]
+		if instruction == nil || instruction.pinned || instruction.reads(register) {
+			return false
+		}
+
+		switch opCode := instruction.builder.opCode(); {
+		case opCode == 6 || opCode == 9:
+			return false
+		case instruction.writes(register):
+			return true
+		}
+
+		address = instruction.end()
+	}
+}
+
+// readsLastAddress returns true if the code running from the address provided may read $la before a jump
+// overwrites it
+func (o *optimizer) readsLastAddress(address int) bool {
+	for {
+		instruction := o.starts[address]
+		if instruction == nil {
+			return o.words[address] != nil
+		}
+
+		if instruction.pinned || instruction.reads(tvm.RegisterLastAddress) {
+			return true
+		}
+
+		if instruction.builder.opCode() == 9 || instruction.alwaysJumps() {
+			return false
+		}
+
+		address = instruction.end()
+	}
+}
+
+// end returns the address of the word after the instruction
+func (i *optimizedInstruction) end() int {
+	return i.address + i.builder.length()
+}
+
+// jumpTarget returns the address a jit jumps to, if it is an address in the program
+func (i *optimizedInstruction) jumpTarget() (int, bool) {
+	target := i.operands[1]
+	return target.number, target.format == tvm.ParamFormatImmediate && target.known && target.address
+}
+
+// alwaysJumps returns true for jits whose condition is a true immediate
+func (i *optimizedInstruction) alwaysJumps() bool {
+	if i.builder.opCode() != 6 {
+		return false
+	}
+
+	condition := i.operands[0]
+	return condition.immediate() && condition.number != 0
+}
+
+// outputParam returns the index of the parameter the instruction writes to, or -1 if it writes to none
+func (i *optimizedInstruction) outputParam() int {
+	switch i.builder.opCode() {
+	case 3:
+		return 0
+	case 15:
+		return 1
+	case 4, 6, 9:
+		return -1
+	default:
+		return len(i.operands) - 1
+	}
+}
+
+// mayFault returns true if the arithmetic instruction may fault when it runs: if it reads memory, which may be
+// protected, or computes with a register the machine may fault on, such as a shift by too many bits or an addition
+// that overflows a word whose overflow mode faults. Instructions of two immediates fault if the machine faults
+// computing them
+func (i *optimizedInstruction) mayFault() bool {
+	opCode, inputs := i.builder.opCode(), i.operands[:i.outputParam()]
+	known := true
+	for _, operand := range inputs {
+		if operand.format == tvm.ParamFormatAddress {
+			return true
+		}
+
+		known = known && operand.immediate()
+	}
+
+	if known {
+		right := 0
+		if len(inputs) > 1 {
+			right = inputs[1].number
+		}
+
+		_, err := i.builder.wordFormat.Compute(opCode, inputs[0].number, right)
+		return err != nil
+	}
+
+	format := i.builder.wordFormat
+	switch opCode {
+	case 1, 2:
+		return format.Size != tvm.WordSizeBig && format.Overflow == tvm.OverflowFault
+	case 16, 17:
+		return true
+	default:
+		return false
+	}
+}
+
+// reads returns true if the instruction reads the register provided
+func (i *optimizedInstruction) reads(register int) bool {
+	for index, operand := range i.operands {
+		if index != i.outputParam() && operand.format == tvm.ParamFormatRegister && operand.number == register {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writes returns true if the instruction writes to the register provided
+func (i *optimizedInstruction) writes(register int) bool {
+	output := i.outputParam()
+	return output >= 0 && i.operands[output].format == tvm.ParamFormatRegister && i.operands[output].number == register
+}
+
+// copiedParam returns the index of the parameter the instruction copies to its output unchanged, such as x in
+// `add x, 0, dst` or `mlt 1, x, dst`, or -1 if it does not copy one
+func (i *optimizedInstruction) copiedParam() int {
+	identities := map[int]int{1: 0, 2: 1, 13: 0, 14: 0, 16: 0, 17: 0}
+	identity, hasIdentity := identities[i.builder.opCode()]
+	if !hasIdentity {
+		return -1
+	}
+
+	isIdentity := func(index int) bool {
+		operand := i.operands[index]
+		return operand.immediate() && operand.number == identity
+	}
+
+	switch {
+	case isIdentity(1):
+		return 0
+	case isIdentity(0) && i.builder.opCode() != 16 && i.builder.opCode() != 17:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// immediate returns true if the value is an immediate known before the second pass that is not an address
+func (v operandValue) immediate() bool {
+	return v.known && !v.address && v.format == tvm.ParamFormatImmediate
+}
+
+// opCode returns the operation of the instruction, without its parameter formats
+func (i *instructionBuilder) opCode() int {
+	return i.OpCode % 100
+}
+
+// paramFormat returns the format of the parameter at the index provided
+func (i *instructionBuilder) paramFormat(index int) tvm.ParamFormat {
+	multiplier := 100
+	for range index {
+		multiplier *= 10
+	}
+
+	return tvm.ParamFormat((i.OpCode / multiplier) % 10)
+}
+
+// move returns an instruction that moves the immediate provided to the output of the instruction, which must be its
+// third parameter
+func (i *instructionBuilder) move(value int) (*instructionBuilder, error) {
+	moved := &instructionBuilder{OpCode: 1, wordFormat: i.wordFormat}
+	if err := moved.addImmediate(value, 0); err != nil {
+		return nil, err
+	}
+
+	if err := moved.addImmediate(0, 1); err != nil {
+		return nil, err
+	}
+
+	if err := moved.updateOpcodeForParam(i.paramFormat(2), 2); err != nil {
+		return nil, err
+	}
+
+	moved.Params = append(moved.Params, i.Params[2])
+	if output, isExpression := i.Expressions[2]; isExpression {
+		moved.Expressions = map[int]expression{2: output}
+	}
+
+	return moved, nil
+}
+
+// setAddress replaces the parameter at the index provided, which must be an immediate, with the address provided
+func (i *instructionBuilder) setAddress(index int, address int) {
+	delete(i.Expressions, index)
+	i.Params[index] = address
+	if !slices.Contains(i.Addresses, index) {
+		i.Addresses = append(i.Addresses, index)
+	}
+}
@@ -0,0 +1,245 @@
+package assembler
+
+import (
+	"fmt"
+	"reflect"
+
+	"tvm/internal/syntax"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// pseudoInstruction lowers a pseudo-instruction into the real instructions it stands for, given its operands and
+// where it is expanded. Expansions never need a scratch register or memory
+type pseudoInstruction func(a *TsvetokAssembler, operands []*syntax.Operand, site expansionSite) ([]*instructionBuilder, error)
+
+// expansionSite is where a pseudo-instruction is expanded: the address its expansion starts at, and the position of
+// its line in the program along with the symbols defined before it
+type expansionSite struct {
+	address  int
+	position int
+	symbols  *symbolTable
+}
+
+// aliasAssumption records whether two address operands of a pseudo-instruction were taken to be the same address
+// when it was expanded, before every label was known
+type aliasAssumption struct {
+	position    int
+	first       *syntax.Operand
+	second      *syntax.Operand
+	expressions [2]expression
+	same        bool
+}
+
+// programAddress is an immediate operand of an expansion that holds an address in the program
+type programAddress int
+
+// pseudoInstructions are the pseudo-instructions the assembler understands, by mnemonic
+var pseudoInstructions map[string]pseudoInstruction
+
+func init() {
+	pseudoInstructions = map[string]pseudoInstruction{
+		"sub": expandSubtract,
+		"mov": expandMove,
+		"nil": expandNil,
+		"jmp": expandJump,
+		"jif": expandJumpIfFalse,
+	}
+}
+
+// expandSubtract lowers `sub a, b, dst` (dst = a - b) by adding the negation of b to a. b is negated into dst
+// unless dst is also a, in which case a is negated instead, since a - b = -(-a + b)
+func expandSubtract(a *TsvetokAssembler, operands []*syntax.Operand, site expansionSite) ([]*instructionBuilder, error) {
+	if err := expectOperands("sub", operands, 3); err != nil {
+		return nil, err
+	}
+
+	left, right, output := operands[0], operands[1], operands[2]
+	if parsed, err := newOperand(right); err != nil {
+		return nil, err
+	} else if parsed.format == tvm.ParamFormatImmediate {
+		if number, isNumber := parsed.expression.(numberExpression); isNumber {
+			parsed.expression = -number
+		} else {
+			parsed.expression = binaryExpression{"-", numberExpression(0), parsed.expression}
+		}
+
+		return a.instructions(a.instruction("add", left, parsed, output))
+	}
+
+	outputIsLeft, err := a.sameOperand(output, left, site)
+	if err != nil {
+		return nil, err
+	}
+
+	if !outputIsLeft {
+		return a.instructions(a.instruction("mlt", right, -1, output), a.instruction("add", left, output, output))
+	}
+
+	if rightIsLeft, err := a.sameOperand(right, left, site); err != nil {
+		return nil, err
+	} else if rightIsLeft {
+		return a.instructions(a.instruction("add", 0, 0, output))
+	}
+
+	return a.instructions(
+		a.instruction("mlt", left, -1, left),
+		a.instruction("add", left, right, left),
+		a.instruction("mlt", left, -1, left),
+	)
+}
+
+// expandMove lowers `mov src, dst` (dst = src)
+func expandMove(a *TsvetokAssembler, operands []*syntax.Operand, _ expansionSite) ([]*instructionBuilder, error) {
+	if err := expectOperands("mov", operands, 2); err != nil {
+		return nil, err
+	}
+
+	return a.instructions(a.instruction("add", operands[0], 0, operands[1]))
+}
+
+// expandNil lowers `nil dst` (dst = 0)
+func expandNil(a *TsvetokAssembler, operands []*syntax.Operand, _ expansionSite) ([]*instructionBuilder, error) {
+	if err := expectOperands("nil", operands, 1); err != nil {
+		return nil, err
+	}
+
+	return a.instructions(a.instruction("add", 0, 0, operands[0]))
+}
+
+// expandJump lowers `jmp target`, which always jumps
+func expandJump(a *TsvetokAssembler, operands []*syntax.Operand, _ expansionSite) ([]*instructionBuilder, error) {
+	if err := expectOperands("jmp", operands, 1); err != nil {
+		return nil, err
+	}
+
+	return a.instructions(a.instruction("jit", 1, operands[0]))
+}
+
+// expandJumpIfFalse lowers `jif condition, target`, which jumps if the condition is 0, by jumping over an
+// unconditional jump to the target if the condition is true. Like any jump, it sets $la whether or not it jumps
+func expandJumpIfFalse(a *TsvetokAssembler, operands []*syntax.Operand, site expansionSite) ([]*instructionBuilder, error) {
+	if err := expectOperands("jif", operands, 2); err != nil {
+		return nil, err
+	}
+
+	return a.instructions(a.instruction("jit", operands[0], programAddress(site.address+6)), a.instruction("jit", 1, operands[1]))
+}
+
+// sameOperand returns true if two operands of a pseudo-instruction refer to the same register or address. Addresses
+// are compared by value when the symbols defined so far are enough to evaluate them, and as written otherwise, in
+// which case the answer is checked once every label is known (see checkAliasAssumptions)
+func (a *TsvetokAssembler) sameOperand(first, second *syntax.Operand, site expansionSite) (bool, error) {
+	firstOperand, err := newOperand(first)
+	if err != nil {
+		return false, err
+	}
+
+	secondOperand, err := newOperand(second)
+	if err != nil {
+		return false, err
+	}
+
+	if firstOperand.format != secondOperand.format {
+		return false, nil
+	}
+
+	if firstOperand.format == tvm.ParamFormatRegister {
+		return firstOperand.register == secondOperand.register, nil
+	}
+
+	firstValue, firstErr := firstOperand.expression.evaluate(site.symbols, site.position)
+	secondValue, secondErr := secondOperand.expression.evaluate(site.symbols, site.position)
+	if firstErr == nil && secondErr == nil {
+		return firstValue.number == secondValue.number, nil
+	}
+
+	same := reflect.DeepEqual(firstOperand.expression, secondOperand.expression)
+	expressions := [2]expression{firstOperand.expression, secondOperand.expression}
+	a.aliasAssumptions = append(a.aliasAssumptions, aliasAssumption{site.position, first, second, expressions, same})
+	return same, nil
+}
+
+// checkAliasAssumptions returns an error for the first pseudo-instruction that took two addresses to be the same,
+// or different, when in fact they are not
+func (a *TsvetokAssembler) checkAliasAssumptions(lines []tsvasmLine, symbols *symbolTable) error {
+	for _, assumption := range a.aliasAssumptions {
+		first, err := assumption.expressions[0].evaluate(symbols, assumption.position)
+		if err != nil {
+			continue
+		}
+
+		second, err := assumption.expressions[1].evaluate(symbols, assumption.position)
+		if err != nil || (first.number == second.number) == assumption.same {
+			continue
+		}
+
+		relation := "the same address"
+		if !assumption.same {
+			relation = "different addresses"
+		}
+
+		err = fmt.Errorf("'%v' and '%v' were taken to be %v before their labels were defined; define them before this line", assumption.first.Text, assumption.second.Text, relation)
+		return lines[assumption.position].wrapError(err)
+	}
+
+	return nil
+}
+
+// expectOperands returns an error unless the pseudo-instruction named was given exactly count operands
+func expectOperands(name string, operands []*syntax.Operand, count int) error {
+	if len(operands) != count {
+		return fmt.Errorf("'%v' expects %v operand(s) but was given %v", name, count, len(operands))
+	}
+
+	return nil
+}
+
+// pendingInstruction is an instruction of an expansion, or the error building it
+type pendingInstruction struct {
+	builder *instructionBuilder
+	err     error
+}
+
+// instruction builds a real instruction of an expansion. Operands are either operands of the pseudo-instruction
+// (syntax.Operands), written to the instruction as they were written in the source, converted operands, immediates
+// (ints), or addresses in the program (programAddresses)
+func (a *TsvetokAssembler) instruction(operation string, operands ...any) pendingInstruction {
+	builder := &instructionBuilder{wordFormat: a.wordFormat}
+	if err := builder.setOperation(operation); err != nil {
+		return pendingInstruction{err: err}
+	}
+
+	for index, param := range operands {
+		var err error
+		switch param := param.(type) {
+		case *syntax.Operand:
+			err = builder.addParam(param, index)
+		case operand:
+			err = builder.addOperand(param, index)
+		case int:
+			err = builder.addImmediate(param, index)
+		case programAddress:
+			err = builder.addAddress(int(param), index)
+		}
+
+		if err != nil {
+			return pendingInstruction{err: err}
+		}
+	}
+
+	return pendingInstruction{builder: builder}
+}
+
+// instructions gathers the instructions of an expansion, or returns the first error building them
+func (a *TsvetokAssembler) instructions(pending ...pendingInstruction) ([]*instructionBuilder, error) {
+	builders := make([]*instructionBuilder, 0, len(pending))
+	for _, instruction := range pending {
+		if instruction.err != nil {
+			return nil, instruction.err
+		}
+
+		builders = append(builders, instruction.builder)
+	}
+
+	return builders, nil
+}
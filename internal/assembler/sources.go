@@ -0,0 +1,138 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tvm/internal/syntax"
+)
+
+// readSources returns the lines of the assembler's string, or of each of its files one after another, with the
+// lines of every included file in place of the directive including it. Every file is only read once, so a file
+// included again (such as by two files that both include it) adds no lines
+func (a *TsvetokAssembler) readSources() ([]tsvasmLine, error) {
+	read := map[string]bool{}
+	if len(a.files) == 0 {
+		lines, err := splitLines(a.originalAssembly, "")
+		if err != nil {
+			return nil, err
+		}
+
+		return a.includeFiles(lines, "", nil, read)
+	}
+
+	lines := make([]tsvasmLine, 0)
+	for _, path := range a.files {
+		fileLines, err := a.readFile(path, nil, read)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, fileLines...)
+	}
+
+	return lines, nil
+}
+
+// readFile returns the lines of the file at the path provided, with its includes in place, or no lines if it was
+// read already. including lists the absolute paths of the files being included, outermost first, which the file
+// must not be one of, and read the absolute paths of every file read so far
+func (a *TsvetokAssembler) readFile(path string, including []string, read map[string]bool) ([]tsvasmLine, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for index, included := range including {
+		if included == absolute {
+			cycle := append(append([]string{}, including[index:]...), absolute)
+			for step := range cycle {
+				cycle[step] = filepath.Base(cycle[step])
+			}
+
+			return nil, fmt.Errorf("include cycle: %v", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if read[absolute] {
+		return nil, nil
+	}
+
+	read[absolute] = true
+
+	source, overlaid := a.overlay[absolute]
+	if !overlaid {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		source = string(contents)
+	}
+
+	lines, err := splitLines(source, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.includeFiles(lines, filepath.Dir(path), append(append([]string{}, including...), absolute), read)
+}
+
+// includeFiles replaces every .include directive in the lines provided, found in the directory provided, with the
+// lines of the file it includes
+func (a *TsvetokAssembler) includeFiles(lines []tsvasmLine, directory string, including []string, read map[string]bool) ([]tsvasmLine, error) {
+	included := make([]tsvasmLine, 0, len(lines))
+	for _, line := range lines {
+		directive, isDirective := line.parsed.Statement.(*syntax.Directive)
+		if !isDirective || directive.Name != ".include" {
+			included = append(included, line)
+			continue
+		}
+
+		if labels, hasLabels := line.labelsOnly(); hasLabels {
+			included = append(included, labels)
+		}
+
+		path, err := a.findInclude(directive.Arguments[0].(*syntax.String).Value, directory)
+		if err != nil {
+			return nil, line.wrapError(err)
+		}
+
+		fileLines, err := a.readFile(path, including, read)
+		if err != nil {
+			return nil, line.wrapError(err)
+		}
+
+		included = append(included, fileLines...)
+	}
+
+	return included, nil
+}
+
+// findInclude returns the path of the file included as name from a file in the directory provided: relative to that
+// directory if it exists there, or to the first of the include paths it exists in otherwise
+func (a *TsvetokAssembler) findInclude(name, directory string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+
+	for _, searched := range append([]string{directory}, a.includePaths...) {
+		path := filepath.Join(searched, name)
+		if absolute, err := filepath.Abs(path); err == nil {
+			if _, overlaid := a.overlay[absolute]; overlaid {
+				return path, nil
+			}
+		}
+
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("cannot find included file '%v'", name)
+}
@@ -0,0 +1,505 @@
+package assembler
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tvm/internal/linker"
+	"tvm/internal/syntax"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// TsvetokAssembler assembles a given TVA program and converts it into a TVM executable
+type TsvetokAssembler struct {
+	originalAssembly string
+	files            []string
+	includePaths     []string
+	overlay          map[string]string
+	sourceMap        tvm.SourceMap
+	listing          Listing
+	wordFormat       tvm.WordFormat
+	optimization     bool
+	macroExpansions  int
+	aliasAssumptions []aliasAssumption
+}
+
+// NewAssemblerFromString returns a TsvetokAssembler instance with the provided string as assembly code.
+// Note that this does not return any errors or attempt to assemble the underlying assembly code
+func NewAssemblerFromString(programStr string) *TsvetokAssembler {
+	return &TsvetokAssembler{originalAssembly: programStr}
+}
+
+// NewAssemblerFromFiles returns a TsvetokAssembler for the files of assembly code provided, which are assembled one
+// after another into a single program, sharing their labels and macros. The files are only read once the program is
+// assembled
+func NewAssemblerFromFiles(paths ...string) *TsvetokAssembler {
+	return &TsvetokAssembler{files: paths}
+}
+
+// SetIncludePaths sets the directories searched, in order, for files included with .include that are not found
+// relative to the file including them
+func (a *TsvetokAssembler) SetIncludePaths(paths ...string) {
+	a.includePaths = paths
+}
+
+// SetOverlay sets the contents of files to use in place of what is on disk, by path, such as the unsaved contents
+// of files open in an editor. The files are found wherever they are named from, whether as one of the assembler's
+// files or by an .include directive
+func (a *TsvetokAssembler) SetOverlay(files map[string]string) {
+	a.overlay = map[string]string{}
+	for path, source := range files {
+		if absolute, err := filepath.Abs(path); err == nil {
+			a.overlay[absolute] = source
+		}
+	}
+}
+
+// SetWordFormat sets the format of the words the program is assembled for, which decides the range of the literals
+// it may contain (see WordFormat.FitLiteral.) Programs are assembled for 32-bit words that wrap around by default
+func (a *TsvetokAssembler) SetWordFormat(format tvm.WordFormat) {
+	a.wordFormat = format
+}
+
+// Assemble assembles the program in two passes. The first lays out every instruction, expanding
+// pseudo-instructions into the real instructions they stand for, and records the address of every label and the
+// definition of every constant; the second evaluates the expressions that instructions' operands are written with
+func (a *TsvetokAssembler) Assemble() ([]int, error) {
+	object, err := a.assemble(false)
+	if err != nil {
+		return []int{}, err
+	}
+
+	return object.Words, nil
+}
+
+// AssembleObject assembles the program into a relocatable object, which is linked with other objects into a
+// program by a linker.Linker. Labels declared with .global are exported to the other objects, and labels declared
+// with .extern may be left for another object to define
+func (a *TsvetokAssembler) AssembleObject() (linker.Object, error) {
+	return a.assemble(true)
+}
+
+// assemble assembles the program as Assemble describes, into an object whose relocations list every word holding
+// an address. Labels declared with .extern may only be left undefined if the object is relocatable
+func (a *TsvetokAssembler) assemble(relocatable bool) (linker.Object, error) {
+	a.sourceMap = tvm.SourceMap{}
+	a.listing = Listing{}
+	a.aliasAssumptions = nil
+
+	a.macroExpansions = 0
+	lines, err := a.readSources()
+	if err != nil {
+		return linker.Object{}, err
+	}
+
+	lines, err = a.expandMacros(lines)
+	if err != nil {
+		return linker.Object{}, err
+	}
+
+	symbols := newSymbolTable()
+	labelLines := map[string]tsvasmLine{}
+	exports := map[string]tsvasmLine{}
+	entries := make([]assembledLine, 0)
+	address := 0
+	for position, line := range lines {
+		for _, label := range line.parsed.Labels {
+			if !isLabel(label.Name) {
+				return linker.Object{}, line.wrapError(invalidName("label", label.Name))
+			}
+
+			if definedOn, defined := labelLines[label.Name]; defined {
+				return linker.Object{}, line.wrapError(fmt.Errorf("label '%v' is already defined on %v", label.Name, describeLine(definedOn.file, definedOn.lineNumber)))
+			}
+
+			if definitions, isConstant := symbols.constants[label.Name]; isConstant {
+				return linker.Object{}, line.wrapError(fmt.Errorf("'%v' is already defined as a constant on %v", label.Name, describeLine(definitions[0].line.file, definitions[0].line.lineNumber)))
+			}
+
+			symbols.labels[label.Name] = address
+			labelLines[label.Name] = line
+		}
+
+		switch statement := line.parsed.Statement.(type) {
+		case *syntax.Directive:
+			switch statement.Name {
+			case ".global", ".extern":
+				names, err := symbolNames(statement)
+				if err != nil {
+					return linker.Object{}, line.wrapError(err)
+				}
+
+				for _, name := range names {
+					if statement.Name == ".global" {
+						exports[name] = line
+					} else {
+						symbols.imports[name] = true
+					}
+				}
+			case ".equ", ".set":
+				if err := defineConstant(symbols, statement, position, line); err != nil {
+					return linker.Object{}, line.wrapError(err)
+				}
+			default:
+				return linker.Object{}, line.wrapError(fmt.Errorf("unknown directive '%v'", statement.Name))
+			}
+		case *syntax.Instruction:
+			// TODO: Do we want to just gather and report all of the errors instead of stopping assembly at the first one?
+			builders, err := a.buildInstructions(statement, expansionSite{address, position, symbols})
+			if err != nil {
+				return linker.Object{}, line.wrapError(err)
+			}
+
+			_, pseudo := pseudoInstructions[statement.Mnemonic]
+			entries = append(entries, assembledLine{line, line.statementCode(), position, address, builders, pseudo})
+			for _, builder := range builders {
+				address += builder.length()
+			}
+		}
+	}
+
+	if err := a.checkAliasAssumptions(lines, symbols); err != nil {
+		return linker.Object{}, err
+	}
+
+	for name, line := range exports {
+		if _, defined := symbols.labels[name]; !defined {
+			return linker.Object{}, line.wrapError(fmt.Errorf("exported label '%v' is never defined", name))
+		}
+	}
+
+	if a.optimization {
+		a.optimize(entries, symbols)
+	}
+
+	symbols.relocatable = relocatable
+	object := linker.Object{WordFormat: a.wordFormat, Words: make([]int, 0, address)}
+	for _, entry := range entries {
+		location := entry.line.sourceLocation()
+		listed := ListingEntry{File: location.File, Line: location.Line, Source: entry.code, Text: entry.code, Pseudo: entry.pseudo}
+		if len(entry.line.invocations) == 0 {
+			listed.Text = strings.TrimSpace(entry.line.parsed.Text)
+		}
+
+		for _, builder := range entry.builders {
+			relocations, err := builder.resolve(symbols, entry.position, len(object.Words))
+			if err != nil {
+				return linker.Object{}, entry.line.wrapError(err)
+			}
+
+			words := builder.toIntcode()
+			assembly, _ := tvm.Disassemble(words, 0)
+			listed.Instructions = append(listed.Instructions, ListedInstruction{len(object.Words), words, assembly})
+			object.Relocations = append(object.Relocations, relocations...)
+			object.Words = append(object.Words, words...)
+		}
+
+		a.sourceMap.Add(entry.address, len(object.Words), entry.line.statementLocation())
+		a.listing.Entries = append(a.listing.Entries, listed)
+	}
+
+	if relocatable {
+		for name := range symbols.imports {
+			if _, defined := symbols.labels[name]; !defined {
+				object.Imports = append(object.Imports, name)
+			}
+		}
+	}
+
+	for name, offset := range symbols.labels {
+		_, exported := exports[name]
+		object.Symbols = append(object.Symbols, linker.Symbol{Name: name, Offset: offset, Exported: exported})
+	}
+
+	sort.Slice(object.Symbols, func(i, j int) bool {
+		if object.Symbols[i].Offset != object.Symbols[j].Offset {
+			return object.Symbols[i].Offset < object.Symbols[j].Offset
+		}
+
+		return object.Symbols[i].Name < object.Symbols[j].Name
+	})
+	sort.Strings(object.Imports)
+	sort.Slice(object.Relocations, func(i, j int) bool { return object.Relocations[i].Offset < object.Relocations[j].Offset })
+
+	if len(a.files) > 0 {
+		object.Name = a.files[0]
+	}
+
+	for name, address := range symbols.labels {
+		a.sourceMap.AddLabel(name, address)
+	}
+
+	a.listing.Labels = symbols.labels
+	a.listing.Definitions = map[string]tvm.SourceLocation{}
+	for name, line := range labelLines {
+		a.listing.Definitions[name] = line.sourceLocation()
+	}
+
+	a.listing.References = labelReferences(lines, symbols)
+	return object, nil
+}
+
+// labelReferences returns every line using each label in an operand or in the definition of a constant
+func labelReferences(lines []tsvasmLine, symbols *symbolTable) map[string][]tvm.SourceLocation {
+	references := map[string][]tvm.SourceLocation{}
+	for _, line := range lines {
+		if directive, isDirective := line.parsed.Statement.(*syntax.Directive); isDirective && directive.Name != ".equ" && directive.Name != ".set" {
+			continue
+		}
+
+		location := line.sourceLocation()
+		syntax.Inspect(line.parsed.Statement, func(node syntax.Node) bool {
+			identifier, isIdentifier := node.(*syntax.Identifier)
+			if !isIdentifier {
+				return true
+			}
+
+			if _, isLabel := symbols.labels[identifier.Name]; !isLabel {
+				return true
+			}
+
+			if uses := references[identifier.Name]; len(uses) == 0 || uses[len(uses)-1] != location {
+				references[identifier.Name] = append(uses, location)
+			}
+
+			return true
+		})
+	}
+
+	return references
+}
+
+// defineConstant records the constant that a .equ or .set directive at the position provided defines, written as
+// `.equ NAME expression` or `.equ NAME, expression`
+func defineConstant(symbols *symbolTable, directive *syntax.Directive, position int, line tsvasmLine) error {
+	name := directive.Arguments[0].(*syntax.Identifier).Name
+	if !isLabel(name) {
+		return invalidName("constant", name)
+	}
+
+	parsed, err := newExpression(directive.Arguments[1])
+	if err != nil {
+		return err
+	}
+
+	return symbols.define(name, constantDefinition{parsed, position, line, directive.Name == ".set"})
+}
+
+// symbolNames returns the labels named by a .global or .extern directive
+func symbolNames(directive *syntax.Directive) ([]string, error) {
+	names := make([]string, 0, len(directive.Arguments))
+	for _, argument := range directive.Arguments {
+		identifier, isIdentifier := argument.(*syntax.Identifier)
+		if !isIdentifier {
+			return nil, fmt.Errorf("'%v' only accepts labels", directive.Name)
+		}
+
+		if !isLabel(identifier.Name) {
+			return nil, invalidName("label", identifier.Name)
+		}
+
+		names = append(names, identifier.Name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("'%v' needs at least one label", directive.Name)
+	}
+
+	return names, nil
+}
+
+// buildInstructions builds the real instructions that the instruction provided stands for where it is found: a
+// single one for real operations, and their expansion for pseudo-instructions
+func (a *TsvetokAssembler) buildInstructions(instruction *syntax.Instruction, site expansionSite) ([]*instructionBuilder, error) {
+	if expand, isPseudoInstruction := pseudoInstructions[instruction.Mnemonic]; isPseudoInstruction {
+		return expand(a, instruction.Operands, site)
+	}
+
+	builder := &instructionBuilder{wordFormat: a.wordFormat}
+	err := builder.setOperation(instruction.Mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	for index, operand := range instruction.Operands {
+		err := builder.addParam(operand, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []*instructionBuilder{builder}, nil
+}
+
+// Listing returns the listing of the most recently assembled program, showing what every line of assembly became
+func (a *TsvetokAssembler) Listing() Listing {
+	return a.listing
+}
+
+// assembledLine is a line of assembly laid out by the first pass of Assemble, waiting for its labels to be resolved
+type assembledLine struct {
+	line     tsvasmLine
+	code     string
+	position int
+	address  int
+	builders []*instructionBuilder
+	pseudo   bool
+}
+
+// SourceMap returns the map from addresses of the most recently assembled program back to the statements of
+// assembly they were assembled from, along with the address of every label. Give it to a TsvetokVirtualMachine (see
+// SetSourceLocator), or write it into an image with the program (see tvm.Image), to have the machine's reports refer
+// to lines of assembly and labels rather than bare addresses
+func (a *TsvetokAssembler) SourceMap() tvm.SourceMap {
+	return a.sourceMap
+}
+
+// tsvasmLine is an intermediary struct that represents the original line of assembly code
+// and what line number it originally was in. Keeping the two together allows for better
+// debug information and error reporting
+type tsvasmLine struct {
+	assemblyCode string
+	lineNumber   int
+
+	// file is the file the line is in, as it was named on the command line or in an .include directive, or empty
+	// for the assembler's string
+	file string
+
+	// invocations are the macro invocations that produced this line, outermost first, if it is part of a macro's
+	// expansion. lineNumber is then the line of the macro's body
+	invocations []macroInvocation
+
+	// parsed is the syntax tree of assemblyCode
+	parsed *syntax.Line
+}
+
+// sourceLocation returns the location in the program this line of assembly stands for: its own, or that of the
+// outermost macro invocation it was expanded from
+func (l tsvasmLine) sourceLocation() tvm.SourceLocation {
+	if len(l.invocations) > 0 {
+		return tvm.SourceLocation{File: l.invocations[0].file, Line: l.invocations[0].line}
+	}
+
+	return tvm.SourceLocation{File: l.file, Line: l.lineNumber}
+}
+
+// statementLocation returns sourceLocation along with the column of the line's statement, or that of the outermost
+// macro invocation it was expanded from
+func (l tsvasmLine) statementLocation() tvm.SourceLocation {
+	location := l.sourceLocation()
+	if len(l.invocations) > 0 {
+		location.Column = l.invocations[0].column
+	} else if l.parsed.Statement != nil {
+		location.Column = l.parsed.Statement.Pos().Column
+	}
+
+	return location
+}
+
+// statementCode returns the code of the line's statement, without its labels
+func (l tsvasmLine) statementCode() string {
+	if len(l.parsed.Labels) == 0 {
+		return l.parsed.Code
+	}
+
+	return l.parsed.Code[l.parsed.Statement.Pos().Column-l.parsed.Labels[0].Position.Column:]
+}
+
+// labelsOnly returns the line with only its labels, and false if it has none
+func (l tsvasmLine) labelsOnly() (tsvasmLine, bool) {
+	if len(l.parsed.Labels) == 0 {
+		return tsvasmLine{}, false
+	}
+
+	parsed := &syntax.Line{Position: l.parsed.Position, Text: l.parsed.Text, Labels: l.parsed.Labels}
+	names := make([]string, 0, len(parsed.Labels))
+	for _, label := range parsed.Labels {
+		names = append(names, label.Name+":")
+	}
+
+	parsed.Code = strings.Join(names, " ")
+	return tsvasmLine{parsed.Code, l.lineNumber, l.file, l.invocations, parsed}, true
+}
+
+// wrapError adds the line's location to the error provided, including every macro invocation it was expanded from
+func (l tsvasmLine) wrapError(err error) error {
+	location := fmt.Sprintf("error on %v", describeLine(l.file, l.lineNumber))
+	for index := len(l.invocations) - 1; index >= 0; index-- {
+		invocation := l.invocations[index]
+		location += fmt.Sprintf(" in macro '%v' invoked on %v", invocation.name, describeLine(invocation.file, invocation.line))
+	}
+
+	var at tvm.SourceLocation
+	var syntaxError *syntax.Error
+	switch {
+	case l.parsed != nil:
+		at = l.statementLocation()
+	case errors.As(err, &syntaxError):
+		at = tvm.SourceLocation{File: l.file, Line: l.lineNumber, Column: syntaxError.Position.Column}
+	default:
+		at = tvm.SourceLocation{File: l.file, Line: l.lineNumber}
+	}
+
+	return LineErr{err, at, location}
+}
+
+// describeLine describes a line of the file provided for error messages
+func describeLine(file string, line int) string {
+	if file == "" {
+		return fmt.Sprintf("line '%v'", line)
+	}
+
+	return fmt.Sprintf("line '%v' of '%v'", line, file)
+}
+
+// splitLines() parses the source provided, found in the file provided, into a struct per line, or returns the
+// first syntax error in it. No struct is returned for lines that consist solely of comments
+func splitLines(source, file string) ([]tsvasmLine, error) {
+	parsed, err := syntax.Parse(source, file)
+	var syntaxErrors syntax.ErrorList
+	if errors.As(err, &syntaxErrors) {
+		first := syntaxErrors[0]
+		return nil, tsvasmLine{lineNumber: first.Position.Line, file: file}.wrapError(first)
+	}
+
+	newLines := make([]tsvasmLine, 0)
+	for _, line := range parsed.Lines {
+		if line.IsBlank() {
+			continue
+		}
+
+		newLine := tsvasmLine{assemblyCode: line.Code, lineNumber: line.Position.Line, file: file, parsed: line}
+		if name := expansionLabel(line); name != "" {
+			return nil, newLine.wrapError(fmt.Errorf("invalid label name '%v': '@' is reserved for labels renamed by macro expansions", name))
+		}
+
+		newLines = append(newLines, newLine)
+	}
+
+	return newLines, nil
+}
+
+// expansionLabel returns the first label defined or used by the line provided whose name has an '@', which only
+// the labels macro expansions rename may have, or an empty string if there is none
+func expansionLabel(line *syntax.Line) string {
+	name := ""
+	syntax.Inspect(line, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.Label:
+			if strings.Contains(node.Name, "@") {
+				name = node.Name
+			}
+		case *syntax.Identifier:
+			if strings.Contains(node.Name, "@") {
+				name = node.Name
+			}
+		}
+
+		return name == ""
+	})
+
+	return name
+}
@@ -0,0 +1,903 @@
+package assembler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type executionTestCase struct {
+	program         string
+	expectedAddress int
+	expectedValue   int
+	testName        string
+}
+
+func TestTsvetokAssembler_HandlesAllRegularInstructionsInMemoryMode(t *testing.T) {
+	for _, tc := range []executionTestCase{
+		{"hlt", 0, 9, "hlt instruction works"},
+		{"add $0, $0, $0\nhlt", 0, 2, "add instruction works"},
+		{"mlt $0, $0, $1\nhlt", 1, 4, "mlt instruction works"},
+		{"in $0\nhlt", 0, -69, "in instruction works"},
+		{"out $0\nhlt", -1, 4, "out instruction works"},
+		{"seq $1, $4, $1\nhlt", 1, 0, "seq instruction works"},
+		{"jit $0, $4\nadd $7, $0, $0\nhlt", 0, 6, "jit instruction works"},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			assembler := NewAssemblerFromString(tc.program)
+			program, err := assembler.Assemble()
+			require.NoError(t, err)
+
+			machine := tvm.NewTsvetokVirtualMachine(program)
+
+			mockInput := tvm.MockInputInterface{NumberToReturn: -69}
+			machine.SetInputInterface(mockInput)
+
+			mockOutput := &tvm.MockOutputInterface{}
+			machine.SetOutputInterface(mockOutput)
+
+			preExecutionMemory := machine.CopyMemory()
+			require.NoError(t, machine.Execute(), fmt.Sprintf("failed execution (program was %v)", preExecutionMemory))
+
+			memory := machine.CopyMemory()
+
+			if tc.expectedAddress < 0 { // Assert output case
+				require.NotNil(t, mockOutput.LastNumberReceived)
+				assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived, "output value was not equal")
+			} else {
+				assert.Equal(t, tc.expectedValue, memory[tc.expectedAddress])
+			}
+		})
+	}
+}
+
+func TestTsvetokAssembler_HandlesAllRegularInstructionsInImmediateMode(t *testing.T) {
+	for _, tc := range []executionTestCase{
+		{"add $2, i12, $0\nhlt", 0, 24, "add instruction works"},
+		{"add 5, 2, $0\nhlt", 0, 7, "add instruction with plain immediates works"},
+		{"mlt 5, 2, $0\nhlt", 0, 10, "mlt instruction with plain immediates works"},
+		{"out i12\nhlt", -1, 12, "out instruction with immediate works"},
+		{"seq $1, 1, $0\nhlt", 0, 1, "seq instruction works"},
+		{"jit $0, 7\nadd $0, $0, $0\nhlt", 0, 1006, "jit with plain immediate address works"},
+		{"jit 0, $4\nadd $0, $0, $0\nhlt", 0, 212, "jit with plain immediate parameter works"},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			assembler := NewAssemblerFromString(tc.program)
+			program, err := assembler.Assemble()
+			require.NoError(t, err)
+
+			machine := tvm.NewTsvetokVirtualMachine(program)
+			mockOutput := &tvm.MockOutputInterface{}
+			machine.SetOutputInterface(mockOutput)
+
+			preExecutionMemory := machine.CopyMemory()
+			require.NoError(t, machine.Execute(), fmt.Sprintf("failed execution (program was %v)", preExecutionMemory))
+
+			if tc.expectedAddress < 0 { // Assertion on output
+				require.NotNil(t, mockOutput.LastNumberReceived)
+				assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived, "output value was not equal")
+			} else {
+				memory := machine.CopyMemory()
+				assert.Equal(t, tc.expectedValue, memory[tc.expectedAddress])
+			}
+		})
+	}
+}
+
+func TestTsvetokAssembler_HandlesAllRegularInstructionsInRegisterMode(t *testing.T) {
+	for _, tc := range []executionTestCase{
+		{"add i2, r0, r0\nadd r0, r0, $0\nhlt", 0, 4, "add supports register mode"},
+		{"mlt i2, i3, r0\nadd r0, r0, $0\nhlt", 0, 12, "mlt supports register mode"},
+		{"in t0\nadd t0, 0, $0\nhlt", 0, -3, "in supports register mode (temporary register)"},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			assembler := NewAssemblerFromString(tc.program)
+			program, err := assembler.Assemble()
+			require.NoError(t, err)
+
+			machine := tvm.NewTsvetokVirtualMachine(program)
+			mockOutput := &tvm.MockOutputInterface{}
+			machine.SetOutputInterface(mockOutput)
+
+			mockInput := &tvm.MockInputInterface{NumberToReturn: -3}
+			machine.SetInputInterface(mockInput)
+
+			preExecutionMemory := machine.CopyMemory()
+			require.NoError(t, machine.Execute(), fmt.Sprintf("failed execution (program was %v)", preExecutionMemory))
+
+			if tc.expectedAddress < 0 { // Assertion on output
+				require.NotNil(t, mockOutput.LastNumberReceived)
+				assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived, "output value was not equal")
+			} else {
+				memory := machine.CopyMemory()
+				assert.Equal(t, tc.expectedValue, memory[tc.expectedAddress])
+			}
+		})
+	}
+}
+
+func TestTsvetokAssembler_IgnoresCommentsSpacesAndTheLike(t *testing.T) {
+	program := `# This is a comment. In Tsvetok Assembly we start comments
+	# with the '#' character. There are no multi-line comments;
+	# only inline comments
+		hlt # this is a comment at the end of the line, which should be ignored
+	`
+
+	assembler := NewAssemblerFromString(program)
+	intcode, err := assembler.Assemble()
+	require.NoError(t, err)
+	require.True(t, len(intcode) > 0)
+	assert.Equal(t, 9, intcode[0])
+}
+
+func TestTsvetokAssembler_SourceMapLetsTheMachineReportSelfModifyingCodeByLine(t *testing.T) {
+	assembler := NewAssemblerFromString("out 0\nadd $0, 1, $0 # patches the out instruction above\nhlt")
+	program, err := assembler.Assemble()
+	require.NoError(t, err)
+
+	machine := tvm.NewTsvetokVirtualMachine(program)
+	machine.SetOutputInterface(&tvm.MockOutputInterface{})
+	machine.SetSourceLocator(assembler.SourceMap())
+	machine.SetSelfModificationDetection(true)
+	machine.SetTraceDepth(4)
+	require.NoError(t, machine.Execute())
+
+	modifications := machine.SelfModifications()
+	require.Len(t, modifications, 1)
+	assert.Equal(t, 2, modifications[0].ProgramCounter)
+	assert.Equal(t, 0, modifications[0].Address)
+	assert.Equal(t, "self-modifying write at pc 2 (line 2:1): address 0 (line 1:1) changed from 104 to 105", modifications[0].String())
+
+	trace := machine.Trace()
+	require.Len(t, trace, 3)
+	assert.Equal(t, []string{modifications[0].String()}, trace[1].Warnings)
+}
+
+func TestTsvetokAssembler_ChecksLiteralsFitTheWordSize(t *testing.T) {
+	for _, tc := range []struct {
+		program  string
+		format   tvm.WordFormat
+		expected []int
+		err      string
+	}{
+		{"out 2147483647", tvm.WordFormat{}, []int{104, 2147483647}, ""},
+		{"out 4294967295", tvm.WordFormat{}, []int{104, -1}, ""},
+		{"out 4294967296", tvm.WordFormat{}, nil, "literal '4294967296' does not fit in a 32-bit word"},
+		{"out 4294967295", tvm.WordFormat{Overflow: tvm.OverflowFault}, nil, "literal '4294967295' does not fit in a 32-bit word"},
+		{"out $4294967296", tvm.WordFormat{Size: tvm.WordSize64}, []int{4, 4294967296}, ""},
+		{"out 9223372036854775808", tvm.WordFormat{Size: tvm.WordSizeBig}, nil, "literal '9223372036854775808' does not fit in a 64-bit integer"},
+	} {
+		assembler := NewAssemblerFromString(tc.program)
+		assembler.SetWordFormat(tc.format)
+		program, err := assembler.Assemble()
+
+		if tc.err != "" {
+			require.Error(t, err, tc.program)
+			assert.Contains(t, err.Error(), tc.err, tc.program)
+			assert.Contains(t, err.Error(), "error on line '1'", tc.program)
+			continue
+		}
+
+		require.NoError(t, err, tc.program)
+		assert.Equal(t, tc.expected, program, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_HandlesArithmeticAndBitwiseInstructions(t *testing.T) {
+	for _, tc := range []executionTestCase{
+		{"slt 2, 3, $0\nhlt", 0, 1, "slt instruction works"},
+		{"div $4, 2, $0\nhlt", 0, 4, "div instruction works"},
+		{"mod 7, i4, $0\nhlt", 0, 3, "mod instruction works"},
+		{"and 12, 10, r0\nadd r0, 0, $0\nhlt", 0, 8, "and instruction works"},
+		{"or 12, 10, t0\nadd t0, 0, $0\nhlt", 0, 14, "or instruction works"},
+		{"xor 12, 10, $0\nhlt", 0, 6, "xor instruction works"},
+		{"not 5, $0\nhlt", 0, -6, "not instruction works"},
+		{"shl 3, 4, $0\nhlt", 0, 48, "shl instruction works"},
+		{"add 48, 0, r1\nshr r1, 4, $0\nhlt", 0, 3, "shr instruction works"},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			assembler := NewAssemblerFromString(tc.program)
+			program, err := assembler.Assemble()
+			require.NoError(t, err)
+
+			machine := tvm.NewTsvetokVirtualMachine(program)
+			require.NoError(t, machine.Execute(), fmt.Sprintf("failed execution (program was %v)", program))
+			assert.Equal(t, tc.expectedValue, machine.CopyMemory()[tc.expectedAddress])
+		})
+	}
+}
+
+func TestTsvetokAssembler_ExpandsPseudoInstructions(t *testing.T) {
+	for _, tc := range []struct {
+		program  string
+		register int
+		expected int
+	}{
+		{"sub 10, 3, r0\nhlt", tvm.RegisterReserved0, 7},
+		{"add 10, 0, r0\nsub r0, 3, r0\nhlt", tvm.RegisterReserved0, 7},
+		{"add 3, 0, r1\nsub 10, r1, r0\nhlt", tvm.RegisterReserved0, 7},
+		{"add 3, 0, r1\nsub 10, r1, r1\nhlt", tvm.RegisterReserved1, 7},
+		{"add 10, 0, r0\nadd 3, 0, r1\nsub r0, r1, r0\nhlt", tvm.RegisterReserved0, 7},
+		{"add 10, 0, r0\nsub r0, r0, r0\nhlt", tvm.RegisterReserved0, 0},
+		{"jmp start\nx: hlt\nstart: add 10, 0, $x\nadd 2, 0, r0\nsub $3, r0, $x\nmov $x, r1\nhlt", tvm.RegisterReserved1, 8},
+		{"jmp start\nx: hlt\nstart: add 10, 0, $x\nadd 2, 0, r0\nsub $(x), r0, $x\nmov $x, r1\nhlt", tvm.RegisterReserved1, 8},
+		{"jmp start\nx: hlt\n.equ y, x\nstart: add 10, 0, $x\nadd 2, 0, r0\nsub $y, r0, $x\nmov $x, r1\nhlt", tvm.RegisterReserved1, 8},
+		{"add 10, 0, $x\nadd 2, 0, r0\nsub $x, r0, $x\nmov $x, r1\nhlt\nx: hlt", tvm.RegisterReserved1, 8},
+		{"mov 42, r0\nhlt", tvm.RegisterReserved0, 42},
+		{"add 42, 0, t0\nmov t0, r0\nhlt", tvm.RegisterReserved0, 42},
+		{"add 42, 0, r0\nnil r0\nhlt", tvm.RegisterReserved0, 0},
+		{"jmp skip\nmov 1, r0\nskip: mov 2, r1\nhlt", tvm.RegisterReserved0, 0},
+		{"jif 0, skip\nmov 1, r0\nskip: hlt", tvm.RegisterReserved0, 0},
+		{"jif 1, skip\nmov 1, r0\nskip: hlt", tvm.RegisterReserved0, 1},
+	} {
+		assembler := NewAssemblerFromString(tc.program)
+		program, err := assembler.Assemble()
+		require.NoError(t, err, tc.program)
+
+		machine := tvm.NewTsvetokVirtualMachine(program)
+		require.NoError(t, machine.Execute(), tc.program)
+
+		value, err := machine.GetValueInRegisterFile(tc.register)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, value, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_ResolvesLabelsAfterExpansion(t *testing.T) {
+	program := `
+		in r0
+	loop:
+		out r0
+		sub r0, 1, r0
+		jif r0, done # jif expands to two instructions
+		jmp loop
+	done: hlt
+	`
+
+	assembler := NewAssemblerFromString(program)
+	intcode, err := assembler.Assemble()
+	require.NoError(t, err)
+	assert.Equal(t, []int{203, 0, 204, 0, 21201, 0, -1, 0, 1206, 0, 14, 1106, 1, 17, 1106, 1, 2, 9}, intcode)
+	assert.Equal(t, map[string]int{"loop": 2, "done": 17}, assembler.Listing().Labels)
+
+	machine := tvm.NewTsvetokVirtualMachine(intcode)
+	machine.SetInputInterface(tvm.MockInputInterface{NumberToReturn: 3})
+	output := &tvm.MockOutputInterface{}
+	machine.SetOutputInterface(output)
+	require.NoError(t, machine.Execute())
+	require.NotNil(t, output.LastNumberReceived)
+	assert.Equal(t, 1, *output.LastNumberReceived)
+
+	location, found := assembler.SourceMap().LocateAddress(12)
+	require.True(t, found)
+	assert.Equal(t, 6, location.Line, "both instructions of an expansion map to its line")
+}
+
+func TestTsvetokAssembler_ReportsLabelAndPseudoInstructionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		program string
+		err     string
+	}{
+		{"jmp nowhere", "undefined label 'nowhere'"},
+		{"here: hlt\nhere: hlt", "label 'here' is already defined on line '1'"},
+		{"r0: hlt", "invalid label name 'r0'"},
+		{"add: hlt", "invalid label name 'add'"},
+		{"hlt\nsub 1, 2", "'sub' expects 3 operand(s) but was given 2"},
+		{"hlt\nmov r0", "'mov' expects 2 operand(s) but was given 1"},
+		{"sub $x, r0, $y\nhlt\nx: y: hlt", "'$y' and '$x' were taken to be different addresses before their labels were defined"},
+	} {
+		_, err := NewAssemblerFromString(tc.program).Assemble()
+		require.Error(t, err, tc.program)
+		assert.Contains(t, err.Error(), tc.err, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_ListingShowsPseudoInstructionExpansions(t *testing.T) {
+	assembler := NewAssemblerFromString("start: in r0\nsub 10, r0, r1\njmp start")
+	_, err := assembler.Assemble()
+	require.NoError(t, err)
+
+	expected := "" +
+		"   0  203 0                       1  in r0\n" +
+		"                                  2  sub 10, r0, r1\n" +
+		"   2  21202 0 -1 1                     mlt r0, -1, r1\n" +
+		"   6  22101 10 1 1                     add 10, r1, r1\n" +
+		"                                  3  jmp start\n" +
+		"  10  1106 1 0                         jit 1, 0\n"
+	assert.Equal(t, expected, assembler.Listing().String())
+}
+
+func TestTsvetokAssembler_ExpandsMacros(t *testing.T) {
+	program := `
+	.macro inc x
+		add \x, 1, \x
+	.endm
+
+	.macro twice register
+		inc \register
+		inc \register
+	.endm
+
+	.macro count_down register # outputs register, register - 1, ..., 1
+	loop:
+		out \register
+		sub \register, 1, \register
+		jit \register, loop
+	.endm
+
+		in r0
+		count_down r0
+		twice r0
+		start: count_down r0
+		hlt
+	`
+
+	assembler := NewAssemblerFromString(program)
+	intcode, err := assembler.Assemble()
+	require.NoError(t, err)
+
+	output := &bytes.Buffer{}
+	machine := tvm.NewTsvetokVirtualMachine(intcode)
+	machine.SetInputInterface(tvm.MockInputInterface{NumberToReturn: 3})
+	machine.SetOutputInterface(tvm.NewWriterOutputInterface(output))
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, "3\n2\n1\n2\n1\n", output.String())
+
+	assert.Equal(t, map[string]int{"loop@1": 2, "start": 19, "loop@5": 19}, assembler.Listing().Labels)
+	location, found := assembler.SourceMap().LocateAddress(12)
+	require.True(t, found)
+	assert.Equal(t, 20, location.Line, "expanded instructions map to the line invoking the macro")
+	assert.Equal(t, 3, location.Column, "and to the column of its invocation")
+
+	symbol, found := assembler.SourceMap().Symbolize(21)
+	require.True(t, found)
+	assert.Equal(t, "start+2", symbol)
+}
+
+func TestTsvetokAssembler_ReportsMacroErrorsWithTheirInvocations(t *testing.T) {
+	for _, tc := range []struct {
+		program string
+		err     string
+	}{
+		{
+			".macro inc x\nadd \\x, 1\nbogus \\x\n.endm\nhlt\ninc r0",
+			"unknown instruction 'bogus'\nerror on line '3' in macro 'inc' invoked on line '6'",
+		},
+		{
+			".macro inc x\nbogus \\x\n.endm\n.macro twice x\ninc \\x\ninc \\x\n.endm\ntwice r0",
+			"unknown instruction 'bogus'\nerror on line '2' in macro 'inc' invoked on line '5' in macro 'twice' invoked on line '8'",
+		},
+		{
+			".macro inc x\nadd \\y, 1, \\x\n.endm\ninc r0",
+			"unknown macro parameter '\\y'\nerror on line '2' in macro 'inc' invoked on line '4'",
+		},
+		{
+			".macro inc x\nadd \\x, 1, \\x\n.endm\ninc r0, r1",
+			"macro 'inc' expects 1 argument(s) but was given 2\nerror on line '4'",
+		},
+		{
+			".macro forever\nforever\n.endm\nforever",
+			"macro recursion limit of '64' exceeded\nerror on line '2' in macro 'forever' invoked on line '2'",
+		},
+		{".macro inc x\nadd \\x, 1, \\x", "macro 'inc' is missing '.endm'\nerror on line '1'"},
+		{".macro a\n.macro b\n.endm\n.endm", "macro definitions cannot be nested (macro 'a' is still open)\nerror on line '2'"},
+		{"hlt\n.endm", "'.endm' without '.macro'\nerror on line '2'"},
+		{".macro a\n.endm\n.macro a\n.endm", "macro 'a' is already defined\nerror on line '3'"},
+		{".macro add\n.endm", "invalid macro name 'add'\nerror on line '1'"},
+		{
+			".macro spin\nloop: jmp loop\n.endm\nspin\nloop@1: hlt",
+			"invalid label name 'loop@1': '@' is reserved for labels renamed by macro expansions\nerror on line '5'",
+		},
+		{
+			".macro spin\nloop: jmp loop\n.endm\nspin\njmp loop@1",
+			"invalid label name 'loop@1': '@' is reserved for labels renamed by macro expansions\nerror on line '5'",
+		},
+		{
+			".macro spin\nagain@1: jmp again@1\n.endm\nspin",
+			"invalid label name 'again@1': '@' is reserved for labels renamed by macro expansions\nerror on line '2'",
+		},
+	} {
+		_, err := NewAssemblerFromString(tc.program).Assemble()
+		require.Error(t, err, tc.program)
+		assert.Contains(t, err.Error(), tc.err, tc.program)
+	}
+}
+
+// writeSources writes the files provided, by path relative to a new temporary directory, and returns the directory
+func writeSources(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+	for path, contents := range files {
+		path = filepath.Join(directory, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+
+	return directory
+}
+
+func TestTsvetokAssembler_IncludesFiles(t *testing.T) {
+	directory := writeSources(t, map[string]string{
+		"main.tva":           "in r0\n.include \"lib/double.tva\"\nout r0\nhlt\n",
+		"lib/double.tva":     "# doubles r0\n.include \"macros.tva\"\ndouble r0\n",
+		"include/macros.tva": ".macro double x\n\tadd \\x, \\x, \\x\n.endm\n",
+	})
+
+	assembler := NewAssemblerFromFiles(filepath.Join(directory, "main.tva"))
+	assembler.SetIncludePaths(filepath.Join(directory, "include"))
+	program, err := assembler.Assemble()
+	require.NoError(t, err)
+	assert.Equal(t, []int{203, 0, 22201, 0, 0, 0, 204, 0, 9}, program)
+
+	location, found := assembler.SourceMap().LocateAddress(3)
+	require.True(t, found)
+	assert.Equal(t, tvm.SourceLocation{File: filepath.Join(directory, "lib", "double.tva"), Line: 3, Column: 1}, location)
+}
+
+func TestTsvetokAssembler_IncludesEveryFileOnce(t *testing.T) {
+	// main.tva includes left.tva and lib/right.tva, and both include square.tva under different paths
+	directory := writeSources(t, map[string]string{
+		"main.tva":      ".include \"left.tva\"\n.include \"lib/right.tva\"\nsquare r0\nhlt\n",
+		"left.tva":      ".include \"square.tva\"\nin r0\n",
+		"lib/right.tva": ".include \"../lib/../square.tva\"\nout r0\n",
+		"square.tva":    ".macro square x\n\tmlt \\x, \\x, \\x\n.endm\nreturn: jit 1, la\n",
+	})
+
+	assembler := NewAssemblerFromFiles(filepath.Join(directory, "main.tva"), filepath.Join(directory, "square.tva"))
+	program, err := assembler.Assemble()
+	require.NoError(t, err)
+	assert.Equal(t, []int{2106, 1, 13, 203, 0, 204, 0, 22202, 0, 0, 0, 9}, program)
+}
+
+func TestTsvetokAssembler_AssemblesSeveralFilesIntoOneProgram(t *testing.T) {
+	directory := writeSources(t, map[string]string{
+		"main.tva":   "jmp main\n.include \"lib.tva\"\nmain: mov 4, r0\njmp square\nreturn: out r0\nhlt\n",
+		"lib.tva":    "# nothing but an include\n",
+		"square.tva": "square: mlt r0, r0, r0\njmp return\n",
+	})
+
+	assembler := NewAssemblerFromFiles(filepath.Join(directory, "main.tva"), filepath.Join(directory, "square.tva"))
+	program, err := assembler.Assemble()
+	require.NoError(t, err)
+
+	output := &tvm.MockOutputInterface{}
+	machine := tvm.NewTsvetokVirtualMachine(program)
+	machine.SetOutputInterface(output)
+	require.NoError(t, machine.Execute())
+	require.NotNil(t, output.LastNumberReceived)
+	assert.Equal(t, 16, *output.LastNumberReceived)
+}
+
+func TestTsvetokAssembler_ReportsIncludeErrors(t *testing.T) {
+	directory := writeSources(t, map[string]string{
+		"cycle.tva":   "hlt\n.include \"a.tva\"\n",
+		"a.tva":       ".include \"b.tva\"\n",
+		"b.tva":       "\n.include \"a.tva\"\n",
+		"missing.tva": ".include \"nowhere.tva\"\n",
+		"bad.tva":     ".include nowhere.tva\n",
+		"broken.tva":  ".include \"lib.tva\"\n",
+		"lib.tva":     "hlt\nbogus\n",
+		"twice.tva":   "here: hlt\n.include \"here.tva\"\n",
+		"here.tva":    "\nhere: hlt\n",
+	})
+
+	for _, tc := range []struct {
+		file string
+		err  string
+	}{
+		{"cycle.tva", "include cycle: a.tva -> b.tva -> a.tva"},
+		{"missing.tva", "cannot find included file 'nowhere.tva'"},
+		{"bad.tva", "expected '.include \"path\"'"},
+		{"broken.tva", fmt.Sprintf("unknown instruction 'bogus'\nerror on line '2' of '%v'", filepath.Join(directory, "lib.tva"))},
+		{"twice.tva", fmt.Sprintf("label 'here' is already defined on line '1' of '%v'", filepath.Join(directory, "twice.tva"))},
+	} {
+		_, err := NewAssemblerFromFiles(filepath.Join(directory, tc.file)).Assemble()
+		require.Error(t, err, tc.file)
+		assert.Contains(t, err.Error(), tc.err, tc.file)
+	}
+}
+
+func TestTsvetokAssembler_AssemblesRelocatableObjects(t *testing.T) {
+	assembler := NewAssemblerFromString(`
+		.global main, helper
+		.extern print, unused
+		main: jmp helper
+		helper: jif r0, print
+		hlt
+	`)
+
+	object, err := assembler.AssembleObject()
+	require.NoError(t, err)
+	assert.Equal(t, linker.Object{
+		Words:       []int{1106, 1, 3, 1206, 0, 9, 1106, 1, 0, 9},
+		Symbols:     []linker.Symbol{{Name: "main", Offset: 0, Exported: true}, {Name: "helper", Offset: 3, Exported: true}},
+		Imports:     []string{"print", "unused"},
+		Relocations: []linker.Relocation{{Offset: 2}, {Offset: 5}, {Offset: 8, Symbol: "print"}},
+	}, object)
+
+	_, err = assembler.Assemble()
+	assert.ErrorContains(t, err, "undefined label 'print'\nerror on line '5'")
+}
+
+func TestTsvetokAssembler_ReportsSymbolErrors(t *testing.T) {
+	for _, tc := range []struct {
+		assembly string
+		err      string
+	}{
+		{".global missing\nhlt", "exported label 'missing' is never defined\nerror on line '1'"},
+		{".extern", "'.extern' needs at least one label"},
+		{".global r0", "invalid label name 'r0'"},
+		{"jmp elsewhere", "undefined label 'elsewhere'"},
+	} {
+		_, err := NewAssemblerFromString(tc.assembly).AssembleObject()
+		assert.ErrorContains(t, err, tc.err, tc.assembly)
+	}
+}
+
+func TestTsvetokAssembler_EvaluatesConstantExpressions(t *testing.T) {
+	for _, tc := range []struct {
+		program  string
+		expected []int
+	}{
+		{"out 1 + 2 * 3", []int{104, 7}},
+		{"out (1 + 2) * 3", []int{104, 9}},
+		{"out 1 << 4 | 3", []int{104, 19}},
+		{"out 7 & 3", []int{104, 3}},
+		{"out 17 / 5 + 17 % 5", []int{104, 5}},
+		{"out 'A'", []int{104, 65}},
+		{"out '\\n'", []int{104, 10}},
+		{"mov ',', r0", []int{21101, 44, 0, 0}},
+		{"out i(SIZE*2)\n.equ SIZE 16", []int{104, 32}},
+		{".equ SIZE, 3\nsub r0, SIZE, r0", []int{21201, 0, -3, 0}},
+		{".equ LAST SIZE - 1\n.equ SIZE 4\nout LAST", []int{104, 3}},
+		{".set X 1\nout X\n.set X 2\nout X", []int{104, 1, 104, 2}},
+		{"out X\n.set X 5\n.set X 6", []int{104, 5}},
+		{"start: out end - start\nend: hlt", []int{104, 2, 9}},
+		{"out $buffer + 1\nbuffer: hlt", []int{4, 3, 9}},
+	} {
+		program, err := NewAssemblerFromString(tc.program).Assemble()
+		require.NoError(t, err, tc.program)
+		assert.Equal(t, tc.expected, program, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_ReportsExpressionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		program string
+		err     string
+	}{
+		{"out MISSING", "undefined label 'MISSING'"},
+		{".equ A B\n.equ B A\nout A", "cyclic definition of constant 'A' (A -> B -> A)\nerror on line '3'"},
+		{".equ A 1\n.equ A 2", "constant 'A' is already defined on line '1'"},
+		{".set A 1\n.equ A 2", "constant 'A' is already defined on line '1'"},
+		{"A: hlt\n.equ A 1", "'A' is already defined as a label"},
+		{".equ A 1\nA: hlt", "'A' is already defined as a constant on line '1'"},
+		{".equ A", "expected '.equ NAME expression'"},
+		{"out 1 +", "invalid expression '1 +': expected a number, label or '(' at the end"},
+		{"out (1", "invalid expression '(1': missing ')'"},
+		{"out 1 ~ 2", "unexpected character '~' (column 7)"},
+		{"out 1 / 0", "division by zero in expression"},
+		{"out r0 + 1", "cannot use register 'r0' in an expression"},
+		{"out 'AB'", "invalid character literal 'AB'"},
+		{".equ i 3\nout i+1", "invalid constant name 'i' ('i' is the immediate indicator"},
+		{"i: hlt", "invalid label name 'i' ('i' is the immediate indicator"},
+	} {
+		_, err := NewAssemblerFromString(tc.program).Assemble()
+		assert.ErrorContains(t, err, tc.err, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_RelocatesLabelArithmetic(t *testing.T) {
+	object, err := NewAssemblerFromString(".extern print\njmp print + 2\nstart: out end - start\nout $start + 1\nend: hlt").AssembleObject()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1106, 1, 2, 104, 4, 4, 4, 9}, object.Words)
+	assert.Equal(t, []linker.Relocation{{Offset: 2, Symbol: "print"}, {Offset: 6}}, object.Relocations)
+
+	for program, message := range map[string]string{
+		"here: jmp here * 2":               "expression cannot be relocated",
+		"here: jmp here / 2":               "cannot apply '/' to an address that is not known until the program is linked",
+		".extern a, b\njmp a + b":          "expression cannot be relocated",
+		"here: jmp here + 1\nout here * 0": "",
+	} {
+		_, err := NewAssemblerFromString(program).AssembleObject()
+		if message == "" {
+			assert.NoError(t, err, program)
+		} else {
+			assert.ErrorContains(t, err, message, program)
+		}
+	}
+}
+
+func TestTsvetokAssembler_ParsesSignedAndAlternateRadixLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		program  string
+		format   tvm.WordFormat
+		expected []int
+	}{
+		{"out -5", tvm.WordFormat{}, []int{104, -5}},
+		{"out i-5", tvm.WordFormat{}, []int{104, -5}},
+		{"out +5", tvm.WordFormat{}, []int{104, 5}},
+		{"out 0x1F", tvm.WordFormat{}, []int{104, 31}},
+		{"out i0x1f", tvm.WordFormat{}, []int{104, 31}},
+		{"out 0b101", tvm.WordFormat{}, []int{104, 5}},
+		{"out 0o17", tvm.WordFormat{}, []int{104, 15}},
+		{"out -0x10", tvm.WordFormat{}, []int{104, -16}},
+		{"out -(2 + 3) * 2", tvm.WordFormat{}, []int{104, -10}},
+		{"out $0x10", tvm.WordFormat{}, []int{4, 16}},
+		{"add -1, 0b11, r0", tvm.WordFormat{}, []int{21101, -1, 3, 0}},
+		{"sub r0, -5, r0", tvm.WordFormat{}, []int{21201, 0, 5, 0}},
+		{".equ NEGATIVE -3\nout NEGATIVE", tvm.WordFormat{}, []int{104, -3}},
+		{"out 0xFFFFFFFF", tvm.WordFormat{}, []int{104, -1}},
+		{"out -2147483648", tvm.WordFormat{Overflow: tvm.OverflowFault}, []int{104, -2147483648}},
+		{"out -0x8000000000000000", tvm.WordFormat{Size: tvm.WordSize64}, []int{104, math.MinInt64}},
+	} {
+		assembler := NewAssemblerFromString(tc.program)
+		assembler.SetWordFormat(tc.format)
+
+		program, err := assembler.Assemble()
+		require.NoError(t, err, tc.program)
+		assert.Equal(t, tc.expected, program, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_ReportsLiteralErrors(t *testing.T) {
+	for _, tc := range []struct {
+		program string
+		format  tvm.WordFormat
+		err     string
+	}{
+		{"out 0x", tvm.WordFormat{}, "invalid number literal '0x'"},
+		{"out 0b102", tvm.WordFormat{}, "invalid number literal '0b102'"},
+		{"out 12abc", tvm.WordFormat{}, "invalid number literal '12abc'"},
+		{"out 0x10000000000000000", tvm.WordFormat{}, "literal '0x10000000000000000' does not fit in a 64-bit integer"},
+		{"out 0xFFFFFFFF", tvm.WordFormat{Overflow: tvm.OverflowFault}, "literal '4294967295' does not fit in a 32-bit word"},
+		{"out -2147483649", tvm.WordFormat{Overflow: tvm.OverflowFault}, "literal '-2147483649' does not fit in a 32-bit word"},
+		{"out $-1", tvm.WordFormat{}, "address '-1' is negative"},
+		{"out $start - 10\nstart: hlt", tvm.WordFormat{}, "address '-8' is negative"},
+		{"out t$5", tvm.WordFormat{}, "invalid expression 't$5'"},
+	} {
+		assembler := NewAssemblerFromString(tc.program)
+		assembler.SetWordFormat(tc.format)
+
+		_, err := assembler.Assemble()
+		assert.ErrorContains(t, err, tc.err, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_ParsesHashesWithinLiterals(t *testing.T) {
+	directory := writeSources(t, map[string]string{
+		"main.tva":  ".include \"lib#1.tva\" # the file name has a '#'\nhlt\n",
+		"lib#1.tva": "out '#' # the character, not a comment\n",
+	})
+
+	program, err := NewAssemblerFromFiles(filepath.Join(directory, "main.tva")).Assemble()
+	require.NoError(t, err)
+	assert.Equal(t, []int{104, '#', 9}, program)
+
+	program, err = NewAssemblerFromString(".macro newline register\nadd '\\n', 0, \\register\n.endm\nnewline r1").Assemble()
+	require.NoError(t, err)
+	assert.Equal(t, []int{21101, 10, 0, 1}, program, "escapes in literals are not macro parameters")
+}
+
+func TestTsvetokAssembler_ReportsSyntaxErrorsWithTheirColumn(t *testing.T) {
+	for _, tc := range []struct {
+		program string
+		err     string
+	}{
+		{"hlt\nout \"text", "unterminated string literal (column 5)\nerror on line '2'"},
+		{"add 1,, r0", "expected an operand but found ',' (column 7)\nerror on line '1'"},
+		{"out 1 2", "invalid expression '1 2': unexpected '2' (column 7)"},
+		{"1: hlt", "expected a label, instruction or directive but found '1' (column 1)"},
+		{".macro inc x\nadd \\x, 1 2, \\x\n.endm", "invalid expression '1 2': unexpected '2' (column 11)\nerror on line '2'"},
+	} {
+		_, err := NewAssemblerFromString(tc.program).Assemble()
+		assert.ErrorContains(t, err, tc.err, tc.program)
+	}
+}
+
+func TestTsvetokAssembler_DetailedListingHasSymbolsAndCrossReferences(t *testing.T) {
+	assembler := NewAssemblerFromString("start: in r0 # read\nsub 10, r0, r1\n.equ END, done\nloop: jif r1, done\njmp loop\ndone: hlt\nunused: hlt")
+	_, err := assembler.Assemble()
+	require.NoError(t, err)
+
+	expected := "" +
+		"  ADDR  WORDS                    DECODED       LINE  SOURCE\n" +
+		"     0  203 0                    in r             1  start: in r0 # read\n" +
+		"                                                  2  sub 10, r0, r1\n" +
+		"     2  21202 0 -1 1             mlt r i r             mlt r0, -1, r1\n" +
+		"     6  22101 10 1 1             add i r r             add 10, r1, r1\n" +
+		"                                                  4  loop: jif r1, done\n" +
+		"    10  1206 1 16                jit r i               jit r1, 16\n" +
+		"    13  1106 1 19                jit i i               jit 1, 19\n" +
+		"                                                  5  jmp loop\n" +
+		"    16  1106 1 10                jit i i               jit 1, 10\n" +
+		"    19  9                        hlt              6  done: hlt\n" +
+		"    20  9                        hlt              7  unused: hlt\n" +
+		"\n" +
+		"SYMBOLS\n" +
+		"  ADDR  NAME\n" +
+		"     0  start\n" +
+		"    10  loop\n" +
+		"    19  done\n" +
+		"    20  unused\n" +
+		"\n" +
+		"CROSS-REFERENCE\n" +
+		"NAME             DEFINED          USED\n" +
+		"done             6                3, 4\n" +
+		"loop             4                5\n" +
+		"start            1                (unused)\n" +
+		"unused           7                (unused)\n"
+	assert.Equal(t, expected, assembler.Listing().Detailed())
+}
+
+func TestTsvetokAssembler_OptimizerAppliesEachRule(t *testing.T) {
+	for _, tc := range []struct {
+		program  string
+		expected []int
+		testName string
+	}{
+		{"add 2, 3, r0\nout r0\nhlt", []int{21101, 5, 0, 0, 204, 0, 9}, "folds immediate additions"},
+		{"slt 2, 3, t0\nout t0\nhlt", []int{21101, 1, 0, 5, 204, 5, 9}, "folds immediate comparisons"},
+		{"mlt 2, 3, $8\nhlt", []int{1101, 6, 0, 8, 9}, "folds into address outputs"},
+		{"mov 1, r0\nmov 2, r0\nout r0\nhlt", []int{21101, 2, 0, 0, 204, 0, 9}, "removes dead stores"},
+		{"mov 1, r0\nout r0\nmov 2, r0\nhlt", []int{21101, 1, 0, 0, 204, 0, 21101, 2, 0, 0, 9}, "keeps stores that are read"},
+		{"in r0\nadd r0, 0, r0\nmlt 1, r0, r0\nout r0\nhlt", []int{203, 0, 204, 0, 9}, "removes copies of a register to itself"},
+		{"jmp next\nnext: hlt", []int{9}, "removes jumps to the next instruction"},
+		{"in r0\njit 0, r0\nhlt", []int{203, 0, 9}, "removes jumps that never jump"},
+		{"jit 1, a\nhlt\na: jmp b\nb: out 1\nhlt", []int{1106, 1, 4, 9, 104, 1, 9}, "threads jumps to jumps"},
+		{"jit 1, a\nhlt\na: jmp routine\nroutine: out 1\njit 1, la", []int{1106, 1, 4, 9, 1106, 1, 7, 104, 1, 2106, 1, 13}, "keeps jumps whose $la is read"},
+		{"saved: mov 1, r0\nmov 2, r0\nout $saved\nhlt", []int{21101, 1, 0, 0, 21101, 2, 0, 0, 4, 0, 9}, "keeps code read as data"},
+		{"mov 1, r0\nmov 2, r0\njit 1, 8\nhlt", []int{21101, 1, 0, 0, 21101, 2, 0, 0, 1106, 1, 8, 9}, "keeps code in place around literal addresses"},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			assembler := NewAssemblerFromString(tc.program)
+			assembler.SetOptimization(true)
+			program, err := assembler.Assemble()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, program)
+		})
+	}
+}
+
+// assembleForFormat assembles the program provided for the word format provided, with or without optimization
+func assembleForFormat(t *testing.T, program string, format tvm.WordFormat, optimize bool) []int {
+	assembler := NewAssemblerFromString(program)
+	assembler.SetWordFormat(format)
+	assembler.SetOptimization(optimize)
+	assembled, err := assembler.Assemble()
+	require.NoError(t, err)
+	return assembled
+}
+
+// runForFormat runs the program provided on a machine with the word format provided, and describes how it ended:
+// the last number it output, or the fault it stopped with
+func runForFormat(t *testing.T, program []int, format tvm.WordFormat) string {
+	machine := tvm.NewTsvetokVirtualMachine(program)
+	require.NoError(t, machine.SetWordFormat(format))
+	machine.SetInputInterface(tvm.MockInputInterface{NumberToReturn: 3})
+	output := &tvm.MockOutputInterface{}
+	machine.SetOutputInterface(output)
+	if err := machine.Execute(); err != nil {
+		return err.Error()
+	}
+
+	require.NotNil(t, output.LastNumberReceived)
+	return fmt.Sprint(*output.LastNumberReceived)
+}
+
+func TestTsvetokAssembler_OptimizerFoldsConstantsAsTheMachineComputesThem(t *testing.T) {
+	for _, size := range []tvm.WordSize{tvm.WordSize32, tvm.WordSize64, tvm.WordSizeBig} {
+		for _, overflow := range []tvm.Overflow{tvm.OverflowWrap, tvm.OverflowSaturate, tvm.OverflowFault} {
+			format := tvm.WordFormat{Size: size, Overflow: overflow}
+			largest := math.MaxInt64
+			if size == tvm.WordSize32 {
+				largest = math.MaxInt32
+			}
+
+			for _, operation := range []string{"add %v, 1, r0", "mlt %v, 2, r0"} {
+				program := fmt.Sprintf(operation, largest) + "\nout r0\nhlt"
+				t.Run(fmt.Sprintf("%v/%v %v", size, overflow, program), func(t *testing.T) {
+					original := assembleForFormat(t, program, format, false)
+					optimized := assembleForFormat(t, program, format, true)
+
+					folded := optimized[2] == 0
+					assert.Equal(t, size != tvm.WordSizeBig && overflow != tvm.OverflowFault, folded,
+						"only results the machine computes without faulting or widening are folded")
+					assert.Equal(t, runForFormat(t, original, format), runForFormat(t, optimized, format))
+				})
+			}
+		}
+	}
+}
+
+func TestTsvetokAssembler_OptimizerKeepsDeadStoresThatMayFault(t *testing.T) {
+	wrap, fault := tvm.WordFormat{}, tvm.WordFormat{Overflow: tvm.OverflowFault}
+	for _, tc := range []struct {
+		store  string
+		format tvm.WordFormat
+		kept   bool
+	}{
+		{"add r0, 1, r1", wrap, false},
+		{"add r0, 1, r1", fault, true},
+		{"mlt r0, r0, r1", fault, true},
+		{"add 2147483647, 1, r1", fault, true},
+		{"and r0, 1, r1", fault, false},
+		{"shl 1, 3, r1", wrap, false},
+		{"shl 1, 32, r1", wrap, true},
+		{"shl 1, r0, r1", wrap, true},
+		{"shr r0, r0, r1", wrap, true},
+		{"add $end, 1, r1", wrap, true},
+	} {
+		program := fmt.Sprintf("in r0\n%v\nmov r0, r1\nout r1\nend: hlt", tc.store)
+		t.Run(fmt.Sprintf("%v %v", tc.format, tc.store), func(t *testing.T) {
+			original := assembleForFormat(t, program, tc.format, false)
+			optimized := assembleForFormat(t, program, tc.format, true)
+
+			assert.Equal(t, tc.kept, len(optimized) == len(original))
+			assert.Equal(t, runForFormat(t, original, tc.format), runForFormat(t, optimized, tc.format))
+		})
+	}
+}
+
+func TestTsvetokAssembler_OptimizerMovesLabelsWithTheirInstructions(t *testing.T) {
+	source := `
+	in r0
+	mov 0, r1 # overwritten straight away
+	mov r0, r1
+loop:
+	out r1
+	add r1, 0, r1
+	sub r1, 1, r1
+	jif r1, done
+	jmp loop
+done:
+	hlt
+`
+
+	run := func(optimize bool) ([]int, Listing) {
+		assembler := NewAssemblerFromString(source)
+		assembler.SetOptimization(optimize)
+		program, err := assembler.Assemble()
+		require.NoError(t, err)
+
+		machine := tvm.NewTsvetokVirtualMachine(program)
+		machine.SetInputInterface(tvm.MockInputInterface{NumberToReturn: 3})
+		output := &tvm.MockOutputInterface{}
+		machine.SetOutputInterface(output)
+		require.NoError(t, machine.Execute())
+		require.NotNil(t, output.LastNumberReceived)
+		assert.Equal(t, 1, *output.LastNumberReceived)
+		return program, assembler.Listing()
+	}
+
+	original, _ := run(false)
+	optimized, listing := run(true)
+	assert.Less(t, len(optimized), len(original))
+	assert.Equal(t, []int{203, 0, 21201, 0, 0, 1, 204, 1, 21201, 1, -1, 1, 1206, 1, 6, 1106, 1, 21, 1106, 1, 6, 9}, optimized)
+	assert.Equal(t, map[string]int{"loop": 6, "done": 21}, listing.Labels)
+	assert.Empty(t, listing.Entries[1].Instructions, "the dead store is listed without instructions")
+}
+
+func TestTsvetokAssembler_ReportsErrorLocationsAndReadsOverlays(t *testing.T) {
+	directory := writeSources(t, map[string]string{
+		"main.tva": ".include \"lib.tva\"\nhlt\n",
+		"lib.tva":  "out 1\n",
+	})
+
+	assembler := NewAssemblerFromFiles(filepath.Join(directory, "main.tva"))
+	assembler.SetOverlay(map[string]string{filepath.Join(directory, "lib.tva"): "out 1\n  bogus r0\n"})
+	_, err := assembler.Assemble()
+
+	var lineErr LineErr
+	require.ErrorAs(t, err, &lineErr)
+	assert.Equal(t, tvm.SourceLocation{File: filepath.Join(directory, "lib.tva"), Line: 2, Column: 3}, lineErr.Location)
+	assert.EqualError(t, lineErr.Err, "unknown instruction 'bogus'")
+}
@@ -0,0 +1,285 @@
+package cfg
+
+import (
+	"slices"
+	"sort"
+)
+
+// Loop is a natural loop: a header that dominates the blocks of the loop, and the blocks that can run on into one
+// of the back edges to the header without passing through it
+type Loop struct {
+	Header *Block
+
+	// Blocks holds every block of the loop, the header included, ordered by address
+	Blocks []*Block
+
+	// BackEdges holds the edges from the loop's blocks back to the header
+	BackEdges []*Edge
+}
+
+// Reachable returns every block control can reach from the entry, following jumps, fall-through and returns,
+// ordered by address
+func (g *Graph) Reachable() []*Block {
+	reached := g.reached()
+	var blocks []*Block
+	for _, block := range g.Blocks {
+		if reached[block] {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks
+}
+
+// Unreachable returns every block control cannot reach from the entry, ordered by address. Code only reached by
+// jumps whose targets are computed at run time is unreachable as far as the graph can tell
+func (g *Graph) Unreachable() []*Block {
+	reached := g.reached()
+	var blocks []*Block
+	for _, block := range g.Blocks {
+		if !reached[block] {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks
+}
+
+func (g *Graph) reached() map[*Block]bool {
+	reached := map[*Block]bool{}
+	if g.Entry() == nil {
+		return reached
+	}
+
+	pending := []*Block{g.Entry()}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if reached[block] {
+			continue
+		}
+
+		reached[block] = true
+		for _, edge := range block.Successors {
+			pending = append(pending, edge.To)
+		}
+	}
+
+	return reached
+}
+
+// flowSuccessors returns the blocks control passes to from the block provided within the routine holding it: a
+// call runs on into the block after it once the routine it calls returns, and returns leave the routine
+func (g *Graph) flowSuccessors(block *Block) []*Block {
+	if g.calls[block] != nil {
+		if after := g.starts[block.End()]; after != nil {
+			return []*Block{after}
+		}
+
+		return nil
+	}
+
+	var successors []*Block
+	for _, edge := range block.Successors {
+		if edge.Kind != EdgeReturn {
+			successors = append(successors, edge.To)
+		}
+	}
+
+	return successors
+}
+
+// dominators returns the immediate dominator of every block control can reach from the entry or the start of a
+// routine, following control within routines (see flowSuccessors.) The entry and the start of every routine are
+// dominated by none, and map to nil
+func (g *Graph) dominators() map[*Block]*Block {
+	// Blocks are numbered by their index, with a virtual root numbered len(g.Blocks) that precedes every root
+	root := len(g.Blocks)
+	successors := make([][]int, root+1)
+	predecessors := make([][]int, root+1)
+	link := func(from, to int) {
+		successors[from] = append(successors[from], to)
+		predecessors[to] = append(predecessors[to], from)
+	}
+
+	if g.Entry() != nil {
+		link(root, g.Entry().Index)
+	}
+
+	for _, block := range g.Blocks {
+		if callee := g.calls[block]; callee != nil && !slices.Contains(successors[root], callee.Index) {
+			link(root, callee.Index)
+		}
+
+		for _, successor := range g.flowSuccessors(block) {
+			link(block.Index, successor.Index)
+		}
+	}
+
+	// The order blocks are finished in by a depth-first search from the root
+	postorder := make([]int, root+1)
+	for index := range postorder {
+		postorder[index] = -1
+	}
+
+	var order []int
+	var visit func(node int)
+	visited := make([]bool, root+1)
+	visit = func(node int) {
+		visited[node] = true
+		for _, successor := range successors[node] {
+			if !visited[successor] {
+				visit(successor)
+			}
+		}
+
+		postorder[node] = len(order)
+		order = append(order, node)
+	}
+
+	visit(root)
+
+	// This is the iterative algorithm of Cooper, Harvey and Kennedy ("A Simple, Fast Dominance Algorithm")
+	idom := make([]int, root+1)
+	for index := range idom {
+		idom[index] = -1
+	}
+
+	idom[root] = root
+	intersect := func(left, right int) int {
+		for left != right {
+			for postorder[left] < postorder[right] {
+				left = idom[left]
+			}
+
+			for postorder[right] < postorder[left] {
+				right = idom[right]
+			}
+		}
+
+		return left
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for index := len(order) - 2; index >= 0; index-- {
+			node := order[index]
+			dominator := -1
+			for _, predecessor := range predecessors[node] {
+				if idom[predecessor] == -1 {
+					continue
+				}
+
+				if dominator == -1 {
+					dominator = predecessor
+				} else {
+					dominator = intersect(predecessor, dominator)
+				}
+			}
+
+			if idom[node] != dominator {
+				idom[node] = dominator
+				changed = true
+			}
+		}
+	}
+
+	dominators := map[*Block]*Block{}
+	for _, block := range g.Blocks {
+		switch idom[block.Index] {
+		case -1:
+		case root:
+			dominators[block] = nil
+		default:
+			dominators[block] = g.Blocks[idom[block.Index]]
+		}
+	}
+
+	return dominators
+}
+
+// Loops returns the natural loops of the program, ordered by the address of their headers. Loops are found within
+// routines, so a routine called from a loop is not part of it. Loops sharing a header are merged
+func (g *Graph) Loops() []Loop {
+	dominators := g.dominators()
+	dominates := func(header, block *Block) bool {
+		for ; block != nil; block = dominators[block] {
+			if block == header {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	loops := map[*Block]*Loop{}
+	for _, block := range g.Blocks {
+		if _, reachable := dominators[block]; !reachable {
+			continue
+		}
+
+		for _, successor := range g.flowSuccessors(block) {
+			if !dominates(successor, block) {
+				continue
+			}
+
+			loop := loops[successor]
+			if loop == nil {
+				loop = &Loop{Header: successor}
+				loops[successor] = loop
+			}
+
+			loop.BackEdges = append(loop.BackEdges, g.flowEdge(block, successor))
+		}
+	}
+
+	predecessors := map[*Block][]*Block{}
+	for _, block := range g.Blocks {
+		for _, successor := range g.flowSuccessors(block) {
+			predecessors[successor] = append(predecessors[successor], block)
+		}
+	}
+
+	var found []Loop
+	for header, loop := range loops {
+		members := map[*Block]bool{header: true}
+		var pending []*Block
+		for _, edge := range loop.BackEdges {
+			pending = append(pending, edge.From)
+		}
+
+		for len(pending) > 0 {
+			block := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if _, reachable := dominators[block]; members[block] || !reachable {
+				continue
+			}
+
+			members[block] = true
+			pending = append(pending, predecessors[block]...)
+		}
+
+		for _, block := range g.Blocks {
+			if members[block] {
+				loop.Blocks = append(loop.Blocks, block)
+			}
+		}
+
+		found = append(found, *loop)
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Header.Start() < found[j].Header.Start() })
+	return found
+}
+
+// flowEdge returns the edge from one block to another that flowSuccessors follows. There is no edge in the graph
+// from a call to the block after it, so one is made up
+func (g *Graph) flowEdge(from, to *Block) *Edge {
+	for _, edge := range from.Successors {
+		if edge.To == to && edge.Kind != EdgeReturn {
+			return edge
+		}
+	}
+
+	return &Edge{from, to, EdgeFallThrough}
+}
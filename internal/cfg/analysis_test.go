@@ -0,0 +1,65 @@
+package cfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func names(blocks []*Block) []string {
+	described := []string{}
+	for _, block := range blocks {
+		described = append(described, block.Name())
+	}
+
+	return described
+}
+
+func TestLoops_FindsNestedLoopsWithinRoutines(t *testing.T) {
+	source := `
+	in r0
+outer:
+	mov 3, r1
+inner:
+	jit 1, print
+	sub r1, 1, r1
+	jit r1, inner
+	sub r0, 1, r0
+	jit r0, outer
+	hlt
+print:
+	out r1
+	jit 1, la
+`
+
+	g := build(t, source)
+	loops := g.Loops()
+	require.Len(t, loops, 2)
+
+	assert.Equal(t, "outer", loops[0].Header.Name())
+	assert.Equal(t, []string{"outer", "inner", "address 9", "address 16"}, names(loops[0].Blocks))
+	require.Len(t, loops[0].BackEdges, 1)
+	assert.Equal(t, "address 16", loops[0].BackEdges[0].From.Name())
+
+	assert.Equal(t, "inner", loops[1].Header.Name())
+	assert.Equal(t, []string{"inner", "address 9"}, names(loops[1].Blocks))
+}
+
+func TestUnreachable_ListsBlocksControlCannotReach(t *testing.T) {
+	g := build(t, "jit 1, end\nout 1\nend: hlt\nout 2\n")
+
+	assert.Equal(t, []string{"address 0", "end"}, names(g.Reachable()))
+	assert.Equal(t, []string{"address 3", "address 6"}, names(g.Unreachable()))
+	assert.Empty(t, g.Loops())
+}
+
+func TestFromMemory_DecodesOnlyWhatControlReaches(t *testing.T) {
+	// jit 1, 5; .word 99; hlt; jit 1, 8; out 7; jit 1, la
+	memory := []int{1106, 1, 8, 9, 99, 1106, 1, 8, 104, 7, 2106, 1, 13}
+	g := FromMemory(memory, map[int][]string{8: {"print"}})
+
+	assert.Equal(t, []string{"address 0", "address 3", "print"}, names(g.Blocks))
+	assert.Equal(t, g.BlockAt(8), g.Callee(g.Entry()))
+	assert.Equal(t, []string{"address 0 -jump-> print", "print -return-> address 3"}, edges(g))
+}
@@ -0,0 +1,366 @@
+// Package cfg builds the control-flow graph of a TVM program: its basic blocks and the ways control passes between
+// them. Since jit sets $la to the address after it, a jit through $la returns to the instruction after the last jit
+// that ran, and the graph follows those returns as edges too
+package cfg
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"tvm/internal/assembler"
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// EdgeKind is the way control passes from one block to another
+type EdgeKind int
+
+const (
+	// EdgeFallThrough runs on from the end of a block into the block after it
+	EdgeFallThrough EdgeKind = iota
+
+	// EdgeJump is a jit whose target is known jumping
+	EdgeJump
+
+	// EdgeReturn is a jit through $la returning to the block after the jit that set $la
+	EdgeReturn
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeFallThrough:
+		return "fall-through"
+	case EdgeJump:
+		return "jump"
+	case EdgeReturn:
+		return "return"
+	default:
+		return "unknown"
+	}
+}
+
+// Edge is a way control may pass from one block to another
+type Edge struct {
+	From, To *Block
+	Kind     EdgeKind
+}
+
+// Block is a basic block: a run of instructions that control only enters at the first and leaves after the last
+type Block struct {
+	// Index is the block's position in its graph's Blocks
+	Index        int
+	Labels       []string
+	Instructions []Instruction
+
+	Successors   []*Edge
+	Predecessors []*Edge
+}
+
+// Start returns the address of the block's first instruction
+func (b *Block) Start() int {
+	return b.Instructions[0].Address
+}
+
+// End returns the address just after the block's last instruction
+func (b *Block) End() int {
+	return b.Last().End()
+}
+
+// Last returns the instruction that ends the block
+func (b *Block) Last() Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Name returns the block's first label, or its address if it has none
+func (b *Block) Name() string {
+	if len(b.Labels) > 0 {
+		return b.Labels[0]
+	}
+
+	return fmt.Sprintf("address %v", b.Start())
+}
+
+// Returns returns true if the block ends in a return from a routine: a jit through $la, or through a copy of $la
+// that a return edge leaves from
+func (b *Block) Returns() bool {
+	if b.Last().IsReturn() {
+		return true
+	}
+
+	for _, edge := range b.Successors {
+		if edge.Kind == EdgeReturn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Program is the code a graph is built from
+type Program struct {
+	Instructions []Instruction
+
+	// Labels lists the labels at every address
+	Labels map[int][]string
+
+	// Unresolved holds the addresses of words whose values are only known once the program is linked, such as
+	// addresses of labels imported from other objects
+	Unresolved map[int]bool
+}
+
+// Graph is the control-flow graph of a program. Control enters it at address 0
+type Graph struct {
+	// Blocks holds every block, ordered by address
+	Blocks []*Block
+
+	starts     map[int]*Block
+	unresolved map[int]bool
+
+	// calls maps every block ending in a call to the block it calls
+	calls map[*Block]*Block
+}
+
+// FromObject builds the graph of an object assembled by the assembler, using its listing to tell instructions apart
+// from data
+func FromObject(object linker.Object, listing assembler.Listing) *Graph {
+	program := Program{Labels: map[int][]string{}, Unresolved: map[int]bool{}}
+	for _, entry := range listing.Entries {
+		for _, listed := range entry.Instructions {
+			program.Instructions = append(program.Instructions, Instruction{listed.Address, listed.Words})
+		}
+	}
+
+	for _, symbol := range object.Symbols {
+		program.Labels[symbol.Offset] = append(program.Labels[symbol.Offset], symbol.Name)
+	}
+
+	for _, relocation := range object.Relocations {
+		if relocation.Symbol != "" {
+			program.Unresolved[relocation.Offset] = true
+		}
+	}
+
+	return New(program)
+}
+
+// New builds the graph of the program provided. A block starts at every label, every known jump target and after
+// every jit or hlt
+func New(program Program) *Graph {
+	instructions := append([]Instruction{}, program.Instructions...)
+	sort.Slice(instructions, func(i, j int) bool { return instructions[i].Address < instructions[j].Address })
+
+	g := &Graph{starts: map[int]*Block{}, unresolved: program.Unresolved, calls: map[*Block]*Block{}}
+	if g.unresolved == nil {
+		g.unresolved = map[int]bool{}
+	}
+
+	leaders := map[int]bool{}
+	for address := range program.Labels {
+		leaders[address] = true
+	}
+
+	for _, instruction := range instructions {
+		if target, known := g.JumpTarget(instruction); known {
+			leaders[target] = true
+		}
+	}
+
+	var current *Block
+	for index, instruction := range instructions {
+		previous := index > 0 && instructions[index-1].End() == instruction.Address && current != nil
+		if !previous || leaders[instruction.Address] || ends(current.Last()) {
+			current = &Block{Index: len(g.Blocks), Labels: program.Labels[instruction.Address]}
+			g.Blocks = append(g.Blocks, current)
+			g.starts[instruction.Address] = current
+		}
+
+		current.Instructions = append(current.Instructions, instruction)
+	}
+
+	for _, block := range g.Blocks {
+		last := block.Last()
+		if last.IsJump() {
+			if target, known := g.JumpTarget(last); known && g.starts[target] != nil {
+				g.connect(block, g.starts[target], EdgeJump)
+			}
+		}
+
+		if next := g.starts[block.End()]; next != nil && g.fallsThrough(last) {
+			g.connect(block, next, EdgeFallThrough)
+		}
+	}
+
+	g.connectReturns()
+	return g
+}
+
+// ends returns true for instructions that end a block
+func ends(i Instruction) bool {
+	return i.IsJump() || i.OpCode() == 9
+}
+
+// fallsThrough returns true if the instruction after the one provided may run straight after it, without a routine
+// returning to it
+func (g *Graph) fallsThrough(i Instruction) bool {
+	return i.OpCode() != 9 && (!i.IsJump() || !g.Unconditional(i))
+}
+
+func (g *Graph) connect(from, to *Block, kind EdgeKind) {
+	for _, edge := range from.Successors {
+		if edge.To == to && edge.Kind == kind {
+			return
+		}
+	}
+
+	edge := &Edge{from, to, kind}
+	from.Successors = append(from.Successors, edge)
+	to.Predecessors = append(to.Predecessors, edge)
+}
+
+// location is a register or word of memory, as named by a parameter in register or address mode
+type location struct {
+	format  tvm.ParamFormat
+	operand int
+}
+
+// target returns where a jit whose target is not an immediate reads its target from
+func target(jump Instruction) location {
+	format, operand := jump.Param(1)
+	return location{format, operand}
+}
+
+// connectReturns adds an edge from every jit through $la, or through a copy of it, to the block after the jit that
+// set it. Routines that make jumps of their own must copy $la before them to return. A jit that always jumps to a
+// known target that then returns, or tries to return after losing $la, is a call. Calls are stepped over while
+// looking for returns, so the search repeats until it finds no new calls
+func (g *Graph) connectReturns() {
+	for found := true; found; {
+		found = false
+		for _, site := range g.Blocks {
+			last := site.Last()
+			after := g.starts[site.End()]
+			if _, known := g.JumpTarget(last); !known {
+				continue
+			}
+
+			for _, edge := range site.Successors {
+				if edge.Kind == EdgeJump && g.connectReturnsTo(edge.To, after) && g.Unconditional(last) && g.calls[site] == nil {
+					g.calls[site] = edge.To
+					found = true
+				}
+			}
+		}
+	}
+}
+
+// search is a point a search for returns has reached: a block, whether $la still holds the address the search
+// returns to, and where copies of that address are held
+type search struct {
+	block *Block
+	valid bool
+	saved []location
+}
+
+// connectReturnsTo adds a return edge to the block after from every jit through $la or a copy of it reached from
+// the block provided, and returns true if any jit through $la is reached, whether or not another jit has
+// overwritten it on the way. There is no block after a call at the end of the code, and so no edge to add
+func (g *Graph) connectReturnsTo(start, after *Block) bool {
+	returns := false
+	visited := map[string]bool{}
+	pending := []search{{start, true, nil}}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		key := fmt.Sprint(current.block.Index, current.valid, current.saved)
+		if visited[key] {
+			continue
+		}
+
+		visited[key] = true
+		saved := current.saved
+		for _, instruction := range current.block.Instructions {
+			copied := instruction.CopiedParam()
+			if !current.valid || copied < 0 || instruction.Register(copied) != tvm.RegisterLastAddress {
+				continue
+			}
+
+			output := instruction.Output()
+			if format, operand := instruction.Param(output); format != tvm.ParamFormatImmediate && !g.unresolved[instruction.Address+1+output] {
+				saved = append(append([]location{}, saved...), location{format, operand})
+			}
+		}
+
+		last := current.block.Last()
+		switch {
+		case last.OpCode() == 9:
+		case !last.IsJump():
+			for _, edge := range current.block.Successors {
+				pending = append(pending, search{edge.To, current.valid, saved})
+			}
+		case last.IsReturn() || slices.Contains(saved, target(last)):
+			returns = true
+			if after != nil && (current.valid || !last.IsReturn()) {
+				g.connect(current.block, after, EdgeReturn)
+			}
+
+			// A jit that does not jump leaves $la as it was
+			if next := g.starts[last.End()]; next != nil && !g.Unconditional(last) {
+				pending = append(pending, search{next, current.valid, saved})
+			}
+		case g.calls[current.block] != nil:
+			if next := g.starts[last.End()]; next != nil {
+				pending = append(pending, search{next, false, saved})
+			}
+		default:
+			for _, edge := range current.block.Successors {
+				pending = append(pending, search{edge.To, current.valid && edge.Kind == EdgeFallThrough, saved})
+			}
+		}
+	}
+
+	return returns
+}
+
+// Entry returns the block control enters the program at, or nil if there is no instruction at address 0
+func (g *Graph) Entry() *Block {
+	return g.starts[0]
+}
+
+// BlockAt returns the block starting at the address provided, or nil if none does
+func (g *Graph) BlockAt(address int) *Block {
+	return g.starts[address]
+}
+
+// BlockContaining returns the block holding the instruction at the address provided, or nil if none does
+func (g *Graph) BlockContaining(address int) *Block {
+	index := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].End() > address })
+	if index == len(g.Blocks) || g.Blocks[index].Start() > address {
+		return nil
+	}
+
+	return g.Blocks[index]
+}
+
+// Callee returns the block the jit ending the block provided calls, or nil if it is not a call. A call is a jit to a
+// known target that may return through $la to the instruction after the jit
+func (g *Graph) Callee(site *Block) *Block {
+	return g.calls[site]
+}
+
+// JumpTarget returns the address a jit jumps to, and false if it is only known at run time
+func (g *Graph) JumpTarget(jump Instruction) (int, bool) {
+	if !jump.IsJump() {
+		return 0, false
+	}
+
+	format, target := jump.Param(1)
+	return target, format == tvm.ParamFormatImmediate && !g.unresolved[jump.Address+2]
+}
+
+// Unconditional returns true if a jit always jumps
+func (g *Graph) Unconditional(jump Instruction) bool {
+	format, condition := jump.Param(0)
+	return format == tvm.ParamFormatImmediate && condition != 0 && !g.unresolved[jump.Address+1]
+}
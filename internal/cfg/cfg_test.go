@@ -0,0 +1,97 @@
+package cfg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/assembler"
+)
+
+func build(t *testing.T, source string) *Graph {
+	a := assembler.NewAssemblerFromString(source)
+	object, err := a.AssembleObject()
+	require.NoError(t, err)
+
+	return FromObject(object, a.Listing())
+}
+
+// edges describes every edge of the graph as "from -kind-> to", naming blocks by their first label or address
+func edges(g *Graph) []string {
+	described := []string{}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			described = append(described, fmt.Sprintf("%v -%v-> %v", block.Name(), edge.Kind, edge.To.Name()))
+		}
+	}
+
+	return described
+}
+
+func TestNew_SplitsBlocksAtLabelsJumpTargetsAndJumps(t *testing.T) {
+	g := build(t, "in r0\nloop: out r0\nsub r0, 1, r0\njit r0, loop\nhlt\n")
+
+	require.Len(t, g.Blocks, 3)
+	assert.Equal(t, g.Blocks[0], g.Entry())
+	assert.Equal(t, 2, g.Blocks[1].Start())
+	assert.Equal(t, []string{"loop"}, g.Blocks[1].Labels)
+	assert.Equal(t, "jit r0, 2", g.Blocks[1].Last().String())
+	assert.Equal(t, g.Blocks[1], g.BlockContaining(9))
+	assert.Nil(t, g.BlockAt(9))
+
+	assert.Equal(t, []string{
+		"address 0 -fall-through-> loop",
+		"loop -jump-> loop",
+		"loop -fall-through-> address 11",
+	}, edges(g))
+}
+
+func TestNew_ReturnsThroughLastAddressToTheCaller(t *testing.T) {
+	g := build(t, "jit 1, square\nout t0\njit 1, square\nhlt\nsquare: mlt t0, t0, t0\njit 1, la\n")
+
+	assert.Equal(t, []string{
+		"address 0 -jump-> square",
+		"address 3 -jump-> square",
+		"square -return-> address 3",
+		"square -return-> address 8",
+	}, edges(g))
+
+	assert.Equal(t, g.BlockAt(9), g.Callee(g.Blocks[0]))
+	assert.True(t, g.BlockAt(9).Returns())
+}
+
+func TestNew_ReturnsThroughCopiesOfLastAddress(t *testing.T) {
+	source := `
+	jit 1, outer
+	hlt
+outer:
+	mov la, $saved
+	jit 1, inner
+	jit 1, $saved
+inner:
+	jit 1, la
+saved:
+	hlt
+`
+
+	g := build(t, source)
+	outer, inner := g.BlockAt(4), g.BlockAt(14)
+	assert.Equal(t, outer, g.Callee(g.Blocks[0]))
+	assert.Equal(t, inner, g.Callee(outer))
+	assert.Equal(t, []string{
+		"address 0 -jump-> outer",
+		"outer -jump-> inner",
+		"address 11 -return-> address 3",
+		"inner -return-> address 11",
+	}, edges(g))
+}
+
+func TestNew_CallsThatLoseTheirReturnAddressHaveNoReturnEdge(t *testing.T) {
+	g := build(t, "jit 1, routine\nhlt\nroutine: jit 1, helper\njit 1, la\nhelper: jit 1, la\n")
+
+	routine := g.BlockAt(4)
+	assert.Equal(t, routine, g.Callee(g.Blocks[0]))
+	assert.Empty(t, g.BlockAt(3).Predecessors)
+}
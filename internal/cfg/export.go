@@ -0,0 +1,124 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// describe returns the lines a block is drawn with: its labels, or its address if it has none, followed by every
+// instruction with its address
+func (b *Block) describe() []string {
+	var lines []string
+	for _, label := range b.Labels {
+		lines = append(lines, label+":")
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, fmt.Sprintf("address %v", b.Start()))
+	}
+
+	for _, instruction := range b.Instructions {
+		lines = append(lines, fmt.Sprintf("%v: %v", instruction.Address, instruction))
+	}
+
+	return lines
+}
+
+// highlights returns the headers of the graph's loops and its unreachable blocks, which both exports draw apart
+func (g *Graph) highlights() (map[*Block]bool, map[*Block]bool) {
+	headers := map[*Block]bool{}
+	for _, loop := range g.Loops() {
+		headers[loop.Header] = true
+	}
+
+	unreachable := map[*Block]bool{}
+	for _, block := range g.Unreachable() {
+		unreachable[block] = true
+	}
+
+	return headers, unreachable
+}
+
+// DOT returns the graph in the Graphviz DOT language. Blocks are boxes listing their instructions; jumps are drawn
+// bold, fall-through plain and returns dashed. Loop headers have a double border, and unreachable blocks are grey
+func (g *Graph) DOT() string {
+	headers, unreachable := g.highlights()
+
+	builder := &strings.Builder{}
+	builder.WriteString("digraph cfg {\n")
+	builder.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, block := range g.Blocks {
+		label := ""
+		for _, line := range block.describe() {
+			label += dotEscape(line) + `\l`
+		}
+
+		attributes := []string{fmt.Sprintf("label=\"%v\"", label)}
+		if headers[block] {
+			attributes = append(attributes, "peripheries=2")
+		}
+
+		if unreachable[block] {
+			attributes = append(attributes, "style=filled", "fillcolor=lightgrey", "fontcolor=grey40")
+		}
+
+		fmt.Fprintf(builder, "\tb%v [%v];\n", block.Index, strings.Join(attributes, ", "))
+	}
+
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			style := map[EdgeKind]string{EdgeJump: " [style=bold]", EdgeReturn: " [style=dashed]"}[edge.Kind]
+			fmt.Fprintf(builder, "\tb%v -> b%v%v;\n", edge.From.Index, edge.To.Index, style)
+		}
+	}
+
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// Mermaid returns the graph as a Mermaid flowchart. Blocks are boxes listing their instructions; jumps are drawn
+// thick, fall-through plain and returns dotted. Loop headers have a thick border, and unreachable blocks are grey
+func (g *Graph) Mermaid() string {
+	headers, unreachable := g.highlights()
+
+	builder := &strings.Builder{}
+	builder.WriteString("flowchart TD\n")
+	for _, block := range g.Blocks {
+		lines := block.describe()
+		for index, line := range lines {
+			lines[index] = mermaidEscape(line)
+		}
+
+		fmt.Fprintf(builder, "    b%v[\"%v\"]\n", block.Index, strings.Join(lines, "<br/>"))
+	}
+
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			arrow := map[EdgeKind]string{EdgeFallThrough: "-->", EdgeJump: "==>", EdgeReturn: "-.->"}[edge.Kind]
+			fmt.Fprintf(builder, "    b%v %v b%v\n", edge.From.Index, arrow, edge.To.Index)
+		}
+	}
+
+	builder.WriteString("    classDef loop stroke-width:3px\n")
+	builder.WriteString("    classDef unreachable fill:#ddd,color:#777\n")
+	for _, block := range g.Blocks {
+		if headers[block] {
+			fmt.Fprintf(builder, "    class b%v loop\n", block.Index)
+		}
+
+		if unreachable[block] {
+			fmt.Fprintf(builder, "    class b%v unreachable\n", block.Index)
+		}
+	}
+
+	return builder.String()
+}
+
+func dotEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// mermaidEscape escapes the characters Mermaid would otherwise read as markup
+func mermaidEscape(text string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(text)
+}
@@ -0,0 +1,98 @@
+package cfg
+
+import (
+	"sort"
+
+	"tvm/internal/assembler"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// FromAssembler assembles a program and builds its graph (see FromObject)
+func FromAssembler(a *assembler.TsvetokAssembler) (*Graph, error) {
+	object, err := a.AssembleObject()
+	if err != nil {
+		return nil, err
+	}
+
+	return FromObject(object, a.Listing()), nil
+}
+
+// FromImage builds the graph of a TVM image (see FromMemory), with the labels of its debug information if it has
+// any
+func FromImage(image tvm.Image) *Graph {
+	memory := make([]int, image.MemorySize())
+	for _, section := range image.Sections {
+		if section.Start >= 0 {
+			copy(memory[section.Start:], section.Words)
+		}
+	}
+
+	labels := map[int][]string{}
+	if image.Debug != nil {
+		for name, address := range image.Debug.Labels {
+			labels[address] = append(labels[address], name)
+		}
+
+		for _, names := range labels {
+			sort.Strings(names)
+		}
+	}
+
+	return FromMemory(memory, labels)
+}
+
+// FromMemory builds the graph of the code in memory provided. Without a listing, instructions cannot be told apart
+// from data, so only the instructions control can reach from address 0 are decoded, by following fall-through,
+// jumps whose targets are known, and returns from calls. Decoding stops at words that are not instructions
+func FromMemory(memory []int, labels map[int][]string) *Graph {
+	decoded := map[int]Instruction{}
+	tried := map[int]bool{}
+	pending := []int{0}
+	for {
+		for len(pending) > 0 {
+			address := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if tried[address] || address < 0 || address >= len(memory) {
+				continue
+			}
+
+			tried[address] = true
+			opCode := memory[address] % 100
+			length := tvm.InstructionLength(opCode)
+			if tvm.OpcodeMnemonic(opCode) == "" || address+length > len(memory) {
+				continue
+			}
+
+			instruction := Instruction{address, memory[address : address+length]}
+			decoded[address] = instruction
+			if instruction.IsJump() {
+				if format, target := instruction.Param(1); format == tvm.ParamFormatImmediate {
+					pending = append(pending, target)
+				}
+
+				if format, condition := instruction.Param(0); format != tvm.ParamFormatImmediate || condition == 0 {
+					pending = append(pending, instruction.End())
+				}
+			} else if opCode != 9 {
+				pending = append(pending, instruction.End())
+			}
+		}
+
+		program := Program{Labels: labels}
+		for _, instruction := range decoded {
+			program.Instructions = append(program.Instructions, instruction)
+		}
+
+		// Calls return to the instruction after them, which is only known to be a call once the graph is built
+		g := New(program)
+		for _, block := range g.Blocks {
+			if g.Callee(block) != nil && !tried[block.End()] {
+				pending = append(pending, block.End())
+			}
+		}
+
+		if len(pending) == 0 {
+			return g
+		}
+	}
+}
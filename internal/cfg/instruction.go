@@ -0,0 +1,109 @@
+package cfg
+
+import (
+	tvm "tvm/internal/virtual_machine"
+)
+
+// Instruction is a single real instruction of a program
+type Instruction struct {
+	Address int
+	Words   []int
+}
+
+// OpCode returns the instruction's opcode, without its parameter formats
+func (i Instruction) OpCode() int {
+	return i.Words[0] % 100
+}
+
+// End returns the address just after the instruction
+func (i Instruction) End() int {
+	return i.Address + len(i.Words)
+}
+
+// Param returns the format and value of the parameter at the index provided
+func (i Instruction) Param(index int) (tvm.ParamFormat, int) {
+	divisor := 100
+	for shift := 0; shift < index; shift++ {
+		divisor *= 10
+	}
+
+	return tvm.ParamFormat((i.Words[0] / divisor) % 10), i.Words[index+1]
+}
+
+// Output returns the index of the parameter the instruction writes to, or -1 if it writes to none
+func (i Instruction) Output() int {
+	switch i.OpCode() {
+	case 3:
+		return 0
+	case 15:
+		return 1
+	case 4, 6, 9:
+		return -1
+	default:
+		return len(i.Words) - 2
+	}
+}
+
+// Inputs returns the indexes of the parameters the instruction reads
+func (i Instruction) Inputs() []int {
+	inputs := []int{}
+	for index := 0; index < len(i.Words)-1; index++ {
+		if index != i.Output() {
+			inputs = append(inputs, index)
+		}
+	}
+
+	return inputs
+}
+
+// Register returns the register the parameter at the index provided names, or -1 if it is not in register mode
+func (i Instruction) Register(index int) int {
+	if format, value := i.Param(index); format == tvm.ParamFormatRegister {
+		return value
+	}
+
+	return -1
+}
+
+// IsJump returns true for jit
+func (i Instruction) IsJump() bool {
+	return i.OpCode() == 6
+}
+
+// IsReturn returns true for jits that jump to the address in $la, returning from a routine
+func (i Instruction) IsReturn() bool {
+	return i.IsJump() && i.Register(1) == tvm.RegisterLastAddress
+}
+
+func (i Instruction) String() string {
+	assembly, _ := tvm.Disassemble(i.Words, 0)
+	return assembly
+}
+
+// CopiedParam returns the index of the parameter the instruction copies unchanged to its output, such as the first
+// parameter of `add x, 0, y`, or -1 if it computes something new
+func (i Instruction) CopiedParam() int {
+	var identity int
+	switch i.OpCode() {
+	case 1, 13, 14:
+		identity = 0
+	case 2:
+		identity = 1
+	case 16, 17:
+		if format, operand := i.Param(1); format == tvm.ParamFormatImmediate && operand == 0 {
+			return 0
+		}
+
+		return -1
+	default:
+		return -1
+	}
+
+	for index := 0; index < 2; index++ {
+		if format, operand := i.Param(index); format == tvm.ParamFormatImmediate && operand == identity {
+			return 1 - index
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,269 @@
+// Package format rewrites TVA source in its canonical style, the one tvfmt enforces:
+//
+//   - every label is on a line of its own, at the start of the line
+//   - instructions are indented with a tab, and their operands line up within each run of lines between blank lines
+//   - directives are at the start of the line
+//   - operands are separated by ", ", immediates lose their `i` indicator, and expressions have a space on either
+//     side of binary operators and none within parentheses or after signs
+//   - comments are kept as they are written, and trailing comments line up within each run of lines that have them
+//   - runs of blank lines become a single blank line, and the file ends with a single newline
+//
+// The operands of macro invocations are kept as they are written, since macros substitute them as text
+package format
+
+import (
+	"strings"
+
+	"tvm/internal/assembler"
+	"tvm/internal/syntax"
+)
+
+// tabWidth is the width tabs are assumed to have when lining up trailing comments
+const tabWidth = 8
+
+// Source formats the TVA source provided, which is named file in errors. Source with syntax errors is not
+// formatted: the errors are returned instead (see syntax.ErrorList)
+func Source(source, file string) (string, error) {
+	parsed, err := syntax.Parse(source, file)
+	if err != nil {
+		return "", err
+	}
+
+	return File(parsed), nil
+}
+
+// File formats a parsed TVA source file
+func File(file *syntax.File) string {
+	rows := make([]row, 0, len(file.Lines))
+	for _, line := range file.Lines {
+		rows = append(rows, lineRows(line)...)
+	}
+
+	builder := &strings.Builder{}
+	for _, block := range blocks(rows) {
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+
+		formatBlock(builder, block)
+	}
+
+	return builder.String()
+}
+
+// row is a line of formatted output, before its mnemonic and comment are lined up with the rest of its block
+type row struct {
+	// code is the whole code of the row for labels and directives, and the mnemonic of instructions, whose
+	// operands are kept apart so that they can be lined up
+	code        string
+	operands    string
+	instruction bool
+
+	// comment is the row's comment, and indented is true for comments on lines of their own that were not written
+	// at the start of the line
+	comment  string
+	indented bool
+}
+
+func (r row) blank() bool {
+	return r.code == "" && r.comment == ""
+}
+
+// lineRows returns the rows a line of source becomes: one for each of its labels, followed by one for its statement
+func lineRows(line *syntax.Line) []row {
+	rows := make([]row, 0, len(line.Labels)+1)
+	for _, label := range line.Labels {
+		rows = append(rows, row{code: label.Name + ":"})
+	}
+
+	switch statement := line.Statement.(type) {
+	case *syntax.Instruction:
+		rows = append(rows, row{code: statement.Mnemonic, operands: formatOperands(statement), instruction: true})
+	case *syntax.Directive:
+		rows = append(rows, row{code: formatDirective(statement)})
+	}
+
+	if line.Comment != nil {
+		comment := strings.TrimRight(line.Comment.Text, " \t\r")
+		if len(rows) == 0 {
+			return []row{{comment: comment, indented: line.Comment.Position.Column > 1}}
+		}
+
+		rows[len(rows)-1].comment = comment
+	}
+
+	if len(rows) == 0 {
+		return []row{{}}
+	}
+
+	return rows
+}
+
+// blocks splits rows into the runs of rows between blank rows, dropping the blank rows themselves
+func blocks(rows []row) [][]row {
+	var blocks [][]row
+	var current []row
+	for _, row := range rows {
+		if !row.blank() {
+			current = append(current, row)
+			continue
+		}
+
+		if len(current) > 0 {
+			blocks = append(blocks, current)
+			current = nil
+		}
+	}
+
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+
+	return blocks
+}
+
+// formatBlock writes a block of rows, lining up the operands of its instructions and its trailing comments
+func formatBlock(builder *strings.Builder, block []row) {
+	mnemonicWidth := 0
+	for _, row := range block {
+		if row.instruction && row.operands != "" && len(row.code) > mnemonicWidth {
+			mnemonicWidth = len(row.code)
+		}
+	}
+
+	codes := make([]string, len(block))
+	for index, row := range block {
+		switch {
+		case row.instruction && row.operands != "":
+			codes[index] = "\t" + row.code + strings.Repeat(" ", mnemonicWidth-len(row.code)) + " " + row.operands
+		case row.instruction:
+			codes[index] = "\t" + row.code
+		case row.code == "" && row.indented:
+			codes[index] = "\t"
+		default:
+			codes[index] = row.code
+		}
+	}
+
+	for start := 0; start < len(block); {
+		end := start + 1
+		if hasTrailingComment(block[start]) {
+			for end < len(block) && hasTrailingComment(block[end]) {
+				end++
+			}
+		}
+
+		commentColumn := 0
+		for index := start; index < end; index++ {
+			if width := visualWidth(codes[index]); width > commentColumn {
+				commentColumn = width
+			}
+		}
+
+		for index := start; index < end; index++ {
+			builder.WriteString(codes[index])
+			if block[index].comment != "" {
+				if block[index].code != "" {
+					builder.WriteString(strings.Repeat(" ", commentColumn-visualWidth(codes[index])+1))
+				}
+
+				builder.WriteString(block[index].comment)
+			}
+
+			builder.WriteString("\n")
+		}
+
+		start = end
+	}
+}
+
+func hasTrailingComment(row row) bool {
+	return row.code != "" && row.comment != ""
+}
+
+// visualWidth returns the number of columns text takes up, with tabs stopping every tabWidth columns
+func visualWidth(text string) int {
+	width := 0
+	for _, character := range text {
+		if character == '\t' {
+			width += tabWidth - width%tabWidth
+		} else {
+			width++
+		}
+	}
+
+	return width
+}
+
+// formatOperands returns the operands of an instruction in canonical form, or as they were written for macro
+// invocations
+func formatOperands(instruction *syntax.Instruction) string {
+	operands := make([]string, 0, len(instruction.Operands))
+	for _, operand := range instruction.Operands {
+		if assembler.IsMnemonic(instruction.Mnemonic) {
+			operands = append(operands, Operand(operand))
+		} else {
+			operands = append(operands, strings.TrimSpace(operand.Text))
+		}
+	}
+
+	return strings.Join(operands, ", ")
+}
+
+func formatDirective(directive *syntax.Directive) string {
+	if len(directive.Arguments) == 0 {
+		return directive.Name
+	}
+
+	arguments := make([]string, 0, len(directive.Arguments))
+	for _, argument := range directive.Arguments {
+		arguments = append(arguments, Expression(argument))
+	}
+
+	// The name of a macro is not one of its parameters
+	if directive.Name == ".macro" && len(arguments) > 1 {
+		return directive.Name + " " + arguments[0] + " " + strings.Join(arguments[1:], ", ")
+	}
+
+	return directive.Name + " " + strings.Join(arguments, ", ")
+}
+
+// Operand returns an operand in canonical form: registers by name, immediates as their expression without the `i`
+// indicator, and addresses as `$` directly followed by their expression. A register written as an address (`$r0`)
+// is a register by name
+func Operand(operand *syntax.Operand) string {
+	switch operand.Mode {
+	case syntax.OperandRegister:
+		return operand.Register
+	case syntax.OperandAddress:
+		if identifier, isIdentifier := operand.Expression.(*syntax.Identifier); isIdentifier && syntax.IsRegisterName(identifier.Name) {
+			return identifier.Name
+		}
+
+		return "$" + Expression(operand.Expression)
+	default:
+		return Expression(operand.Expression)
+	}
+}
+
+// Expression returns an expression in canonical form. Literals are kept as they are written
+func Expression(expression syntax.Expression) string {
+	switch expression := expression.(type) {
+	case *syntax.Number:
+		return expression.Text
+	case *syntax.String:
+		return expression.Text
+	case *syntax.Identifier:
+		return expression.Name
+	case *syntax.MacroParameter:
+		return "\\" + expression.Name
+	case *syntax.Unary:
+		return expression.Operator + Expression(expression.Operand)
+	case *syntax.Binary:
+		return Expression(expression.Left) + " " + expression.Operator + " " + Expression(expression.Right)
+	case *syntax.Paren:
+		return "(" + Expression(expression.Inner) + ")"
+	default:
+		return ""
+	}
+}
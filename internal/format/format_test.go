@@ -0,0 +1,109 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/assembler"
+	"tvm/internal/syntax"
+)
+
+func TestSource_RewritesInTheCanonicalStyle(t *testing.T) {
+	source := "# counts down from the input\n\n\n" +
+		"start:   in r0 # read\n" +
+		"loop: again: out   r0\n" +
+		"  sub r0,i1,r0   # decrement\n" +
+		"\tjit r0 , $ ( loop+0 )\n" +
+		"  # done\n" +
+		"hlt\n\n" +
+		".equ   SIZE,(4*2)\n" +
+		".macro twice op x\n" +
+		"\t\\op \\x\n" +
+		"\\op   \\x\n" +
+		".endm\n" +
+		"twice out,i5\n\n"
+
+	formatted, err := Source(source, "main.tva")
+	require.NoError(t, err)
+	assert.Equal(t, "# counts down from the input\n\n"+
+		"start:\n"+
+		"\tin  r0 # read\n"+
+		"loop:\n"+
+		"again:\n"+
+		"\tout r0\n"+
+		"\tsub r0, 1, r0 # decrement\n"+
+		"\tjit r0, $(loop + 0)\n"+
+		"\t# done\n"+
+		"\thlt\n\n"+
+		".equ SIZE, (4 * 2)\n"+
+		".macro twice op, x\n"+
+		"\t\\op   \\x\n"+
+		"\t\\op   \\x\n"+
+		".endm\n"+
+		"\ttwice out, i5\n", formatted)
+}
+
+func TestSource_WritesRegistersWrittenAsAddressesByName(t *testing.T) {
+	formatted, err := Source("in $r0\nadd $r0, $t7, $t0\nout $la\nout $r0x\nr0x: hlt\n", "main.tva")
+	require.NoError(t, err)
+	assert.Equal(t, "\tin  r0\n\tadd r0, t7, t0\n\tout la\n\tout $r0x\nr0x:\n\thlt\n", formatted)
+}
+
+func TestSource_LinesUpTrailingComments(t *testing.T) {
+	formatted, err := Source("out 1 # one\nadd r0, 1, r0 # two\nloop: # three\nhlt\nout 2 # four", "")
+	require.NoError(t, err)
+	assert.Equal(t, "\tout 1         # one\n\tadd r0, 1, r0 # two\nloop:                 # three\n\thlt\n\tout 2 # four\n", formatted)
+}
+
+func TestSource_RefusesSourceWithSyntaxErrors(t *testing.T) {
+	_, err := Source("out 1\nout (1", "main.tva")
+
+	var errs syntax.ErrorList
+	require.ErrorAs(t, err, &errs)
+	assert.Equal(t, syntax.Position{File: "main.tva", Line: 2, Column: 7}, errs[0].Position)
+}
+
+// fixtures returns the programs in testdata, by file name
+func fixtures(t *testing.T) map[string]string {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.tva"))
+	require.NoError(t, err)
+
+	programs := map[string]string{}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		require.NoError(t, err)
+		programs[filepath.Base(path)] = string(source)
+	}
+
+	return programs
+}
+
+func TestSource_IsIdempotentAndPreservesTheFixtures(t *testing.T) {
+	programs := fixtures(t)
+	require.NotEmpty(t, programs)
+
+	for name, fixture := range programs {
+		t.Run(name, func(t *testing.T) {
+			formatted, err := Source(fixture, "")
+			require.NoError(t, err)
+
+			again, err := Source(formatted, "")
+			require.NoError(t, err, formatted)
+			assert.Equal(t, formatted, again, "formatting is not idempotent")
+
+			expected, expectedErr := assembler.NewAssemblerFromString(fixture).Assemble()
+			program, err := assembler.NewAssemblerFromString(formatted).Assemble()
+			if expectedErr != nil {
+				assert.Error(t, err, "formatting fixes the program into:\n%v", formatted)
+				return
+			}
+
+			require.NoError(t, err, "formatting breaks the program into:\n%v", formatted)
+			assert.Equal(t, expected, program, "formatting changes the program into:\n%v", formatted)
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// Linker lays out objects one after another into a single program, starting with the first object, resolves the
+// symbols they import from each other and applies their relocations
+type Linker struct {
+	objects          []Object
+	keepUnreferenced bool
+	symbols          map[string]int
+}
+
+// NewLinker returns a Linker for the objects provided. The program starts at the start of the first object. Note
+// that this does not link the objects or check them for errors
+func NewLinker(objects ...Object) *Linker {
+	return &Linker{objects: objects}
+}
+
+// SetKeepUnreferenced sets whether routines that nothing refers to are kept in the program. They are stripped by
+// default (see Link)
+func (l *Linker) SetKeepUnreferenced(keep bool) {
+	l.keepUnreferenced = keep
+}
+
+// Symbols returns the address of every exported symbol in the most recently linked program, leaving out the ones
+// that were stripped
+func (l *Linker) Symbols() map[string]int {
+	return l.symbols
+}
+
+// symbolDefinition is where an exported symbol is defined
+type symbolDefinition struct {
+	object int
+	offset int
+}
+
+// routine is the code of an object from one of its symbols (or its start) up to the next, which the linker keeps
+// or strips as a whole
+type routine struct {
+	object int
+	start  int
+	end    int
+
+	kept    bool
+	address int
+}
+
+// Link returns the program made up of the objects, as an image with a single section ("program") loaded at address
+// 0 with every permission. Unless told otherwise (see SetKeepUnreferenced), only routines the program can reach are
+// kept: those its start is in, those a kept routine refers to, and those a kept routine may run on into. A routine
+// only cannot run on into the next one if it ends with `hlt` or with an unconditional jump to an address held in a
+// register or memory, such as a return through $la; jumps to fixed addresses set $la, so code after them may still
+// be returned to
+func (l *Linker) Link() (tvm.Image, error) {
+	l.symbols = map[string]int{}
+	if len(l.objects) == 0 {
+		return tvm.Image{}, errors.New("nothing to link")
+	}
+
+	exports, err := l.exports()
+	if err != nil {
+		return tvm.Image{}, err
+	}
+
+	if err := l.checkRelocations(exports); err != nil {
+		return tvm.Image{}, err
+	}
+
+	routines := l.routines()
+	l.markReachable(routines, exports)
+
+	size := 0
+	for index := range routines {
+		if routines[index].kept {
+			routines[index].address = size
+			size += routines[index].end - routines[index].start
+		}
+	}
+
+	format := l.objects[0].WordFormat
+	program := make([]int, 0, size)
+	for _, routine := range routines {
+		if !routine.kept {
+			continue
+		}
+
+		object := l.objects[routine.object]
+		words := append([]int{}, object.Words[routine.start:routine.end]...)
+		for _, relocation := range object.Relocations {
+			if relocation.Offset < routine.start || relocation.Offset >= routine.end {
+				continue
+			}
+
+			target := l.relocationTarget(routine.object, relocation, exports)
+			address, err := format.FitLiteral(addressOf(routines, target, size))
+			if err != nil {
+				return tvm.Image{}, fmt.Errorf("cannot relocate offset '%v' of '%v': %w", relocation.Offset, object.Name, err)
+			}
+
+			words[relocation.Offset-routine.start] = address
+		}
+
+		program = append(program, words...)
+	}
+
+	for name, definition := range exports {
+		if routine := routineAt(routines, definition); routine == nil || routine.kept {
+			l.symbols[name] = addressOf(routines, definition, size)
+		}
+	}
+
+	return tvm.Image{Sections: []tvm.Section{{Name: "program", Permissions: tvm.MemoryPermissionAll, Words: program}}, WordFormat: format}, nil
+}
+
+// exports returns where every exported symbol is defined, checking that no symbol is exported twice and that every
+// object is assembled for the same word format
+func (l *Linker) exports() (map[string]symbolDefinition, error) {
+	exports := map[string]symbolDefinition{}
+	for index, object := range l.objects {
+		if object.WordFormat != l.objects[0].WordFormat {
+			return nil, fmt.Errorf("'%v' is assembled for '%v' words but '%v' is assembled for '%v' words", object.Name, object.WordFormat, l.objects[0].Name, l.objects[0].WordFormat)
+		}
+
+		for _, symbol := range object.Symbols {
+			if symbol.Offset < 0 || symbol.Offset > len(object.Words) {
+				return nil, fmt.Errorf("symbol '%v' of '%v' is outside of the object", symbol.Name, object.Name)
+			}
+
+			if !symbol.Exported {
+				continue
+			}
+
+			if defined, exists := exports[symbol.Name]; exists {
+				return nil, fmt.Errorf("symbol '%v' is exported by both '%v' and '%v'", symbol.Name, l.objects[defined.object].Name, object.Name)
+			}
+
+			exports[symbol.Name] = symbolDefinition{index, symbol.Offset}
+		}
+	}
+
+	return exports, nil
+}
+
+// checkRelocations checks that every relocation is of a word of its object, and that every symbol it refers to is
+// imported by the object and exported by another
+func (l *Linker) checkRelocations(exports map[string]symbolDefinition) error {
+	for index, object := range l.objects {
+		imports := map[string]bool{}
+		for _, name := range object.Imports {
+			imports[name] = true
+		}
+
+		for _, relocation := range object.Relocations {
+			if relocation.Offset < 0 || relocation.Offset >= len(object.Words) {
+				return fmt.Errorf("relocation of offset '%v' is outside of '%v'", relocation.Offset, object.Name)
+			}
+
+			if relocation.Symbol != "" && !imports[relocation.Symbol] {
+				return fmt.Errorf("'%v' refers to symbol '%v' without importing it", object.Name, relocation.Symbol)
+			}
+
+			if _, exported := exports[relocation.Symbol]; relocation.Symbol != "" && !exported {
+				return fmt.Errorf("undefined symbol '%v' imported by '%v'", relocation.Symbol, object.Name)
+			}
+
+			target := l.relocationTarget(index, relocation, exports)
+			if target.offset < 0 || target.offset > len(l.objects[target.object].Words) {
+				return fmt.Errorf("offset '%v' of '%v' refers to an address outside of '%v'", relocation.Offset, object.Name, l.objects[target.object].Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// relocationTarget returns the object and offset the word being relocated refers to
+func (l *Linker) relocationTarget(object int, relocation Relocation, exports map[string]symbolDefinition) symbolDefinition {
+	value := l.objects[object].Words[relocation.Offset]
+	if relocation.Symbol == "" {
+		return symbolDefinition{object, value}
+	}
+
+	definition := exports[relocation.Symbol]
+	return symbolDefinition{definition.object, definition.offset + value}
+}
+
+// routines splits every object into routines at its start and at every symbol it defines, in the order they are
+// laid out in
+func (l *Linker) routines() []routine {
+	routines := make([]routine, 0)
+	for index, object := range l.objects {
+		starts := map[int]bool{0: true}
+		for _, symbol := range object.Symbols {
+			starts[symbol.Offset] = true
+		}
+
+		offsets := make([]int, 0, len(starts))
+		for offset := range starts {
+			if offset < len(object.Words) {
+				offsets = append(offsets, offset)
+			}
+		}
+
+		sort.Ints(offsets)
+		for position, offset := range offsets {
+			end := len(object.Words)
+			if position+1 < len(offsets) {
+				end = offsets[position+1]
+			}
+
+			routines = append(routines, routine{object: index, start: offset, end: end})
+		}
+	}
+
+	return routines
+}
+
+// markReachable marks the routines the program can reach as kept, or every routine if unreferenced routines are
+// kept
+func (l *Linker) markReachable(routines []routine, exports map[string]symbolDefinition) {
+	if l.keepUnreferenced {
+		for index := range routines {
+			routines[index].kept = true
+		}
+
+		return
+	}
+
+	pending := make([]int, 0)
+	mark := func(index int) {
+		if index >= 0 && index < len(routines) && !routines[index].kept {
+			routines[index].kept = true
+			pending = append(pending, index)
+		}
+	}
+
+	mark(0)
+
+	for len(pending) > 0 {
+		index := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		current := routines[index]
+		object := l.objects[current.object]
+		for _, relocation := range object.Relocations {
+			if relocation.Offset >= current.start && relocation.Offset < current.end {
+				mark(routineIndex(routines, l.relocationTarget(current.object, relocation, exports)))
+			}
+		}
+
+		if mayRunOn(object.Words[current.start:current.end]) {
+			mark(index + 1)
+		}
+	}
+}
+
+// mayRunOn returns false if the code provided certainly ends with `hlt` or with an unconditional jump to an address
+// held in a register or memory
+func mayRunOn(code []int) bool {
+	last := -1
+	for position := 0; position < len(code); position += tvm.InstructionLength(code[position] % 100) {
+		last = position
+	}
+
+	if last < 0 || last+tvm.InstructionLength(code[last]%100) != len(code) {
+		return true
+	}
+
+	opCode := code[last]
+	switch opCode % 100 {
+	case 9:
+		return false
+	case 6:
+		conditionFormat := tvm.ParamFormat((opCode / 100) % 10)
+		targetFormat := tvm.ParamFormat((opCode / 1000) % 10)
+		return conditionFormat != tvm.ParamFormatImmediate || code[last+1] == 0 || targetFormat == tvm.ParamFormatImmediate
+	default:
+		return true
+	}
+}
+
+// routineIndex returns the index of the routine holding the offset of the object provided, or -1 if none does
+func routineIndex(routines []routine, target symbolDefinition) int {
+	for index, routine := range routines {
+		if routine.object == target.object && target.offset >= routine.start && target.offset < routine.end {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// routineAt returns the routine holding the offset of the object provided, or nil if none does
+func routineAt(routines []routine, target symbolDefinition) *routine {
+	if index := routineIndex(routines, target); index >= 0 {
+		return &routines[index]
+	}
+
+	return nil
+}
+
+// addressOf returns the address that an offset of an object ends up at in a program of the size provided. Offsets
+// just past the end of an object end up just past the last kept routine before them
+func addressOf(routines []routine, target symbolDefinition, size int) int {
+	if routine := routineAt(routines, target); routine != nil {
+		return routine.address + target.offset - routine.start
+	}
+
+	for _, routine := range routines {
+		if routine.kept && routine.object > target.object {
+			return routine.address
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,139 @@
+package linker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// mainObject jumps to square in libraryObject, which jumps back to it
+var mainObject = Object{
+	Name:        "main.tvo",
+	Words:       []int{1106, 1, 0, 104, 7, 9},
+	Symbols:     []Symbol{{"back", 3, true}},
+	Imports:     []string{"square"},
+	Relocations: []Relocation{{2, "square"}},
+}
+
+// libraryObject has a routine that nothing refers to, followed by one that mainObject jumps to
+var libraryObject = Object{
+	Name:        "library.tvo",
+	Words:       []int{104, 1, 9, 104, 2, 1106, 1, 0},
+	Symbols:     []Symbol{{"unused", 0, true}, {"square", 3, true}},
+	Imports:     []string{"back"},
+	Relocations: []Relocation{{7, "back"}},
+}
+
+func TestObject_RoundTrips(t *testing.T) {
+	object := libraryObject
+	object.Name = ""
+	object.WordFormat = tvm.WordFormat{Size: tvm.WordSize64, Overflow: tvm.OverflowFault}
+	object.Words = append([]int{}, object.Words...)
+	object.Words[1] = 5000000000
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteObject(buffer, object))
+
+	read, err := ReadObject(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, object, read)
+}
+
+func TestReadObject_RejectsMalformedFiles(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteObject(buffer, libraryObject))
+	contents := buffer.Bytes()
+
+	_, err := ReadObject(bytes.NewReader([]byte("TVM")))
+	assert.EqualError(t, err, "not a TVM object file (missing 'TVO' header)")
+
+	_, err = ReadObject(bytes.NewReader(contents[:len(contents)-2]))
+	assert.EqualError(t, err, "TVM object file is truncated")
+
+	_, err = ReadObject(bytes.NewReader(append(append([]byte{}, contents...), 0)))
+	assert.EqualError(t, err, "TVM object file has '1' trailing bytes")
+}
+
+func TestLink_StripsUnreferencedRoutines(t *testing.T) {
+	linker := NewLinker(mainObject, libraryObject)
+
+	image, err := linker.Link()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1106, 1, 6, 104, 7, 9, 104, 2, 1106, 1, 3}, image.Sections[0].Words)
+	assert.Equal(t, map[string]int{"back": 3, "square": 6}, linker.Symbols())
+
+	machine, err := tvm.NewTsvetokVirtualMachineFromImage(image)
+	require.NoError(t, err)
+
+	output := &tvm.MockOutputInterface{}
+	machine.SetOutputInterface(output)
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, 7, *output.LastNumberReceived)
+}
+
+func TestLink_KeepsUnreferencedRoutinesIfAsked(t *testing.T) {
+	linker := NewLinker(mainObject, libraryObject)
+	linker.SetKeepUnreferenced(true)
+
+	image, err := linker.Link()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1106, 1, 9, 104, 7, 9, 104, 1, 9, 104, 2, 1106, 1, 3}, image.Sections[0].Words)
+	assert.Equal(t, map[string]int{"back": 3, "unused": 6, "square": 9}, linker.Symbols())
+}
+
+func TestLink_MovesAddressesWithinAnObject(t *testing.T) {
+	loop := Object{Name: "loop.tvo", Words: []int{104, 1, 1106, 1, 0}, Relocations: []Relocation{{4, ""}}}
+
+	linker := NewLinker(Object{Name: "main.tvo", Words: []int{9}}, loop)
+	linker.SetKeepUnreferenced(true)
+
+	image, err := linker.Link()
+	require.NoError(t, err)
+	assert.Equal(t, []int{9, 104, 1, 1106, 1, 1}, image.Sections[0].Words)
+}
+
+func TestLink_KeepsRoutinesThatCodeMayRunOnInto(t *testing.T) {
+	object := Object{
+		Name:    "main.tvo",
+		Words:   []int{104, 1, 104, 2, 2106, 1, 13, 9},
+		Symbols: []Symbol{{"next", 2, false}, {"after_return", 7, false}},
+	}
+
+	image, err := NewLinker(object).Link()
+	require.NoError(t, err)
+	assert.Equal(t, []int{104, 1, 104, 2, 2106, 1, 13}, image.Sections[0].Words)
+}
+
+func TestMayRunOn(t *testing.T) {
+	assert.False(t, mayRunOn([]int{104, 1, 9}))
+	assert.False(t, mayRunOn([]int{2106, 1, 13}))
+	assert.False(t, mayRunOn([]int{106, 1, 0}))
+	assert.True(t, mayRunOn([]int{1106, 1, 0}))
+	assert.True(t, mayRunOn([]int{2106, 0, 13}))
+	assert.True(t, mayRunOn([]int{2206, 0, 13}))
+	assert.True(t, mayRunOn([]int{104, 1}))
+	assert.True(t, mayRunOn([]int{}))
+}
+
+func TestLink_ReportsErrors(t *testing.T) {
+	undeclared := Object{Name: "undeclared.tvo", Words: []int{1106, 1, 0}, Relocations: []Relocation{{2, "square"}}}
+	wide := Object{Name: "wide.tvo", WordFormat: tvm.WordFormat{Size: tvm.WordSize64}, Words: []int{9}}
+
+	for _, test := range []struct {
+		objects []Object
+		err     string
+	}{
+		{nil, "nothing to link"},
+		{[]Object{mainObject}, "undefined symbol 'square' imported by 'main.tvo'"},
+		{[]Object{undeclared, libraryObject}, "'undeclared.tvo' refers to symbol 'square' without importing it"},
+		{[]Object{mainObject, libraryObject, libraryObject}, "symbol 'unused' is exported by both 'library.tvo' and 'library.tvo'"},
+		{[]Object{mainObject, wide}, "'wide.tvo' is assembled for '64/wrap' words but 'main.tvo' is assembled for '32/wrap' words"},
+	} {
+		_, err := NewLinker(test.objects...).Link()
+		assert.EqualError(t, err, test.err)
+	}
+}
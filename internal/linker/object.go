@@ -0,0 +1,213 @@
+package linker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// ObjectFileMagic is the sequence of ASCII characters every TVM object file begins with
+const ObjectFileMagic = "TVO"
+
+// objectFileVersion is the version of the object file format written by WriteObject
+const objectFileVersion = 1
+
+// Object is a relocatable piece of a program, assembled as if it were loaded at address 0. The linker (see Link)
+// decides where it is actually loaded and patches every word listed in Relocations to match
+type Object struct {
+	// Name names the object in errors, usually after the file it was assembled from
+	Name       string
+	WordFormat tvm.WordFormat
+	Words      []int
+
+	// Symbols are the labels defined in the object. Only exported symbols can be imported by other objects
+	Symbols []Symbol
+
+	// Imports are the symbols the object expects another object to export
+	Imports     []string
+	Relocations []Relocation
+}
+
+// Symbol is a label defined in an object, and the offset of the word it labels
+type Symbol struct {
+	Name     string
+	Offset   int
+	Exported bool
+}
+
+// Relocation is a word of an object that holds an address, and so must change when the object is loaded anywhere
+// but address 0. The word holds an offset into the object, which is moved by wherever the object is loaded, or, if
+// Symbol is set, an offset from the imported symbol named, which is moved by wherever that symbol ends up
+type Relocation struct {
+	Offset int
+	Symbol string
+}
+
+// ReadObject reads a TVM object file: the ASCII characters "TVO" followed by little-endian integers. They are the
+// format version, the word size and overflow mode (see WordFormat), the number of words followed by the words
+// themselves as 64-bit integers, the number of symbols followed by every symbol's name (its length in bytes, then
+// the name), offset and whether it is exported (1) or not (0), the number of imports followed by every import's
+// name, and finally the number of relocations followed by every relocation's offset and symbol name (empty for
+// offsets into the object.) Everything but the words is a 32-bit integer
+func ReadObject(r io.Reader) (Object, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return Object{}, err
+	}
+
+	if !bytes.HasPrefix(contents, []byte(ObjectFileMagic)) {
+		return Object{}, fmt.Errorf("not a TVM object file (missing '%v' header)", ObjectFileMagic)
+	}
+
+	reader := &objectReader{contents: contents[len(ObjectFileMagic):]}
+	if version := reader.word(); version != objectFileVersion && reader.err == nil {
+		return Object{}, fmt.Errorf("unsupported TVM object file version '%v'", version)
+	}
+
+	object := Object{WordFormat: tvm.WordFormat{Size: tvm.WordSize(reader.word()), Overflow: tvm.Overflow(reader.word())}}
+	if err := object.WordFormat.Validate(); err != nil && reader.err == nil {
+		return Object{}, fmt.Errorf("TVM object file has an %w", err)
+	}
+
+	object.Words = make([]int, reader.count(8))
+	for index := range object.Words {
+		object.Words[index] = reader.wideWord()
+	}
+
+	for count := reader.count(12); count > 0; count-- {
+		object.Symbols = append(object.Symbols, Symbol{reader.string(), reader.word(), reader.word() == 1})
+	}
+
+	for count := reader.count(4); count > 0; count-- {
+		object.Imports = append(object.Imports, reader.string())
+	}
+
+	for count := reader.count(8); count > 0; count-- {
+		object.Relocations = append(object.Relocations, Relocation{reader.word(), reader.string()})
+	}
+
+	if reader.err == nil && len(reader.contents) != 0 {
+		reader.err = fmt.Errorf("TVM object file has '%v' trailing bytes", len(reader.contents))
+	}
+
+	if reader.err != nil {
+		return Object{}, reader.err
+	}
+
+	return object, nil
+}
+
+// WriteObject writes the object provided in the TVM object file format (see ReadObject.) The object's name is not
+// written: objects read back are named after the file they are read from
+func WriteObject(w io.Writer, object Object) error {
+	if err := object.WordFormat.Validate(); err != nil {
+		return err
+	}
+
+	buffer := []byte(ObjectFileMagic)
+	buffer = binary.LittleEndian.AppendUint32(buffer, objectFileVersion)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(object.WordFormat.Size))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(object.WordFormat.Overflow))
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(object.Words)))
+	for _, word := range object.Words {
+		buffer = binary.LittleEndian.AppendUint64(buffer, uint64(int64(word)))
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(object.Symbols)))
+	for _, symbol := range object.Symbols {
+		buffer = appendString(buffer, symbol.Name)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(symbol.Offset)))
+
+		exported := uint32(0)
+		if symbol.Exported {
+			exported = 1
+		}
+
+		buffer = binary.LittleEndian.AppendUint32(buffer, exported)
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(object.Imports)))
+	for _, name := range object.Imports {
+		buffer = appendString(buffer, name)
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(object.Relocations)))
+	for _, relocation := range object.Relocations {
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(relocation.Offset)))
+		buffer = appendString(buffer, relocation.Symbol)
+	}
+
+	_, err := w.Write(buffer)
+	return err
+}
+
+// appendString appends a string's length in bytes, as a little-endian 32-bit integer, followed by the string
+func appendString(buffer []byte, value string) []byte {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value)))
+	return append(buffer, value...)
+}
+
+// objectReader consumes little-endian integers and strings from an object file, remembering the first error so
+// that callers can check once at the end
+type objectReader struct {
+	contents []byte
+	err      error
+}
+
+func (o *objectReader) word() int {
+	raw := o.bytes(4)
+	if raw == nil {
+		return 0
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(raw)))
+}
+
+func (o *objectReader) wideWord() int {
+	raw := o.bytes(8)
+	if raw == nil {
+		return 0
+	}
+
+	return int(int64(binary.LittleEndian.Uint64(raw)))
+}
+
+func (o *objectReader) string() string {
+	return string(o.bytes(o.count(1)))
+}
+
+// count reads a word that counts entries of at least minimumSize bytes each, rejecting negative counts and counts
+// of more entries than the rest of the file could hold
+func (o *objectReader) count(minimumSize int) int {
+	count := o.word()
+	if count < 0 && o.err == nil {
+		o.err = fmt.Errorf("TVM object file has invalid count '%v'", count)
+	} else if count > len(o.contents)/minimumSize && o.err == nil {
+		o.err = fmt.Errorf("TVM object file is truncated")
+	}
+
+	if o.err != nil {
+		return 0
+	}
+
+	return count
+}
+
+func (o *objectReader) bytes(length int) []byte {
+	if o.err != nil {
+		return nil
+	}
+
+	if length > len(o.contents) {
+		o.err = fmt.Errorf("TVM object file is truncated")
+		return nil
+	}
+
+	read := o.contents[:length]
+	o.contents = o.contents[length:]
+	return read
+}
@@ -0,0 +1,365 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"tvm/internal/cfg"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// reservedRegisters is the number of registers ($r0 to $r4) a routine must leave as it found them
+const reservedRegisters = 5
+
+// value is what a register or word of memory holds while a routine runs, as far as the calling convention checks
+// can tell: the value some register held when the routine was entered, or anything else
+type value struct {
+	// register is the register whose value on entry is held, or -1
+	register int
+
+	// changed is the address of the instruction that last put something else there, or -1 if it is not known
+	changed int
+}
+
+// routineState is what every register and known word of memory holds at some point of a routine
+type routineState struct {
+	registers [14]value
+	memory    map[int]value
+}
+
+func newRoutineState() routineState {
+	state := routineState{memory: map[int]value{}}
+	for register := range state.registers {
+		state.registers[register] = value{register, -1}
+	}
+
+	return state
+}
+
+func (s routineState) copy() routineState {
+	copied := routineState{registers: s.registers, memory: make(map[int]value, len(s.memory))}
+	for address, held := range s.memory {
+		copied.memory[address] = held
+	}
+
+	return copied
+}
+
+// join returns what is known of both states, and true if that differs from s
+func (s routineState) join(other routineState) (routineState, bool) {
+	joined, changed := s.copy(), false
+	for register, held := range other.registers {
+		if joined.registers[register].register != held.register {
+			joined.registers[register] = value{-1, max(joined.registers[register].changed, held.changed)}
+			changed = true
+		}
+	}
+
+	for address, held := range joined.memory {
+		if otherHeld, known := other.memory[address]; !known || otherHeld.register != held.register {
+			delete(joined.memory, address)
+			changed = true
+		}
+	}
+
+	return joined, changed
+}
+
+// read returns what the parameter at the index provided reads
+func (s routineState) read(i cfg.Instruction, index int) value {
+	switch format, operand := i.Param(index); format {
+	case tvm.ParamFormatRegister:
+		if operand >= 0 && operand < len(s.registers) {
+			return s.registers[operand]
+		}
+	case tvm.ParamFormatAddress:
+		if held, known := s.memory[operand]; known {
+			return held
+		}
+	}
+
+	return value{-1, -1}
+}
+
+// write records the instruction writing what it computes to its output
+func (s *routineState) write(i cfg.Instruction, p *program) {
+	output := i.Output()
+	if output < 0 {
+		return
+	}
+
+	written := value{-1, i.Address}
+	if copied := i.CopiedParam(); copied >= 0 {
+		written = s.read(i, copied)
+	}
+
+	switch format, operand := i.Param(output); {
+	case format == tvm.ParamFormatRegister && operand >= 0 && operand < len(s.registers):
+		s.registers[operand] = written
+	case format == tvm.ParamFormatAddress && !p.unknown[i.Address+1+output]:
+		s.memory[operand] = written
+	}
+}
+
+// conventionChecker runs the calling convention checks over every routine of a program
+type conventionChecker struct {
+	p *program
+
+	// found holds every diagnostic found so far, by the address and register it is about, so that a block checked
+	// again as more becomes known about it reports each problem once
+	found map[[2]int]Diagnostic
+}
+
+// checkReservedRegisters reports routines that may return through $la with one of $r0 to $r4 holding something
+// other than what it held when the routine was called
+func checkReservedRegisters(p *program) []Diagnostic {
+	return p.checkRoutines("reserved-registers")
+}
+
+// checkReturnAddresses reports routines that return through $la after a jit of their own has overwritten it
+func checkReturnAddresses(p *program) []Diagnostic {
+	return p.checkRoutines("return-address")
+}
+
+// checkRoutines returns what the rule provided found in every routine of the program. Both rules are checked
+// together the first time either runs
+func (p *program) checkRoutines(rule string) []Diagnostic {
+	if p.routineDiagnostics == nil {
+		var routines []*cfg.Block
+		for _, block := range p.graph.Blocks {
+			if callee := p.graph.Callee(block); callee != nil && !slices.Contains(routines, callee) {
+				routines = append(routines, callee)
+			}
+		}
+
+		sort.Slice(routines, func(i, j int) bool { return routines[i].Start() < routines[j].Start() })
+		checker := &conventionChecker{p, map[[2]int]Diagnostic{}}
+		for _, routine := range routines {
+			checker.checkRoutine(routine)
+		}
+
+		p.routineDiagnostics = []Diagnostic{}
+		for _, diagnostic := range checker.found {
+			p.routineDiagnostics = append(p.routineDiagnostics, diagnostic)
+		}
+
+		sort.Slice(p.routineDiagnostics, func(i, j int) bool { return p.routineDiagnostics[i].Address < p.routineDiagnostics[j].Address })
+	}
+
+	var diagnostics []Diagnostic
+	for _, diagnostic := range p.routineDiagnostics {
+		if diagnostic.Rule == rule {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	return diagnostics
+}
+
+// checkRoutine follows what the routine starting at the block provided does to every register, until it returns
+func (c *conventionChecker) checkRoutine(routine *cfg.Block) {
+	states := map[*cfg.Block]routineState{routine: newRoutineState()}
+	pending := []*cfg.Block{routine}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		state := states[block].copy()
+		for _, instruction := range block.Instructions[:len(block.Instructions)-1] {
+			state.write(instruction, c.p)
+		}
+
+		for _, next := range c.followRoutine(routine, block, state) {
+			previous, seen := states[next.block]
+			if !seen {
+				states[next.block] = next.state
+				pending = append(pending, next.block)
+				continue
+			}
+
+			if joined, changed := previous.join(next.state); changed {
+				states[next.block] = joined
+				pending = append(pending, next.block)
+			}
+		}
+	}
+}
+
+// successorState is a block a routine runs on into, and what is known on entering it
+type successorState struct {
+	block *cfg.Block
+	state routineState
+}
+
+// followRoutine runs the last instruction of a block of a routine, given what is known before it runs, checking
+// returns and returning the blocks the routine runs on into. Routines the block calls are taken to keep the
+// convention, preserving $r0 to $r4 but not the $t registers
+func (c *conventionChecker) followRoutine(routine, block *cfg.Block, state routineState) []successorState {
+	last := block.Last()
+	if last.OpCode() == 9 {
+		return nil
+	}
+
+	if !last.IsJump() {
+		state.write(last, c.p)
+		return c.successors(block, state, cfg.EdgeFallThrough)
+	}
+
+	if target := state.read(last, 1); target.register == tvm.RegisterLastAddress {
+		c.checkReturn(routine, last, state)
+	} else if last.IsReturn() {
+		overwritten := "a jit"
+		if target.changed >= 0 {
+			overwritten = fmt.Sprintf("the jit at %v", c.p.locate(target.changed))
+		}
+
+		c.report("return-address", last.Address, tvm.RegisterLastAddress, "'%v' returns through $la, but %v overwrote it", routine.Name(), overwritten)
+	}
+
+	state.registers[tvm.RegisterLastAddress] = value{-1, last.Address}
+	if callee := c.p.graph.Callee(block); callee != nil {
+		for register := tvm.RegisterTemporary0; register <= tvm.RegisterTemporary7; register++ {
+			state.registers[register] = value{-1, last.Address}
+		}
+
+		if after := c.p.graph.BlockAt(block.End()); after != nil {
+			return []successorState{{after, state}}
+		}
+
+		return nil
+	}
+
+	return c.successors(block, state, cfg.EdgeJump, cfg.EdgeFallThrough)
+}
+
+// checkReturn reports the reserved registers a routine returns without restoring
+func (c *conventionChecker) checkReturn(routine *cfg.Block, jump cfg.Instruction, state routineState) {
+	for register := 0; register < reservedRegisters; register++ {
+		if held := state.registers[register]; held.register != register {
+			changed := ""
+			if held.changed >= 0 {
+				changed = fmt.Sprintf(" (changed at %v)", c.p.locate(held.changed))
+			}
+
+			c.report("reserved-registers", jump.Address, register, "'%v' returns without restoring $%v%v", routine.Name(), tvm.RegisterName(register), changed)
+		}
+	}
+}
+
+func (c *conventionChecker) successors(block *cfg.Block, state routineState, kinds ...cfg.EdgeKind) []successorState {
+	var successors []successorState
+	for _, edge := range block.Successors {
+		for _, kind := range kinds {
+			if edge.Kind == kind {
+				successors = append(successors, successorState{edge.To, state})
+			}
+		}
+	}
+
+	return successors
+}
+
+func (c *conventionChecker) report(rule string, address, register int, format string, args ...any) {
+	c.found[[2]int{address, register}] = c.p.diagnose(rule, address, format, args...)
+}
+
+// checkTemporariesAcrossCalls reports reads of $t registers after a call returns, before they are set again, that
+// the routine called does not set either. Those reads rely on the register surviving the call, rather than reading
+// a result of the routine
+func checkTemporariesAcrossCalls(p *program) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, site := range p.graph.Blocks {
+		callee := p.graph.Callee(site)
+		if callee == nil {
+			continue
+		}
+
+		clobbered := map[int]bool{}
+		results := p.temporariesSet(callee)
+		for register := tvm.RegisterTemporary0; register <= tvm.RegisterTemporary7; register++ {
+			if !results[register] {
+				clobbered[register] = true
+			}
+		}
+
+		visited := map[*cfg.Block]bool{}
+		for block := p.graph.BlockAt(site.End()); block != nil && !visited[block] && len(clobbered) > 0; {
+			visited[block] = true
+			for _, instruction := range block.Instructions {
+				for _, input := range instruction.Inputs() {
+					if register := instruction.Register(input); clobbered[register] {
+						diagnostics = append(diagnostics, p.diagnose("temporary-across-call", instruction.Address,
+							"relies on $%v surviving the call to '%v' at %v, but $t registers are not preserved across calls", tvm.RegisterName(register), callee.Name(), p.locate(site.Last().Address)))
+						delete(clobbered, register)
+					}
+				}
+
+				if output := instruction.Output(); output >= 0 {
+					delete(clobbered, instruction.Register(output))
+				}
+			}
+
+			next := block
+			block = nil
+			for _, edge := range next.Successors {
+				if edge.Kind == cfg.EdgeFallThrough && !next.Last().IsJump() {
+					block = edge.To
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// temporariesSet returns the $t registers the routine starting at the block provided may set before it returns,
+// including through the routines it calls
+func (p *program) temporariesSet(routine *cfg.Block) map[int]bool {
+	if set, known := p.routineTemporaries[routine]; known {
+		return set
+	}
+
+	// A routine that calls itself sees what is known of it so far
+	set := map[int]bool{}
+	p.routineTemporaries[routine] = set
+
+	visited := map[*cfg.Block]bool{}
+	pending := []*cfg.Block{routine}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[block] {
+			continue
+		}
+
+		visited[block] = true
+		for _, instruction := range block.Instructions {
+			if output := instruction.Output(); output >= 0 {
+				if register := instruction.Register(output); register >= tvm.RegisterTemporary0 && register <= tvm.RegisterTemporary7 {
+					set[register] = true
+				}
+			}
+		}
+
+		if callee := p.graph.Callee(block); callee != nil {
+			for register := range p.temporariesSet(callee) {
+				set[register] = true
+			}
+
+			if after := p.graph.BlockAt(block.End()); after != nil {
+				pending = append(pending, after)
+			}
+
+			continue
+		}
+
+		for _, edge := range block.Successors {
+			if edge.Kind != cfg.EdgeReturn {
+				pending = append(pending, edge.To)
+			}
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,301 @@
+// Package lint finds bugs in TVA programs that assemble but are likely to misbehave, such as writes to $la or
+// reads of temporary registers that a jump has clobbered. Every check is a Rule that can be turned off on its own
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tvm/internal/assembler"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// Diagnostic is a problem a rule found in a program
+type Diagnostic struct {
+	Rule     string
+	Location tvm.SourceLocation
+
+	// Address is the address of the instruction the diagnostic is about, or -1 if it is not about an instruction
+	Address int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v (%v)", d.Location, d.Message, d.Rule)
+}
+
+// Rule is a check for a single kind of problem
+type Rule struct {
+	Name        string
+	Description string
+	check       func(p *program) []Diagnostic
+}
+
+var rules = []Rule{
+	{"write-la", "instructions other than jit that write to $la, which the machine forbids", checkLastAddressWrites},
+	{"temporary-after-jump", "reads of a $t register where a jump other than a call arrives, before it is set again ($t registers are not preserved between jumps)", checkTemporariesAfterJumps},
+	{"temporary-across-call", "reads of a $t register after a call returns, before it is set again, relying on the routine called to preserve it", checkTemporariesAcrossCalls},
+	{"reserved-registers", "routines that return through $la without restoring $r0 to $r4, which the caller relies on being preserved", checkReservedRegisters},
+	{"return-address", "routines that return through $la after a jit of their own has overwritten it, rather than saving it first", checkReturnAddresses},
+	{"unreachable", "code after hlt or an unconditional jump that nothing jumps to", checkUnreachableCode},
+	{"jump-into-instruction", "jumps to an address that is not the start of an instruction", checkJumpsIntoInstructions},
+	{"unused-label", "labels that are never used or exported", checkUnusedLabels},
+	{"data-as-code", "instructions that run but are also read or written as data", checkDataExecutedAsCode},
+}
+
+// Rules returns every rule, in the order they run
+func Rules() []Rule {
+	return append([]Rule{}, rules...)
+}
+
+// Config chooses the rules Lint runs. Every rule runs unless it is disabled
+type Config struct {
+	Disabled map[string]bool
+}
+
+// Validate returns an error if the configuration names a rule that does not exist
+func (c Config) Validate() error {
+	for name := range c.Disabled {
+		if !isRule(name) {
+			return fmt.Errorf("unknown rule '%v'", name)
+		}
+	}
+
+	return nil
+}
+
+func isRule(name string) bool {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lint assembles the program and returns what every enabled rule found, ordered by location. Labels the program
+// declares with .extern may be left undefined, so that files meant to be linked with others can be linted on their
+// own
+func Lint(a *assembler.TsvetokAssembler, config Config) ([]Diagnostic, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	object, err := a.AssembleObject()
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProgram(object, a.Listing(), a.SourceMap())
+	diagnostics := []Diagnostic{}
+	for _, rule := range rules {
+		if !config.Disabled[rule.Name] {
+			diagnostics = append(diagnostics, rule.check(p)...)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		left, right := diagnostics[i].Location, diagnostics[j].Location
+		if left.File != right.File {
+			return left.File < right.File
+		}
+
+		if left.Line != right.Line {
+			return left.Line < right.Line
+		}
+
+		return left.Column < right.Column
+	})
+
+	return diagnostics, nil
+}
+
+func (p *program) diagnose(rule string, address int, format string, args ...any) Diagnostic {
+	return Diagnostic{rule, p.locate(address), address, fmt.Sprintf(format, args...)}
+}
+
+// checkLastAddressWrites reports instructions writing to $la, which fault when they run
+func checkLastAddressWrites(p *program) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, instruction := range p.instructions {
+		if output := instruction.output(); output >= 0 && instruction.register(output) == tvm.RegisterLastAddress {
+			diagnostics = append(diagnostics, p.diagnose("write-la", instruction.address, "%v writes to $la, which only jit may set", tvm.OpcodeMnemonic(instruction.opCode)))
+		}
+	}
+
+	return diagnostics
+}
+
+// checkTemporariesAfterJumps reports reads of $t registers that no instruction has set since a jump other than a
+// call arrived, in the code at the jump's target. Code at other labels may be jumped to from anywhere, so what is
+// known about the registers is forgotten there. Reads after calls are left to checkTemporariesAcrossCalls
+func checkTemporariesAfterJumps(p *program) []Diagnostic {
+	jumpedTo := map[int]bool{}
+	for _, instruction := range p.instructions {
+		if instruction.opCode != 6 || p.isCall(instruction) {
+			continue
+		}
+
+		if target, known := p.jumpTarget(instruction); known {
+			jumpedTo[target] = true
+		}
+	}
+
+	var diagnostics []Diagnostic
+	clobbered := map[int]bool{}
+	for index, instruction := range p.instructions {
+		switch {
+		case jumpedTo[instruction.address]:
+			for register := tvm.RegisterTemporary0; register <= tvm.RegisterTemporary7; register++ {
+				clobbered[register] = true
+			}
+		case index == 0 || len(p.labels[instruction.address]) > 0 || p.instructions[index-1].end() != instruction.address:
+			clobbered = map[int]bool{}
+		}
+
+		for _, input := range instruction.inputs() {
+			if register := instruction.register(input); clobbered[register] {
+				diagnostics = append(diagnostics, p.diagnose("temporary-after-jump", instruction.address, "reads $%v after a jump without setting it first", tvm.RegisterName(register)))
+				delete(clobbered, register)
+			}
+		}
+
+		if output := instruction.output(); output >= 0 {
+			delete(clobbered, instruction.register(output))
+		}
+
+		if instruction.opCode == 6 && p.isCall(instruction) {
+			clobbered = map[int]bool{}
+		}
+	}
+
+	return diagnostics
+}
+
+// checkUnreachableCode reports the first instruction of every run of instructions after one that never runs on,
+// unless something jumps to it
+func checkUnreachableCode(p *program) []Diagnostic {
+	targets := map[int]bool{}
+	for _, instruction := range p.instructions {
+		if instruction.opCode != 6 {
+			continue
+		}
+
+		if target, known := p.jumpTarget(instruction); known {
+			targets[target] = true
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for index := 1; index < len(p.instructions); index++ {
+		previous, instruction := p.instructions[index-1], p.instructions[index]
+		if p.fallsThrough(previous) || previous.end() != instruction.address || len(p.labels[instruction.address]) > 0 || targets[instruction.address] {
+			continue
+		}
+
+		after := "an unconditional jump"
+		if previous.opCode == 9 {
+			after = "hlt"
+		}
+
+		diagnostics = append(diagnostics, p.diagnose("unreachable", instruction.address, "unreachable code after %v", after))
+		for index+1 < len(p.instructions) && p.instructions[index+1].address == p.instructions[index].end() && len(p.labels[p.instructions[index+1].address]) == 0 && !targets[p.instructions[index+1].address] {
+			index++
+		}
+	}
+
+	return diagnostics
+}
+
+// checkJumpsIntoInstructions reports jumps whose target is known but is not the start of an instruction
+func checkJumpsIntoInstructions(p *program) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, instruction := range p.instructions {
+		if instruction.opCode != 6 {
+			continue
+		}
+
+		target, known := p.jumpTarget(instruction)
+		if _, isStart := p.starts[target]; !known || isStart {
+			continue
+		}
+
+		index := sort.Search(len(p.instructions), func(i int) bool { return p.instructions[i].end() > target })
+		if target < 0 || index == len(p.instructions) || p.instructions[index].address > target {
+			diagnostics = append(diagnostics, p.diagnose("jump-into-instruction", instruction.address, "jumps to address %v, which holds no instruction", target))
+			continue
+		}
+
+		inside := p.instructions[index]
+		diagnostics = append(diagnostics, p.diagnose("jump-into-instruction", instruction.address,
+			"jumps to address %v, which is word %v of the %v at %v", target, target-inside.address, tvm.OpcodeMnemonic(inside.opCode), p.locate(inside.address)))
+	}
+
+	return diagnostics
+}
+
+// checkUnusedLabels reports labels that nothing uses or exports. A label defined in a macro's body is reported
+// once, at the first invocation of the macro, however many times the macro is expanded
+func checkUnusedLabels(p *program) []Diagnostic {
+	names := make([]string, 0, len(p.listing.Definitions))
+	for name := range p.listing.Definitions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	reported := map[string]bool{}
+	var diagnostics []Diagnostic
+	for _, name := range names {
+		if len(p.listing.References[name]) > 0 || p.exported[name] {
+			continue
+		}
+
+		location := p.listing.Definitions[name]
+		if local := strings.Split(name, "@")[0]; local != name {
+			if reported[local] {
+				continue
+			}
+
+			name = local
+			reported[local] = true
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{"unused-label", location, -1, fmt.Sprintf("label '%v' is never used", name)})
+	}
+
+	return diagnostics
+}
+
+// checkDataExecutedAsCode reports instructions that may run while some instruction also reads or writes their
+// words through an address mode operand
+func checkDataExecutedAsCode(p *program) []Diagnostic {
+	accesses := map[int]instruction{}
+	for _, instruction := range p.instructions {
+		for index := 0; index < len(instruction.words)-1; index++ {
+			format, address := instruction.param(index)
+			if _, seen := accesses[address]; format == tvm.ParamFormatAddress && !seen && !p.unknown[instruction.address+1+index] {
+				accesses[address] = instruction
+			}
+		}
+	}
+
+	reachable := p.reachable()
+	var diagnostics []Diagnostic
+	for _, instruction := range p.instructions {
+		if !reachable[instruction.address] {
+			continue
+		}
+
+		for address := instruction.address; address < instruction.end(); address++ {
+			if accessor, accessed := accesses[address]; accessed {
+				diagnostics = append(diagnostics, p.diagnose("data-as-code", instruction.address,
+					"%v runs as code but address %v is used as data by the %v at %v", tvm.OpcodeMnemonic(instruction.opCode), address, tvm.OpcodeMnemonic(accessor.opCode), p.locate(accessor.address)))
+				break
+			}
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,141 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/assembler"
+)
+
+func lint(t *testing.T, source string, config Config) []string {
+	diagnostics, err := Lint(assembler.NewAssemblerFromString(source), config)
+	require.NoError(t, err)
+
+	messages := make([]string, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		messages = append(messages, diagnostic.String())
+	}
+
+	return messages
+}
+
+func TestLint_FindsNothingWrongWithACleanProgram(t *testing.T) {
+	source := `
+	in r0
+loop:
+	out r0
+	sub r0, 1, r0
+	jit r0, loop
+	mov 5, t0
+	jit 1, square
+	out t1
+	hlt
+
+square:
+	mlt t0, t0, t1
+	jit 1, la
+`
+
+	assert.Empty(t, lint(t, source, Config{}))
+}
+
+func TestLint_ReportsEveryRule(t *testing.T) {
+	source := `add 1, 2, la
+mov 5, t0
+jit 1, routine
+out t0
+jmp middle+1
+middle: add $store, 1, $store
+hlt
+out 1
+unused: routine: jit 1, la
+store: hlt
+`
+
+	assert.Equal(t, []string{
+		"line 1:1: add writes to $la, which only jit may set (write-la)",
+		"line 4:1: relies on $t0 surviving the call to 'routine' at line 3:1, but $t registers are not preserved across calls (temporary-across-call)",
+		"line 5:1: jumps to address 17, which is word 1 of the add at line 6:9 (jump-into-instruction)",
+		"line 8:1: unreachable code after hlt (unreachable)",
+		"line 9: label 'unused' is never used (unused-label)",
+	}, lint(t, source, Config{}))
+}
+
+func TestLint_ChecksTheCallingConvention(t *testing.T) {
+	source := `
+	in r0
+	jit 1, clobber
+	jit 1, nested
+	jit 1, saved
+	out r0
+	mov 1, t1
+loop:
+	out t1
+	jit r0, loop
+	hlt
+
+clobber:
+	add r1, 1, r1
+	mov r0, $save
+	mov 7, r0
+	mov $save, r0
+	jit 1, la
+save:
+	hlt
+
+nested:
+	jit 1, clobber
+	jit 1, la
+
+saved:
+	mov la, $return
+	mov r2, t6
+	jit 1, clobber
+	mov t6, r2
+	jit 1, $return
+return:
+	hlt
+`
+
+	assert.Equal(t, []string{
+		"line 9:2: reads $t1 after a jump without setting it first (temporary-after-jump)",
+		"line 18:2: 'clobber' returns without restoring $r1 (changed at line 14:2) (reserved-registers)",
+		"line 24:2: 'nested' returns through $la, but the jit at line 23:2 overwrote it (return-address)",
+		"line 30:2: relies on $t6 surviving the call to 'clobber' at line 29:2, but $t registers are not preserved across calls (temporary-across-call)",
+		"line 31:2: 'saved' returns without restoring $r2 (changed at line 29:2) (reserved-registers)",
+	}, lint(t, source, Config{}))
+}
+
+func TestLint_ReportsTemporariesReadWhereJumpsArrive(t *testing.T) {
+	source := "add 1, 0, t0\nin r0\njit r0, foo\nout t0\nhlt\nfoo: out t0\nhlt\n"
+
+	assert.Equal(t, []string{
+		"line 6:6: reads $t0 after a jump without setting it first (temporary-after-jump)",
+	}, lint(t, source, Config{}))
+}
+
+func TestLint_ReportsDataExecutedAsCode(t *testing.T) {
+	source := "out 0\nadd $0, 1, $0\nhlt\nadd $counter, 1, $counter\nhlt\ncounter: hlt\n"
+
+	assert.Equal(t, []string{
+		"line 1:1: out runs as code but address 0 is used as data by the add at line 2:1 (data-as-code)",
+		"line 4:1: unreachable code after hlt (unreachable)",
+	}, lint(t, source, Config{}))
+}
+
+func TestLint_SkipsDisabledRules(t *testing.T) {
+	source := "jmp end\nout 1\nunused: end: hlt\n"
+
+	assert.Equal(t, []string{"line 3: label 'unused' is never used (unused-label)"}, lint(t, source, Config{Disabled: map[string]bool{"unreachable": true}}))
+
+	_, err := Lint(assembler.NewAssemblerFromString(source), Config{Disabled: map[string]bool{"bogus": true}})
+	assert.EqualError(t, err, "unknown rule 'bogus'")
+}
+
+func TestLint_ReportsLabelsOfMacrosOnceAndIgnoresExportedLabels(t *testing.T) {
+	source := ".global entry\n.macro twice x\nagain: out \\x\nout \\x\n.endm\nentry: twice 1\ntwice 2\nhlt\n"
+
+	assert.Equal(t, []string{"line 6: label 'again' is never used (unused-label)"}, lint(t, source, Config{}))
+}
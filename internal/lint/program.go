@@ -0,0 +1,209 @@
+package lint
+
+import (
+	"sort"
+
+	"tvm/internal/assembler"
+	"tvm/internal/cfg"
+	"tvm/internal/linker"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// instruction is a real instruction of the program being linted
+type instruction struct {
+	address int
+	words   []int
+	opCode  int
+}
+
+func (i instruction) end() int {
+	return i.address + len(i.words)
+}
+
+// param returns the format and value of the parameter at the index provided
+func (i instruction) param(index int) (tvm.ParamFormat, int) {
+	divisor := 100
+	for shift := 0; shift < index; shift++ {
+		divisor *= 10
+	}
+
+	return tvm.ParamFormat((i.words[0] / divisor) % 10), i.words[index+1]
+}
+
+// output returns the index of the parameter the instruction writes to, or -1 if it writes to none
+func (i instruction) output() int {
+	switch i.opCode {
+	case 3:
+		return 0
+	case 15:
+		return 1
+	case 4, 6, 9:
+		return -1
+	default:
+		return len(i.words) - 2
+	}
+}
+
+// inputs returns the indexes of the parameters the instruction reads
+func (i instruction) inputs() []int {
+	inputs := []int{}
+	for index := 0; index < len(i.words)-1; index++ {
+		if index != i.output() {
+			inputs = append(inputs, index)
+		}
+	}
+
+	return inputs
+}
+
+// register returns the register the parameter at the index provided names, or -1 if it is not in register mode
+func (i instruction) register(index int) int {
+	if format, value := i.param(index); format == tvm.ParamFormatRegister {
+		return value
+	}
+
+	return -1
+}
+
+// program is an assembled program along with everything the rules need to know about it
+type program struct {
+	instructions []instruction
+
+	// starts maps the address of every instruction to its index in instructions
+	starts map[int]int
+
+	// labels lists the labels at every address, and exported the labels other objects may use
+	labels   map[int][]string
+	exported map[string]bool
+
+	// unknown holds the words whose values are only known once the program is linked, such as addresses of labels
+	// imported from other objects
+	unknown map[int]bool
+
+	listing   assembler.Listing
+	sourceMap tvm.SourceMap
+
+	graph *cfg.Graph
+
+	// routineDiagnostics memoizes checkRoutines, and routineTemporaries temporariesSet
+	routineDiagnostics []Diagnostic
+	routineTemporaries map[*cfg.Block]map[int]bool
+}
+
+func newProgram(object linker.Object, listing assembler.Listing, sourceMap tvm.SourceMap) *program {
+	p := &program{
+		starts:    map[int]int{},
+		labels:    map[int][]string{},
+		exported:  map[string]bool{},
+		unknown:   map[int]bool{},
+		listing:   listing,
+		sourceMap: sourceMap,
+		graph:     cfg.FromObject(object, listing),
+
+		routineTemporaries: map[*cfg.Block]map[int]bool{},
+	}
+
+	for _, entry := range listing.Entries {
+		for _, listed := range entry.Instructions {
+			p.starts[listed.Address] = len(p.instructions)
+			p.instructions = append(p.instructions, instruction{listed.Address, listed.Words, listed.Words[0] % 100})
+		}
+	}
+
+	for _, symbol := range object.Symbols {
+		p.labels[symbol.Offset] = append(p.labels[symbol.Offset], symbol.Name)
+		if symbol.Exported {
+			p.exported[symbol.Name] = true
+		}
+	}
+
+	for _, relocation := range object.Relocations {
+		if relocation.Symbol != "" {
+			p.unknown[relocation.Offset] = true
+		}
+	}
+
+	sort.Slice(p.instructions, func(i, j int) bool { return p.instructions[i].address < p.instructions[j].address })
+	for index, instruction := range p.instructions {
+		p.starts[instruction.address] = index
+	}
+
+	return p
+}
+
+// jumpTarget returns the address a jit jumps to, and false if it is only known at run time
+func (p *program) jumpTarget(jump instruction) (int, bool) {
+	format, target := jump.param(1)
+	return target, format == tvm.ParamFormatImmediate && !p.unknown[jump.address+2]
+}
+
+// unconditional returns true if a jit always jumps
+func (p *program) unconditional(jump instruction) bool {
+	format, condition := jump.param(0)
+	return format == tvm.ParamFormatImmediate && condition != 0 && !p.unknown[jump.address+1]
+}
+
+// isCall returns true if the jit provided calls a routine (see cfg.Graph.Callee)
+func (p *program) isCall(jump instruction) bool {
+	block := p.graph.BlockContaining(jump.address)
+	return block != nil && p.graph.Callee(block) != nil
+}
+
+// isReturn returns true if the jit provided returns from a routine, through $la or a copy of it
+func (p *program) isReturn(jump instruction) bool {
+	block := p.graph.BlockContaining(jump.address)
+	return block != nil && block.Returns()
+}
+
+// fallsThrough returns true if the instruction after the one provided may run after it: unless it halts, returns
+// or jumps unconditionally to somewhere other than a routine (see cfg.Graph.Callee.) Jumps set $la, so the
+// instruction after a jump is where the routine it jumps to returns to
+func (p *program) fallsThrough(i instruction) bool {
+	switch {
+	case i.opCode == 9:
+		return false
+	case i.opCode != 6 || !p.unconditional(i):
+		return true
+	case p.isReturn(i):
+		return false
+	}
+
+	_, known := p.jumpTarget(i)
+	return !known || p.isCall(i)
+}
+
+// reachable returns the address of every instruction that may run when the program starts at address 0, following
+// jumps whose targets are known
+func (p *program) reachable() map[int]bool {
+	reached := map[int]bool{}
+	pending := []int{0}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		index, isInstruction := p.starts[current]
+		if reached[current] || !isInstruction {
+			continue
+		}
+
+		reached[current] = true
+		instruction := p.instructions[index]
+		if instruction.opCode == 6 {
+			if target, known := p.jumpTarget(instruction); known {
+				pending = append(pending, target)
+			}
+		}
+
+		if p.fallsThrough(instruction) {
+			pending = append(pending, instruction.end())
+		}
+	}
+
+	return reached
+}
+
+// locate returns the source location of an address
+func (p *program) locate(address int) tvm.SourceLocation {
+	location, _ := p.sourceMap.LocateAddress(address)
+	return location
+}
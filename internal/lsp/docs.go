@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"tvm/internal/syntax"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// instructionDoc documents an instruction or pseudo-instruction for hovers and completions
+type instructionDoc struct {
+	// synopsis is how the instruction is written, naming its operands
+	synopsis string
+	summary  string
+
+	// opCode is the instruction's opcode, or 0 for pseudo-instructions
+	opCode int
+}
+
+// instructionDocs documents every mnemonic the assembler understands
+var instructionDocs = map[string]instructionDoc{
+	"add": {"add a, b, dst", "Adds a and b, and writes the sum to dst.", 1},
+	"mlt": {"mlt a, b, dst", "Multiplies a by b, and writes the product to dst.", 2},
+	"in":  {"in dst", "Reads a number from the input, and writes it to dst.", 3},
+	"out": {"out a", "Writes a to the output.", 4},
+	"seq": {"seq a, b, dst", "Writes 1 to dst if a equals b, and 0 otherwise.", 5},
+	"jit": {"jit condition, target", "Jumps to target if condition is not 0. A jump that is taken sets $la to the address after the jit, which is how routines return (`jit 1, la`).", 6},
+	"slt": {"slt a, b, dst", "Writes 1 to dst if a is less than b, and 0 otherwise.", 7},
+	"hlt": {"hlt", "Halts the machine.", 9},
+	"div": {"div a, b, dst", "Divides a by b, rounding towards zero, and writes the quotient to dst. Dividing by zero stops the machine.", 10},
+	"mod": {"mod a, b, dst", "Writes the remainder of dividing a by b to dst. The remainder has the sign of a. Dividing by zero stops the machine.", 11},
+	"and": {"and a, b, dst", "Writes the bitwise and of a and b to dst.", 12},
+	"or":  {"or a, b, dst", "Writes the bitwise or of a and b to dst.", 13},
+	"xor": {"xor a, b, dst", "Writes the bitwise exclusive or of a and b to dst.", 14},
+	"not": {"not a, dst", "Writes the bitwise complement of a to dst.", 15},
+	"shl": {"shl a, b, dst", "Shifts a left by b bits, and writes the result to dst.", 16},
+	"shr": {"shr a, b, dst", "Shifts a right by b bits, keeping its sign, and writes the result to dst.", 17},
+	"sub": {"sub a, b, dst", "Pseudo-instruction: writes a - b to dst. Assembles to an add of -b when b is an immediate, and to a mlt and an add otherwise.", 0},
+	"mov": {"mov src, dst", "Pseudo-instruction: copies src to dst. Assembles to `add src, 0, dst`.", 0},
+	"nil": {"nil dst", "Pseudo-instruction: writes 0 to dst. Assembles to `add 0, 0, dst`.", 0},
+	"jmp": {"jmp target", "Pseudo-instruction: always jumps to target. Assembles to `jit 1, target`.", 0},
+	"jif": {"jif condition, target", "Pseudo-instruction: jumps to target if condition is 0. Assembles to a jit over a `jit 1, target`, and sets $la like any jump.", 0},
+}
+
+// registerDoc describes a register for hovers and completions
+func registerDoc(name string) string {
+	for register := range tvm.RegisterLastAddress + 1 {
+		if tvm.RegisterName(register) != name {
+			continue
+		}
+
+		switch {
+		case register == tvm.RegisterLastAddress:
+			return fmt.Sprintf("Register %v: the address after the last jump taken. Routines return through it; only jit may write it.", register)
+		case register < tvm.RegisterTemporary0:
+			return fmt.Sprintf("Register %v: reserved, so routines must restore it before returning.", register)
+		default:
+			return fmt.Sprintf("Register %v: temporary, so calls do not preserve it.", register)
+		}
+	}
+
+	return ""
+}
+
+// encodeOpCode returns the first word of the instruction provided: its opcode plus the mode of every operand
+func encodeOpCode(opCode int, operands []*syntax.Operand) int {
+	modes := map[syntax.OperandMode]tvm.ParamFormat{
+		syntax.OperandAddress:   tvm.ParamFormatAddress,
+		syntax.OperandImmediate: tvm.ParamFormatImmediate,
+		syntax.OperandRegister:  tvm.ParamFormatRegister,
+	}
+
+	word, multiplier := opCode, 100
+	for _, operand := range operands {
+		word += int(modes[operand.Mode]) * multiplier
+		multiplier *= 10
+	}
+
+	return word
+}
+
+// describeInstruction returns the Markdown a hover over the instruction provided shows: its synopsis and summary,
+// how it is encoded, and the instructions it assembled to if they are known. Macro invocations only show the latter
+func describeInstruction(instruction *syntax.Instruction, assembled []string) string {
+	var sections []string
+	if doc, documented := instructionDocs[instruction.Mnemonic]; documented {
+		sections = append(sections, fmt.Sprintf("```tva\n%v\n```\n%v", doc.synopsis, doc.summary))
+		if doc.opCode != 0 {
+			sections = append(sections, fmt.Sprintf("Opcode %v, so this instruction's first word is `%v`: the digits above the last two give the mode of each operand, from the right (0 address, 1 immediate, 2 register).", doc.opCode, encodeOpCode(doc.opCode, instruction.Operands)))
+		}
+	}
+
+	if len(assembled) > 0 {
+		sections = append(sections, fmt.Sprintf("Assembled:\n```\n%v\n```", strings.Join(assembled, "\n")))
+	}
+
+	return strings.Join(sections, "\n\n")
+}
@@ -0,0 +1,365 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"tvm/internal/assembler"
+	"tvm/internal/format"
+	"tvm/internal/syntax"
+	tvm "tvm/internal/virtual_machine"
+)
+
+// openDocument returns the open document named by a request's parameters
+func (s *Server) openDocument(uri string) (*document, error) {
+	d, open := s.documents[uri]
+	if !open {
+		return nil, fmt.Errorf("document '%v' is not open", uri)
+	}
+
+	return d, nil
+}
+
+// positionParams decodes the parameters of a request about a position in a document, and returns the document, the
+// line and byte column (both from 1) of the position, and the node of the syntax tree there, if any
+func (s *Server) positionParams(raw json.RawMessage, params any, at *textDocumentPositionParams) (*document, int, int, syntax.Node, error) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	d, err := s.openDocument(at.TextDocument.URI)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	line, column := d.column(at.Position)
+	return d, line, column, d.nodeAt(line, column), nil
+}
+
+// nodeAt returns the node of the document's syntax tree at the line and byte column provided that requests are
+// answered about: a label's definition, an identifier, a register operand, or the mnemonic of an instruction
+func (d *document) nodeAt(line, column int) syntax.Node {
+	if d.parsed == nil || line < 1 || line > len(d.parsed.Lines) {
+		return nil
+	}
+
+	within := func(position syntax.Position, text string) bool {
+		return column >= position.Column && column <= position.Column+len(text)
+	}
+
+	var found syntax.Node
+	syntax.Inspect(d.parsed.Lines[line-1], func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.Label:
+			if within(node.Position, node.Name) {
+				found = node
+			}
+		case *syntax.Identifier:
+			if within(node.Position, node.Name) {
+				found = node
+			}
+		case *syntax.Operand:
+			if node.Mode == syntax.OperandRegister && within(node.Position, node.Text) {
+				found = node
+			}
+		case *syntax.Instruction:
+			if within(node.Position, node.Mnemonic) {
+				found = node
+			}
+		}
+
+		return found == nil
+	})
+
+	return found
+}
+
+// occurrence is a place a label is defined or used
+type occurrence struct {
+	location   location
+	definition bool
+}
+
+// occurrences returns every place the label named is defined or used in the files of the document's program: the
+// document itself, and, if it assembles, every file it includes
+func (s *Server) occurrences(d *document, name string) []occurrence {
+	files := []*document{d}
+	if d.assembled != nil {
+		seen := map[string]bool{d.path: true}
+		for _, entry := range d.assembled.Listing().Entries {
+			if entry.File == "" || seen[entry.File] {
+				continue
+			}
+
+			seen[entry.File] = true
+			if other := s.file(entry.File); other != nil {
+				files = append(files, other)
+			}
+		}
+	}
+
+	var found []occurrence
+	for _, file := range files {
+		syntax.Inspect(file.parsed, func(node syntax.Node) bool {
+			switch node := node.(type) {
+			case *syntax.Label:
+				if node.Name == name {
+					found = append(found, occurrence{file.location(node.Position, node.Name), true})
+				}
+			case *syntax.Identifier:
+				if node.Name == name {
+					found = append(found, occurrence{file.location(node.Position, node.Name), false})
+				}
+			}
+
+			return true
+		})
+	}
+
+	return found
+}
+
+// file returns the file at the path provided, parsed: the open document if it is open, or the file on disk
+// otherwise. It returns nil if the file cannot be read
+func (s *Server) file(path string) *document {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+
+	for _, open := range s.documents {
+		if open.path == absolute {
+			return open
+		}
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	d := &document{uri: pathURI(path), path: path, text: string(source)}
+	for _, line := range strings.Split(d.text, "\n") {
+		d.lines = append(d.lines, strings.TrimSuffix(line, "\r"))
+	}
+
+	d.parsed, _ = syntax.Parse(d.text, path)
+	return d
+}
+
+// location returns the location of the text provided, found at the position provided
+func (d *document) location(at syntax.Position, text string) location {
+	return location{d.uri, d.textRange(at.Line, at.Column, at.Column+len(text))}
+}
+
+// labelAt returns the name of the label defined or used by the node provided, or false if it is not a label, or is
+// defined nowhere in the document's program
+func (s *Server) labelAt(d *document, node syntax.Node) (string, []occurrence, bool) {
+	name := ""
+	switch node := node.(type) {
+	case *syntax.Label:
+		name = node.Name
+	case *syntax.Identifier:
+		name = node.Name
+	default:
+		return "", nil, false
+	}
+
+	found := s.occurrences(d, name)
+	for _, candidate := range found {
+		if candidate.definition {
+			return name, found, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// definition answers textDocument/definition with where the label at the position is defined
+func (s *Server) definition(raw json.RawMessage) (any, error) {
+	params := textDocumentPositionParams{}
+	d, _, _, node, err := s.positionParams(raw, &params, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	_, found, isLabel := s.labelAt(d, node)
+	if !isLabel {
+		return nil, nil
+	}
+
+	locations := []location{}
+	for _, candidate := range found {
+		if candidate.definition {
+			locations = append(locations, candidate.location)
+		}
+	}
+
+	return locations, nil
+}
+
+// references answers textDocument/references with every use of the label at the position, and its definition if
+// the client asks for it
+func (s *Server) references(raw json.RawMessage) (any, error) {
+	params := referenceParams{}
+	d, _, _, node, err := s.positionParams(raw, &params, &params.textDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	_, found, isLabel := s.labelAt(d, node)
+	if !isLabel {
+		return nil, nil
+	}
+
+	locations := []location{}
+	for _, candidate := range found {
+		if !candidate.definition || params.Context.IncludeDeclaration {
+			locations = append(locations, candidate.location)
+		}
+	}
+
+	return locations, nil
+}
+
+// hover answers textDocument/hover: instructions show their documentation and encoding, registers what they are for,
+// and labels their address
+func (s *Server) hover(raw json.RawMessage) (any, error) {
+	params := textDocumentPositionParams{}
+	d, line, _, node, err := s.positionParams(raw, &params, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	text, start, length := "", syntax.Position{}, 0
+	switch node := node.(type) {
+	case *syntax.Instruction:
+		text, start, length = describeInstruction(node, d.assembledLines(line)), node.Position, len(node.Mnemonic)
+	case *syntax.Operand:
+		if doc := registerDoc(node.Register); doc != "" {
+			text, start, length = fmt.Sprintf("`$%v`: %v", node.Register, doc), node.Position, len(node.Text)
+		}
+	case *syntax.Label, *syntax.Identifier:
+		name, found, isLabel := s.labelAt(d, node)
+		if !isLabel {
+			break
+		}
+
+		text, start, length = d.describeLabel(name, found), node.Pos(), len(name)
+	}
+
+	if text == "" {
+		return nil, nil
+	}
+
+	at := d.textRange(start.Line, start.Column, start.Column+length)
+	return hover{markupContent{"markdown", text}, &at}, nil
+}
+
+// assembledLines returns the instructions the line provided (from 1) assembled to, as listed, or nothing if the
+// document does not assemble
+func (d *document) assembledLines(line int) []string {
+	if d.assembled == nil {
+		return nil
+	}
+
+	var lines []string
+	for _, entry := range d.assembled.Listing().Entries {
+		if entry.File != d.path || entry.Line != line {
+			continue
+		}
+
+		for _, instruction := range entry.Instructions {
+			words := make([]string, 0, len(instruction.Words))
+			for _, word := range instruction.Words {
+				words = append(words, fmt.Sprint(word))
+			}
+
+			lines = append(lines, fmt.Sprintf("%4d  %-20v %v", instruction.Address, strings.Join(words, " "), instruction.Assembly))
+		}
+	}
+
+	return lines
+}
+
+// describeLabel returns the Markdown a hover over a label shows: where it is defined, its address if the document
+// assembles, and how many times it is used
+func (d *document) describeLabel(name string, found []occurrence) string {
+	description := fmt.Sprintf("label `%v`", name)
+	if d.assembled != nil {
+		description += fmt.Sprintf(" at address %v", d.assembled.Listing().Labels[name])
+	}
+
+	uses := 0
+	for _, candidate := range found {
+		if candidate.definition {
+			description += fmt.Sprintf(", defined on line %v", candidate.location.Range.Start.Line+1)
+			if candidate.location.URI != d.uri {
+				description += fmt.Sprintf(" of %v", filepath.Base(uriPath(candidate.location.URI)))
+			}
+		} else {
+			uses++
+		}
+	}
+
+	return fmt.Sprintf("%v (%v uses)", description, uses)
+}
+
+// statementPrefix matches the start of a line up to where a mnemonic is written: any labels, then the start of the
+// mnemonic
+var statementPrefix = regexp.MustCompile(`^\s*(?:[A-Za-z_][A-Za-z0-9_]*:\s*)*[A-Za-z_]*$`)
+
+// completion answers textDocument/completion with every mnemonic where an instruction's mnemonic is written, and
+// every register where its operands are
+func (s *Server) completion(raw json.RawMessage) (any, error) {
+	params := textDocumentPositionParams{}
+	d, line, column, _, err := s.positionParams(raw, &params, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := d.line(line - 1)[:column-1]
+	items := []completionItem{}
+	switch {
+	case strings.Contains(prefix, "#") || strings.Contains(prefix, "."):
+	case statementPrefix.MatchString(prefix):
+		for _, mnemonic := range assembler.Mnemonics() {
+			doc := instructionDocs[mnemonic]
+			items = append(items, completionItem{mnemonic, completionItemKindKeyword, doc.synopsis, &markupContent{"markdown", doc.summary}})
+		}
+	default:
+		for register := range tvm.RegisterLastAddress + 1 {
+			name := tvm.RegisterName(register)
+			items = append(items, completionItem{name, completionItemKindVariable, fmt.Sprintf("register %v", register), &markupContent{"markdown", registerDoc(name)}})
+		}
+	}
+
+	return items, nil
+}
+
+// formatting answers textDocument/formatting with an edit replacing the document with its formatted source, or no
+// edits if it is formatted already or has syntax errors
+func (s *Server) formatting(raw json.RawMessage) (any, error) {
+	params := documentFormattingParams{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	d, err := s.openDocument(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := format.Source(d.text, d.path)
+	if err != nil || formatted == d.text {
+		return []textEdit{}, nil
+	}
+
+	last := len(d.lines)
+	whole := textRange{position{0, 0}, d.position(last, len(d.lines[last-1])+1)}
+	return []textEdit{{whole, formatted}}, nil
+}
@@ -0,0 +1,350 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"tvm/internal/assembler"
+	"tvm/internal/syntax"
+)
+
+// Server is a Language Server Protocol server for TVA. It keeps the documents a client has open, assembles them
+// whenever they change to publish the assembler's errors as diagnostics, and answers requests for definitions,
+// references, hovers, completions and formatting
+type Server struct {
+	includePaths []string
+	documents    map[string]*document
+	writer       io.Writer
+
+	initialized, shutDown bool
+
+	// err is the first error writing to the client, which stops the server
+	err error
+}
+
+// document is a document the client has open
+type document struct {
+	uri string
+
+	// path is the path of the document's file, or empty if its URI is not a file
+	path  string
+	text  string
+	lines []string
+
+	parsed *syntax.File
+
+	// assembled is the assembler that assembled the document's text, or nil if it does not assemble
+	assembled *assembler.TsvetokAssembler
+}
+
+// NewServer returns a server that searches the directories provided for included files, after the directory of
+// the file including them
+func NewServer(includePaths ...string) *Server {
+	return &Server{includePaths: includePaths, documents: map[string]*document{}}
+}
+
+// Serve reads messages from the client on the reader provided and answers on the writer provided, until the client
+// sends exit. It returns an error if the connection ends or fails before then, or if the client exits without
+// shutting the server down first
+func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
+	s.writer = writer
+	buffered := bufio.NewReader(reader)
+	for s.err == nil {
+		received, err := readMessage(buffered)
+		var invalid *responseError
+		switch {
+		case errors.As(err, &invalid):
+			s.send(&message{ID: nullID(), Error: invalid})
+			continue
+		case errors.Is(err, io.EOF):
+			return errors.New("the client closed the connection without exiting")
+		case err != nil:
+			return err
+		}
+
+		if received.Method == "exit" {
+			if !s.shutDown {
+				return errors.New("the client exited without shutting the server down")
+			}
+
+			return nil
+		}
+
+		s.handle(received)
+	}
+
+	return s.err
+}
+
+// handle answers a request, or acts on a notification
+func (s *Server) handle(received *message) {
+	switch {
+	case received.ID == nil:
+		s.notified(received)
+		return
+	case received.Method == "":
+		// The server sends no requests, so has no use for responses
+		return
+	}
+
+	result, err := s.request(received)
+	if err != nil {
+		s.send(&message{ID: received.ID, Error: err})
+		return
+	}
+
+	encoded, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		s.send(&message{ID: received.ID, Error: &responseError{codeInternalError, marshalErr.Error()}})
+		return
+	}
+
+	s.send(&message{ID: received.ID, Result: encoded})
+}
+
+// request returns the result of a request, or the error it fails with
+func (s *Server) request(received *message) (any, *responseError) {
+	switch {
+	case received.Method == "initialize":
+		s.initialized = true
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1,
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "tva-lsp"},
+		}, nil
+	case !s.initialized:
+		return nil, &responseError{codeServerNotInitialized, "the server has not been initialized"}
+	case s.shutDown:
+		return nil, &responseError{codeInvalidRequest, "the server has been shut down"}
+	}
+
+	handlers := map[string]func(json.RawMessage) (any, error){
+		"shutdown": func(json.RawMessage) (any, error) {
+			s.shutDown = true
+			return nil, nil
+		},
+		"textDocument/definition": s.definition,
+		"textDocument/references": s.references,
+		"textDocument/hover":      s.hover,
+		"textDocument/completion": s.completion,
+		"textDocument/formatting": s.formatting,
+	}
+
+	handler, handled := handlers[received.Method]
+	if !handled {
+		return nil, &responseError{codeMethodNotFound, fmt.Sprintf("unknown method '%v'", received.Method)}
+	}
+
+	result, err := handler(received.Params)
+	if err != nil {
+		return nil, &responseError{codeInvalidParams, err.Error()}
+	}
+
+	return result, nil
+}
+
+// notified acts on a notification. Notifications the server does not know are ignored, as are any received before
+// the server is initialized
+func (s *Server) notified(received *message) {
+	if !s.initialized {
+		return
+	}
+
+	switch received.Method {
+	case "textDocument/didOpen":
+		params := didOpenParams{}
+		if json.Unmarshal(received.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		params := didChangeParams{}
+		if json.Unmarshal(received.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		params := didCloseParams{}
+		if json.Unmarshal(received.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{params.TextDocument.URI, []diagnostic{}})
+		}
+	}
+}
+
+// update records the new text of a document, then assembles it and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	d := &document{uri: uri, path: uriPath(uri), text: text}
+	for _, line := range strings.Split(text, "\n") {
+		d.lines = append(d.lines, strings.TrimSuffix(line, "\r"))
+	}
+
+	s.documents[uri] = d
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{uri, s.diagnose(d)})
+}
+
+// diagnose parses and assembles a document, and returns its syntax errors, or otherwise the error assembling it
+func (s *Server) diagnose(d *document) []diagnostic {
+	parsed, err := syntax.Parse(d.text, d.path)
+	d.parsed = parsed
+
+	diagnostics := []diagnostic{}
+	var syntaxErrors syntax.ErrorList
+	if errors.As(err, &syntaxErrors) {
+		for _, syntaxError := range syntaxErrors {
+			diagnostics = append(diagnostics, d.diagnostic(syntaxError.Position.Line, syntaxError.Position.Column, syntaxError.Message))
+		}
+
+		return diagnostics
+	}
+
+	a := s.assembler(d)
+	if _, err := a.AssembleObject(); err != nil {
+		line, column := 1, 0
+		message := err.Error()
+		var lineErr assembler.LineErr
+		if errors.As(err, &lineErr) && lineErr.Location.File == d.path {
+			line, column, message = lineErr.Location.Line, lineErr.Location.Column, lineErr.Err.Error()
+		}
+
+		return append(diagnostics, d.diagnostic(line, column, message))
+	}
+
+	d.assembled = a
+	return diagnostics
+}
+
+// assembler returns an assembler for the document, reading any other open document from the client rather than
+// from disk
+func (s *Server) assembler(d *document) *assembler.TsvetokAssembler {
+	if d.path == "" {
+		a := assembler.NewAssemblerFromString(d.text)
+		a.SetIncludePaths(s.includePaths...)
+		return a
+	}
+
+	overlay := map[string]string{}
+	for _, open := range s.documents {
+		if open.path != "" {
+			overlay[open.path] = open.text
+		}
+	}
+
+	a := assembler.NewAssemblerFromFiles(d.path)
+	a.SetIncludePaths(s.includePaths...)
+	a.SetOverlay(overlay)
+	return a
+}
+
+// diagnostic returns an error at the line and column provided (both from 1), covering the word there, or the code
+// of the line if the column is not known (0)
+func (d *document) diagnostic(line, column int, text string) diagnostic {
+	start, end := column, column
+	if code := d.line(line - 1); column == 0 {
+		start = len(code) - len(strings.TrimLeft(code, " \t")) + 1
+		end = len(strings.TrimRight(strings.SplitN(code, "#", 2)[0], " \t")) + 1
+	} else {
+		end = start + max(wordLength(code[min(start-1, len(code)):]), 1)
+	}
+
+	return diagnostic{d.textRange(line, start, end), severityError, "tva", text}
+}
+
+// wordLength returns the length of the word at the start of the text provided, up to a space, comma or comment
+func wordLength(text string) int {
+	if index := strings.IndexAny(text, " \t,#"); index >= 0 {
+		return index
+	}
+
+	return len(text)
+}
+
+// line returns the line provided (from 0), or an empty string if the document has no such line
+func (d *document) line(index int) string {
+	if index < 0 || index >= len(d.lines) {
+		return ""
+	}
+
+	return d.lines[index]
+}
+
+// position converts a line and byte column (both from 1) to an LSP position
+func (d *document) position(line, column int) position {
+	text := d.line(line - 1)
+	prefix := text[:max(min(column-1, len(text)), 0)]
+	return position{line - 1, len(utf16.Encode([]rune(prefix)))}
+}
+
+// textRange returns the range on the line provided between two byte columns (all from 1)
+func (d *document) textRange(line, start, end int) textRange {
+	return textRange{d.position(line, start), d.position(line, end)}
+}
+
+// column converts an LSP position to the line and byte column (both from 1) it stands for
+func (d *document) column(at position) (int, int) {
+	text := d.line(at.Line)
+	units := 0
+	for offset, character := range text {
+		if units >= at.Character {
+			return at.Line + 1, offset + 1
+		}
+
+		units += utf16.RuneLen(character)
+	}
+
+	return at.Line + 1, len(text) + 1
+}
+
+// notify sends a notification to the client
+func (s *Server) notify(method string, params any) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		s.err = err
+		return
+	}
+
+	s.send(&message{Method: method, Params: encoded})
+}
+
+// send writes a message to the client, keeping the first error writing
+func (s *Server) send(sent *message) {
+	if s.err == nil {
+		s.err = writeMessage(s.writer, sent)
+	}
+}
+
+// uriPath returns the path of a file URI, or an empty string for any other URI
+func uriPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return ""
+	}
+
+	return filepath.FromSlash(parsed.Path)
+}
+
+// pathURI returns the file URI of a path
+func pathURI(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// nullID returns the ID of responses to messages whose ID could not be read
+func nullID() *json.RawMessage {
+	null := json.RawMessage("null")
+	return &null
+}
@@ -0,0 +1,306 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tvm/internal/assembler"
+)
+
+// client is a scripted LSP client, talking to a server running in the same process over a pair of pipes
+type client struct {
+	t      *testing.T
+	writer *io.PipeWriter
+	nextID int
+
+	// received holds every message the server sends, and notifications those not yet looked at
+	received      chan *message
+	notifications []*message
+	served        chan error
+}
+
+// newClient starts the server provided and returns a client talking to it. Unless initialize is false, the client
+// initializes the server first
+func newClient(t *testing.T, server *Server, initialize bool) *client {
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	c := &client{t: t, writer: clientWriter, received: make(chan *message, 64), served: make(chan error, 1)}
+
+	go func() {
+		c.served <- server.Serve(serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+
+	go func() {
+		buffered := bufio.NewReader(clientReader)
+		for {
+			received, err := readMessage(buffered)
+			if err != nil {
+				close(c.received)
+				return
+			}
+
+			c.received <- received
+		}
+	}()
+
+	t.Cleanup(func() {
+		clientWriter.Close()
+		clientReader.Close()
+	})
+
+	if initialize {
+		require.Nil(t, c.request("initialize", map[string]any{"capabilities": map[string]any{}}, nil))
+		c.notify("initialized", map[string]any{})
+	}
+
+	return c
+}
+
+// send writes a message to the server
+func (c *client) send(method string, id *json.RawMessage, params any) {
+	encoded, err := json.Marshal(params)
+	require.NoError(c.t, err)
+	require.NoError(c.t, writeMessage(c.writer, &message{ID: id, Method: method, Params: encoded}))
+}
+
+// request sends a request and waits for its response, decoding its result into the value provided, and returns
+// the error it failed with if it did
+func (c *client) request(method string, params any, result any) *responseError {
+	c.nextID++
+	id := json.RawMessage(fmt.Sprint(c.nextID))
+	c.send(method, &id, params)
+
+	for received := range c.received {
+		if received.ID == nil {
+			c.notifications = append(c.notifications, received)
+			continue
+		}
+
+		require.Equal(c.t, string(id), string(*received.ID))
+		if received.Error != nil {
+			return received.Error
+		}
+
+		if result != nil {
+			require.NoError(c.t, json.Unmarshal(received.Result, result))
+		}
+
+		return nil
+	}
+
+	c.t.Fatalf("the server stopped before answering '%v'", method)
+	return nil
+}
+
+func (c *client) notify(method string, params any) {
+	c.send(method, nil, params)
+}
+
+// diagnostics waits for the server to publish diagnostics for the document provided, and returns them
+func (c *client) diagnostics(uri string) []diagnostic {
+	for {
+		for index, notification := range c.notifications {
+			params := publishDiagnosticsParams{}
+			if notification.Method != "textDocument/publishDiagnostics" || json.Unmarshal(notification.Params, &params) != nil || params.URI != uri {
+				continue
+			}
+
+			c.notifications = append(c.notifications[:index], c.notifications[index+1:]...)
+			return params.Diagnostics
+		}
+
+		received, open := <-c.received
+		require.True(c.t, open, "the server stopped before publishing diagnostics")
+		c.notifications = append(c.notifications, received)
+	}
+}
+
+// open opens a document with the text provided and returns its diagnostics
+func (c *client) open(uri, text string) []diagnostic {
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": textDocumentItem{uri, "tva", 1, text}})
+	return c.diagnostics(uri)
+}
+
+// shutDown shuts the server down and returns what Serve returned
+func (c *client) shutDown() error {
+	require.Nil(c.t, c.request("shutdown", nil, nil))
+	c.notify("exit", nil)
+	return <-c.served
+}
+
+// at returns the parameters of a request about a position in a document
+func at(uri string, line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{textDocumentIdentifier{uri}, position{line, character}}
+}
+
+func TestServer_PublishesDiagnosticsAsDocumentsChange(t *testing.T) {
+	c := newClient(t, NewServer(), true)
+	uri := "untitled:main.tva"
+
+	assert.Equal(t, []diagnostic{{
+		Range:    textRange{position{1, 1}, position{1, 6}},
+		Severity: severityError,
+		Source:   "tva",
+		Message:  "unknown instruction 'bogus'",
+	}}, c.open(uri, "hlt\n\tbogus r0 # oops\n"))
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": "add 1,, r0\njmp nowhere\n"}},
+	})
+	diagnostics := c.diagnostics(uri)
+	require.Len(t, diagnostics, 1, "syntax errors are reported before the program is assembled")
+	assert.Equal(t, position{0, 6}, diagnostics[0].Range.Start)
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 3},
+		"contentChanges": []map[string]any{{"text": "jmp nowhere\n"}},
+	})
+	diagnostics = c.diagnostics(uri)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "undefined label 'nowhere'", diagnostics[0].Message)
+	assert.Equal(t, textRange{position{0, 0}, position{0, 3}}, diagnostics[0].Range)
+
+	c.notify("textDocument/didClose", map[string]any{"textDocument": textDocumentIdentifier{uri}})
+	assert.Empty(t, c.diagnostics(uri))
+	assert.NoError(t, c.shutDown())
+}
+
+// writeProgram writes a program that includes a library into a temporary directory, and returns the URIs of both
+func writeProgram(t *testing.T) (string, string) {
+	directory := t.TempDir()
+	main := filepath.Join(directory, "main.tva")
+	lib := filepath.Join(directory, "lib.tva")
+	require.NoError(t, os.WriteFile(main, []byte(".include \"lib.tva\"\n\tin r0\nloop:\n\tjmp square\nback:\n\tout r0\n\tjmp loop\n"), 0o644))
+	require.NoError(t, os.WriteFile(lib, []byte("square:\n\tmlt r0, r0, r0\n\tjmp back\n"), 0o644))
+
+	return pathURI(main), pathURI(lib)
+}
+
+func TestServer_FindsDefinitionsAndReferencesAcrossIncludes(t *testing.T) {
+	mainURI, libURI := writeProgram(t)
+	source, err := os.ReadFile(uriPath(mainURI))
+	require.NoError(t, err)
+
+	c := newClient(t, NewServer(), true)
+	require.Empty(t, c.open(mainURI, string(source)))
+
+	var locations []location
+	require.Nil(t, c.request("textDocument/definition", at(mainURI, 3, 6), &locations))
+	assert.Equal(t, []location{{libURI, textRange{position{0, 0}, position{0, 6}}}}, locations)
+
+	require.Nil(t, c.request("textDocument/definition", at(mainURI, 6, 6), &locations))
+	assert.Equal(t, []location{{mainURI, textRange{position{2, 0}, position{2, 4}}}}, locations)
+
+	params := referenceParams{textDocumentPositionParams: at(mainURI, 4, 1)}
+	params.Context.IncludeDeclaration = true
+	require.Nil(t, c.request("textDocument/references", params, &locations))
+	assert.Equal(t, []location{
+		{mainURI, textRange{position{4, 0}, position{4, 4}}},
+		{libURI, textRange{position{2, 5}, position{2, 9}}},
+	}, locations)
+
+	var missing []location
+	require.Nil(t, c.request("textDocument/definition", at(mainURI, 1, 1), &missing))
+	assert.Nil(t, missing, "mnemonics have no definition")
+	assert.NoError(t, c.shutDown())
+}
+
+func TestServer_HoversShowEncodingsRegistersAndLabels(t *testing.T) {
+	mainURI, _ := writeProgram(t)
+	source, err := os.ReadFile(uriPath(mainURI))
+	require.NoError(t, err)
+
+	c := newClient(t, NewServer(), true)
+	require.Empty(t, c.open(mainURI, string(source)))
+
+	var result hover
+	require.Nil(t, c.request("textDocument/hover", at(mainURI, 1, 1), &result))
+	assert.Equal(t, "markdown", result.Contents.Kind)
+	assert.Contains(t, result.Contents.Value, "in dst")
+	assert.Contains(t, result.Contents.Value, "first word is `203`")
+	assert.Contains(t, result.Contents.Value, "   7  203 0                in r0")
+	assert.Equal(t, &textRange{position{1, 1}, position{1, 3}}, result.Range)
+
+	require.Nil(t, c.request("textDocument/hover", at(mainURI, 3, 2), &result))
+	assert.Contains(t, result.Contents.Value, "Pseudo-instruction")
+	assert.Contains(t, result.Contents.Value, "jit 1, 0")
+
+	require.Nil(t, c.request("textDocument/hover", at(mainURI, 5, 6), &result))
+	assert.Equal(t, "`$r0`: Register 0: reserved, so routines must restore it before returning.", result.Contents.Value)
+
+	require.Nil(t, c.request("textDocument/hover", at(mainURI, 2, 0), &result))
+	assert.Equal(t, "label `loop` at address 9, defined on line 3 (1 uses)", result.Contents.Value)
+	assert.NoError(t, c.shutDown())
+}
+
+func TestServer_CompletesMnemonicsAndRegisters(t *testing.T) {
+	c := newClient(t, NewServer(), true)
+	uri := "untitled:main.tva"
+	c.open(uri, "loop: a\n\tadd r0, \n# m\n")
+
+	var items []completionItem
+	require.Nil(t, c.request("textDocument/completion", at(uri, 0, 7), &items))
+	require.Len(t, items, len(assembler.Mnemonics()))
+	assert.Equal(t, completionItem{"add", completionItemKindKeyword, "add a, b, dst", &markupContent{"markdown", "Adds a and b, and writes the sum to dst."}}, items[0])
+
+	require.Nil(t, c.request("textDocument/completion", at(uri, 1, 9), &items))
+	require.Len(t, items, 14)
+	assert.Equal(t, "t0", items[5].Label)
+	assert.Equal(t, "la", items[13].Label)
+
+	require.Nil(t, c.request("textDocument/completion", at(uri, 2, 3), &items))
+	assert.Empty(t, items, "comments are not completed")
+	assert.NoError(t, c.shutDown())
+}
+
+func TestServer_FormatsDocuments(t *testing.T) {
+	c := newClient(t, NewServer(), true)
+	uri := "untitled:main.tva"
+	c.open(uri, "loop:   add 1,2,r0\njmp loop")
+
+	var edits []textEdit
+	require.Nil(t, c.request("textDocument/formatting", documentFormattingParams{textDocumentIdentifier{uri}}, &edits))
+	assert.Equal(t, []textEdit{{textRange{position{0, 0}, position{1, 8}}, "loop:\n\tadd 1, 2, r0\n\tjmp loop\n"}}, edits)
+
+	c.open(uri, "add 1,, r0\n")
+	require.Nil(t, c.request("textDocument/formatting", documentFormattingParams{textDocumentIdentifier{uri}}, &edits))
+	assert.Empty(t, edits, "source with syntax errors is left alone")
+	assert.NoError(t, c.shutDown())
+}
+
+func TestServer_FollowsTheLifecycle(t *testing.T) {
+	c := newClient(t, NewServer(), false)
+	err := c.request("textDocument/hover", at("untitled:main.tva", 0, 0), nil)
+	require.NotNil(t, err)
+	assert.Equal(t, codeServerNotInitialized, err.Code)
+
+	require.Nil(t, c.request("initialize", map[string]any{}, nil))
+	err = c.request("workspace/symbol", map[string]any{}, nil)
+	require.NotNil(t, err)
+	assert.Equal(t, codeMethodNotFound, err.Code)
+
+	err = c.request("textDocument/hover", at("untitled:closed.tva", 0, 0), nil)
+	require.NotNil(t, err)
+	assert.Equal(t, codeInvalidParams, err.Code)
+
+	c.notify("exit", nil)
+	assert.EqualError(t, <-c.served, "the client exited without shutting the server down")
+}
+
+func TestInstructionDocs_DocumentEveryMnemonic(t *testing.T) {
+	for _, mnemonic := range assembler.Mnemonics() {
+		assert.Contains(t, instructionDocs, mnemonic)
+	}
+
+	assert.Len(t, instructionDocs, len(assembler.Mnemonics()))
+}
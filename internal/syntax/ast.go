@@ -0,0 +1,192 @@
+package syntax
+
+// Node is a node of the syntax tree of a TVA file
+type Node interface {
+	// Pos returns where the node starts
+	Pos() Position
+}
+
+// File is a parsed TVA source file, with a Line for every line of the source, blank ones included
+type File struct {
+	Name  string
+	Lines []*Line
+}
+
+func (f *File) Pos() Position { return Position{f.Name, 1, 1} }
+
+// Line is a line of TVA source: any number of labels, then an optional statement, then an optional comment
+type Line struct {
+	Position Position
+
+	// Text is the line as it was written, without its line ending
+	Text string
+
+	// Code is the text of the line's labels and statement, without the comment or surrounding whitespace
+	Code string
+
+	Labels    []*Label
+	Statement Statement
+	Comment   *Comment
+}
+
+func (l *Line) Pos() Position { return l.Position }
+
+// IsBlank returns true if the line has neither labels nor a statement
+func (l *Line) IsBlank() bool {
+	return len(l.Labels) == 0 && l.Statement == nil
+}
+
+// Label is a label defined at the start of a line, written as `name:`
+type Label struct {
+	Position Position
+	Name     string
+}
+
+func (l *Label) Pos() Position { return l.Position }
+
+// Comment is a comment, from '#' to the end of the line
+type Comment struct {
+	Position Position
+
+	// Text is the comment as it was written, '#' included
+	Text string
+}
+
+func (c *Comment) Pos() Position { return c.Position }
+
+// Statement is an Instruction or a Directive
+type Statement interface {
+	Node
+	statement()
+}
+
+// Instruction is an instruction, pseudo-instruction or macro invocation: a mnemonic followed by comma-separated
+// operands. The mnemonic is whatever name was written, which the parser does not check; within a macro's body it
+// may also be a macro parameter, such as `\operation`
+type Instruction struct {
+	Position Position
+	Mnemonic string
+	Operands []*Operand
+}
+
+func (i *Instruction) Pos() Position { return i.Position }
+func (*Instruction) statement()      {}
+
+// Directive is a directive, such as `.include "lib.tva"` or `.equ SIZE, 16`. Name includes the dot. The arguments
+// of .macro are its name and parameters as Identifiers, those of .equ and .set are the constant's name as an
+// Identifier followed by its expression, and those of .include are a single String
+type Directive struct {
+	Position  Position
+	Name      string
+	Arguments []Expression
+}
+
+func (d *Directive) Pos() Position { return d.Position }
+func (*Directive) statement()      {}
+
+// OperandMode is how an operand is written, which decides the parameter mode it is assembled with
+type OperandMode int
+
+const (
+	// OperandImmediate is an expression whose value is the operand, optionally written after the `i` indicator
+	OperandImmediate OperandMode = iota
+
+	// OperandAddress is `$` followed by an expression whose value is the address of the operand
+	OperandAddress
+
+	// OperandRegister is the name of a register on its own, such as `r0`, `t3` or `la`
+	OperandRegister
+)
+
+// Operand is an operand of an instruction
+type Operand struct {
+	Position Position
+	Mode     OperandMode
+
+	// Indicator is true for immediates written after the `i` indicator
+	Indicator bool
+
+	// Register is the name of the register of register mode operands, which the parser does not check
+	Register string
+
+	// Expression is the expression of immediate and address mode operands
+	Expression Expression
+
+	// Text is the operand as it was written
+	Text string
+}
+
+func (o *Operand) Pos() Position { return o.Position }
+
+// Expression is a constant expression: a Number, String, Identifier, MacroParameter, Unary, Binary or Paren
+type Expression interface {
+	Node
+	expression()
+}
+
+// Number is a number or character literal. Signs written directly before number literals are part of them, so
+// that `-0x8000000000000000` is a single literal
+type Number struct {
+	Position Position
+
+	// Text is the literal as it was written, such as `0x1F`, `-5` or `'A'`
+	Text  string
+	Value int
+}
+
+// String is a string literal, which only .include accepts
+type String struct {
+	Position Position
+
+	// Text is the literal as it was written, quotes included
+	Text  string
+	Value string
+}
+
+// Identifier is the name of a label or constant, or of a register used where only an expression is allowed
+type Identifier struct {
+	Position Position
+	Name     string
+}
+
+// MacroParameter is a reference to a parameter in a macro's body, such as `\register`. Name leaves out the backslash
+type MacroParameter struct {
+	Position Position
+	Name     string
+}
+
+// Unary applies + or - to an expression
+type Unary struct {
+	Position Position
+	Operator string
+	Operand  Expression
+}
+
+// Binary applies one of the binary operators to two expressions
+type Binary struct {
+	Position    Position
+	Operator    string
+	Left, Right Expression
+}
+
+// Paren is an expression within parentheses
+type Paren struct {
+	Position Position
+	Inner    Expression
+}
+
+func (n *Number) Pos() Position         { return n.Position }
+func (s *String) Pos() Position         { return s.Position }
+func (i *Identifier) Pos() Position     { return i.Position }
+func (m *MacroParameter) Pos() Position { return m.Position }
+func (u *Unary) Pos() Position          { return u.Position }
+func (b *Binary) Pos() Position         { return b.Position }
+func (p *Paren) Pos() Position          { return p.Position }
+
+func (*Number) expression()         {}
+func (*String) expression()         {}
+func (*Identifier) expression()     {}
+func (*MacroParameter) expression() {}
+func (*Unary) expression()          {}
+func (*Binary) expression()         {}
+func (*Paren) expression()          {}
@@ -0,0 +1,495 @@
+package syntax
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parse parses TVA source, found in the file provided, into a syntax tree. Lines that cannot be parsed are kept with
+// whatever could be parsed of them (their labels, usually), so the tree is always complete; the error, if not nil,
+// is an ErrorList of every problem found, in the order they appear in the source
+func Parse(source, file string) (*File, error) {
+	return parse(source, file, 1)
+}
+
+// ParseLine parses a single line of TVA source, found on the line of the file provided
+func ParseLine(text, file string, line int) (*Line, error) {
+	if strings.Contains(text, "\n") {
+		return nil, errors.New("cannot parse several lines as one")
+	}
+
+	parsed, err := parse(text, file, line)
+	return parsed.Lines[0], err
+}
+
+// parse parses source whose first line is the line of the file provided
+func parse(source, file string, firstLine int) (*File, error) {
+	tokens, errs := lex(source, file, firstLine)
+
+	parsed := &File{Name: file}
+	texts := strings.Split(source, "\n")
+	start := 0
+	for index, token := range tokens {
+		if token.Kind != TokenNewline && token.Kind != TokenEOF {
+			continue
+		}
+
+		text := strings.TrimSuffix(texts[len(parsed.Lines)], "\r")
+		position := Position{file, firstLine + len(parsed.Lines), 1}
+		parsed.Lines = append(parsed.Lines, parseLine(tokens[start:index], token, text, position, &errs))
+		start = index + 1
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Position.Line != errs[j].Position.Line {
+			return errs[i].Position.Line < errs[j].Position.Line
+		}
+
+		return errs[i].Position.Column < errs[j].Position.Column
+	})
+
+	return parsed, errs.err()
+}
+
+// parseLine parses the tokens of a line, which are followed by the end token provided (a newline or the end of the
+// file), adding any error found to errs
+func parseLine(tokens []Token, end Token, text string, position Position, errs *ErrorList) *Line {
+	line := &Line{Position: position, Text: text}
+
+	code := tokens
+	if len(code) > 0 && code[len(code)-1].Kind == TokenComment {
+		comment := code[len(code)-1]
+		line.Comment = &Comment{comment.Position, comment.Text}
+		code = code[:len(code)-1]
+	}
+
+	if len(code) > 0 {
+		line.Code = text[code[0].Position.Column-1 : code[len(code)-1].end()-1]
+	}
+
+	stream := &tokenStream{tokens: code, end: end, text: text}
+	if err := stream.parseLine(line); err != nil && !stream.invalid() {
+		*errs = append(*errs, err)
+	}
+
+	return line
+}
+
+// tokenStream is a recursive descent parser over tokens that all come from the same line of text
+type tokenStream struct {
+	tokens []Token
+	index  int
+
+	// end is the token just past the last one, returned by peek once every token is consumed
+	end  Token
+	text string
+}
+
+func (s *tokenStream) peek() Token {
+	return s.peekAt(0)
+}
+
+func (s *tokenStream) peekAt(offset int) Token {
+	if s.index+offset < len(s.tokens) {
+		return s.tokens[s.index+offset]
+	}
+
+	return Token{Kind: TokenEOF, Position: s.end.Position}
+}
+
+func (s *tokenStream) next() Token {
+	token := s.peek()
+	if s.index < len(s.tokens) {
+		s.index++
+	}
+
+	return token
+}
+
+func (s *tokenStream) done() bool {
+	return s.index >= len(s.tokens)
+}
+
+// invalid returns true if the stream holds a token the lexer could not make sense of, which has already been
+// reported as an error
+func (s *tokenStream) invalid() bool {
+	for _, token := range s.tokens {
+		if token.Kind == TokenInvalid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// source returns the text the tokens provided were lexed from
+func (s *tokenStream) source(tokens []Token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	return s.text[tokens[0].Position.Column-1 : tokens[len(tokens)-1].end()-1]
+}
+
+func errorAt(token Token, format string, args ...any) *Error {
+	return &Error{token.Position, fmt.Sprintf(format, args...)}
+}
+
+// parseLine parses labels followed by an optional statement into the line provided
+func (s *tokenStream) parseLine(line *Line) *Error {
+	for s.peek().Kind == TokenIdentifier && s.peekAt(1).Kind == TokenColon {
+		label := s.next()
+		s.next()
+		line.Labels = append(line.Labels, &Label{label.Position, label.Text})
+	}
+
+	var err *Error
+	switch token := s.peek(); token.Kind {
+	case TokenEOF:
+		return nil
+	case TokenDirective:
+		line.Statement, err = s.parseDirective()
+	case TokenIdentifier, TokenMacroParameter:
+		line.Statement, err = s.parseInstruction()
+	default:
+		return errorAt(token, "expected a label, instruction or directive but found %v", token.describe())
+	}
+
+	if err == nil && !s.done() {
+		err = errorAt(s.peek(), "expected ',' but found %v", s.peek().describe())
+	}
+
+	return err
+}
+
+// parseInstruction parses a mnemonic followed by comma-separated operands
+func (s *tokenStream) parseInstruction() (Statement, *Error) {
+	mnemonic := s.next()
+	instruction := &Instruction{Position: mnemonic.Position, Mnemonic: mnemonic.Text}
+	if s.done() {
+		return instruction, nil
+	}
+
+	for {
+		operand, err := s.parseOperand()
+		if err != nil {
+			return instruction, err
+		}
+
+		instruction.Operands = append(instruction.Operands, operand)
+		if s.peek().Kind != TokenComma {
+			return instruction, nil
+		}
+
+		s.next()
+	}
+}
+
+// registerNamePattern matches the names of registers, valid or not
+var registerNamePattern = regexp.MustCompile(`^(la|[rt]\d+)$`)
+
+// IsRegisterName reports whether the name provided is written like the name of a register, valid or not, and so
+// is parsed as a register mode operand on its own
+func IsRegisterName(name string) bool {
+	return registerNamePattern.MatchString(name)
+}
+
+// parseOperand parses an operand, which runs up to the next comma outside of parentheses
+func (s *tokenStream) parseOperand() (*Operand, *Error) {
+	start, depth := s.index, 0
+	for ; s.index < len(s.tokens); s.index++ {
+		kind := s.tokens[s.index].Kind
+		if kind == TokenComma && depth == 0 {
+			break
+		} else if kind == TokenLeftParen {
+			depth++
+		} else if kind == TokenRightParen {
+			depth--
+		}
+	}
+
+	tokens := s.tokens[start:s.index]
+	if len(tokens) == 0 {
+		return nil, errorAt(s.peek(), "expected an operand but found %v", s.peek().describe())
+	}
+
+	text := s.source(tokens)
+	operand := &Operand{Position: tokens[0].Position, Text: text}
+	if len(tokens) == 1 && tokens[0].Kind == TokenIdentifier && registerNamePattern.MatchString(tokens[0].Text) {
+		operand.Mode, operand.Register = OperandRegister, tokens[0].Text
+		return operand, nil
+	}
+
+	inner := &tokenStream{tokens: tokens, end: s.peek(), text: s.text}
+	switch tokens[0].Kind {
+	case TokenDollar:
+		operand.Mode = OperandAddress
+		inner.next()
+	case TokenImmediate:
+		operand.Indicator = true
+		inner.next()
+	}
+
+	expression, err := inner.parseExpression(0)
+	if err == nil && !inner.done() {
+		err = errorAt(inner.peek(), "unexpected %v", inner.peek().describe())
+	}
+
+	if err != nil {
+		return nil, &Error{err.Position, fmt.Sprintf("invalid expression '%v': %v", text, err.Message)}
+	}
+
+	operand.Expression = expression
+	return operand, nil
+}
+
+// parseDirective parses a directive and its arguments, which are comma-separated expressions unless the directive
+// says otherwise (see Directive)
+func (s *tokenStream) parseDirective() (Statement, *Error) {
+	name := s.next()
+	directive := &Directive{Position: name.Position, Name: name.Text}
+	switch name.Text {
+	case ".include":
+		path := s.next()
+		if path.Kind != TokenString || !s.done() {
+			return directive, errorAt(name, "expected '.include \"path\"'")
+		}
+
+		value, err := parseString(path.Text)
+		if err != nil {
+			return directive, errorAt(path, "%v", err)
+		}
+
+		directive.Arguments = []Expression{&String{path.Position, path.Text, value}}
+	case ".macro":
+		if s.done() {
+			return directive, errorAt(name, "'.macro' needs a name")
+		}
+
+		for !s.done() {
+			token := s.next()
+			switch {
+			case token.Kind == TokenIdentifier:
+				directive.Arguments = append(directive.Arguments, &Identifier{token.Position, token.Text})
+			case len(directive.Arguments) == 0:
+				return directive, errorAt(token, "invalid macro name %v", token.describe())
+			case token.Kind != TokenComma:
+				return directive, errorAt(token, "invalid macro parameter %v", token.describe())
+			}
+		}
+	case ".equ", ".set":
+		constant := s.next()
+		if s.peek().Kind == TokenComma {
+			s.next()
+		}
+
+		if constant.Kind != TokenIdentifier || s.done() {
+			return directive, errorAt(name, "expected '%v NAME expression'", name.Text)
+		}
+
+		tokens := s.tokens[s.index:]
+		expression, err := s.parseExpression(0)
+		if err == nil && !s.done() {
+			err = errorAt(s.peek(), "unexpected %v", s.peek().describe())
+		}
+
+		if err != nil {
+			return directive, &Error{err.Position, fmt.Sprintf("invalid expression '%v': %v", s.source(tokens), err.Message)}
+		}
+
+		directive.Arguments = []Expression{&Identifier{constant.Position, constant.Text}, expression}
+	default:
+		for !s.done() {
+			argument, err := s.parseExpression(0)
+			if err != nil {
+				return directive, err
+			}
+
+			directive.Arguments = append(directive.Arguments, argument)
+			if s.peek().Kind != TokenComma {
+				break
+			}
+
+			s.next()
+		}
+	}
+
+	return directive, nil
+}
+
+// binaryOperators are the binary operators of expressions, from the lowest precedence to the highest
+var binaryOperators = [][]string{{"|"}, {"&"}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"}}
+
+// parseExpression parses a run of terms joined by operators of the precedence provided (an index into
+// binaryOperators) or higher. Operators bind as they do in C
+func (s *tokenStream) parseExpression(precedence int) (Expression, *Error) {
+	if precedence == len(binaryOperators) {
+		return s.parseTerm()
+	}
+
+	left, err := s.parseExpression(precedence + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for s.peek().Kind == TokenOperator && contains(binaryOperators[precedence], s.peek().Text) {
+		operator := s.next()
+		right, err := s.parseExpression(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Binary{left.Pos(), operator.Text, left, right}
+	}
+
+	return left, nil
+}
+
+// parseTerm parses a literal, name, macro parameter, parenthesised expression, or a term preceded by + or -
+func (s *tokenStream) parseTerm() (Expression, *Error) {
+	token := s.next()
+	switch token.Kind {
+	case TokenLeftParen:
+		inner, err := s.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.peek().Kind != TokenRightParen {
+			return nil, errorAt(s.peek(), "missing ')'")
+		}
+
+		s.next()
+		return &Paren{token.Position, inner}, nil
+	case TokenNumber:
+		return parseNumber(token, token.Text)
+	case TokenCharacter:
+		value, err := ParseCharacter(token.Text)
+		if err != nil {
+			return nil, errorAt(token, "%v", err)
+		}
+
+		return &Number{token.Position, token.Text, value}, nil
+	case TokenString:
+		value, err := parseString(token.Text)
+		if err != nil {
+			return nil, errorAt(token, "%v", err)
+		}
+
+		return &String{token.Position, token.Text, value}, nil
+	case TokenIdentifier:
+		return &Identifier{token.Position, token.Text}, nil
+	case TokenMacroParameter:
+		return &MacroParameter{token.Position, token.Text[1:]}, nil
+	case TokenOperator:
+		if token.Text != "+" && token.Text != "-" {
+			break
+		}
+
+		if s.peek().Kind == TokenNumber {
+			literal := s.next()
+			return parseNumber(token, token.Text+literal.Text)
+		}
+
+		operand, err := s.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Unary{token.Position, token.Text, operand}, nil
+	case TokenEOF:
+		return nil, errorAt(token, "expected a number, label or '(' at the end")
+	}
+
+	return nil, errorAt(token, "expected a number, label or '(' but found %v", token.describe())
+}
+
+// parseNumber parses the number literal written as text, which starts at the token provided
+func parseNumber(token Token, text string) (Expression, *Error) {
+	value, err := ParseLiteral(text)
+	if err != nil {
+		return nil, errorAt(token, "%v", err)
+	}
+
+	return &Number{token.Position, text, value}, nil
+}
+
+// literalBases are the prefixes of number literals written in bases other than 10
+var literalBases = map[string]int{"0x": 16, "0X": 16, "0b": 2, "0B": 2, "0o": 8, "0O": 8}
+
+// ParseLiteral parses a number literal, optionally signed: decimal (42), hexadecimal (0x2A), binary (0b101010) or
+// octal (0o52). Literals must fit in a 64-bit integer; whether they fit in a word is up to the word format
+func ParseLiteral(literal string) (int, error) {
+	digits := strings.TrimLeft(literal, "+-")
+	sign := literal[:len(literal)-len(digits)]
+
+	base := 10
+	if len(digits) > 2 {
+		if prefixBase, hasPrefix := literalBases[digits[:2]]; hasPrefix {
+			base, digits = prefixBase, digits[2:]
+		}
+	}
+
+	number, err := strconv.ParseInt(sign+digits, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("literal '%v' does not fit in a 64-bit integer", literal)
+	} else if err != nil {
+		return 0, fmt.Errorf("invalid number literal '%v'", literal)
+	}
+
+	return int(number), nil
+}
+
+// escapes are the escape sequences character and string literals may use
+var escapes = map[string]rune{`\n`: '\n', `\t`: '\t', `\r`: '\r', `\0`: 0, `\\`: '\\', `\'`: '\'', `\"`: '"'}
+
+// ParseCharacter returns the code point of a character literal, such as 'A' or '\n'
+func ParseCharacter(literal string) (int, error) {
+	inner := literal[1 : len(literal)-1]
+	if escaped, isEscape := escapes[inner]; isEscape {
+		return int(escaped), nil
+	}
+
+	runes := []rune(inner)
+	if len(runes) != 1 || inner == `\` {
+		return 0, fmt.Errorf("invalid character literal %v", literal)
+	}
+
+	return int(runes[0]), nil
+}
+
+// parseString returns the value of a string literal, such as "lib.tva"
+func parseString(literal string) (string, error) {
+	inner := literal[1 : len(literal)-1]
+	value := strings.Builder{}
+	for index := 0; index < len(inner); index++ {
+		if inner[index] != '\\' {
+			value.WriteByte(inner[index])
+			continue
+		}
+
+		escaped, isEscape := escapes[inner[index:min(index+2, len(inner))]]
+		if !isEscape {
+			return "", fmt.Errorf("invalid escape sequence in string literal %v", literal)
+		}
+
+		value.WriteRune(escaped)
+		index++
+	}
+
+	return value.String(), nil
+}
+
+func contains(values []string, wanted string) bool {
+	for _, candidate := range values {
+		if candidate == wanted {
+			return true
+		}
+	}
+
+	return false
+}
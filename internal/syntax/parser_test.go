@@ -0,0 +1,125 @@
+package syntax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLex_PositionsEveryToken(t *testing.T) {
+	tokens, errs := Lex("start: add i5, $x # '#'\n\t.include \"a#b\"", "main.tva")
+	require.Empty(t, errs)
+
+	kinds := make([]TokenKind, 0, len(tokens))
+	for _, token := range tokens {
+		kinds = append(kinds, token.Kind)
+	}
+
+	assert.Equal(t, []TokenKind{
+		TokenIdentifier, TokenColon, TokenIdentifier, TokenImmediate, TokenNumber, TokenComma, TokenDollar,
+		TokenIdentifier, TokenComment, TokenNewline, TokenDirective, TokenString, TokenEOF,
+	}, kinds)
+	assert.Equal(t, Token{TokenComment, "# '#'", Position{"main.tva", 1, 19}}, tokens[8])
+	assert.Equal(t, Token{TokenString, "\"a#b\"", Position{"main.tva", 2, 11}}, tokens[11])
+}
+
+func TestLex_ReportsUnexpectedCharacters(t *testing.T) {
+	_, errs := Lex("out 1 ~ 2\nout 'A", "")
+	require.Len(t, errs, 2)
+	assert.Equal(t, &Error{Position{"", 1, 7}, "unexpected character '~'"}, errs[0])
+	assert.Equal(t, &Error{Position{"", 2, 5}, "unterminated character literal"}, errs[1])
+}
+
+func TestParse_BuildsTheSyntaxTree(t *testing.T) {
+	file, err := Parse("loop: again: sub r0, -(SIZE + 1) * 2, $buffer # count down\n\n.equ SIZE, 'A'", "main.tva")
+	require.NoError(t, err)
+	require.Len(t, file.Lines, 3)
+
+	line := file.Lines[0]
+	assert.Equal(t, "loop: again: sub r0, -(SIZE + 1) * 2, $buffer", line.Code)
+	assert.Equal(t, []*Label{{Position{"main.tva", 1, 1}, "loop"}, {Position{"main.tva", 1, 7}, "again"}}, line.Labels)
+	assert.Equal(t, &Comment{Position{"main.tva", 1, 47}, "# count down"}, line.Comment)
+
+	instruction, isInstruction := line.Statement.(*Instruction)
+	require.True(t, isInstruction)
+	assert.Equal(t, "sub", instruction.Mnemonic)
+	require.Len(t, instruction.Operands, 3)
+
+	assert.Equal(t, &Operand{Position: Position{"main.tva", 1, 18}, Mode: OperandRegister, Register: "r0", Text: "r0"}, instruction.Operands[0])
+
+	product := instruction.Operands[1].Expression.(*Binary)
+	assert.Equal(t, "*", product.Operator)
+	assert.Equal(t, Position{"main.tva", 1, 22}, product.Position)
+	assert.Equal(t, &Number{Position{"main.tva", 1, 36}, "2", 2}, product.Right)
+
+	negation := product.Left.(*Unary)
+	sum := negation.Operand.(*Paren).Inner.(*Binary)
+	assert.Equal(t, &Identifier{Position{"main.tva", 1, 24}, "SIZE"}, sum.Left)
+
+	assert.Equal(t, OperandAddress, instruction.Operands[2].Mode)
+	assert.Equal(t, "$buffer", instruction.Operands[2].Text)
+	assert.Equal(t, &Identifier{Position{"main.tva", 1, 40}, "buffer"}, instruction.Operands[2].Expression)
+
+	assert.True(t, file.Lines[1].IsBlank())
+
+	directive := file.Lines[2].Statement.(*Directive)
+	assert.Equal(t, ".equ", directive.Name)
+	assert.Equal(t, []Expression{&Identifier{Position{"main.tva", 3, 6}, "SIZE"}, &Number{Position{"main.tva", 3, 12}, "'A'", 65}}, directive.Arguments)
+}
+
+func TestParse_FoldsSignsIntoLiterals(t *testing.T) {
+	for text, expected := range map[string]Expression{
+		"out -0x8000000000000000": &Number{Position{"", 1, 5}, "-0x8000000000000000", -0x8000000000000000},
+		"out i-5":                 &Number{Position{"", 1, 6}, "-5", -5},
+		"out - 5":                 &Number{Position{"", 1, 5}, "-5", -5},
+		"out -X":                  &Unary{Position{"", 1, 5}, "-", &Identifier{Position{"", 1, 6}, "X"}},
+	} {
+		line, err := ParseLine(text, "", 1)
+		require.NoError(t, err, text)
+		assert.Equal(t, expected, line.Statement.(*Instruction).Operands[0].Expression, text)
+	}
+}
+
+func TestParse_ParsesDirectives(t *testing.T) {
+	file, err := Parse(".macro inc x, y\n.macro pair a b\n.include \"lib\\\\x.tva\"\n.global a, b\n.endm", "")
+	require.NoError(t, err)
+
+	arguments := func(line int) []Expression { return file.Lines[line].Statement.(*Directive).Arguments }
+	assert.Equal(t, []Expression{&Identifier{Position{"", 1, 8}, "inc"}, &Identifier{Position{"", 1, 12}, "x"}, &Identifier{Position{"", 1, 15}, "y"}}, arguments(0))
+	assert.Len(t, arguments(1), 3)
+	assert.Equal(t, []Expression{&String{Position{"", 3, 10}, "\"lib\\\\x.tva\"", "lib\\x.tva"}}, arguments(2))
+	assert.Len(t, arguments(3), 2)
+	assert.Empty(t, arguments(4))
+}
+
+func TestParse_ReportsEveryErrorWithItsPosition(t *testing.T) {
+	file, err := Parse("out t$5\nstart: 12\nhlt\nadd 1,\n.equ A\n.include lib.tva\nout (1\nout 0x", "")
+	require.Len(t, file.Lines, 8)
+	assert.Equal(t, []*Label{{Position{"", 2, 1}, "start"}}, file.Lines[1].Labels, "lines keep what could be parsed")
+
+	var errs ErrorList
+	require.True(t, errors.As(err, &errs))
+	assert.Equal(t, ErrorList{
+		{Position{"", 1, 6}, "invalid expression 't$5': unexpected '$'"},
+		{Position{"", 2, 8}, "expected a label, instruction or directive but found '12'"},
+		{Position{"", 4, 7}, "expected an operand but found the end of the line"},
+		{Position{"", 5, 1}, "expected '.equ NAME expression'"},
+		{Position{"", 6, 1}, "expected '.include \"path\"'"},
+		{Position{"", 7, 7}, "invalid expression '(1': missing ')'"},
+		{Position{"", 8, 5}, "invalid expression '0x': invalid number literal '0x'"},
+	}, errs)
+	assert.Equal(t, "invalid expression 't$5': unexpected '$' (column 6) (and 6 more errors)", err.Error())
+}
+
+func TestParseLiteral_ParsesEveryBase(t *testing.T) {
+	for literal, expected := range map[string]int{"42": 42, "-0x2A": -42, "0b101010": 42, "+0o52": 42, "0X2a": 42} {
+		value, err := ParseLiteral(literal)
+		require.NoError(t, err, literal)
+		assert.Equal(t, expected, value, literal)
+	}
+
+	_, err := ParseLiteral("9223372036854775808")
+	assert.EqualError(t, err, "literal '9223372036854775808' does not fit in a 64-bit integer")
+}
@@ -0,0 +1,299 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is a position in a TVA source file. Line and Column start at 1, and columns count bytes
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String returns the position in the usual "file:line:column" notation, leaving out the file if it is unknown
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%v:%v", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%v:%v:%v", p.File, p.Line, p.Column)
+}
+
+// TokenKind is the kind of a token
+type TokenKind int
+
+const (
+	// TokenInvalid is a run of characters that cannot start any token. Lexing reports an error for each
+	TokenInvalid TokenKind = iota
+
+	// TokenEOF marks the end of the source
+	TokenEOF
+
+	// TokenNewline ends every line but the last
+	TokenNewline
+
+	// TokenComment is a comment, from '#' to the end of the line
+	TokenComment
+
+	// TokenIdentifier is a name: a mnemonic, register, label or constant
+	TokenIdentifier
+
+	// TokenDirective is the name of a directive, such as `.include`, dot included
+	TokenDirective
+
+	// TokenMacroParameter is a reference to a macro parameter, such as `\register`, backslash included
+	TokenMacroParameter
+
+	// TokenNumber is a number literal, which may not be valid (see ParseLiteral)
+	TokenNumber
+
+	// TokenCharacter is a character literal, such as 'A', quotes included
+	TokenCharacter
+
+	// TokenString is a string literal, such as "lib.tva", quotes included
+	TokenString
+
+	// TokenImmediate is the `i` indicator written directly before an immediate, as in `i12` or `i(SIZE * 2)`
+	TokenImmediate
+
+	// TokenDollar is the `$` indicator of address mode operands
+	TokenDollar
+
+	TokenComma
+	TokenColon
+	TokenLeftParen
+	TokenRightParen
+
+	// TokenOperator is one of the operators of expressions: + - * / % << >> & |
+	TokenOperator
+)
+
+var tokenKindNames = map[TokenKind]string{
+	TokenInvalid:        "invalid token",
+	TokenEOF:            "end of file",
+	TokenNewline:        "end of line",
+	TokenComment:        "comment",
+	TokenIdentifier:     "identifier",
+	TokenDirective:      "directive",
+	TokenMacroParameter: "macro parameter",
+	TokenNumber:         "number",
+	TokenCharacter:      "character literal",
+	TokenString:         "string literal",
+	TokenImmediate:      "immediate indicator",
+	TokenDollar:         "'$'",
+	TokenComma:          "','",
+	TokenColon:          "':'",
+	TokenLeftParen:      "'('",
+	TokenRightParen:     "')'",
+	TokenOperator:       "operator",
+}
+
+func (t TokenKind) String() string {
+	return tokenKindNames[t]
+}
+
+// Token is a token of TVA source, with the text it was lexed from and where that text starts
+type Token struct {
+	Kind     TokenKind
+	Text     string
+	Position Position
+}
+
+// describe describes the token for error messages
+func (t Token) describe() string {
+	switch t.Kind {
+	case TokenEOF, TokenNewline:
+		return "the end of the line"
+	default:
+		return fmt.Sprintf("'%v'", t.Text)
+	}
+}
+
+// end returns the column just after the token
+func (t Token) end() int {
+	return t.Position.Column + len(t.Text)
+}
+
+// Error is an error in TVA source, at the position provided
+type Error struct {
+	Position Position
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (column %v)", e.Message, e.Position.Column)
+}
+
+// ErrorList is every error found in a TVA source file, in the order they were found
+type ErrorList []*Error
+
+func (e ErrorList) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%v (and %v more errors)", e[0].Error(), len(e)-1)
+	}
+}
+
+// err returns the list as an error, or nil if it is empty
+func (e ErrorList) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Lex splits TVA source into tokens, ending with TokenEOF. Characters that cannot start a token become
+// TokenInvalid tokens, which are also reported as errors; lexing always carries on to the end of the source
+func Lex(source, file string) ([]Token, ErrorList) {
+	return lex(source, file, 1)
+}
+
+// lex lexes source whose first line is the line of the file provided
+func lex(source, file string, line int) ([]Token, ErrorList) {
+	lexer := &lexer{source: source, file: file, line: line}
+	for lexer.offset < len(source) {
+		lexer.lexToken()
+	}
+
+	lexer.emit(TokenEOF, lexer.offset)
+	return lexer.tokens, lexer.errors
+}
+
+// lexer is the state of Lex
+type lexer struct {
+	source    string
+	file      string
+	offset    int
+	line      int
+	lineStart int
+	tokens    []Token
+	errors    ErrorList
+}
+
+// lexToken lexes the token starting at the current offset, or skips the whitespace there
+func (l *lexer) lexToken() {
+	character := l.source[l.offset]
+	next := byte(0)
+	if l.offset+1 < len(l.source) {
+		next = l.source[l.offset+1]
+	}
+
+	switch {
+	case character == ' ' || character == '\t' || character == '\r':
+		l.offset++
+	case character == '\n':
+		l.emit(TokenNewline, l.offset+1)
+		l.line++
+		l.lineStart = l.offset
+	case character == '#':
+		l.emit(TokenComment, l.lineEnd())
+	case character == '"' || character == '\'':
+		l.lexQuoted(character)
+	case character == '.' && isLetter(next):
+		l.emit(TokenDirective, l.nameEnd(l.offset+1))
+	case character == '\\' && isLetter(next):
+		l.emit(TokenMacroParameter, l.nameEnd(l.offset+1))
+	case character == 'i' && (isDigit(next) || strings.IndexByte("+-'(", next) >= 0):
+		l.emit(TokenImmediate, l.offset+1)
+	case isLetter(character):
+		l.emit(TokenIdentifier, l.nameEnd(l.offset))
+	case isDigit(character):
+		l.emit(TokenNumber, l.nameEnd(l.offset))
+	case character == '$':
+		l.emit(TokenDollar, l.offset+1)
+	case character == ',':
+		l.emit(TokenComma, l.offset+1)
+	case character == ':':
+		l.emit(TokenColon, l.offset+1)
+	case character == '(':
+		l.emit(TokenLeftParen, l.offset+1)
+	case character == ')':
+		l.emit(TokenRightParen, l.offset+1)
+	case (character == '<' || character == '>') && next == character:
+		l.emit(TokenOperator, l.offset+2)
+	case strings.IndexByte("+-*/%&|", character) >= 0:
+		l.emit(TokenOperator, l.offset+1)
+	default:
+		l.fail(fmt.Sprintf("unexpected character '%c'", character))
+		l.emit(TokenInvalid, l.offset+1)
+	}
+}
+
+// lexQuoted lexes a string or character literal, which must end on the line it starts on. Backslashes escape the
+// character after them
+func (l *lexer) lexQuoted(quote byte) {
+	kind, name := TokenString, "string"
+	if quote == '\'' {
+		kind, name = TokenCharacter, "character"
+	}
+
+	for end := l.offset + 1; end < len(l.source) && l.source[end] != '\n'; end++ {
+		switch l.source[end] {
+		case '\\':
+			end++
+		case quote:
+			l.emit(kind, end+1)
+			return
+		}
+	}
+
+	l.fail(fmt.Sprintf("unterminated %v literal", name))
+	l.emit(TokenInvalid, l.lineEnd())
+}
+
+// emit adds a token of the kind provided, running from the current offset up to end, and moves past it
+func (l *lexer) emit(kind TokenKind, end int) {
+	if end > len(l.source) {
+		end = len(l.source)
+	}
+
+	l.tokens = append(l.tokens, Token{kind, l.source[l.offset:end], l.position()})
+	l.offset = end
+}
+
+func (l *lexer) fail(message string) {
+	l.errors = append(l.errors, &Error{l.position(), message})
+}
+
+func (l *lexer) position() Position {
+	return Position{l.file, l.line, l.offset - l.lineStart + 1}
+}
+
+// lineEnd returns the offset of the end of the current line, newline excluded
+func (l *lexer) lineEnd() int {
+	if end := strings.IndexByte(l.source[l.offset:], '\n'); end >= 0 {
+		return l.offset + end
+	}
+
+	return len(l.source)
+}
+
+// nameEnd returns the offset just after the run of name characters starting at the offset provided
+func (l *lexer) nameEnd(offset int) int {
+	for offset < len(l.source) && isNameCharacter(l.source[offset]) {
+		offset++
+	}
+
+	return offset
+}
+
+func isLetter(character byte) bool {
+	return character == '_' || (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
+}
+
+func isDigit(character byte) bool {
+	return character >= '0' && character <= '9'
+}
+
+// isNameCharacter returns true for the characters names may continue with. '@' separates the label of a macro's
+// body from the number of the expansion it was renamed for
+func isNameCharacter(character byte) bool {
+	return isLetter(character) || isDigit(character) || character == '@'
+}
@@ -0,0 +1,47 @@
+package syntax
+
+// Inspect visits the node provided and every node below it, depth first and in source order. The children of a node
+// are only visited if visit returns true for it
+func Inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *File:
+		for _, line := range node.Lines {
+			Inspect(line, visit)
+		}
+	case *Line:
+		for _, label := range node.Labels {
+			Inspect(label, visit)
+		}
+
+		if node.Statement != nil {
+			Inspect(node.Statement, visit)
+		}
+
+		if node.Comment != nil {
+			Inspect(node.Comment, visit)
+		}
+	case *Instruction:
+		for _, operand := range node.Operands {
+			Inspect(operand, visit)
+		}
+	case *Directive:
+		for _, argument := range node.Arguments {
+			Inspect(argument, visit)
+		}
+	case *Operand:
+		if node.Expression != nil {
+			Inspect(node.Expression, visit)
+		}
+	case *Unary:
+		Inspect(node.Operand, visit)
+	case *Binary:
+		Inspect(node.Left, visit)
+		Inspect(node.Right, visit)
+	case *Paren:
+		Inspect(node.Inner, visit)
+	}
+}
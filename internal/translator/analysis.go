@@ -0,0 +1,183 @@
+package translator
+
+import (
+	"sort"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// instruction is a statically decoded instruction that translated code can execute directly
+type instruction struct {
+	address   int
+	opCode    int
+	length    int
+	formats   [3]int
+	operands  [3]int
+	mnemonic  string
+	assembled string
+}
+
+// next returns the address just past the instruction
+func (i instruction) next() int { return i.address + i.length }
+
+// programAnalysis is what static analysis learns about a program before it is translated
+type programAnalysis struct {
+	program []int
+
+	// instructions holds every instruction reachable from address 0 without computed jumps that translated code can
+	// execute directly. Anything else reachable (unknown opcodes, cut-off or malformed operands) is left to the
+	// embedded interpreter, which reports the same errors the TVM would
+	instructions map[int]instruction
+
+	// leaders are the addresses that start a basic block: address 0, every static jump target and every address
+	// after a jump
+	leaders map[int]bool
+
+	// code marks every word of every instruction in instructions. Translated code hands over to the interpreter as
+	// soon as it writes to one of them
+	code map[int]bool
+
+	// computedJumps is true if any jump's target is only known at runtime
+	computedJumps bool
+}
+
+// analyze discovers every instruction reachable from address 0 by following fall-through and static jump targets
+func analyze(program []int) *programAnalysis {
+	analysis := &programAnalysis{
+		program:      program,
+		instructions: map[int]instruction{},
+		leaders:      map[int]bool{0: true},
+		code:         map[int]bool{},
+	}
+
+	visited := map[int]bool{}
+	worklist := []int{0}
+	for len(worklist) > 0 {
+		address := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if visited[address] {
+			continue
+		}
+
+		visited[address] = true
+		decoded, translatable := analysis.decode(address)
+		if !translatable {
+			continue
+		}
+
+		analysis.instructions[address] = decoded
+		for word := address; word < decoded.next(); word++ {
+			analysis.code[word] = true
+		}
+
+		for _, successor := range analysis.successors(decoded) {
+			worklist = append(worklist, successor)
+		}
+	}
+
+	return analysis
+}
+
+// successors returns the addresses control may flow to after the instruction provided, marking jump targets and
+// the addresses after jumps as leaders
+func (p *programAnalysis) successors(decoded instruction) []int {
+	switch decoded.opCode {
+	case 9:
+		return []int{}
+	case 6:
+		successors := []int{}
+		conditionKnown := decoded.formats[0] == tvm.ParamFormatImmediate
+		condition := decoded.operands[0]
+
+		if !conditionKnown || condition == 0 {
+			p.leaders[decoded.next()] = true
+			successors = append(successors, decoded.next())
+		}
+
+		if !conditionKnown || condition != 0 {
+			if decoded.formats[1] == tvm.ParamFormatImmediate {
+				p.leaders[decoded.operands[1]] = true
+				successors = append(successors, decoded.operands[1])
+			} else {
+				p.computedJumps = true
+			}
+		}
+
+		return successors
+	default:
+		return []int{decoded.next()}
+	}
+}
+
+// decode decodes the instruction at the address provided, and reports whether translated code can execute it
+// directly: its opcode must exist, all of its operands must fit in memory, and every operand must be valid for
+// its format (addresses inside memory, registers that exist, outputs that can be written to)
+func (p *programAnalysis) decode(address int) (instruction, bool) {
+	if address < 0 || address >= len(p.program) {
+		return instruction{}, false
+	}
+
+	rawOpcode := p.program[address]
+	opCode := rawOpcode % 100
+	decoded := instruction{
+		address:  address,
+		opCode:   opCode,
+		length:   tvm.InstructionLength(opCode),
+		formats:  [3]int{(rawOpcode / 100) % 10, (rawOpcode / 1000) % 10, rawOpcode / 10000},
+		mnemonic: tvm.OpcodeMnemonic(opCode),
+	}
+
+	if decoded.mnemonic == "" || decoded.next() > len(p.program) {
+		return instruction{}, false
+	}
+
+	for index := 0; index < decoded.length-1; index++ {
+		decoded.operands[index] = p.program[address+1+index]
+		if !p.validOperand(decoded.formats[index], decoded.operands[index], isOutput(opCode, index)) {
+			return instruction{}, false
+		}
+	}
+
+	decoded.assembled, _ = tvm.Disassemble(p.program, address)
+	return decoded, true
+}
+
+func (p *programAnalysis) validOperand(format, operand int, output bool) bool {
+	switch format {
+	case tvm.ParamFormatAddress:
+		return operand >= 0 && operand < len(p.program)
+	case tvm.ParamFormatRegister:
+		return tvm.RegisterName(operand) != "" && !(output && operand == tvm.RegisterLastAddress)
+	case tvm.ParamFormatImmediate:
+		return !output
+	default:
+		return false
+	}
+}
+
+// isOutput returns true if the parameter at the index provided is written to by the opcode provided
+func isOutput(opCode, index int) bool {
+	switch opCode {
+	case 1, 2, 5, 7, 10, 11, 12, 13, 14, 16, 17:
+		return index == 2
+	case 15:
+		return index == 1
+	case 3:
+		return index == 0
+	default:
+		return false
+	}
+}
+
+// sortedLeaders returns the leaders that start a translatable instruction, in ascending order
+func (p *programAnalysis) sortedLeaders() []int {
+	leaders := []int{}
+	for leader := range p.leaders {
+		if _, translatable := p.instructions[leader]; translatable {
+			leaders = append(leaders, leader)
+		}
+	}
+
+	sort.Ints(leaders)
+	return leaders
+}
@@ -0,0 +1,517 @@
+package translator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// Translate returns the source code of a standalone Go package, named packageName, that runs the program provided
+// as native code with the word format provided. The package exports Run(in Input, out Output) error, where Input
+// and Output are satisfied by the TVM's own InputInterface and OutputInterface. Memory protection, limits and the
+// other TVM runtime options are not part of translated programs, and neither are arbitrary-precision words
+//
+// Every basic block reachable through static jumps becomes a case of a switch-based state machine. Computed jumps
+// into code that was not translated, and any write into translated code, hand execution over to an interpreter
+// embedded in the package, so programs that modify themselves behave exactly as they do on the TVM
+func Translate(program []int, wordFormat tvm.WordFormat, packageName, sourceName string) ([]byte, error) {
+	if !token.IsIdentifier(packageName) {
+		return nil, fmt.Errorf("invalid package name '%v'", packageName)
+	}
+
+	if err := wordFormat.Validate(); err != nil {
+		return nil, err
+	}
+
+	if wordFormat.Size == tvm.WordSizeBig {
+		return nil, fmt.Errorf("programs with %v words cannot be translated", wordFormat.Size)
+	}
+
+	analysis := analyze(program)
+	out := &bytes.Buffer{}
+
+	fmt.Fprintf(out, "// Code generated by tvc2go from %v. DO NOT EDIT.\n\n", sourceName)
+	fmt.Fprintf(out, "// Package %v runs the TVM program %v as native Go code.\n", packageName, sourceName)
+	fmt.Fprintf(out, "package %v\n\n", packageName)
+	out.WriteString(preamble)
+	fmt.Fprintln(out, "// wordBits and overflow are the word format the program runs with")
+	fmt.Fprintf(out, "const (\nwordBits = %v\noverflow = %q\n)\n\n", wordFormat.Size, wordFormat.Overflow)
+	out.WriteString(words)
+
+	fmt.Fprintln(out, "// initialMemory is the program as it was loaded")
+	fmt.Fprintln(out, "var initialMemory = []int{")
+	for start := 0; start < len(program); start += 16 {
+		end := min(start+16, len(program))
+		words := make([]string, 0, end-start)
+		for _, word := range program[start:end] {
+			words = append(words, fmt.Sprint(word))
+		}
+
+		fmt.Fprintf(out, "%v,\n", strings.Join(words, ", "))
+	}
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "// run executes translated code from the current program counter")
+	fmt.Fprintln(out, "func (m *machine) run(in Input, out Output) error {")
+	fmt.Fprintln(out, "for {")
+	fmt.Fprintln(out, "switch m.pc {")
+	for _, leader := range analysis.sortedLeaders() {
+		emitBlock(out, analysis, leader)
+	}
+	fmt.Fprintln(out, "default:")
+	fmt.Fprintln(out, "return m.interpret(in, out)")
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "}")
+	out.WriteString(interpreter)
+
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("translated code does not compile: %w", err)
+	}
+
+	return formatted, nil
+}
+
+// emitBlock emits the case of the basic block starting at the leader provided. Blocks run until a jump, a halt,
+// the next leader, or an instruction that only the interpreter can execute
+func emitBlock(out *bytes.Buffer, analysis *programAnalysis, leader int) {
+	fmt.Fprintf(out, "case %v:\n", leader)
+
+	address := leader
+	for {
+		decoded, translatable := analysis.instructions[address]
+		if !translatable {
+			fmt.Fprintf(out, "m.pc = %v\nreturn m.interpret(in, out)\n", address)
+			return
+		}
+
+		fmt.Fprintf(out, "// %v: %v\n", address, decoded.assembled)
+		fmt.Fprintln(out, "{")
+		ended := emitInstruction(out, analysis, decoded)
+		fmt.Fprintln(out, "}")
+		if ended {
+			return
+		}
+
+		address = decoded.next()
+		if analysis.leaders[address] {
+			fmt.Fprintf(out, "m.pc = %v\n", address)
+			return
+		}
+	}
+}
+
+// emitInstruction emits the code for a single instruction and reports whether it ended the block
+func emitInstruction(out *bytes.Buffer, analysis *programAnalysis, decoded instruction) bool {
+	read := func(index int) string {
+		switch decoded.formats[index] {
+		case tvm.ParamFormatAddress:
+			return fmt.Sprintf("m.memory[%v]", decoded.operands[index])
+		case tvm.ParamFormatRegister:
+			return fmt.Sprintf("m.registers[%v]", decoded.operands[index])
+		default:
+			if decoded.operands[index] < 0 {
+				return fmt.Sprintf("(%v)", decoded.operands[index])
+			}
+
+			return fmt.Sprint(decoded.operands[index])
+		}
+	}
+
+	// write emits the store of the value provided into the output parameter, and reports whether it modified
+	// translated code, in which case the interpreter takes over from the next instruction
+	write := func(index int, value string) bool {
+		fmt.Fprintf(out, "%v = %v\n", read(index), value)
+		if decoded.formats[index] == tvm.ParamFormatAddress && analysis.code[decoded.operands[index]] {
+			fmt.Fprintf(out, "m.pc = %v\nreturn m.interpret(in, out)\n", decoded.next())
+			return true
+		}
+
+		return false
+	}
+
+	// checked emits the store of a computation that may fail, such as one that overflows a word
+	checked := func(index int, computation string) bool {
+		fmt.Fprintf(out, "value, err := %v\nif err != nil {\nreturn err\n}\n", computation)
+		return write(index, "value")
+	}
+
+	switch decoded.opCode {
+	case 1:
+		return checked(2, fmt.Sprintf("add(%v, %v)", read(0), read(1)))
+	case 2:
+		return checked(2, fmt.Sprintf("mlt(%v, %v)", read(0), read(1)))
+	case 3:
+		return checked(0, `fit("in", in.ReceiveInput())`)
+	case 4:
+		fmt.Fprintf(out, "out.EmitOutput(%v)\n", read(0))
+		return false
+	case 5:
+		return write(2, fmt.Sprintf("boolToWord(%v == %v)", read(0), read(1)))
+	case 6:
+		jump := fmt.Sprintf("m.registers[%v] = %v\nm.pc = %v\n", tvm.RegisterLastAddress, decoded.next(), read(1))
+		if decoded.formats[0] == tvm.ParamFormatImmediate {
+			// The condition is known, so is whether the jump is taken
+			if decoded.operands[0] != 0 {
+				fmt.Fprint(out, jump)
+			} else {
+				fmt.Fprintf(out, "m.pc = %v\n", decoded.next())
+			}
+
+			return true
+		}
+
+		fmt.Fprintf(out, "if %v != 0 {\n%vcontinue\n}\n", read(0), jump)
+		fmt.Fprintf(out, "m.pc = %v\n", decoded.next())
+		return true
+	case 7:
+		return write(2, fmt.Sprintf("boolToWord(%v < %v)", read(0), read(1)))
+	case 10, 11, 16, 17:
+		return checked(2, fmt.Sprintf("%v(%v, %v)", decoded.mnemonic, read(0), read(1)))
+	case 12:
+		return write(2, fmt.Sprintf("%v & %v", read(0), read(1)))
+	case 13:
+		return write(2, fmt.Sprintf("%v | %v", read(0), read(1)))
+	case 14:
+		return write(2, fmt.Sprintf("%v ^ %v", read(0), read(1)))
+	case 15:
+		return write(1, fmt.Sprintf("^%v", read(0)))
+	default:
+		fmt.Fprintf(out, "m.pc = %v\nreturn nil\n", decoded.address)
+		return true
+	}
+}
+
+// preamble is the part of every translated package that comes before the program
+const preamble = `import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Input is anything that can provide the program with integers, such as the TVM's InputInterface
+type Input interface {
+	ReceiveInput() int
+}
+
+// Output is anything the program can emit integers to, such as the TVM's OutputInterface
+type Output interface {
+	EmitOutput(int)
+}
+
+// Run runs the program from the beginning until it halts, returning an error if it faults
+func Run(in Input, out Output) error {
+	m := &machine{memory: append([]int{}, initialMemory...)}
+	return m.run(in, out)
+}
+
+// machine is the state of a running program
+type machine struct {
+	memory    []int
+	registers [14]int
+	pc        int
+}
+
+func boolToWord(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+`
+
+// words is the part of every translated package that fits values in words, just as the TVM's WordFormat does
+const words = `// fit returns the value provided as it is stored in a word, applying the overflow mode if it does not fit
+func fit(operation string, value int) (int, error) {
+	if wordBits == 64 || (value >= math.MinInt32 && value <= math.MaxInt32) {
+		return value, nil
+	}
+
+	return fitExact(operation, big.NewInt(int64(value)))
+}
+
+// fitExact returns the exact value provided as it is stored in a word
+func fitExact(operation string, exact *big.Int) (int, error) {
+	minimum := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), wordBits-1))
+	maximum := new(big.Int).Sub(new(big.Int).Neg(minimum), big.NewInt(1))
+	if exact.Cmp(minimum) >= 0 && exact.Cmp(maximum) <= 0 {
+		return int(exact.Int64()), nil
+	}
+
+	switch overflow {
+	case "saturate":
+		if exact.Sign() < 0 {
+			return int(minimum.Int64()), nil
+		}
+
+		return int(maximum.Int64()), nil
+	case "fault":
+		return 0, fmt.Errorf("%v overflowed a %v-bit word with '%v'", operation, wordBits, exact)
+	default:
+		modulus := new(big.Int).Lsh(big.NewInt(1), wordBits)
+		wrapped := new(big.Int).Mod(exact, modulus)
+		if wrapped.Cmp(maximum) > 0 {
+			wrapped.Sub(wrapped, modulus)
+		}
+
+		return int(wrapped.Int64()), nil
+	}
+}
+
+func add(a, b int) (int, error) {
+	if sum := a + b; (sum > a) == (b > 0) {
+		return fit("add", sum)
+	}
+
+	return fitExact("add", new(big.Int).Add(big.NewInt(int64(a)), big.NewInt(int64(b))))
+}
+
+func mlt(a, b int) (int, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+
+	if product := a * b; product/b == a && !(a == -1 && b == math.MinInt) && !(b == -1 && a == math.MinInt) {
+		return fit("mlt", product)
+	}
+
+	return fitExact("mlt", new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(b))))
+}
+
+func div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("attempted to divide by zero")
+	}
+
+	if a == math.MinInt && b == -1 {
+		return fitExact("div", new(big.Int).Neg(big.NewInt(int64(a))))
+	}
+
+	return fit("div", a/b)
+}
+
+func mod(a, b int) (int, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("attempted to divide by zero")
+	}
+
+	return a % b, nil
+}
+
+func shl(a, b int) (int, error) {
+	if b < 0 || b >= wordBits {
+		return 0, fmt.Errorf("cannot shift by '%v' bits (expected 0 to %v)", b, wordBits-1)
+	}
+
+	if shifted := a << b; b < 63 && shifted>>b == a {
+		return fit("shl", shifted)
+	}
+
+	return fitExact("shl", new(big.Int).Lsh(big.NewInt(int64(a)), uint(b)))
+}
+
+func shr(a, b int) (int, error) {
+	if b < 0 || b >= wordBits {
+		return 0, fmt.Errorf("cannot shift by '%v' bits (expected 0 to %v)", b, wordBits-1)
+	}
+
+	return a >> b, nil
+}
+
+`
+
+// interpreter is the interpreter embedded in every translated package. It implements the TVM's instruction set
+// one instruction at a time, with the TVM's error messages
+const interpreter = `
+// interpret executes the program one instruction at a time from the current program counter. Translated code hands
+// over to it for computed jumps into code that was not translated, and after writing into translated code
+func (m *machine) interpret(in Input, out Output) error {
+	for {
+		if m.pc < 0 || m.pc >= len(m.memory) {
+			return fmt.Errorf("program counter '%v' is outside of memory (memory is of size '%v')", m.pc, len(m.memory))
+		}
+
+		rawOpcode := m.memory[m.pc]
+		switch rawOpcode % 100 {
+		case 1, 2, 5, 7, 10, 11, 12, 13, 14, 16, 17:
+			left, err := m.param(rawOpcode, 0)
+			if err != nil {
+				return err
+			}
+
+			right, err := m.param(rawOpcode, 1)
+			if err != nil {
+				return err
+			}
+
+			output, err := m.param(rawOpcode, 2)
+			if err != nil {
+				return err
+			}
+
+			value, name := 0, ""
+			switch rawOpcode % 100 {
+			case 1:
+				value, err = add(left.value, right.value)
+				name = "add"
+			case 2:
+				value, err = mlt(left.value, right.value)
+				name = "mlt"
+			case 5:
+				value, name = boolToWord(left.value == right.value), "seq"
+			case 7:
+				value, name = boolToWord(left.value < right.value), "slt"
+			case 10:
+				value, err = div(left.value, right.value)
+				name = "div"
+			case 11:
+				value, err = mod(left.value, right.value)
+				name = "mod"
+			case 12:
+				value, name = left.value&right.value, "and"
+			case 13:
+				value, name = left.value|right.value, "or"
+			case 14:
+				value, name = left.value^right.value, "xor"
+			case 16:
+				value, err = shl(left.value, right.value)
+				name = "shl"
+			case 17:
+				value, err = shr(left.value, right.value)
+				name = "shr"
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := m.write(output, value, name); err != nil {
+				return err
+			}
+
+			m.pc += 4
+		case 15:
+			input, err := m.param(rawOpcode, 0)
+			if err != nil {
+				return err
+			}
+
+			output, err := m.param(rawOpcode, 1)
+			if err != nil {
+				return err
+			}
+
+			if err := m.write(output, ^input.value, "not"); err != nil {
+				return err
+			}
+
+			m.pc += 3
+		case 3:
+			output, err := m.param(rawOpcode, 0)
+			if err != nil {
+				return err
+			}
+
+			number, err := fit("in", in.ReceiveInput())
+			if err != nil {
+				return err
+			}
+
+			if err := m.write(output, number, "in"); err != nil {
+				return err
+			}
+
+			m.pc += 2
+		case 4:
+			value, err := m.param(rawOpcode, 0)
+			if err != nil {
+				return err
+			}
+
+			out.EmitOutput(value.value)
+			m.pc += 2
+		case 6:
+			condition, err := m.param(rawOpcode, 0)
+			if err != nil {
+				return err
+			}
+
+			target, err := m.param(rawOpcode, 1)
+			if err != nil {
+				return err
+			}
+
+			next := m.pc + 3
+			m.pc = next
+			if condition.value != 0 {
+				m.registers[13] = next
+				m.pc = target.value
+			}
+		case 9:
+			return nil
+		default:
+			return fmt.Errorf("no operation found for opcode \"%v\"", rawOpcode)
+		}
+	}
+}
+
+// param is an instruction's parameter: its format, its operand word and the value it refers to
+type param struct {
+	format  int
+	operand int
+	value   int
+}
+
+func (m *machine) param(rawOpcode, index int) (param, error) {
+	format := []int{(rawOpcode / 100) % 10, (rawOpcode / 1000) % 10, rawOpcode / 10000}[index]
+	paramAddress := m.pc + 1 + index
+	if paramAddress >= len(m.memory) {
+		return param{}, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", paramAddress, len(m.memory))
+	}
+
+	operand := m.memory[paramAddress]
+	switch format {
+	case 0:
+		if operand < 0 || operand >= len(m.memory) {
+			return param{}, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", operand, len(m.memory))
+		}
+
+		return param{format, operand, m.memory[operand]}, nil
+	case 1:
+		return param{format, operand, operand}, nil
+	case 2:
+		if operand < 0 || operand >= len(m.registers) {
+			return param{}, fmt.Errorf("cannot lookup register at address '%v' (register file is of size '%v')", operand, len(m.registers))
+		}
+
+		return param{format, operand, m.registers[operand]}, nil
+	default:
+		return param{}, fmt.Errorf("unknown parameter format '%v' at address '%v'", format, paramAddress)
+	}
+}
+
+func (m *machine) write(output param, value int, name string) error {
+	switch output.format {
+	case 0:
+		m.memory[output.operand] = value
+	case 2:
+		if output.operand == 13 {
+			return fmt.Errorf("attempted to write to last address register '13'")
+		}
+
+		m.registers[output.operand] = value
+	default:
+		return fmt.Errorf("invalid output parameter for %v operation", name)
+	}
+
+	return nil
+}
+`
@@ -0,0 +1,204 @@
+package translator
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tvm "tvm/internal/virtual_machine"
+)
+
+// countdownProgram reads n and outputs n, n-1, ..., 1 using a static loop
+var countdownProgram = []int{203, 0, 204, 0, 21201, 0, -1, 0, 21205, 0, 0, 5, 1206, 5, 18, 1106, 1, 2, 9}
+
+// computedJumpProgram jumps through a register to code that static analysis cannot find, and outputs 42
+var computedJumpProgram = []int{21101, 0, 10, 5, 2106, 1, 5, 104, 1, 9, 104, 42, 9}
+
+// selfModifyingProgram rewrites the operand of its own output instruction before it runs, and outputs 42
+var selfModifyingProgram = []int{1101, 40, 2, 5, 104, 7, 9}
+
+// squaringProgram reads n and outputs n squared, then n to the fourth
+var squaringProgram = []int{3, 15, 2, 15, 15, 15, 4, 15, 2, 15, 15, 15, 4, 15, 9, 0}
+
+// operationsProgram reads a and b and outputs a div b, a mod b, a and b, a or b, a xor b, not a, a shl b and a shr b
+var operationsProgram = []int{
+	203, 0, 203, 1, 22210, 0, 1, 2, 204, 2, 22211, 0, 1, 2, 204, 2, 22212, 0, 1, 2, 204, 2, 22213, 0, 1, 2, 204, 2,
+	22214, 0, 1, 2, 204, 2, 2215, 0, 2, 204, 2, 22216, 0, 1, 2, 204, 2, 22217, 0, 1, 2, 204, 2, 9,
+}
+
+// interpretedOperationsProgram runs operationsProgram after a computed jump, so that only the embedded interpreter
+// executes it
+var interpretedOperationsProgram = append([]int{21101, 0, 7, 5, 2106, 1, 5}, operationsProgram...)
+
+// faultingProgram writes to the last address register
+var faultingProgram = []int{104, 1, 21101, 1, 1, 13, 9}
+
+func TestAnalyze_FindsBasicBlocks(t *testing.T) {
+	analysis := analyze(countdownProgram)
+
+	assert.Equal(t, []int{0, 2, 15, 18}, analysis.sortedLeaders())
+	assert.False(t, analysis.computedJumps)
+	assert.True(t, analysis.code[14])
+	assert.False(t, analysis.code[19])
+}
+
+func TestAnalyze_LeavesComputedJumpTargetsToTheInterpreter(t *testing.T) {
+	analysis := analyze(computedJumpProgram)
+
+	assert.True(t, analysis.computedJumps)
+	assert.Equal(t, []int{0}, analysis.sortedLeaders())
+	assert.NotContains(t, analysis.instructions, 10)
+}
+
+func TestAnalyze_PrunesJumpsWithConstantConditions(t *testing.T) {
+	// jit 0, 5 never jumps, jit 1, 7 always does: address 5 and the word after the second jump are unreachable
+	analysis := analyze([]int{1106, 0, 5, 1106, 1, 7, 9, 9})
+
+	assert.Equal(t, []int{0, 3, 7}, analysis.sortedLeaders())
+	assert.NotContains(t, analysis.instructions, 6)
+}
+
+func TestAnalyze_LeavesInvalidInstructionsToTheInterpreter(t *testing.T) {
+	analysis := analyze(faultingProgram)
+
+	assert.Contains(t, analysis.instructions, 0)
+	assert.NotContains(t, analysis.instructions, 2, "writes to $la must fault at runtime")
+}
+
+func TestTranslate_GeneratesAGoPackage(t *testing.T) {
+	source, err := Translate(countdownProgram, tvm.WordFormat{}, "countdown", "countdown.tvm")
+	require.NoError(t, err)
+
+	file, err := parser.ParseFile(token.NewFileSet(), "countdown.go", source, parser.ParseComments)
+	require.NoError(t, err)
+	assert.Equal(t, "countdown", file.Name.Name)
+	assert.True(t, strings.HasPrefix(string(source), "// Code generated by tvc2go from countdown.tvm. DO NOT EDIT."))
+	assert.Contains(t, string(source), "// 12: jit t0, 18")
+}
+
+func TestTranslate_RejectsInvalidPackageNames(t *testing.T) {
+	_, err := Translate(countdownProgram, tvm.WordFormat{}, "not-a-name", "countdown.tvm")
+	assert.EqualError(t, err, "invalid package name 'not-a-name'")
+}
+
+func TestTranslate_RejectsArbitraryPrecisionWords(t *testing.T) {
+	_, err := Translate(countdownProgram, tvm.WordFormat{Size: tvm.WordSizeBig}, "countdown", "countdown.tvm")
+	assert.EqualError(t, err, "programs with big words cannot be translated")
+}
+
+func TestTranslate_BehavesLikeTheVirtualMachine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds translated programs with the go tool")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go tool is not available")
+	}
+
+	testCases := []struct {
+		name    string
+		program []int
+		format  tvm.WordFormat
+		input   string
+	}{
+		{"static loop", countdownProgram, tvm.WordFormat{}, "5"},
+		{"computed jump", computedJumpProgram, tvm.WordFormat{}, ""},
+		{"self-modifying code", selfModifyingProgram, tvm.WordFormat{}, ""},
+		{"fault", faultingProgram, tvm.WordFormat{}, ""},
+		{"32-bit wrap", squaringProgram, tvm.WordFormat{}, "100000"},
+		{"32-bit saturate", squaringProgram, tvm.WordFormat{Overflow: tvm.OverflowSaturate}, "-100000"},
+		{"32-bit fault", squaringProgram, tvm.WordFormat{Overflow: tvm.OverflowFault}, "100000"},
+		{"32-bit input", squaringProgram, tvm.WordFormat{Overflow: tvm.OverflowFault}, "5000000000"},
+		{"64-bit wrap", squaringProgram, tvm.WordFormat{Size: tvm.WordSize64}, "100000"},
+		{"64-bit saturate", squaringProgram, tvm.WordFormat{Size: tvm.WordSize64, Overflow: tvm.OverflowSaturate}, "100000"},
+		{"64-bit fault", squaringProgram, tvm.WordFormat{Size: tvm.WordSize64, Overflow: tvm.OverflowFault}, "100000"},
+		{"operations", operationsProgram, tvm.WordFormat{}, "-7 2"},
+		{"interpreted operations", interpretedOperationsProgram, tvm.WordFormat{}, "-7 2"},
+		{"64-bit operations", operationsProgram, tvm.WordFormat{Size: tvm.WordSize64}, "-7 40"},
+		{"division by zero", operationsProgram, tvm.WordFormat{}, "100 0"},
+		{"interpreted division by zero", interpretedOperationsProgram, tvm.WordFormat{}, "100 0"},
+		{"shift overflow", operationsProgram, tvm.WordFormat{Overflow: tvm.OverflowFault}, "3 30"},
+		{"interpreted shift overflow", interpretedOperationsProgram, tvm.WordFormat{Overflow: tvm.OverflowFault}, "3 30"},
+		{"invalid shift", operationsProgram, tvm.WordFormat{}, "3 32"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			expected := runOnVirtualMachine(t, testCase.program, testCase.format, testCase.input)
+			assert.Equal(t, expected, runTranslated(t, testCase.program, testCase.format, testCase.input))
+		})
+	}
+}
+
+// runOnVirtualMachine runs the program provided on the TVM and returns its outputs, one per line, followed by its
+// error if it faulted
+func runOnVirtualMachine(t *testing.T, program []int, format tvm.WordFormat, input string) string {
+	out := &bytes.Buffer{}
+	machine := tvm.NewTsvetokVirtualMachine(append([]int{}, program...))
+	require.NoError(t, machine.SetWordFormat(format))
+	machine.SetInputInterface(tvm.NewReaderInputInterface(strings.NewReader(input)))
+	machine.SetOutputInterface(tvm.NewWriterOutputInterface(out))
+	if err := machine.Execute(); err != nil {
+		out.WriteString("error: " + err.Error() + "\n")
+	}
+
+	return out.String()
+}
+
+// runTranslatedDriver runs a translated program just as runOnVirtualMachine runs it on the TVM
+const runTranslatedDriver = `package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+type input struct{ scanner *bufio.Scanner }
+
+func (i input) ReceiveInput() int {
+	var number int
+	i.scanner.Scan()
+	fmt.Sscan(i.scanner.Text(), &number)
+	return number
+}
+
+type output struct{}
+
+func (output) EmitOutput(number int) { fmt.Println(number) }
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Split(bufio.ScanWords)
+	if err := Run(input{scanner}, output{}); err != nil {
+		fmt.Println("error: " + err.Error())
+	}
+}
+`
+
+// runTranslated translates the program provided, builds it and runs it, returning what runOnVirtualMachine would
+func runTranslated(t *testing.T, program []int, format tvm.WordFormat, input string) string {
+	source, err := Translate(program, format, "main", "program.tvm")
+	require.NoError(t, err)
+
+	directory := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "go.mod"), []byte("module translated\n\ngo 1.21\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "program.go"), source, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "main.go"), []byte(runTranslatedDriver), 0o644))
+
+	command := exec.Command("go", "run", ".")
+	command.Dir = directory
+	command.Stdin = strings.NewReader(input)
+	output, err := command.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	return string(output)
+}
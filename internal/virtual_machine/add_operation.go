@@ -1,41 +1,30 @@
 package virtual_machine
 
-import ()
+import (
+	"math/big"
+)
 
 // addOperation adds two numbers together
 type addOperation struct {
 	*TsvetokVirtualMachine
 }
 
+// addOperator adds two words
+var addOperator = arithmeticOperator{
+	name: "add",
+	native: func(a, b int) (int, bool) {
+		sum := a + b
+		return sum, (sum > a) == (b > 0)
+	},
+	exact: func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) },
+}
+
 func newAddOperation(t *TsvetokVirtualMachine) addOperation {
 	return addOperation{t}
 }
 
 func (a addOperation) Execute() error {
-	leftParam, err := a.getFirstParam()
-	if err != nil {
-		return err
-	}
-
-	rightParam, err := a.getSecondParam()
-	if err != nil {
-		return err
-	}
-
-	outAddr, err := a.getThirdParam()
-	if err != nil {
-		return err
-	}
-
-	if outAddr.Format == ParamFormatAddress {
-		return a.SetValueInMemory(outAddr.Address, leftParam.Value+rightParam.Value)
-	}
-
-	if outAddr.Format == ParamFormatRegister {
-		return a.SetValueInRegisterFile(outAddr.Address, leftParam.Value+rightParam.Value)
-	}
-
-	return InvalidOutputParamErr{"add"}
+	return a.executeArithmetic(addOperator)
 }
 
 func (a addOperation) GetNextProgramCounter() int { return a.getProgramCounter() + 4 }
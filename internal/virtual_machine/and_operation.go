@@ -0,0 +1,29 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// andOperation sets the output parameter to the bitwise and of two numbers
+type andOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// andOperator computes the bitwise and of two words, as two's complement integers
+var andOperator = arithmeticOperator{
+	name:   "and",
+	native: func(a, b int) (int, bool) { return a & b, true },
+	exact:  func(a, b *big.Int) *big.Int { return new(big.Int).And(a, b) },
+}
+
+func newAndOperation(t *TsvetokVirtualMachine) andOperation {
+	return andOperation{t}
+}
+
+func (a andOperation) Execute() error {
+	return a.executeArithmetic(andOperator)
+}
+
+func (a andOperation) GetNextProgramCounter() int { return a.getProgramCounter() + 4 }
+
+func (_ andOperation) Halt() bool { return false }
@@ -0,0 +1,80 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// executeArithmetic executes the current instruction as one that computes the operator provided over its first two
+// parameters and writes the result, fitted in a word (see SetWordFormat), to its third. Unary operators compute
+// over their first parameter and write to their second
+func (t *TsvetokVirtualMachine) executeArithmetic(operator arithmeticOperator) error {
+	left, err := t.getFirstParam()
+	if err != nil {
+		return err
+	}
+
+	if operator.unary {
+		output, err := t.getOutputParam(1)
+		if err != nil {
+			return err
+		}
+
+		value, wide, err := t.compute(operator, left, operationParam{})
+		if err != nil {
+			return err
+		}
+
+		return t.writeParam(output, operator.name, value, wide)
+	}
+
+	right, err := t.getSecondParam()
+	if err != nil {
+		return err
+	}
+
+	output, err := t.getOutputParam(2)
+	if err != nil {
+		return err
+	}
+
+	value, wide, err := t.compute(operator, left, right)
+	if err != nil {
+		return err
+	}
+
+	return t.writeParam(output, operator.name, value, wide)
+}
+
+// compute computes the operator provided over two parameters and fits the result in a word. Results too wide for
+// an int, which only exist with WordSizeBig, are returned as a big.Int instead
+func (t *TsvetokVirtualMachine) compute(operator arithmeticOperator, left, right operationParam) (int, *big.Int, error) {
+	if left.Wide == nil && right.Wide == nil {
+		return t.wordFormat.apply(operator, left.Value, right.Value)
+	}
+
+	if operator.validate != nil {
+		if err := operator.validate(t.wordFormat, right.exact()); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return t.wordFormat.fitExact(operator.name, operator.exact(left.exact(), right.exact()))
+}
+
+// writeParam writes a value to the output parameter provided of the operation named. wide, if not nil, is written
+// instead of value
+func (t *TsvetokVirtualMachine) writeParam(output operationParam, operation string, value int, wide *big.Int) error {
+	if output.Format != ParamFormatAddress && output.Format != ParamFormatRegister {
+		return InvalidOutputParamErr{operation}
+	}
+
+	if wide != nil {
+		return t.setWide(output.Format, output.Address, wide)
+	}
+
+	if output.Format == ParamFormatAddress {
+		return t.SetValueInMemory(output.Address, value)
+	}
+
+	return t.SetValueInRegisterFile(output.Address, value)
+}
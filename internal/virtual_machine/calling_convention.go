@@ -0,0 +1,265 @@
+package virtual_machine
+
+import (
+	"fmt"
+)
+
+// reservedRegisterCount is the number of registers ($r0 to $r4) preserved across calls by convention
+const reservedRegisterCount = 5
+
+// maxCallFrames is the most calls the calling convention checker remembers. Jumps that are not calls (such as
+// loops) look like calls that never return, so the oldest are forgotten once there are too many
+const maxCallFrames = 1024
+
+// ConventionViolation records the program breaking the calling convention while the machine ran: either a routine
+// returning with one of $r0 to $r4 changed, or a caller relying on a $t register surviving a call, by reading it
+// after the call returned when neither the routine nor the caller since has set it. Which of the two it is follows
+// from Register
+type ConventionViolation struct {
+	// ProgramCounter is the address of the jit that returned, or of the instruction that read the $t register
+	ProgramCounter int `json:"programCounter"`
+	Register       int `json:"register"`
+
+	// CallSite is the address of the jit that called the routine, and Routine the address it called
+	CallSite int `json:"callSite"`
+	Routine  int `json:"routine"`
+
+	// Before and After are the values of a reserved register when the routine was called and when it returned
+	Before int `json:"before,omitempty"`
+	After  int `json:"after,omitempty"`
+
+	// Location is the source location of ProgramCounter, and Symbol the label of Routine, when the machine has a
+	// SourceLocator that knows them
+	Location *SourceLocation `json:"location,omitempty"`
+	Symbol   string          `json:"symbol,omitempty"`
+}
+
+func (c ConventionViolation) String() string {
+	where := fmt.Sprintf("pc %v", c.ProgramCounter)
+	if c.Location != nil {
+		where = fmt.Sprintf("%v (%v)", where, c.Location)
+	}
+
+	routine := fmt.Sprintf("routine at %v", c.Routine)
+	if c.Symbol != "" {
+		routine = fmt.Sprintf("%v (%v)", routine, c.Symbol)
+	}
+
+	if c.Register < reservedRegisterCount {
+		return fmt.Sprintf("calling convention broken at %v: %v returned with $%v changed from %v to %v (called from pc %v)",
+			where, routine, RegisterName(c.Register), c.Before, c.After, c.CallSite)
+	}
+
+	return fmt.Sprintf("calling convention broken at %v: $%v read after the %v returned without setting it, but calls do not preserve it (called from pc %v)",
+		where, RegisterName(c.Register), routine, c.CallSite)
+}
+
+// callFrame is a jump the calling convention checker has seen taken, which a later jump back to the address after
+// it returns from
+type callFrame struct {
+	callSite int
+	routine  int
+	reserved [reservedRegisterCount]int
+
+	// writes is how many times each register had been written to when the call was made
+	writes [registerFileSize]int
+}
+
+// callStack holds the calls the calling convention checker remembers, oldest first, in a ring of at most
+// maxCallFrames frames, so that forgetting the oldest call does not move the others
+type callStack struct {
+	frames []callFrame
+
+	// oldest is the index in frames of the oldest call, and size how many calls there are
+	oldest int
+	size   int
+}
+
+// at returns the call at the index provided, counting from the oldest
+func (s *callStack) at(index int) *callFrame {
+	return &s.frames[(s.oldest+index)%len(s.frames)]
+}
+
+// push remembers a call, forgetting the oldest if there are already maxCallFrames
+func (s *callStack) push(frame callFrame) {
+	switch {
+	case s.size < len(s.frames):
+		*s.at(s.size) = frame
+		s.size++
+	case len(s.frames) < maxCallFrames:
+		s.frames = append(s.frames, frame)
+		s.size++
+	default:
+		s.frames[s.oldest] = frame
+		s.oldest = (s.oldest + 1) % len(s.frames)
+	}
+}
+
+// conventionChecker follows calls and returns as the machine runs
+type conventionChecker struct {
+	frames callStack
+
+	// jump is the address of the jit the machine executed last, or -1 if the last instruction was not a jit, and
+	// indirect is true if its target was not an immediate
+	jump     int
+	indirect bool
+
+	// writes counts the writes to each register, and stale maps the $t registers that neither a routine nor its
+	// caller since has set to the frame of the call to that routine
+	writes [registerFileSize]int
+	stale  map[int]callFrame
+
+	violations []ConventionViolation
+}
+
+// clone returns an independent copy of the checker, or nil if checking is off
+func (c *conventionChecker) clone() *conventionChecker {
+	if c == nil {
+		return nil
+	}
+
+	clone := *c
+	clone.frames.frames = append([]callFrame{}, c.frames.frames...)
+	clone.violations = append([]ConventionViolation{}, c.violations...)
+	clone.stale = make(map[int]callFrame, len(c.stale))
+	for register, frame := range c.stale {
+		clone.stale[register] = frame
+	}
+
+	return &clone
+}
+
+// SetConventionChecking turns calling convention checking on or off. While it is on, every jit the machine takes
+// is taken to be a call, and a later jump through a register or memory to the address after it a return from that
+// call. The machine records routines returning with $r0 to $r4 changed, and reads of $t registers after a return
+// that neither the routine nor any instruction since has set (see ConventionViolations), annotating the trace with
+// a warning for each (see SetTraceDepth.) Turning checking off forgets everything recorded so far
+func (t *TsvetokVirtualMachine) SetConventionChecking(enabled bool) {
+	if !enabled {
+		t.convention = nil
+		return
+	}
+
+	if t.convention == nil {
+		t.convention = &conventionChecker{jump: -1, stale: map[int]callFrame{}}
+	}
+}
+
+// ConventionViolations returns every calling convention violation recorded so far, in the order they happened
+func (t *TsvetokVirtualMachine) ConventionViolations() []ConventionViolation {
+	if t.convention == nil {
+		return []ConventionViolation{}
+	}
+
+	return append([]ConventionViolation{}, t.convention.violations...)
+}
+
+// checkConventionJump follows the jit the machine executed last, if the last instruction was a jit. It runs before
+// the instruction at the current program counter is traced, so that warnings about returns are attached to the jit
+func (t *TsvetokVirtualMachine) checkConventionJump() {
+	if c := t.convention; c != nil && c.jump >= 0 {
+		t.followJump(c.jump)
+		c.jump = -1
+	}
+}
+
+// checkConvention checks the registers read by the instruction at the current program counter, which is about to
+// execute
+func (t *TsvetokVirtualMachine) checkConvention() {
+	c := t.convention
+	if c == nil {
+		return
+	}
+
+	raw := t.memory[t.programCounter]
+	opCode := raw % 100
+	length := instructionLength(opCode)
+	output := writtenParam(opCode, length)
+
+	written := -1
+	divisor := 100
+	for index := 0; index < length-1 && t.programCounter+1+index < len(t.memory); index, divisor = index+1, divisor*10 {
+		register := t.memory[t.programCounter+1+index]
+		if ParamFormat((raw/divisor)%10) != ParamFormatRegister || register < 0 || register >= registerFileSize {
+			continue
+		}
+
+		if index == output {
+			written = register
+			continue
+		}
+
+		if frame, stale := c.stale[register]; stale {
+			delete(c.stale, register)
+			t.recordViolation(ConventionViolation{ProgramCounter: t.programCounter, Register: register, CallSite: frame.callSite, Routine: frame.routine})
+		}
+	}
+
+	if written >= 0 {
+		delete(c.stale, written)
+		c.writes[written]++
+	}
+
+	if opCode == 6 {
+		c.jump = t.programCounter
+		c.indirect = ParamFormat((raw/1000)%10) != ParamFormatImmediate
+	}
+}
+
+// followJump records the jit at the address provided, which the machine has just executed, as a return if it
+// jumped through a register or memory to the address after a call, and as a call if it jumped anywhere else.
+// Returns must jump through a register or memory, since a routine can be called from anywhere
+func (t *TsvetokVirtualMachine) followJump(jump int) {
+	c := t.convention
+	if t.programCounter == jump+3 {
+		return
+	}
+
+	for index := c.frames.size - 1; index >= 0 && c.indirect; index-- {
+		frame := *c.frames.at(index)
+		if frame.callSite+3 != t.programCounter {
+			continue
+		}
+
+		c.frames.size = index
+		for register, before := range frame.reserved {
+			if after := t.registerFile[register]; after != before {
+				t.recordViolation(ConventionViolation{ProgramCounter: jump, Register: register, CallSite: frame.callSite, Routine: frame.routine, Before: before, After: after})
+			}
+		}
+
+		for register := RegisterTemporary0; register <= RegisterTemporary7; register++ {
+			if c.writes[register] == frame.writes[register] {
+				c.stale[register] = frame
+			}
+		}
+
+		return
+	}
+
+	frame := callFrame{callSite: jump, routine: t.programCounter, writes: c.writes}
+	copy(frame.reserved[:], t.registerFile)
+	c.frames.push(frame)
+}
+
+func (t *TsvetokVirtualMachine) recordViolation(violation ConventionViolation) {
+	violation.Location = t.locate(violation.ProgramCounter)
+	violation.Symbol = t.symbolize(violation.Routine)
+	t.convention.violations = append(t.convention.violations, violation)
+	t.warnInTrace(violation.String())
+}
+
+// writtenParam returns the index of the parameter an instruction with the opcode and length provided writes to, or
+// -1 if it writes to none
+func writtenParam(opCode, length int) int {
+	switch opCode {
+	case 3:
+		return 0
+	case 15:
+		return 1
+	case 1, 2, 5, 7, 10, 11, 12, 13, 14, 16, 17:
+		return length - 2
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,103 @@
+package virtual_machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTsvetokVirtualMachine_ChecksTheCallingConvention(t *testing.T) {
+	for _, tc := range []struct {
+		program            []int
+		expectedViolations []ConventionViolation
+		testName           string
+	}{
+		{
+			// r1 = 5; call 10; out t0; hlt; 10: r1 = 7; jit 1, la
+			program: []int{21101, 5, 0, 1, 1106, 1, 10, 204, 5, 9, 21101, 7, 0, 1, 2106, 1, 13},
+			expectedViolations: []ConventionViolation{
+				{ProgramCounter: 14, Register: 1, CallSite: 4, Routine: 10, Before: 5, After: 7},
+				{ProgramCounter: 7, Register: RegisterTemporary0, CallSite: 4, Routine: 10},
+			},
+			testName: "changed reserved registers and reads of temporary registers after a call are reported",
+		},
+		{
+			// r1 = 5; call 10; out 5; hlt; 10: $30 = r1; r1 = 7; r1 = $30; jit 1, la
+			program:            []int{21101, 5, 0, 1, 1106, 1, 10, 104, 5, 9, 1201, 1, 0, 30, 21101, 7, 0, 1, 21001, 30, 0, 1, 2106, 1, 13, 0, 0, 0, 0, 0, 0},
+			expectedViolations: []ConventionViolation{},
+			testName:           "restored reserved registers are not reported",
+		},
+		{
+			// call 6; out t0; hlt; 6: t0 = 7; jit 1, la
+			program:            []int{1106, 1, 6, 204, 5, 9, 21101, 7, 0, 5, 2106, 1, 13},
+			expectedViolations: []ConventionViolation{},
+			testName:           "temporary registers the routine sets are its results",
+		},
+		{
+			// jit 1, 5; hlt; 5: r0 = 1; jit 1, 3
+			program:            []int{1106, 1, 5, 9, 0, 21101, 1, 0, 0, 1106, 1, 3},
+			expectedViolations: []ConventionViolation{},
+			testName:           "jumps to immediates are never returns",
+		},
+	} {
+		t.Run(tc.testName, func(t *testing.T) {
+			forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+				machine := newMachine(tc.program)
+				machine.SetOutputInterface(&MockOutputInterface{})
+				machine.SetConventionChecking(true)
+
+				require.NoError(t, machine.Execute())
+				assert.Equal(t, tc.expectedViolations, machine.ConventionViolations())
+			})
+		})
+	}
+}
+
+func TestTsvetokVirtualMachine_ConventionViolationsAreLocated(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		sourceMap := &SourceMap{}
+		sourceMap.Add(10, 17, SourceLocation{Line: 6})
+		sourceMap.AddLabel("routine", 10)
+
+		machine := newMachine([]int{21101, 5, 0, 1, 1106, 1, 10, 104, 5, 9, 21101, 7, 0, 1, 2106, 1, 13})
+		machine.SetOutputInterface(&MockOutputInterface{})
+		machine.SetSourceLocator(sourceMap)
+		machine.SetTraceDepth(4)
+		machine.SetConventionChecking(true)
+		require.NoError(t, machine.Execute())
+
+		violations := machine.ConventionViolations()
+		require.Len(t, violations, 1)
+		assert.Equal(t, "calling convention broken at pc 14 (line 6): routine at 10 (routine) returned with $r1 changed from 5 to 7 (called from pc 4)", violations[0].String())
+
+		trace := machine.Trace()
+		assert.Equal(t, 14, trace[len(trace)-3].ProgramCounter)
+		assert.Equal(t, []string{violations[0].String()}, trace[len(trace)-3].Warnings)
+	})
+}
+
+func TestTsvetokVirtualMachine_ConventionCheckingIsOffByDefault(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{21101, 5, 0, 1, 1106, 1, 10, 204, 5, 9, 21101, 7, 0, 1, 2106, 1, 13})
+	machine.SetOutputInterface(&MockOutputInterface{})
+	require.NoError(t, machine.Execute())
+
+	assert.Empty(t, machine.ConventionViolations())
+}
+
+func TestCallStack_ForgetsTheOldestCallsOnceFull(t *testing.T) {
+	var stack callStack
+	for callSite := 0; callSite < maxCallFrames+500; callSite++ {
+		stack.push(callFrame{callSite: callSite})
+	}
+
+	require.Equal(t, maxCallFrames, stack.size)
+	assert.Equal(t, 500, stack.at(0).callSite)
+	assert.Equal(t, maxCallFrames+499, stack.at(stack.size-1).callSite)
+
+	stack.size = 10
+	stack.push(callFrame{callSite: -1})
+	assert.Equal(t, 11, stack.size)
+	assert.Equal(t, 509, stack.at(9).callSite)
+	assert.Equal(t, -1, stack.at(10).callSite)
+}
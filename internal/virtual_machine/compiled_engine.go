@@ -0,0 +1,425 @@
+package virtual_machine
+
+import (
+	"fmt"
+)
+
+// Engine selects how a TsvetokVirtualMachine executes its program. Every engine produces exactly the same
+// results, errors, limits, traces and reports; they only differ in speed
+type Engine int
+
+const (
+	// EngineInterpreter decodes (see the decode cache) and executes one instruction at a time
+	EngineInterpreter Engine = iota
+
+	// EngineCompiled translates straight-line runs of instructions (basic blocks) into chains of Go closures with
+	// their operands already bound, and executes those. Instructions that are modified after being compiled are
+	// executed by the interpreter from then on
+	EngineCompiled
+)
+
+// maxBlockLength is the most instructions compiled into a single block
+const maxBlockLength = 256
+
+// SetEngine selects the engine Execute runs the machine with. Step always interprets a single instruction
+func (t *TsvetokVirtualMachine) SetEngine(engine Engine) {
+	t.engine = engine
+}
+
+// GetEngine returns the engine Execute runs the machine with
+func (t *TsvetokVirtualMachine) GetEngine() Engine {
+	return t.engine
+}
+
+// compiledInstruction executes one instruction and sets the program counter to the next one. It reports whether
+// the instruction halted the machine
+type compiledInstruction func() (bool, error)
+
+// compiledBlock is a basic block: instructions that always execute one after another, ending with an instruction
+// that may transfer control elsewhere (or halt)
+type compiledBlock struct {
+	start        int
+	end          int
+	instructions []compiledInstruction
+
+	// stale is set once any word of the block has been written to, after which the block must not run again
+	stale bool
+}
+
+// compiledCode holds every block compiled so far, indexed by address
+type compiledCode struct {
+	blocks []*compiledBlock
+
+	// owners lists the blocks that include each address, and modified marks addresses that were written to after
+	// being compiled. Instructions including a modified address are only ever interpreted
+	owners   [][]*compiledBlock
+	modified []bool
+}
+
+// executeCompiled is Execute for EngineCompiled. Machines with WordSizeBig words are always interpreted, since
+// compiled instructions only compute with ints
+func (t *TsvetokVirtualMachine) executeCompiled() error {
+	if t.wordFormat.Size == WordSizeBig {
+		return t.executeInterpreted()
+	}
+
+	if t.compiled == nil || len(t.compiled.blocks) != len(t.memory) {
+		t.compiled = &compiledCode{
+			blocks:   make([]*compiledBlock, len(t.memory)),
+			owners:   make([][]*compiledBlock, len(t.memory)),
+			modified: make([]bool, len(t.memory)),
+		}
+	}
+
+	for {
+		var halted bool
+		var err error
+
+		if block := t.compiledBlockAt(t.programCounter); block != nil {
+			halted, err = t.runCompiledBlock(block)
+		} else {
+			halted, err = t.step()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if halted {
+			return nil
+		}
+	}
+}
+
+// runCompiledBlock runs the block provided until it ends, halts, faults, or is modified
+func (t *TsvetokVirtualMachine) runCompiledBlock(block *compiledBlock) (bool, error) {
+	for _, instruction := range block.instructions {
+		halted, err := instruction()
+		if err != nil || halted {
+			return halted, err
+		}
+
+		if block.stale {
+			return false, nil
+		}
+	}
+
+	return false, nil
+}
+
+// compiledBlockAt returns the block starting at the address provided, compiling it if needed. Returns nil if the
+// instruction at the address cannot be compiled, in which case it must be interpreted
+func (t *TsvetokVirtualMachine) compiledBlockAt(address int) *compiledBlock {
+	if address < 0 || address >= len(t.memory) {
+		return nil
+	}
+
+	if block := t.compiled.blocks[address]; block != nil {
+		return block
+	}
+
+	block := &compiledBlock{start: address, end: address}
+	for len(block.instructions) < maxBlockLength && block.end < len(t.memory) {
+		decoded := decodedInstruction{}
+		t.decodeAt(block.end, &decoded)
+		if decoded.operation == nil || t.isModified(block.end, decoded.length) {
+			break
+		}
+
+		block.instructions = append(block.instructions, t.compileInstruction(block.end, &decoded))
+		block.end += decoded.length
+
+		if opCode := decoded.rawOpcode % 100; opCode == 6 || opCode == 9 {
+			break
+		}
+	}
+
+	if len(block.instructions) == 0 {
+		return nil
+	}
+
+	t.compiled.blocks[address] = block
+	for owned := block.start; owned < block.end && owned < len(t.memory); owned++ {
+		t.compiled.owners[owned] = append(t.compiled.owners[owned], block)
+	}
+
+	return block
+}
+
+// isModified returns true if any of the words in [address, address+length) were modified after being compiled
+func (t *TsvetokVirtualMachine) isModified(address, length int) bool {
+	for modified := address; modified < address+length && modified < len(t.memory); modified++ {
+		if t.compiled.modified[modified] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invalidateCompiled discards every compiled block including the address provided
+func (t *TsvetokVirtualMachine) invalidateCompiled(address int) {
+	if t.compiled == nil || address >= len(t.compiled.owners) || len(t.compiled.owners[address]) == 0 {
+		return
+	}
+
+	for _, block := range t.compiled.owners[address] {
+		block.stale = true
+		if t.compiled.blocks[block.start] == block {
+			t.compiled.blocks[block.start] = nil
+		}
+	}
+
+	t.compiled.owners[address] = nil
+	t.compiled.modified[address] = true
+}
+
+// beginInstruction does the bookkeeping the interpreter does before executing the instruction at the address
+// provided (see Step)
+func (t *TsvetokVirtualMachine) beginInstruction(address, length int) error {
+	t.programCounter = address
+	if err := t.checkInstructionLimits(); err != nil {
+		return err
+	}
+
+	t.checkConventionJump()
+	t.recordTrace()
+	t.checkConvention()
+	if err := t.checkExecutable(length); err != nil {
+		return err
+	}
+
+	t.recordDecode(length)
+	t.usage.InstructionsExecuted++
+	return nil
+}
+
+// compileInstruction translates the decoded instruction at the address provided into a closure
+func (t *TsvetokVirtualMachine) compileInstruction(address int, decoded *decodedInstruction) compiledInstruction {
+	length := decoded.length
+	next := address + length
+
+	switch decoded.rawOpcode % 100 {
+	case 1:
+		return t.compileArithmetic(address, decoded, addOperator)
+	case 2:
+		return t.compileArithmetic(address, decoded, multiplyOperator)
+	case 3:
+		write := t.compileWrite(address, decoded, 0, "in")
+		return func() (bool, error) {
+			if err := t.beginInstruction(address, length); err != nil {
+				return false, err
+			}
+
+			if err := write.check(); err != nil {
+				return false, err
+			}
+
+			number, err := t.receiveInput()
+			if err != nil {
+				return false, err
+			}
+
+			number, err = t.wordFormat.Fit("in", number)
+			if err != nil {
+				return false, err
+			}
+
+			if err := write.store(number); err != nil {
+				return false, err
+			}
+
+			t.programCounter = next
+			return false, nil
+		}
+	case 4:
+		read := t.compileRead(address, decoded, 0)
+		return func() (bool, error) {
+			if err := t.beginInstruction(address, length); err != nil {
+				return false, err
+			}
+
+			value, err := read()
+			if err != nil {
+				return false, err
+			}
+
+			if err := t.emitOutput(value); err != nil {
+				return false, err
+			}
+
+			t.programCounter = next
+			return false, nil
+		}
+	case 5:
+		return t.compileArithmetic(address, decoded, setIfEqualOperator)
+	case 6:
+		readCondition := t.compileRead(address, decoded, 0)
+		readTarget := t.compileRead(address, decoded, 1)
+		return func() (bool, error) {
+			if err := t.beginInstruction(address, length); err != nil {
+				return false, err
+			}
+
+			condition, err := readCondition()
+			if err != nil {
+				return false, err
+			}
+
+			target, err := readTarget()
+			if err != nil {
+				return false, err
+			}
+
+			t.programCounter = next
+			if condition != 0 {
+				t.registerFile[RegisterLastAddress] = next
+				t.programCounter = target
+			}
+
+			return false, nil
+		}
+	case 7:
+		return t.compileArithmetic(address, decoded, setIfLessThanOperator)
+	case 10:
+		return t.compileArithmetic(address, decoded, divideOperator)
+	case 11:
+		return t.compileArithmetic(address, decoded, moduloOperator)
+	case 12:
+		return t.compileArithmetic(address, decoded, andOperator)
+	case 13:
+		return t.compileArithmetic(address, decoded, orOperator)
+	case 14:
+		return t.compileArithmetic(address, decoded, xorOperator)
+	case 15:
+		return t.compileArithmetic(address, decoded, notOperator)
+	case 16:
+		return t.compileArithmetic(address, decoded, shiftLeftOperator)
+	case 17:
+		return t.compileArithmetic(address, decoded, shiftRightOperator)
+	default:
+		return func() (bool, error) {
+			if err := t.beginInstruction(address, length); err != nil {
+				return false, err
+			}
+
+			return true, nil
+		}
+	}
+}
+
+// compileArithmetic compiles an instruction that computes its output parameter from its first two parameters (or
+// from its first, for unary operators)
+func (t *TsvetokVirtualMachine) compileArithmetic(address int, decoded *decodedInstruction, operator arithmeticOperator) compiledInstruction {
+	length := decoded.length
+	next := address + length
+	readLeft := t.compileRead(address, decoded, 0)
+	readRight := t.compileRead(address, decoded, 1)
+	write := t.compileWrite(address, decoded, 2, operator.name)
+	format := t.wordFormat
+
+	if operator.unary {
+		readRight = func() (int, error) { return 0, nil }
+		write = t.compileWrite(address, decoded, 1, operator.name)
+	}
+
+	return func() (bool, error) {
+		if err := t.beginInstruction(address, length); err != nil {
+			return false, err
+		}
+
+		left, err := readLeft()
+		if err != nil {
+			return false, err
+		}
+
+		right, err := readRight()
+		if err != nil {
+			return false, err
+		}
+
+		if err := write.check(); err != nil {
+			return false, err
+		}
+
+		result, _, err := format.apply(operator, left, right)
+		if err != nil {
+			return false, err
+		}
+
+		if err := write.store(result); err != nil {
+			return false, err
+		}
+
+		t.programCounter = next
+		return false, nil
+	}
+}
+
+// compileRead returns a closure that resolves the value of the parameter at the index provided, exactly as
+// newOperationParam would
+func (t *TsvetokVirtualMachine) compileRead(address int, decoded *decodedInstruction, index int) func() (int, error) {
+	paramAddress := address + 1 + index
+	if index >= decoded.operandCount {
+		return func() (int, error) {
+			return 0, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", paramAddress, len(t.memory))
+		}
+	}
+
+	operand := decoded.operands[index]
+	switch decoded.formats[index] {
+	case ParamFormatImmediate:
+		return func() (int, error) { return operand, nil }
+	case ParamFormatAddress:
+		return func() (int, error) { return t.GetValueInMemory(operand) }
+	case ParamFormatRegister:
+		return func() (int, error) { return t.GetValueInRegisterFile(operand) }
+	default:
+		format := decoded.formats[index]
+		return func() (int, error) {
+			return 0, fmt.Errorf("unknown parameter format '%v' at address '%v'", format, paramAddress)
+		}
+	}
+}
+
+// compiledWrite stores an instruction's result into its output parameter. check resolves the parameter just as
+// the interpreter does before the result is computed (see newOutputParam), and store writes the result
+type compiledWrite struct {
+	check func() error
+	store func(int) error
+}
+
+// compileWrite compiles the output parameter at the index provided of the instruction named
+func (t *TsvetokVirtualMachine) compileWrite(address int, decoded *decodedInstruction, index int, name string) compiledWrite {
+	read := t.compileRead(address, decoded, index)
+	check := func() error {
+		_, err := read()
+		return err
+	}
+
+	if index >= decoded.operandCount {
+		return compiledWrite{check, nil}
+	}
+
+	operand := decoded.operands[index]
+	switch decoded.formats[index] {
+	case ParamFormatAddress:
+		check = func() error { return t.checkWritable(operand) }
+		return compiledWrite{check, func(value int) error { return t.SetValueInMemory(operand, value) }}
+	case ParamFormatRegister:
+		return compiledWrite{check, func(value int) error { return t.SetValueInRegisterFile(operand, value) }}
+	case ParamFormatImmediate:
+		return compiledWrite{check, func(int) error { return InvalidOutputParamErr{name} }}
+	default:
+		return compiledWrite{check, nil}
+	}
+}
+
+// boolToWord converts a boolean to the integer TVM uses for it
+func boolToWord(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,83 @@
+package virtual_machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// machineConstructor makes a machine that runs the program provided with the engine under test
+type machineConstructor func(program []int) *TsvetokVirtualMachine
+
+// engineNames names every engine for the subtests of forEachEngine
+var engineNames = map[Engine]string{EngineInterpreter: "interpreter", EngineCompiled: "compiled"}
+
+// forEachEngine runs the test provided as a subtest for every engine, since every engine must behave identically
+func forEachEngine(t *testing.T, test func(t *testing.T, newMachine machineConstructor)) {
+	for _, engine := range []Engine{EngineInterpreter, EngineCompiled} {
+		t.Run(engineNames[engine], func(t *testing.T) {
+			test(t, func(program []int) *TsvetokVirtualMachine {
+				machine := NewTsvetokVirtualMachine(program)
+				machine.SetEngine(engine)
+				return machine
+			})
+		})
+	}
+}
+
+func TestCompiledEngine_FallsBackToTheInterpreterForModifiedCode(t *testing.T) {
+	// Outputs 5, patches the output's operand to 6 and jumps back to output again
+	machine := NewTsvetokVirtualMachine([]int{104, 5, 1001, 1, 1, 1, 21005, 1, 6, 5, 1206, 5, 0, 9})
+	machine.SetEngine(EngineCompiled)
+	mockOutput := &MockOutputInterface{}
+	machine.SetOutputInterface(mockOutput)
+
+	require.NoError(t, machine.Execute())
+	require.NotNil(t, mockOutput.LastNumberReceived)
+	assert.Equal(t, 6, *mockOutput.LastNumberReceived)
+	assert.True(t, machine.compiled.modified[1])
+	assert.Nil(t, machine.compiledBlockAt(0), "modified instructions must not be compiled again")
+	assert.NotNil(t, machine.compiledBlockAt(2))
+}
+
+func TestCompiledEngine_StopsRunningABlockThatModifiesItself(t *testing.T) {
+	// The add at address 0 rewrites the instruction after it (address 4) from an output of 7 into a halt
+	machine := NewTsvetokVirtualMachine([]int{1101, 4, 5, 4, 104, 7, 9})
+	machine.SetEngine(EngineCompiled)
+	mockOutput := &MockOutputInterface{}
+	machine.SetOutputInterface(mockOutput)
+
+	require.NoError(t, machine.Execute())
+	assert.Nil(t, mockOutput.LastNumberReceived)
+	assert.Equal(t, 4, machine.getProgramCounter())
+}
+
+func TestCompiledEngine_MatchesTheInterpreterOnEveryCounter(t *testing.T) {
+	results := map[Engine]MachineState{}
+	for _, engine := range []Engine{EngineInterpreter, EngineCompiled} {
+		machine := NewTsvetokVirtualMachine(append([]int{}, countdownLoopProgram...))
+		machine.SetEngine(engine)
+		machine.SetLimits(Limits{MaxInstructions: 1000})
+		require.Error(t, machine.Execute())
+
+		results[engine] = machine.Snapshot()
+	}
+
+	assert.Equal(t, results[EngineInterpreter], results[EngineCompiled])
+}
+
+func BenchmarkTsvetokVirtualMachine_CompiledEngine(b *testing.B) {
+	instructions := 0
+	for range b.N {
+		machine := NewTsvetokVirtualMachine(append([]int{}, countdownLoopProgram...))
+		machine.SetEngine(EngineCompiled)
+		if err := machine.Execute(); err != nil {
+			b.Fatal(err)
+		}
+
+		instructions += machine.InstructionsExecuted()
+	}
+
+	b.ReportMetric(float64(instructions)/b.Elapsed().Seconds(), "instructions/s")
+}
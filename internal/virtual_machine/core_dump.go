@@ -0,0 +1,64 @@
+package virtual_machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CoreDumpFormatVersion is the version of the core file format written by WriteCoreDump
+const CoreDumpFormatVersion = 1
+
+// CoreDump captures everything known about a machine at the moment it faulted, for post-mortem inspection: its
+// full state, the instructions leading up to the fault (see SetTraceDepth), and the fault itself
+type CoreDump struct {
+	Version int          `json:"version"`
+	Fault   string       `json:"fault"`
+	State   MachineState `json:"state"`
+	Trace   []TraceEntry `json:"trace"`
+
+	// Debug is the machine's source map, if it was given one (see SetSourceLocator), so that debuggers can resolve
+	// addresses of the dump back to source code
+	Debug *SourceMap `json:"debug,omitempty"`
+}
+
+// CoreDump returns a core dump of the machine for the fault provided. The machine's program counter still
+// points at the faulting instruction, since a faulting instruction never advances it
+func (t *TsvetokVirtualMachine) CoreDump(fault error) CoreDump {
+	return CoreDump{
+		Version: CoreDumpFormatVersion,
+		Fault:   fault.Error(),
+		State:   t.Snapshot(),
+		Trace:   t.Trace(),
+		Debug:   t.debugInfo(),
+	}
+}
+
+// WriteCoreDump writes the core dump provided to w as a JSON document
+func WriteCoreDump(w io.Writer, core CoreDump) error {
+	encoded, err := json.MarshalIndent(core, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(encoded, '\n'))
+	return err
+}
+
+// ReadCoreDump reads a core dump written by WriteCoreDump
+func ReadCoreDump(r io.Reader) (CoreDump, error) {
+	var core CoreDump
+	if err := json.NewDecoder(r).Decode(&core); err != nil {
+		return CoreDump{}, err
+	}
+
+	if core.Version != CoreDumpFormatVersion {
+		return CoreDump{}, fmt.Errorf("unsupported core file version '%v'", core.Version)
+	}
+
+	if len(core.State.Registers) != registerFileSize {
+		return CoreDump{}, fmt.Errorf("core file has '%v' registers (expected '%v')", len(core.State.Registers), registerFileSize)
+	}
+
+	return core, nil
+}
@@ -0,0 +1,59 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTsvetokVirtualMachine_TraceKeepsTheMostRecentInstructions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1101, 1, 2, 0, 104, 7, 1106, 1, 10, 0, 9})
+		machine.SetOutputInterface(&MockOutputInterface{})
+		machine.SetTraceDepth(2)
+		require.NoError(t, machine.Execute())
+
+		assert.Equal(t, []TraceEntry{
+			{ProgramCounter: 6, Instruction: []int{1106, 1, 10}},
+			{ProgramCounter: 10, Instruction: []int{9}},
+		}, machine.Trace())
+	})
+}
+
+func TestTsvetokVirtualMachine_TraceIsEmptyWhenTracingIsOff(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{9})
+	require.NoError(t, machine.Execute())
+
+	assert.Empty(t, machine.Trace())
+}
+
+func TestCoreDump_CapturesFaultStateAndTrace(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1101, 1, 2, 0, 10001, 0, 0, 0, 9})
+		machine.SetTraceDepth(8)
+		err := machine.Execute()
+		require.Error(t, err)
+
+		core := machine.CoreDump(err)
+		assert.Equal(t, err.Error(), core.Fault)
+		assert.Equal(t, 4, core.State.ProgramCounter)
+		assert.Equal(t, 3, core.State.Memory[0])
+		require.Len(t, core.Trace, 2)
+		assert.Equal(t, []int{10001, 0, 0, 0}, core.Trace[1].Instruction)
+
+		buffer := &bytes.Buffer{}
+		require.NoError(t, WriteCoreDump(buffer, core))
+
+		decoded, err := ReadCoreDump(buffer)
+		require.NoError(t, err)
+		assert.Equal(t, core, decoded)
+	})
+}
+
+func TestCoreDump_RejectsUnknownVersions(t *testing.T) {
+	_, err := ReadCoreDump(strings.NewReader(`{"version": 99}`))
+	assert.Error(t, err)
+}
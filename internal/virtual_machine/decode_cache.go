@@ -0,0 +1,93 @@
+package virtual_machine
+
+import (
+	"fmt"
+)
+
+// maxInstructionLength is the number of words taken up by the longest instruction (see instructionLength)
+const maxInstructionLength = 4
+
+// decodedInstruction is an instruction whose opcode, parameter formats and operand words have already been pulled
+// out of memory, along with the operation that executes it. Parameter values are not part of the decoding since
+// they depend on registers and memory at the time the instruction executes
+type decodedInstruction struct {
+	valid     bool
+	rawOpcode int
+	length    int
+	operation TVMOperation
+
+	// formats and operands hold each parameter's format digit and operand word. operandCount is the number of
+	// operand words that actually fit in memory, which is less than the instruction needs if it was cut off
+	formats      [3]int
+	operands     [3]int
+	operandCount int
+}
+
+// decodeCurrentInstruction returns the decoding of the instruction at the current program counter. Decodings are
+// cached by address, so each instruction is only decoded again after something writes to one of its words
+func (t *TsvetokVirtualMachine) decodeCurrentInstruction() *decodedInstruction {
+	if t.decodeCacheDisabled {
+		t.scratchDecode = decodedInstruction{}
+		t.decodeAt(t.programCounter, &t.scratchDecode)
+		return &t.scratchDecode
+	}
+
+	if len(t.decodeCache) != len(t.memory) {
+		t.decodeCache = make([]decodedInstruction, len(t.memory))
+	}
+
+	decoded := &t.decodeCache[t.programCounter]
+	if !decoded.valid {
+		t.decodeAt(t.programCounter, decoded)
+	}
+
+	return decoded
+}
+
+// decodeAt decodes the instruction at the address provided
+func (t *TsvetokVirtualMachine) decodeAt(address int, decoded *decodedInstruction) {
+	rawOpcode := t.memory[address]
+
+	decoded.valid = true
+	decoded.rawOpcode = rawOpcode
+	decoded.length = instructionLength(rawOpcode % 100)
+	decoded.operation = t.newOperation(rawOpcode % 100)
+	decoded.formats = [3]int{(rawOpcode / 100) % 10, (rawOpcode / 1000) % 10, rawOpcode / 10000}
+
+	decoded.operandCount = 0
+	for index := 0; index < decoded.length-1 && address+1+index < len(t.memory); index++ {
+		decoded.operands[index] = t.memory[address+1+index]
+		decoded.operandCount++
+	}
+}
+
+// invalidateDecode forgets the decoding of every instruction that may include the address provided
+func (t *TsvetokVirtualMachine) invalidateDecode(address int) {
+	for start := address - maxInstructionLength + 1; start <= address; start++ {
+		if start >= 0 && start < len(t.decodeCache) {
+			t.decodeCache[start].valid = false
+		}
+	}
+}
+
+// getParam returns the parameter at the index provided (0 for the first parameter) of the instruction currently
+// executing
+func (t *TsvetokVirtualMachine) getParam(index int) (operationParam, error) {
+	paramAddress := t.programCounter + 1 + index
+	if index >= t.currentInstruction.operandCount {
+		return operationParam{}, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", paramAddress, len(t.memory))
+	}
+
+	return newOperationParam(t, t.currentInstruction.formats[index], t.currentInstruction.operands[index], paramAddress)
+}
+
+// getOutputParam returns the parameter at the index provided of the instruction currently executing as the
+// parameter its result is written to (see newOutputParam)
+func (t *TsvetokVirtualMachine) getOutputParam(index int) (operationParam, error) {
+	paramAddress := t.programCounter + 1 + index
+	if index >= t.currentInstruction.operandCount {
+		return operationParam{}, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", paramAddress, len(t.memory))
+	}
+
+	return newOutputParam(t, t.currentInstruction.formats[index], t.currentInstruction.operands[index], paramAddress)
+}
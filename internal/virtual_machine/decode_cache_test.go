@@ -0,0 +1,66 @@
+package virtual_machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countdownLoopProgram counts $r0 down from the number at address 1 to zero entirely in registers
+var countdownLoopProgram = []int{21101, 100000, 0, 0, 21201, 0, -1, 0, 21205, 0, 0, 5, 1206, 5, 18, 1106, 1, 4, 9}
+
+func TestTsvetokVirtualMachine_DecodeCacheIsInvalidatedByWrites(t *testing.T) {
+	// Outputs 5, patches the output's operand to 6 and jumps back to output again
+	program := []int{104, 5, 1001, 1, 1, 1, 21005, 1, 6, 5, 1206, 5, 0, 9}
+
+	for _, cacheDisabled := range []bool{false, true} {
+		machine := NewTsvetokVirtualMachine(append([]int{}, program...))
+		machine.decodeCacheDisabled = cacheDisabled
+		mockOutput := &MockOutputInterface{}
+		machine.SetOutputInterface(mockOutput)
+
+		require.NoError(t, machine.Execute())
+		require.NotNil(t, mockOutput.LastNumberReceived)
+		assert.Equal(t, 6, *mockOutput.LastNumberReceived, "decode cache disabled: %v", cacheDisabled)
+		assert.Equal(t, 2, machine.GetUsage().OutputsEmitted)
+	}
+}
+
+func TestTsvetokVirtualMachine_DecodeCacheIsClearedOnRestore(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{104, 1, 9})
+	machine.SetOutputInterface(&MockOutputInterface{})
+	require.NoError(t, machine.Execute())
+
+	mockOutput := &MockOutputInterface{}
+	machine.SetOutputInterface(mockOutput)
+	require.NoError(t, machine.Restore(MachineState{Memory: []int{104, 2, 9}, Registers: make([]int, registerFileSize)}))
+	require.NoError(t, machine.Execute())
+
+	require.NotNil(t, mockOutput.LastNumberReceived)
+	assert.Equal(t, 2, *mockOutput.LastNumberReceived)
+}
+
+func benchmarkCountdownLoop(b *testing.B, cacheDisabled bool) {
+	instructions := 0
+	for range b.N {
+		machine := NewTsvetokVirtualMachine(append([]int{}, countdownLoopProgram...))
+		machine.SetEngine(EngineInterpreter)
+		machine.decodeCacheDisabled = cacheDisabled
+		if err := machine.Execute(); err != nil {
+			b.Fatal(err)
+		}
+
+		instructions += machine.InstructionsExecuted()
+	}
+
+	b.ReportMetric(float64(instructions)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func BenchmarkTsvetokVirtualMachine_WithDecodeCache(b *testing.B) {
+	benchmarkCountdownLoop(b, false)
+}
+
+func BenchmarkTsvetokVirtualMachine_WithoutDecodeCache(b *testing.B) {
+	benchmarkCountdownLoop(b, true)
+}
@@ -0,0 +1,80 @@
+package virtual_machine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// opcodeMnemonics are the assembly mnemonics of every opcode, indexed by opcode
+var opcodeMnemonics = map[int]string{
+	1:  "add",
+	2:  "mlt",
+	3:  "in",
+	4:  "out",
+	5:  "seq",
+	6:  "jit",
+	7:  "slt",
+	9:  "hlt",
+	10: "div",
+	11: "mod",
+	12: "and",
+	13: "or",
+	14: "xor",
+	15: "not",
+	16: "shl",
+	17: "shr",
+}
+
+// OpcodeMnemonic returns the assembly mnemonic of the opcode provided (the raw opcode modulo 100), or an empty
+// string if no such opcode exists
+func OpcodeMnemonic(opCode int) string {
+	return opcodeMnemonics[opCode]
+}
+
+// InstructionLength returns the number of words (opcode included) taken up by an instruction with the opcode
+// provided (the raw opcode modulo 100.) Unknown opcodes are one word long
+func InstructionLength(opCode int) int {
+	return instructionLength(opCode)
+}
+
+// Disassemble returns the instruction at the address provided in assembly syntax, along with its length. Words
+// that are not valid instructions are shown as data (e.g. ".word 1234")
+func Disassemble(memory []int, address int) (string, int) {
+	if address < 0 || address >= len(memory) {
+		return "", 0
+	}
+
+	rawOpcode := memory[address]
+	mnemonic := OpcodeMnemonic(rawOpcode % 100)
+	length := instructionLength(rawOpcode % 100)
+	if mnemonic == "" || address+length > len(memory) {
+		return fmt.Sprintf(".word %v", rawOpcode), 1
+	}
+
+	formats := []int{(rawOpcode / 100) % 10, (rawOpcode / 1000) % 10, rawOpcode / 10000}
+	operands := make([]string, 0, length-1)
+	for index := 0; index < length-1; index++ {
+		operand := memory[address+1+index]
+
+		switch formats[index] {
+		case ParamFormatAddress:
+			operands = append(operands, fmt.Sprintf("$%v", operand))
+		case ParamFormatImmediate:
+			operands = append(operands, fmt.Sprintf("%v", operand))
+		case ParamFormatRegister:
+			if name := RegisterName(operand); name != "" {
+				operands = append(operands, name)
+			} else {
+				return fmt.Sprintf(".word %v", rawOpcode), 1
+			}
+		default:
+			return fmt.Sprintf(".word %v", rawOpcode), 1
+		}
+	}
+
+	if len(operands) == 0 {
+		return mnemonic, length
+	}
+
+	return fmt.Sprintf("%v %v", mnemonic, strings.Join(operands, ", ")), length
+}
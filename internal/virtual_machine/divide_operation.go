@@ -0,0 +1,46 @@
+package virtual_machine
+
+import (
+	"math"
+	"math/big"
+)
+
+// divideOperation divides the first number by the second, rounding towards zero
+type divideOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// divideOperator divides two words, faulting if the divisor is 0
+var divideOperator = arithmeticOperator{
+	name: "div",
+	native: func(a, b int) (int, bool) {
+		if a == math.MinInt && b == -1 {
+			return 0, false
+		}
+
+		return a / b, true
+	},
+	exact:    func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) },
+	validate: validateDivisor,
+}
+
+func newDivideOperation(t *TsvetokVirtualMachine) divideOperation {
+	return divideOperation{t}
+}
+
+func (d divideOperation) Execute() error {
+	return d.executeArithmetic(divideOperator)
+}
+
+func (d divideOperation) GetNextProgramCounter() int { return d.getProgramCounter() + 4 }
+
+func (_ divideOperation) Halt() bool { return false }
+
+// validateDivisor faults with a DivisionByZeroErr if the divisor provided is 0
+func validateDivisor(_ WordFormat, divisor *big.Int) error {
+	if divisor.Sign() == 0 {
+		return DivisionByZeroErr{}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package virtual_machine
 
 import (
 	"fmt"
+	"time"
 )
 
 // AttemptedLastAddressWriteErr indicates that an operation attempted to write to the last address
@@ -22,3 +23,134 @@ type InvalidOutputParamErr struct {
 func (i InvalidOutputParamErr) Error() string {
 	return fmt.Sprintf("invalid output parameter for %v operation", i.Operation)
 }
+
+// InstructionLimitExceededErr indicates that the machine attempted to execute more instructions than its
+// limits allow
+type InstructionLimitExceededErr struct {
+	Limit int
+}
+
+func (i InstructionLimitExceededErr) Error() string {
+	return fmt.Sprintf("instruction limit of '%v' exceeded", i.Limit)
+}
+
+// DeadlineExceededErr indicates that the machine was still executing when its wall-clock deadline passed
+type DeadlineExceededErr struct {
+	Deadline time.Time
+}
+
+func (d DeadlineExceededErr) Error() string {
+	return fmt.Sprintf("execution deadline '%v' exceeded", d.Deadline.Format(time.RFC3339Nano))
+}
+
+// MemoryLimitExceededErr indicates that the machine's memory holds more words than its limits allow
+type MemoryLimitExceededErr struct {
+	Limit int
+	Size  int
+}
+
+func (m MemoryLimitExceededErr) Error() string {
+	return fmt.Sprintf("memory of size '%v' exceeds limit of '%v' words", m.Size, m.Limit)
+}
+
+// OutputLimitExceededErr indicates that the machine attempted to emit more outputs than its limits allow
+type OutputLimitExceededErr struct {
+	Limit int
+}
+
+func (o OutputLimitExceededErr) Error() string {
+	return fmt.Sprintf("output limit of '%v' exceeded", o.Limit)
+}
+
+// InputLimitExceededErr indicates that the machine attempted to read more inputs than its limits allow
+type InputLimitExceededErr struct {
+	Limit int
+}
+
+func (i InputLimitExceededErr) Error() string {
+	return fmt.Sprintf("input limit of '%v' exceeded", i.Limit)
+}
+
+// ProtectionFaultErr indicates that an instruction accessed memory in a way that the memory's region does not
+// permit, such as writing into a read-only code region
+type ProtectionFaultErr struct {
+	Region         MemoryRegion
+	Address        int
+	ProgramCounter int
+	Access         MemoryPermission
+}
+
+func (p ProtectionFaultErr) Error() string {
+	return fmt.Sprintf("protection fault at pc '%v': %v of address '%v' in region '%v' (%v)",
+		p.ProgramCounter, p.Access.accessName(), p.Address, p.Region.Name, p.Region.Permissions)
+}
+
+// WordOverflowErr indicates that a value did not fit in the machine's words while its overflow mode is
+// OverflowFault (see SetWordFormat)
+type WordOverflowErr struct {
+	Operation string
+	Value     string
+	Size      WordSize
+}
+
+func (w WordOverflowErr) Error() string {
+	return fmt.Sprintf("%v overflowed a %v-bit word with '%v'", w.Operation, w.Size, w.Value)
+}
+
+// WideWordErr indicates that a word too wide for an int, which only exists with WordSizeBig, was used as something
+// other than data, such as an address or a jump target
+type WideWordErr struct {
+	Operation string
+	Value     string
+}
+
+func (w WideWordErr) Error() string {
+	return fmt.Sprintf("%v cannot use '%v' since it does not fit in 64 bits", w.Operation, w.Value)
+}
+
+// DivisionByZeroErr indicates that a div or mod instruction attempted to divide by zero
+type DivisionByZeroErr struct{}
+
+func (_ DivisionByZeroErr) Error() string {
+	return "attempted to divide by zero"
+}
+
+// InvalidShiftErr indicates that a shl or shr instruction attempted to shift by a negative amount, or by at least
+// as many bits as a word has
+type InvalidShiftErr struct {
+	Amount string
+	Limit  int
+}
+
+func (i InvalidShiftErr) Error() string {
+	return fmt.Sprintf("cannot shift by '%v' bits (expected 0 to %v)", i.Amount, i.Limit-1)
+}
+
+// SourceFaultErr wraps an error the machine faulted with when it knows where in the source code the faulting
+// instruction came from (see SetSourceLocator)
+type SourceFaultErr struct {
+	ProgramCounter int
+
+	// Location and Symbol are the source location and label of the faulting instruction, when they are known
+	Location *SourceLocation
+	Symbol   string
+
+	Err error
+}
+
+func (s SourceFaultErr) Error() string {
+	where := fmt.Sprintf("pc %v", s.ProgramCounter)
+	if s.Symbol != "" {
+		where = fmt.Sprintf("%v in %v", where, s.Symbol)
+	}
+
+	if s.Location == nil {
+		return fmt.Sprintf("%v (%v)", s.Err, where)
+	}
+
+	return fmt.Sprintf("%v: %v (%v)", s.Location, s.Err, where)
+}
+
+func (s SourceFaultErr) Unwrap() error {
+	return s.Err
+}
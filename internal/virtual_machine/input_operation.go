@@ -12,22 +12,22 @@ func newInputOperation(t *TsvetokVirtualMachine) inputOperation {
 }
 
 func (m inputOperation) Execute() error {
-	address, err := m.getFirstParam()
+	address, err := m.getOutputParam(0)
 	if err != nil {
 		return err
 	}
 
-	number := m.ReceiveInput()
-
-	if address.Format == ParamFormatAddress {
-		return m.SetValueInMemory(address.Address, number)
+	number, err := m.receiveInput()
+	if err != nil {
+		return err
 	}
 
-	if address.Format == ParamFormatRegister {
-		return m.SetValueInRegisterFile(address.Address, number)
+	number, err = m.wordFormat.Fit("in", number)
+	if err != nil {
+		return err
 	}
 
-	return InvalidOutputParamErr{"in"}
+	return m.writeParam(address, "in", number, nil)
 }
 
 func (m inputOperation) GetNextProgramCounter() int { return m.getProgramCounter() + 2 }
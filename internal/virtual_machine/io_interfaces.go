@@ -1,6 +1,12 @@
 package virtual_machine
 
-import ()
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+)
 
 // InputInterface represents any external service or program that can be called upon for
 // an integer
@@ -9,9 +15,78 @@ type InputInterface interface {
 	ReceiveInput() int
 }
 
+// FallibleInputInterface is an InputInterface that can fail to acquire an integer (for example, when its source
+// runs dry.) If a machine's InputInterface implements it, failures are reported by the input instruction
+type FallibleInputInterface interface {
+	InputInterface
+
+	// ReceiveInputErr acquires and returns an integer from an external source, or an error if none could be acquired
+	ReceiveInputErr() (int, error)
+}
+
 // OutputInterface represents any external service or program that an integer can be
 // emitted
 type OutputInterface interface {
 	// EmitOutput emits the integer provided to a given target
 	EmitOutput(int)
 }
+
+// BigOutputInterface is an OutputInterface that can also emit words too wide for an int, which only exist with
+// WordSizeBig. Emitting such a word through any other OutputInterface is a WideWordErr
+type BigOutputInterface interface {
+	OutputInterface
+
+	// EmitBigOutput emits the arbitrary-precision integer provided to a given target
+	EmitBigOutput(*big.Int)
+}
+
+// ReaderInputInterface reads whitespace-separated decimal integers from an io.Reader
+type ReaderInputInterface struct {
+	scanner *bufio.Scanner
+}
+
+func NewReaderInputInterface(r io.Reader) *ReaderInputInterface {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+
+	return &ReaderInputInterface{scanner}
+}
+
+func (r *ReaderInputInterface) ReceiveInput() int {
+	number, _ := r.ReceiveInputErr()
+	return number
+}
+
+func (r *ReaderInputInterface) ReceiveInputErr() (int, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return 0, err
+		}
+
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	number, err := strconv.Atoi(r.scanner.Text())
+	if err != nil {
+		return 0, fmt.Errorf("invalid input '%v': expected an integer", r.scanner.Text())
+	}
+
+	return number, nil
+}
+
+// WriterOutputInterface writes each integer emitted on its own line to an io.Writer
+type WriterOutputInterface struct {
+	writer io.Writer
+}
+
+func NewWriterOutputInterface(w io.Writer) *WriterOutputInterface {
+	return &WriterOutputInterface{w}
+}
+
+func (w *WriterOutputInterface) EmitOutput(number int) {
+	fmt.Fprintln(w.writer, number)
+}
+
+func (w *WriterOutputInterface) EmitBigOutput(number *big.Int) {
+	fmt.Fprintln(w.writer, number)
+}
@@ -26,9 +26,14 @@ func (s *jumpIfTrueOperation) Execute() error {
 	}
 
 	s.nextProgramCounter = s.getProgramCounter() + 3
-	if firstParam.Value != 0 {
+	if firstParam.Value != 0 || firstParam.Wide != nil {
+		target, err := secondParam.native("jit")
+		if err != nil {
+			return err
+		}
+
 		s.registerFile[RegisterLastAddress] = s.nextProgramCounter
-		s.nextProgramCounter = secondParam.Value
+		s.nextProgramCounter = target
 	}
 
 	return nil
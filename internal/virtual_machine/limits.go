@@ -0,0 +1,171 @@
+package virtual_machine
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+)
+
+// Limits describes the resources a TsvetokVirtualMachine may consume while executing. Any field left at its
+// zero value is treated as unlimited, so the zero Limits places no restrictions on the machine at all. Each
+// limit that is exceeded produces its own error type (see error.go) so that callers can tell them apart
+type Limits struct {
+	// MaxInstructions is the maximum number of instructions the machine may execute, including the final halt
+	MaxInstructions int `json:"maxInstructions"`
+
+	// Deadline is the wall-clock time after which the machine refuses to execute any further instructions. It is
+	// encoded as the time remaining until it (see remainingTime), so that a machine decoded later gets as long
+	Deadline time.Time `json:"-"`
+
+	// MaxMemoryWords is the maximum number of words the machine's memory may hold
+	MaxMemoryWords int `json:"maxMemoryWords"`
+
+	// MaxOutputs is the maximum number of integers the machine may emit through its OutputInterface
+	MaxOutputs int `json:"maxOutputs"`
+
+	// MaxInputReads is the maximum number of integers the machine may request from its InputInterface
+	MaxInputReads int `json:"maxInputReads"`
+}
+
+// limitFields has the fields of Limits without its JSON methods
+type limitFields Limits
+
+// limitsJSON is how Limits are encoded in JSON: the deadline is the nanoseconds remaining until it
+type limitsJSON struct {
+	limitFields
+	RemainingTime time.Duration `json:"remainingTime,omitempty"`
+}
+
+func (l Limits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(limitsJSON{limitFields(l), remainingTime(l.Deadline)})
+}
+
+func (l *Limits) UnmarshalJSON(data []byte) error {
+	decoded := limitsJSON{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*l = Limits(decoded.limitFields)
+	l.Deadline = deadlineAfter(decoded.RemainingTime)
+	return nil
+}
+
+// remainingTime returns the time left until the deadline provided, or 0 if there is none. A deadline that has
+// passed leaves a nanosecond, so that a machine given it again is still out of time
+func remainingTime(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+
+	return max(time.Until(deadline), time.Nanosecond)
+}
+
+// deadlineAfter returns the deadline the time remaining provided from now, or no deadline if it is 0
+func deadlineAfter(remaining time.Duration) time.Time {
+	if remaining <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(remaining)
+}
+
+// UsageCounters tracks how much of each limited resource the machine has consumed so far. The counters are
+// kept across calls to Execute (and across snapshots) so that a machine cannot dodge its limits by being
+// executed repeatedly
+type UsageCounters struct {
+	InstructionsExecuted int `json:"instructionsExecuted"`
+	OutputsEmitted       int `json:"outputsEmitted"`
+	InputsRead           int `json:"inputsRead"`
+}
+
+// SetLimits replaces the machine's resource limits. Resources already consumed still count against the new limits
+func (t *TsvetokVirtualMachine) SetLimits(limits Limits) {
+	t.limits = limits
+}
+
+// GetLimits returns the machine's current resource limits
+func (t *TsvetokVirtualMachine) GetLimits() Limits {
+	return t.limits
+}
+
+// GetUsage returns how much of each limited resource the machine has consumed over its lifetime
+func (t *TsvetokVirtualMachine) GetUsage() UsageCounters {
+	return t.usage
+}
+
+// InstructionsExecuted returns the number of instructions the machine has executed over its lifetime
+func (t *TsvetokVirtualMachine) InstructionsExecuted() int {
+	return t.usage.InstructionsExecuted
+}
+
+// checkInstructionLimits returns an error if executing one more instruction would violate the instruction or
+// deadline limits
+func (t *TsvetokVirtualMachine) checkInstructionLimits() error {
+	if t.limits.MaxInstructions > 0 && t.usage.InstructionsExecuted >= t.limits.MaxInstructions {
+		return InstructionLimitExceededErr{t.limits.MaxInstructions}
+	}
+
+	if !t.limits.Deadline.IsZero() && time.Now().After(t.limits.Deadline) {
+		return DeadlineExceededErr{t.limits.Deadline}
+	}
+
+	return nil
+}
+
+// checkMemoryLimit returns an error if memory of the size provided would violate the memory limit
+func (t *TsvetokVirtualMachine) checkMemoryLimit(size int) error {
+	if t.limits.MaxMemoryWords > 0 && size > t.limits.MaxMemoryWords {
+		return MemoryLimitExceededErr{t.limits.MaxMemoryWords, size}
+	}
+
+	return nil
+}
+
+// receiveInput requests an integer from the machine's InputInterface, respecting the input limit
+func (t *TsvetokVirtualMachine) receiveInput() (int, error) {
+	if t.limits.MaxInputReads > 0 && t.usage.InputsRead >= t.limits.MaxInputReads {
+		return 0, InputLimitExceededErr{t.limits.MaxInputReads}
+	}
+
+	if fallible, isFallible := t.InputInterface.(FallibleInputInterface); isFallible {
+		number, err := fallible.ReceiveInputErr()
+		if err != nil {
+			return 0, err
+		}
+
+		t.usage.InputsRead++
+		return number, nil
+	}
+
+	t.usage.InputsRead++
+	return t.ReceiveInput(), nil
+}
+
+// emitOutput sends an integer to the machine's OutputInterface, respecting the output limit
+func (t *TsvetokVirtualMachine) emitOutput(number int) error {
+	if t.limits.MaxOutputs > 0 && t.usage.OutputsEmitted >= t.limits.MaxOutputs {
+		return OutputLimitExceededErr{t.limits.MaxOutputs}
+	}
+
+	t.usage.OutputsEmitted++
+	t.EmitOutput(number)
+	return nil
+}
+
+// emitWideOutput sends a word too wide for an int to the machine's OutputInterface, which must be a
+// BigOutputInterface, respecting the output limit
+func (t *TsvetokVirtualMachine) emitWideOutput(number *big.Int) error {
+	wide, isWide := t.OutputInterface.(BigOutputInterface)
+	if !isWide {
+		return WideWordErr{"out", number.String()}
+	}
+
+	if t.limits.MaxOutputs > 0 && t.usage.OutputsEmitted >= t.limits.MaxOutputs {
+		return OutputLimitExceededErr{t.limits.MaxOutputs}
+	}
+
+	t.usage.OutputsEmitted++
+	wide.EmitBigOutput(number)
+	return nil
+}
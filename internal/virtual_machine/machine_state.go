@@ -0,0 +1,441 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// MachineStateMagic is the sequence of ASCII characters every binary machine state begins with
+const MachineStateMagic = "TVMS"
+
+// machineStateVersion is the version of the binary machine state format written by MarshalBinary. Bump it
+// whenever the layout changes so that old snapshots are rejected rather than misread
+const machineStateVersion = 3
+
+// MachineState is a complete, self-contained copy of a TsvetokVirtualMachine's state: everything needed to resume
+// execution exactly where it left off, either in the same process or another one. Input and output interfaces are
+// not part of the state and must be provided again after restoring
+type MachineState struct {
+	Memory         []int          `json:"memory"`
+	Registers      []int          `json:"registers"`
+	ProgramCounter int            `json:"programCounter"`
+	Limits         Limits         `json:"limits"`
+	Usage          UsageCounters  `json:"usage"`
+	Regions        []MemoryRegion `json:"regions"`
+	WordFormat     WordFormat     `json:"wordFormat"`
+
+	// WideMemory and WideRegisters hold the words too wide for an int (see WordSizeBig) by address, in place of
+	// the 0 held in Memory and Registers
+	WideMemory    map[int]*big.Int `json:"wideMemory,omitempty"`
+	WideRegisters map[int]*big.Int `json:"wideRegisters,omitempty"`
+}
+
+// Snapshot returns a copy of the machine's current state. The copy shares no memory with the machine
+func (t *TsvetokVirtualMachine) Snapshot() MachineState {
+	registers := make([]int, len(t.registerFile))
+	copy(registers, t.registerFile)
+
+	state := MachineState{
+		Memory:         t.CopyMemory(),
+		Registers:      registers,
+		ProgramCounter: t.programCounter,
+		Limits:         t.limits,
+		Usage:          t.usage,
+		Regions:        t.MemoryRegions(),
+		WordFormat:     t.wordFormat,
+	}
+
+	if t.wide != nil {
+		state.WideMemory = copyWideWords(t.wide.memory)
+		state.WideRegisters = copyWideWords(t.wide.registers)
+	}
+
+	return state
+}
+
+// Restore replaces the machine's state with a copy of the one provided. The machine's input and output interfaces
+// are left untouched, and so is everything else if the state provided is invalid
+func (t *TsvetokVirtualMachine) Restore(state MachineState) error {
+	if len(state.Registers) != registerFileSize {
+		return fmt.Errorf("machine state has '%v' registers (expected '%v')", len(state.Registers), registerFileSize)
+	}
+
+	restored := NewTsvetokVirtualMachine(append([]int{}, state.Memory...))
+	copy(restored.registerFile, state.Registers)
+	if err := restored.SetWordFormat(state.WordFormat); err != nil {
+		return err
+	}
+
+	if err := restored.restoreWideWords(state.WideMemory, state.WideRegisters); err != nil {
+		return err
+	}
+
+	for _, region := range state.Regions {
+		if err := restored.AddMemoryRegion(region); err != nil {
+			return err
+		}
+	}
+
+	t.memory = restored.memory
+	t.registerFile = restored.registerFile
+	t.wordFormat = restored.wordFormat
+	t.wide = restored.wide
+	t.regions = restored.regions
+	t.decodeCache = nil
+	t.compiled = nil
+
+	t.programCounter = state.ProgramCounter
+	t.limits = state.Limits
+	t.usage = state.Usage
+	return nil
+}
+
+// NewTsvetokVirtualMachineFromState returns a machine resumed from the state provided
+func NewTsvetokVirtualMachineFromState(state MachineState) (*TsvetokVirtualMachine, error) {
+	machine := NewTsvetokVirtualMachine([]int{})
+	if err := machine.Restore(state); err != nil {
+		return nil, err
+	}
+
+	return machine, nil
+}
+
+// Fork returns an independent copy of the machine, including its input and output interfaces, its engine, its
+// source locator, its trace, and everything self-modification detection and calling convention checking have
+// recorded. This allows exploring alternative inputs from the same point of execution: give the fork a different
+// InputInterface and execute both
+func (t *TsvetokVirtualMachine) Fork() *TsvetokVirtualMachine {
+	fork, _ := NewTsvetokVirtualMachineFromState(t.Snapshot())
+	fork.InputInterface = t.InputInterface
+	fork.OutputInterface = t.OutputInterface
+	fork.engine = t.engine
+	fork.sourceLocator = t.sourceLocator
+	fork.trace = t.trace.clone()
+	fork.selfModification = t.selfModification.clone()
+	fork.convention = t.convention.clone()
+
+	return fork
+}
+
+// MarshalBinary encodes the state in the stable binary format: the ASCII characters "TVMS", then a sequence of
+// little-endian signed 64-bit integers---the format version, the program counter, the five limits (the deadline
+// as the nanoseconds remaining until it, 0 if unset), the three usage counters, the register count followed by the
+// registers, the memory size followed by memory, the memory region count followed by every region's start, end,
+// permissions and name length, each of which is followed by the name's bytes, then the word size and overflow
+// mode, and finally the count of wide memory words followed by every word's address and length, each followed by
+// the word in decimal, and the same for wide registers
+func (m MachineState) MarshalBinary() ([]byte, error) {
+	words := []int64{
+		machineStateVersion,
+		int64(m.ProgramCounter),
+		int64(m.Limits.MaxInstructions),
+		int64(remainingTime(m.Limits.Deadline)),
+		int64(m.Limits.MaxMemoryWords),
+		int64(m.Limits.MaxOutputs),
+		int64(m.Limits.MaxInputReads),
+		int64(m.Usage.InstructionsExecuted),
+		int64(m.Usage.OutputsEmitted),
+		int64(m.Usage.InputsRead),
+		int64(len(m.Registers)),
+	}
+
+	for _, register := range m.Registers {
+		words = append(words, int64(register))
+	}
+
+	words = append(words, int64(len(m.Memory)))
+	for _, word := range m.Memory {
+		words = append(words, int64(word))
+	}
+
+	buffer := make([]byte, 0, len(MachineStateMagic)+len(words)*8)
+	buffer = append(buffer, MachineStateMagic...)
+	for _, word := range words {
+		buffer = binary.LittleEndian.AppendUint64(buffer, uint64(word))
+	}
+
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(len(m.Regions)))
+	for _, region := range m.Regions {
+		for _, word := range []int{region.Start, region.End, int(region.Permissions), len(region.Name)} {
+			buffer = binary.LittleEndian.AppendUint64(buffer, uint64(int64(word)))
+		}
+
+		buffer = append(buffer, region.Name...)
+	}
+
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(m.WordFormat.Size))
+	buffer = binary.LittleEndian.AppendUint64(buffer, uint64(m.WordFormat.Overflow))
+	for _, wide := range []map[int]*big.Int{m.WideMemory, m.WideRegisters} {
+		addresses := make([]int, 0, len(wide))
+		for address := range wide {
+			addresses = append(addresses, address)
+		}
+
+		sort.Ints(addresses)
+		buffer = binary.LittleEndian.AppendUint64(buffer, uint64(len(addresses)))
+		for _, address := range addresses {
+			text := wide[address].String()
+			buffer = binary.LittleEndian.AppendUint64(buffer, uint64(int64(address)))
+			buffer = binary.LittleEndian.AppendUint64(buffer, uint64(len(text)))
+			buffer = append(buffer, text...)
+		}
+	}
+
+	return buffer, nil
+}
+
+// UnmarshalBinary decodes a state written by MarshalBinary
+func (m *MachineState) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(MachineStateMagic)) {
+		return fmt.Errorf("not a TVM machine state (missing '%v' header)", MachineStateMagic)
+	}
+
+	reader := bytes.NewReader(data[len(MachineStateMagic):])
+	next := func() (int, error) {
+		var word int64
+		if err := binary.Read(reader, binary.LittleEndian, &word); err != nil {
+			return 0, fmt.Errorf("machine state is truncated: %w", err)
+		}
+
+		return int(word), nil
+	}
+
+	version, err := next()
+	if err != nil {
+		return err
+	}
+
+	if version != machineStateVersion {
+		return fmt.Errorf("unsupported machine state version '%v'", version)
+	}
+
+	var header [10]int
+	for index := range header {
+		if header[index], err = next(); err != nil {
+			return err
+		}
+	}
+
+	state := MachineState{
+		ProgramCounter: header[0],
+		Limits: Limits{
+			MaxInstructions: header[1],
+			MaxMemoryWords:  header[3],
+			MaxOutputs:      header[4],
+			MaxInputReads:   header[5],
+		},
+		Usage: UsageCounters{
+			InstructionsExecuted: header[6],
+			OutputsEmitted:       header[7],
+			InputsRead:           header[8],
+		},
+	}
+
+	state.Limits.Deadline = deadlineAfter(time.Duration(header[2]))
+
+	if state.Registers, err = readCountedWords(next, header[9], reader.Len()); err != nil {
+		return err
+	}
+
+	memorySize, err := next()
+	if err != nil {
+		return err
+	}
+
+	if state.Memory, err = readCountedWords(next, memorySize, reader.Len()); err != nil {
+		return err
+	}
+
+	if state.Regions, err = readRegions(reader, next); err != nil {
+		return err
+	}
+
+	var format [2]int
+	for field := range format {
+		if format[field], err = next(); err != nil {
+			return err
+		}
+	}
+
+	state.WordFormat = WordFormat{WordSize(format[0]), Overflow(format[1])}
+	if state.WideMemory, err = readWideWords(reader, next); err != nil {
+		return err
+	}
+
+	if state.WideRegisters, err = readWideWords(reader, next); err != nil {
+		return err
+	}
+
+	if reader.Len() != 0 {
+		return fmt.Errorf("machine state has '%v' trailing bytes", reader.Len())
+	}
+
+	*m = state
+	return nil
+}
+
+// readCountedWords reads count words using next, refusing counts that cannot possibly fit in the bytes remaining
+func readCountedWords(next func() (int, error), count, remainingBytes int) ([]int, error) {
+	if count < 0 || count > remainingBytes/8 {
+		return nil, fmt.Errorf("machine state has invalid word count '%v'", count)
+	}
+
+	words := make([]int, count)
+	for index := range words {
+		word, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		words[index] = word
+	}
+
+	return words, nil
+}
+
+// readRegions reads the memory regions of a binary state
+func readRegions(reader *bytes.Reader, next func() (int, error)) ([]MemoryRegion, error) {
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	if count < 0 || count > reader.Len()/32 {
+		return nil, fmt.Errorf("machine state has invalid region count '%v'", count)
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	regions := make([]MemoryRegion, count)
+	for index := range regions {
+		var fields [4]int
+		for field := range fields {
+			if fields[field], err = next(); err != nil {
+				return nil, err
+			}
+		}
+
+		if fields[3] < 0 || fields[3] > reader.Len() {
+			return nil, fmt.Errorf("machine state has invalid region name length '%v'", fields[3])
+		}
+
+		name := make([]byte, fields[3])
+		if _, err := io.ReadFull(reader, name); err != nil {
+			return nil, err
+		}
+
+		regions[index] = MemoryRegion{string(name), fields[0], fields[1], MemoryPermission(fields[2])}
+	}
+
+	return regions, nil
+}
+
+// readWideWords reads the wide words at the end of a binary state
+func readWideWords(reader *bytes.Reader, next func() (int, error)) (map[int]*big.Int, error) {
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	if count < 0 || count > reader.Len()/16 {
+		return nil, fmt.Errorf("machine state has invalid wide word count '%v'", count)
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	words := make(map[int]*big.Int, count)
+	for range count {
+		address, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		if length < 0 || length > reader.Len() {
+			return nil, fmt.Errorf("machine state has invalid wide word length '%v'", length)
+		}
+
+		text := make([]byte, length)
+		if _, err := io.ReadFull(reader, text); err != nil {
+			return nil, err
+		}
+
+		word, valid := new(big.Int).SetString(string(text), 10)
+		if !valid {
+			return nil, fmt.Errorf("machine state has invalid wide word '%v'", string(text))
+		}
+
+		words[address] = word
+	}
+
+	return words, nil
+}
+
+// MachineStateFormat selects how WriteMachineState encodes a machine state
+type MachineStateFormat int
+
+const (
+	// MachineStateFormatBinary is the compact binary format (see MachineState.MarshalBinary)
+	MachineStateFormatBinary MachineStateFormat = iota
+
+	// MachineStateFormatJSON is a human-readable JSON document mirroring MachineState's fields
+	MachineStateFormatJSON
+)
+
+// WriteMachineState writes the state provided to w in the format requested
+func WriteMachineState(w io.Writer, state MachineState, format MachineStateFormat) error {
+	var encoded []byte
+	var err error
+
+	switch format {
+	case MachineStateFormatBinary:
+		encoded, err = state.MarshalBinary()
+	case MachineStateFormatJSON:
+		encoded, err = json.MarshalIndent(state, "", "  ")
+		encoded = append(encoded, '\n')
+	default:
+		return fmt.Errorf("unknown machine state format '%v'", format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encoded)
+	return err
+}
+
+// ReadMachineState reads a state written by WriteMachineState, detecting which format it was written in
+func ReadMachineState(r io.Reader) (MachineState, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return MachineState{}, err
+	}
+
+	var state MachineState
+	if bytes.HasPrefix(contents, []byte(MachineStateMagic)) {
+		err = state.UnmarshalBinary(contents)
+	} else {
+		err = json.Unmarshal(contents, &state)
+	}
+
+	if err != nil {
+		return MachineState{}, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,201 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countdownProgram reads a number into $r0 and then outputs and decrements it until it reaches zero
+var countdownProgram = []int{203, 0, 204, 0, 21201, 0, -1, 0, 21205, 0, 0, 5, 1206, 5, 18, 1106, 1, 2, 9}
+
+func TestMachineState_SnapshotAndRestoreResumesExecution(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine(countdownProgram)
+		machine.SetInputInterface(MockInputInterface{NumberToReturn: 3})
+		machine.SetOutputInterface(&MockOutputInterface{})
+		machine.SetLimits(Limits{MaxInstructions: 4})
+		require.Error(t, machine.Execute())
+
+		state := machine.Snapshot()
+		state.Limits = Limits{}
+
+		resumed, err := NewTsvetokVirtualMachineFromState(state)
+		require.NoError(t, err)
+
+		mockOutput := &MockOutputInterface{}
+		resumed.SetOutputInterface(mockOutput)
+		require.NoError(t, resumed.Execute())
+
+		require.NotNil(t, mockOutput.LastNumberReceived)
+		assert.Equal(t, 1, *mockOutput.LastNumberReceived)
+		assert.Equal(t, machine.GetUsage().InputsRead, resumed.GetUsage().InputsRead)
+	})
+}
+
+func TestMachineState_SnapshotDoesNotShareMemory(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{1, 0, 0, 0, 9})
+	state := machine.Snapshot()
+	require.NoError(t, machine.Execute())
+
+	assert.Equal(t, 1, state.Memory[0])
+}
+
+func TestMachineState_RoundTripsThroughEveryFormat(t *testing.T) {
+	state := MachineState{
+		Memory:         []int{1, -2, 3 << 40, 9},
+		Registers:      []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, -14},
+		ProgramCounter: 3,
+		Limits:         Limits{MaxInstructions: 10, Deadline: time.Now().Add(time.Hour), MaxOutputs: 4},
+		Usage:          UsageCounters{InstructionsExecuted: 7, OutputsEmitted: 2, InputsRead: 1},
+		Regions:        []MemoryRegion{{"code", 0, 2, MemoryPermissionRead | MemoryPermissionExecute}, {"data", 2, 4, MemoryPermissionAll}},
+	}
+
+	for _, format := range []MachineStateFormat{MachineStateFormatBinary, MachineStateFormatJSON} {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, WriteMachineState(buffer, state, format))
+
+		decoded, err := ReadMachineState(buffer)
+		require.NoError(t, err)
+		assert.WithinDuration(t, state.Limits.Deadline, decoded.Limits.Deadline, time.Second)
+
+		decoded.Limits.Deadline = state.Limits.Deadline
+		assert.Equal(t, state, decoded)
+	}
+}
+
+func TestMachineState_ResumesWithTheTimeThatWasLeft(t *testing.T) {
+	machine := NewTsvetokVirtualMachine(countdownProgram)
+	machine.SetInputInterface(MockInputInterface{NumberToReturn: 3})
+	machine.SetOutputInterface(&MockOutputInterface{})
+	machine.SetLimits(Limits{MaxInstructions: 4, Deadline: time.Now().Add(20 * time.Millisecond)})
+	require.Error(t, machine.Execute())
+
+	buffers := []*bytes.Buffer{{}, {}}
+	for index, format := range []MachineStateFormat{MachineStateFormatBinary, MachineStateFormatJSON} {
+		require.NoError(t, WriteMachineState(buffers[index], machine.Snapshot(), format))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	for _, buffer := range buffers {
+		state, err := ReadMachineState(buffer)
+		require.NoError(t, err)
+		assert.True(t, state.Limits.Deadline.After(time.Now()), "the deadline restarts from when the state is read")
+
+		state.Limits.MaxInstructions = 0
+		resumed, err := NewTsvetokVirtualMachineFromState(state)
+		require.NoError(t, err)
+		resumed.SetOutputInterface(&MockOutputInterface{})
+		assert.NoError(t, resumed.Execute())
+	}
+
+	expired := MachineState{Registers: make([]int, registerFileSize), Memory: []int{9}, Limits: Limits{Deadline: time.Now().Add(-time.Second)}}
+	encoded, err := expired.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, expired.UnmarshalBinary(encoded))
+	assert.False(t, expired.Limits.Deadline.IsZero(), "a deadline that had passed when the state was written still applies")
+}
+
+func TestMachineState_RejectsCorruptBinaryState(t *testing.T) {
+	encoded, err := MachineState{Registers: make([]int, registerFileSize), Memory: []int{9}}.MarshalBinary()
+	require.NoError(t, err)
+
+	var state MachineState
+	assert.Error(t, state.UnmarshalBinary(encoded[:len(encoded)-3]))
+	assert.Error(t, state.UnmarshalBinary([]byte("TVMX")))
+	assert.Error(t, state.UnmarshalBinary(append(encoded, 0)))
+
+	older := append([]byte{}, encoded...)
+	older[len(MachineStateMagic)] = machineStateVersion - 1
+	assert.EqualError(t, state.UnmarshalBinary(older), fmt.Sprintf("unsupported machine state version '%v'", machineStateVersion-1))
+}
+
+func TestMachineState_RestoreRejectsInvalidStatesWithoutChangingTheMachine(t *testing.T) {
+	for _, state := range []MachineState{
+		{Registers: []int{1}},
+		{Registers: make([]int, registerFileSize), Memory: []int{1, 2}, WordFormat: WordFormat{Size: 7}},
+		{Registers: make([]int, registerFileSize), Memory: []int{1 << 40}, WordFormat: WordFormat{WordSize32, OverflowFault}},
+		{Registers: make([]int, registerFileSize), Memory: []int{1, 2}, Regions: []MemoryRegion{{"a", 0, 2, MemoryPermissionAll}, {"b", 1, 2, MemoryPermissionAll}}},
+	} {
+		machine := NewTsvetokVirtualMachine([]int{9})
+		before := machine.Snapshot()
+
+		assert.Error(t, machine.Restore(state))
+		assert.Equal(t, before, machine.Snapshot())
+	}
+}
+
+func TestTsvetokVirtualMachine_ForkExploresAlternativeInputs(t *testing.T) {
+	machine := NewTsvetokVirtualMachine(countdownProgram)
+	machine.SetInputInterface(NewReaderInputInterface(strings.NewReader("")))
+	machine.SetOutputInterface(&MockOutputInterface{})
+	require.Error(t, machine.Execute(), "input is exhausted so execution must stop on the in instruction")
+
+	for _, input := range []int{2, 5} {
+		fork := machine.Fork()
+		fork.SetInputInterface(MockInputInterface{NumberToReturn: input})
+
+		mockOutput := &MockOutputInterface{}
+		fork.SetOutputInterface(mockOutput)
+		require.NoError(t, fork.Execute())
+		require.NotNil(t, mockOutput.LastNumberReceived)
+		assert.Equal(t, 1, *mockOutput.LastNumberReceived)
+		assert.Equal(t, input, fork.GetUsage().OutputsEmitted)
+	}
+
+	assert.Equal(t, 0, machine.GetUsage().OutputsEmitted, "forks must not affect the original machine")
+}
+
+func TestTsvetokVirtualMachine_ForkKeepsTheMachinesSettingsAndRecords(t *testing.T) {
+	sourceMap := SourceMap{}
+	sourceMap.Add(0, 4, SourceLocation{File: "main.tva", Line: 1, Column: 1})
+
+	// Rewrites its own opcode with the same word, then halts
+	machine := NewTsvetokVirtualMachine([]int{1101, 1101, 0, 0, 9})
+	machine.SetEngine(EngineCompiled)
+	machine.SetSourceLocator(&sourceMap)
+	machine.SetTraceDepth(4)
+	machine.SetSelfModificationDetection(true)
+	machine.SetConventionChecking(true)
+	_, err := machine.Step()
+	require.NoError(t, err)
+
+	fork := machine.Fork()
+	assert.Equal(t, EngineCompiled, fork.GetEngine())
+	assert.Equal(t, machine.Trace(), fork.Trace())
+	require.Len(t, machine.SelfModifications(), 1)
+	assert.Equal(t, machine.SelfModifications(), fork.SelfModifications())
+	assert.NotNil(t, fork.convention)
+	assert.Equal(t, "main.tva:1:1", fork.locate(0).String())
+
+	_, err = fork.Step()
+	require.NoError(t, err)
+	assert.Len(t, fork.Trace(), 2)
+	assert.Len(t, machine.Trace(), 1, "forks must not affect the original machine's trace")
+}
+
+func TestProgramFile_RoundTrips(t *testing.T) {
+	program := []int{1101, -5, 7, 0, 9}
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteProgram(buffer, program))
+	assert.Equal(t, []byte("TVM"), buffer.Bytes()[:3])
+
+	decoded, err := ReadProgram(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, program, decoded)
+}
+
+func TestProgramFile_RejectsInvalidFiles(t *testing.T) {
+	_, err := ReadProgram(strings.NewReader("ELF"))
+	assert.Error(t, err)
+
+	_, err = ReadProgram(strings.NewReader("TVM\x09\x00"))
+	assert.Error(t, err)
+
+	assert.Error(t, WriteProgram(&bytes.Buffer{}, []int{1 << 40}))
+}
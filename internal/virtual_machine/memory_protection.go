@@ -0,0 +1,152 @@
+package virtual_machine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MemoryPermission is a set of accesses allowed on a region of memory
+type MemoryPermission int
+
+const (
+	// MemoryPermissionRead allows instructions to read the region's words as address-mode operands
+	MemoryPermissionRead MemoryPermission = 1 << iota
+
+	// MemoryPermissionWrite allows instructions to write to the region's words
+	MemoryPermissionWrite
+
+	// MemoryPermissionExecute allows the region's words to be fetched and decoded as instructions and operands
+	MemoryPermissionExecute
+
+	// MemoryPermissionAll allows every kind of access. Regions with all permissions behave exactly like
+	// unprotected memory, which allows for self-modifying code
+	MemoryPermissionAll = MemoryPermissionRead | MemoryPermissionWrite | MemoryPermissionExecute
+)
+
+// String returns the permissions in the familiar "rwx" notation, with "-" in place of any missing permission
+func (m MemoryPermission) String() string {
+	flags := []byte("---")
+	if m&MemoryPermissionRead != 0 {
+		flags[0] = 'r'
+	}
+
+	if m&MemoryPermissionWrite != 0 {
+		flags[1] = 'w'
+	}
+
+	if m&MemoryPermissionExecute != 0 {
+		flags[2] = 'x'
+	}
+
+	return string(flags)
+}
+
+// accessName describes a single kind of access for error messages
+func (m MemoryPermission) accessName() string {
+	switch m {
+	case MemoryPermissionRead:
+		return "read"
+	case MemoryPermissionWrite:
+		return "write"
+	case MemoryPermissionExecute:
+		return "execute"
+	default:
+		return m.String()
+	}
+}
+
+// ParseMemoryPermission parses permissions in "rwx" notation (see MemoryPermission.String.) Missing permissions
+// may be written as "-" or left out entirely, so "r-x" and "rx" are equivalent
+func ParseMemoryPermission(permissions string) (MemoryPermission, error) {
+	parsed := MemoryPermission(0)
+	for _, flag := range strings.ReplaceAll(permissions, "-", "") {
+		switch flag {
+		case 'r':
+			parsed |= MemoryPermissionRead
+		case 'w':
+			parsed |= MemoryPermissionWrite
+		case 'x':
+			parsed |= MemoryPermissionExecute
+		default:
+			return 0, fmt.Errorf("invalid memory permissions '%v'", permissions)
+		}
+	}
+
+	return parsed, nil
+}
+
+// MemoryRegion is a named, contiguous range of memory with a set of permissions. Memory that falls outside of
+// every region is unprotected
+type MemoryRegion struct {
+	Name        string           `json:"name"`
+	Start       int              `json:"start"`
+	End         int              `json:"end"`
+	Permissions MemoryPermission `json:"permissions"`
+}
+
+// Contains returns true if the address provided falls within the region
+func (m MemoryRegion) Contains(address int) bool {
+	return address >= m.Start && address < m.End
+}
+
+// AddMemoryRegion protects the region of memory provided. Regions may not overlap
+func (t *TsvetokVirtualMachine) AddMemoryRegion(region MemoryRegion) error {
+	if region.Start < 0 || region.End <= region.Start {
+		return fmt.Errorf("invalid memory region '%v' [%v, %v)", region.Name, region.Start, region.End)
+	}
+
+	for _, existing := range t.regions {
+		if region.Start < existing.End && existing.Start < region.End {
+			return fmt.Errorf("memory region '%v' overlaps memory region '%v'", region.Name, existing.Name)
+		}
+	}
+
+	t.regions = append(t.regions, region)
+	return nil
+}
+
+// MemoryRegions returns the regions of memory the machine protects
+func (t *TsvetokVirtualMachine) MemoryRegions() []MemoryRegion {
+	return append([]MemoryRegion{}, t.regions...)
+}
+
+// checkAccess returns a ProtectionFaultErr if the access requested is not allowed at the address provided
+func (t *TsvetokVirtualMachine) checkAccess(address int, access MemoryPermission) error {
+	for _, region := range t.regions {
+		if region.Contains(address) {
+			if region.Permissions&access != access {
+				return ProtectionFaultErr{region, address, t.programCounter, access}
+			}
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// checkWritable returns an error if the address provided is outside of memory or may not be written. Output
+// parameters are resolved with it rather than by reading them, since writing only needs the write permission
+func (t *TsvetokVirtualMachine) checkWritable(address int) error {
+	if address < 0 || address >= len(t.memory) {
+		return fmt.Errorf("cannot write to memory at address '%v' (memory is of size '%v')", address, len(t.memory))
+	}
+
+	return t.checkAccess(address, MemoryPermissionWrite)
+}
+
+// checkExecutable returns a ProtectionFaultErr if any of the words of the instruction at the current program
+// counter may not be executed
+func (t *TsvetokVirtualMachine) checkExecutable(length int) error {
+	if len(t.regions) == 0 {
+		return nil
+	}
+
+	for address := t.programCounter; address < t.programCounter+length && address < len(t.memory); address++ {
+		if err := t.checkAccess(address, MemoryPermissionExecute); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const permissionReadExecute = MemoryPermissionRead | MemoryPermissionExecute
+
+func TestTsvetokVirtualMachine_ProtectionFaultsOnViolations(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []struct {
+			program       []int
+			regions       []MemoryRegion
+			expectedFault ProtectionFaultErr
+			testName      string
+		}{
+			{
+				program:       []int{1101, 1, 2, 1, 9},
+				regions:       []MemoryRegion{{"code", 0, 5, permissionReadExecute}},
+				expectedFault: ProtectionFaultErr{MemoryRegion{"code", 0, 5, permissionReadExecute}, 1, 0, MemoryPermissionWrite},
+				testName:      "writing into read-only code",
+			},
+			{
+				program:       []int{104, 9, 4, 5, 9, 7},
+				regions:       []MemoryRegion{{"code", 0, 5, permissionReadExecute}, {"secret", 5, 6, MemoryPermissionWrite}},
+				expectedFault: ProtectionFaultErr{MemoryRegion{"secret", 5, 6, MemoryPermissionWrite}, 5, 2, MemoryPermissionRead},
+				testName:      "reading from write-only memory",
+			},
+			{
+				program:       []int{1106, 1, 3, 9},
+				regions:       []MemoryRegion{{"code", 0, 3, permissionReadExecute}, {"data", 3, 4, MemoryPermissionRead | MemoryPermissionWrite}},
+				expectedFault: ProtectionFaultErr{MemoryRegion{"data", 3, 4, MemoryPermissionRead | MemoryPermissionWrite}, 3, 3, MemoryPermissionExecute},
+				testName:      "executing data",
+			},
+			{
+				program:       []int{1101, 1, 2, 5, 9, 0},
+				regions:       []MemoryRegion{{"code", 0, 3, permissionReadExecute}, {"data", 3, 6, MemoryPermissionRead | MemoryPermissionWrite}},
+				expectedFault: ProtectionFaultErr{MemoryRegion{"data", 3, 6, MemoryPermissionRead | MemoryPermissionWrite}, 3, 0, MemoryPermissionExecute},
+				testName:      "operand words must be executable",
+			},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				machine := newMachine(tc.program)
+				machine.SetOutputInterface(&MockOutputInterface{})
+				for _, region := range tc.regions {
+					require.NoError(t, machine.AddMemoryRegion(region))
+				}
+
+				err := machine.Execute()
+				require.Error(t, err)
+
+				fault, isProtectionFault := err.(ProtectionFaultErr)
+				require.True(t, isProtectionFault, "error provided must be ProtectionFaultErr (was %v)", err)
+				assert.Equal(t, tc.expectedFault, fault)
+				assert.Contains(t, fault.Error(), fault.Region.Name)
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_WritesToWriteOnlyMemory(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []struct {
+			program  []int
+			expected int
+			testName string
+		}{
+			{[]int{1101, 2, 3, 5, 9, 0}, 5, "add"},
+			{[]int{3, 5, 9, 0, 0, 0}, 5, "in"},
+			{[]int{1107, 2, 3, 5, 9, 0}, 1, "slt"},
+			{[]int{1105, 3, 3, 5, 9, 0}, 1, "seq"},
+			{[]int{115, 4, 5, 9, 0, 0}, -5, "not"},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				machine := newMachine(tc.program)
+				machine.SetInputInterface(&MockInputInterface{NumberToReturn: 5})
+				require.NoError(t, machine.AddMemoryRegion(MemoryRegion{"out", 5, 6, MemoryPermissionWrite}))
+
+				require.NoError(t, machine.Execute())
+				assert.Equal(t, tc.expected, machine.CopyMemory()[5])
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_WritableExecutableRegionsAllowSelfModifyingCode(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		// Rewrites the halt at address 4 into an output of 9, then halts at address 6
+		machine := newMachine([]int{1101, 4, 100, 4, 9, 6, 9})
+		mockOutput := &MockOutputInterface{}
+		machine.SetOutputInterface(mockOutput)
+		require.NoError(t, machine.AddMemoryRegion(MemoryRegion{"code", 0, 7, MemoryPermissionAll}))
+
+		require.NoError(t, machine.Execute())
+		require.NotNil(t, mockOutput.LastNumberReceived)
+		assert.Equal(t, 6, *mockOutput.LastNumberReceived)
+	})
+}
+
+func TestTsvetokVirtualMachine_RejectsInvalidMemoryRegions(t *testing.T) {
+	machine := NewTsvetokVirtualMachine(make([]int, 10))
+	require.NoError(t, machine.AddMemoryRegion(MemoryRegion{"code", 0, 5, permissionReadExecute}))
+
+	assert.Error(t, machine.AddMemoryRegion(MemoryRegion{"overlap", 4, 6, MemoryPermissionRead}))
+	assert.Error(t, machine.AddMemoryRegion(MemoryRegion{"empty", 6, 6, MemoryPermissionRead}))
+	assert.Error(t, machine.AddMemoryRegion(MemoryRegion{"negative", -2, 0, MemoryPermissionRead}))
+	assert.Len(t, machine.MemoryRegions(), 1)
+}
+
+func TestMemoryPermission_ParsesAndPrintsRwxNotation(t *testing.T) {
+	for notation, expected := range map[string]MemoryPermission{
+		"r-x": permissionReadExecute,
+		"rx":  permissionReadExecute,
+		"rwx": MemoryPermissionAll,
+		"---": 0,
+	} {
+		parsed, err := ParseMemoryPermission(notation)
+		require.NoError(t, err)
+		assert.Equal(t, expected, parsed)
+	}
+
+	assert.Equal(t, "rw-", (MemoryPermissionRead | MemoryPermissionWrite).String())
+
+	_, err := ParseMemoryPermission("rwz")
+	assert.Error(t, err)
+}
+
+func TestImage_RoundTripsAndLoadsProtectedSections(t *testing.T) {
+	image := Image{Sections: []Section{
+		{"code", 0, permissionReadExecute, []int{1101, 1, 2, 6, 9}},
+		{"data", 6, MemoryPermissionRead | MemoryPermissionWrite, []int{0, -1}},
+	}}
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteImage(buffer, image))
+
+	decoded, err := ReadImage(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, image, decoded)
+
+	machine, err := NewTsvetokVirtualMachineFromImage(decoded)
+	require.NoError(t, err)
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, []int{1101, 1, 2, 6, 9, 0, 3, -1}, machine.CopyMemory())
+	assert.Len(t, machine.MemoryRegions(), 2)
+}
+
+func TestImage_ReadsPlainProgramsAsOneUnprotectedSection(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteProgram(buffer, []int{1101, 1, 2, 0, 9}))
+
+	image, err := ReadImage(buffer)
+	require.NoError(t, err)
+
+	machine, err := NewTsvetokVirtualMachineFromImage(image)
+	require.NoError(t, err)
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, 3, machine.CopyMemory()[0])
+}
+
+func TestImage_RejectsCorruptImages(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteImage(buffer, Image{Sections: []Section{{"code", 0, MemoryPermissionAll, []int{9}}}}))
+	encoded := buffer.Bytes()
+
+	for _, corrupt := range [][]byte{encoded[:len(encoded)-1], append(append([]byte{}, encoded...), 0), []byte("ELF")} {
+		_, err := ReadImage(bytes.NewReader(corrupt))
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,31 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// moduloOperation sets the output parameter to the remainder of dividing the first number by the second. The remainder has the
+// same sign as the first number
+type moduloOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// moduloOperator takes the remainder of dividing two words, faulting if the divisor is 0
+var moduloOperator = arithmeticOperator{
+	name:     "mod",
+	native:   func(a, b int) (int, bool) { return a % b, true },
+	exact:    func(a, b *big.Int) *big.Int { return new(big.Int).Rem(a, b) },
+	validate: validateDivisor,
+}
+
+func newModuloOperation(t *TsvetokVirtualMachine) moduloOperation {
+	return moduloOperation{t}
+}
+
+func (m moduloOperation) Execute() error {
+	return m.executeArithmetic(moduloOperator)
+}
+
+func (m moduloOperation) GetNextProgramCounter() int { return m.getProgramCounter() + 4 }
+
+func (_ moduloOperation) Halt() bool { return false }
@@ -1,41 +1,36 @@
 package virtual_machine
 
-import ()
+import (
+	"math"
+	"math/big"
+)
 
 // multiplyOperation multiplies two nubmers together
 type multiplyOperation struct {
 	*TsvetokVirtualMachine
 }
 
+// multiplyOperator multiplies two words
+var multiplyOperator = arithmeticOperator{
+	name: "mlt",
+	native: func(a, b int) (int, bool) {
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+
+		product := a * b
+		overflowed := product/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt)
+		return product, !overflowed
+	},
+	exact: func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) },
+}
+
 func newMultiplyOperation(t *TsvetokVirtualMachine) multiplyOperation {
 	return multiplyOperation{t}
 }
 
 func (m multiplyOperation) Execute() error {
-	leftParam, err := m.getFirstParam()
-	if err != nil {
-		return err
-	}
-
-	rightParam, err := m.getSecondParam()
-	if err != nil {
-		return err
-	}
-
-	outAddr, err := m.getThirdParam()
-	if err != nil {
-		return err
-	}
-
-	if outAddr.Format == ParamFormatAddress {
-		return m.SetValueInMemory(outAddr.Address, leftParam.Value*rightParam.Value)
-	}
-
-	if outAddr.Format == ParamFormatRegister {
-		return m.SetValueInRegisterFile(outAddr.Address, leftParam.Value*rightParam.Value)
-	}
-
-	return InvalidOutputParamErr{"mlt"}
+	return m.executeArithmetic(multiplyOperator)
 }
 
 func (m multiplyOperation) GetNextProgramCounter() int { return m.getProgramCounter() + 4 }
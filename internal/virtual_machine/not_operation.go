@@ -0,0 +1,30 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// notOperation sets its second (output) parameter to the bitwise complement of its first
+type notOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// notOperator computes the bitwise complement of a word, as a two's complement integer
+var notOperator = arithmeticOperator{
+	name:   "not",
+	native: func(a, _ int) (int, bool) { return ^a, true },
+	exact:  func(a, _ *big.Int) *big.Int { return new(big.Int).Not(a) },
+	unary:  true,
+}
+
+func newNotOperation(t *TsvetokVirtualMachine) notOperation {
+	return notOperation{t}
+}
+
+func (n notOperation) Execute() error {
+	return n.executeArithmetic(notOperator)
+}
+
+func (n notOperation) GetNextProgramCounter() int { return n.getProgramCounter() + 3 }
+
+func (_ notOperation) Halt() bool { return false }
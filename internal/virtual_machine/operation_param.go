@@ -2,6 +2,7 @@ package virtual_machine
 
 import (
 	"fmt"
+	"math/big"
 )
 
 type ParamFormat int
@@ -38,20 +39,46 @@ type operationParam struct {
 	// Value is the integer found in memory at the parameter's Address (see above.) This integer is equal to
 	// address if the parameter is in immediate mode
 	Value int
+
+	// Wide is the parameter's value if it is too wide for an int (see WordSizeBig), in which case Value is 0
+	Wide *big.Int
+}
+
+// exact returns the parameter's value as an arbitrary-precision integer
+func (o operationParam) exact() *big.Int {
+	if o.Wide != nil {
+		return o.Wide
+	}
+
+	return big.NewInt(int64(o.Value))
 }
 
-func newOperationParam(t *TsvetokVirtualMachine, paramFormat, paramAddress int) (operationParam, error) {
+// native returns the parameter's value for uses that need an int, such as addresses and jump targets, or a
+// WideWordErr naming the operation provided if the value is too wide for one
+func (o operationParam) native(operation string) (int, error) {
+	if o.Wide != nil {
+		return 0, WideWordErr{operation, o.Wide.String()}
+	}
+
+	return o.Value, nil
+}
+
+// newOperationParam resolves the operand word found at paramAddress according to the parameter format provided
+func newOperationParam(t *TsvetokVirtualMachine, paramFormat, immediate, paramAddress int) (operationParam, error) {
 	if paramFormat != ParamFormatImmediate && paramFormat != ParamFormatAddress && paramFormat != ParamFormatRegister {
 		return operationParam{}, fmt.Errorf("unknown parameter format '%v' at address '%v'", paramFormat, paramAddress)
 	}
 
-	immediate, err := t.GetValueInMemory(paramAddress)
-	if err != nil {
-		return operationParam{}, err
+	if wide := t.wideAt(ParamFormatAddress, paramAddress); wide != nil {
+		if paramFormat == ParamFormatImmediate {
+			return operationParam{paramFormat, 0, 0, wide}, nil
+		}
+
+		return operationParam{}, WideWordErr{fmt.Sprintf("operand at address '%v'", paramAddress), wide.String()}
 	}
 
 	if paramFormat == ParamFormatImmediate {
-		return operationParam{paramFormat, immediate, immediate}, nil
+		return operationParam{paramFormat, immediate, immediate, nil}, nil
 	}
 
 	if paramFormat == ParamFormatRegister {
@@ -60,7 +87,7 @@ func newOperationParam(t *TsvetokVirtualMachine, paramFormat, paramAddress int)
 			return operationParam{}, err
 		}
 
-		return operationParam{paramFormat, immediate, registerValue}, nil
+		return operationParam{paramFormat, immediate, registerValue, t.wideAt(paramFormat, immediate)}, nil
 	}
 
 	value, err := t.GetValueInMemory(immediate)
@@ -68,5 +95,23 @@ func newOperationParam(t *TsvetokVirtualMachine, paramFormat, paramAddress int)
 		return operationParam{}, err
 	}
 
-	return operationParam{paramFormat, immediate, value}, nil
+	return operationParam{paramFormat, immediate, value, t.wideAt(paramFormat, immediate)}, nil
+}
+
+// newOutputParam resolves the operand word found at paramAddress as the output parameter of an instruction. Unlike
+// newOperationParam, the word the parameter points at is never read: only that it may be written is checked
+func newOutputParam(t *TsvetokVirtualMachine, paramFormat, immediate, paramAddress int) (operationParam, error) {
+	if paramFormat != ParamFormatAddress {
+		return newOperationParam(t, paramFormat, immediate, paramAddress)
+	}
+
+	if wide := t.wideAt(ParamFormatAddress, paramAddress); wide != nil {
+		return operationParam{}, WideWordErr{fmt.Sprintf("operand at address '%v'", paramAddress), wide.String()}
+	}
+
+	if err := t.checkWritable(immediate); err != nil {
+		return operationParam{}, err
+	}
+
+	return operationParam{paramFormat, immediate, 0, nil}, nil
 }
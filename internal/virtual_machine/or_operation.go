@@ -0,0 +1,29 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// orOperation sets the output parameter to the bitwise or of two numbers
+type orOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// orOperator computes the bitwise or of two words, as two's complement integers
+var orOperator = arithmeticOperator{
+	name:   "or",
+	native: func(a, b int) (int, bool) { return a | b, true },
+	exact:  func(a, b *big.Int) *big.Int { return new(big.Int).Or(a, b) },
+}
+
+func newOrOperation(t *TsvetokVirtualMachine) orOperation {
+	return orOperation{t}
+}
+
+func (o orOperation) Execute() error {
+	return o.executeArithmetic(orOperator)
+}
+
+func (o orOperation) GetNextProgramCounter() int { return o.getProgramCounter() + 4 }
+
+func (_ orOperation) Halt() bool { return false }
@@ -17,9 +17,11 @@ func (m outputOperation) Execute() error {
 		return err
 	}
 
-	m.EmitOutput(param.Value)
+	if param.Wide != nil {
+		return m.emitWideOutput(param.Wide)
+	}
 
-	return nil
+	return m.emitOutput(param.Value)
 }
 
 func (m outputOperation) GetNextProgramCounter() int { return m.getProgramCounter() + 2 }
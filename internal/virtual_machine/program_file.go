@@ -0,0 +1,401 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// ProgramFileMagic is the sequence of ASCII characters every TVM binary file begins with
+const ProgramFileMagic = "TVM"
+
+// ReadProgram reads a TVM binary file: the ASCII characters "TVM" followed by little-endian 32-bit words until
+// the end of the file
+func ReadProgram(r io.Reader) ([]int, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return []int{}, err
+	}
+
+	if !bytes.HasPrefix(contents, []byte(ProgramFileMagic)) {
+		return []int{}, fmt.Errorf("not a TVM file (missing '%v' header)", ProgramFileMagic)
+	}
+
+	words := contents[len(ProgramFileMagic):]
+	if len(words)%4 != 0 {
+		return []int{}, fmt.Errorf("TVM file is truncated ('%v' trailing bytes)", len(words)%4)
+	}
+
+	program := make([]int, 0, len(words)/4)
+	for offset := 0; offset < len(words); offset += 4 {
+		program = append(program, int(int32(binary.LittleEndian.Uint32(words[offset:]))))
+	}
+
+	return program, nil
+}
+
+// WriteProgram writes the program provided in the TVM binary file format (see ReadProgram.) Returns an error if
+// any word cannot be represented in 32 bits
+func WriteProgram(w io.Writer, program []int) error {
+	buffer := make([]byte, 0, len(ProgramFileMagic)+len(program)*4)
+	buffer = append(buffer, ProgramFileMagic...)
+
+	for address, word := range program {
+		if word < math.MinInt32 || word > math.MaxInt32 {
+			return fmt.Errorf("word '%v' at address '%v' does not fit in 32 bits", word, address)
+		}
+
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(word)))
+	}
+
+	_, err := w.Write(buffer)
+	return err
+}
+
+// ImageFileMagic is the sequence of ASCII characters every sectioned TVM image begins with
+const ImageFileMagic = "TVX"
+
+// imageFileVersion is the version of the sectioned image format written by WriteImage
+const imageFileVersion = 3
+
+// Section is a named, contiguous run of words loaded at a fixed address, along with the permissions the memory
+// it occupies is protected with
+type Section struct {
+	Name        string
+	Start       int
+	Permissions MemoryPermission
+	Words       []int
+}
+
+// Image is a TVM program made up of sections, along with the word format it runs with and, optionally, the debug
+// information that maps its addresses back to source code. A plain program (see ReadProgram) is an image with a
+// single section, "program", loaded at address 0 with every permission, the default word format and no debug
+// information
+type Image struct {
+	Sections   []Section
+	WordFormat WordFormat
+	Debug      *SourceMap
+}
+
+// MemorySize returns the number of words of memory needed to hold every section
+func (i Image) MemorySize() int {
+	size := 0
+	for _, section := range i.Sections {
+		if end := section.Start + len(section.Words); end > size {
+			size = end
+		}
+	}
+
+	return size
+}
+
+// NewTsvetokVirtualMachineFromImage returns a machine with every section of the image loaded into memory and
+// protected with its permissions, running with the image's word format. Memory between sections is zeroed and
+// unprotected. Words that do not fit in the word format are fitted as its overflow mode dictates (see
+// SetWordFormat.) The image's debug information, if any, becomes the machine's source locator (see
+// SetSourceLocator)
+func NewTsvetokVirtualMachineFromImage(image Image) (*TsvetokVirtualMachine, error) {
+	machine := NewTsvetokVirtualMachine(make([]int, image.MemorySize()))
+
+	for _, section := range image.Sections {
+		if section.Start < 0 {
+			return nil, fmt.Errorf("section '%v' starts at negative address '%v'", section.Name, section.Start)
+		}
+
+		copy(machine.memory[section.Start:], section.Words)
+		if len(section.Words) == 0 {
+			continue
+		}
+
+		region := MemoryRegion{section.Name, section.Start, section.Start + len(section.Words), section.Permissions}
+		if err := machine.AddMemoryRegion(region); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := machine.SetWordFormat(image.WordFormat); err != nil {
+		return nil, err
+	}
+
+	if image.Debug != nil {
+		machine.SetSourceLocator(*image.Debug)
+	}
+
+	return machine, nil
+}
+
+// ReadImage reads either a plain TVM binary file (see ReadProgram) or a sectioned TVM image. Sectioned images
+// begin with the ASCII characters "TVX" followed by little-endian 32-bit integers: the format version, the word
+// size and overflow mode (see WordFormat), the number of sections, and then for every section its name's length
+// in bytes, the name itself, its start address, its permissions (see MemoryPermission), its length in words, and
+// finally its words. Words are 32-bit integers in images of 32-bit words, and 64-bit integers otherwise. Version 1
+// images, which predate word formats, have no word size or overflow mode and use the default word format.
+//
+// Version 3 images end with their debug information (see SourceMap), which is empty for images without any: the
+// number of source files followed by each file's name length and name, then the number of address ranges
+// followed by each range's start and end addresses, the index of its file, its line and its column, and finally
+// the number of labels followed by each label's name length, name and address
+func ReadImage(r io.Reader) (Image, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if bytes.HasPrefix(contents, []byte(ProgramFileMagic)) {
+		program, err := ReadProgram(bytes.NewReader(contents))
+		if err != nil {
+			return Image{}, err
+		}
+
+		return Image{Sections: []Section{{"program", 0, MemoryPermissionAll, program}}}, nil
+	}
+
+	if !bytes.HasPrefix(contents, []byte(ImageFileMagic)) {
+		return Image{}, fmt.Errorf("not a TVM file (missing '%v' or '%v' header)", ProgramFileMagic, ImageFileMagic)
+	}
+
+	reader := &imageReader{contents: contents[len(ImageFileMagic):]}
+	version := reader.word()
+	if (version < 1 || version > imageFileVersion) && reader.err == nil {
+		return Image{}, fmt.Errorf("unsupported TVM image version '%v'", version)
+	}
+
+	image := Image{}
+	if version > 1 {
+		image.WordFormat = WordFormat{WordSize(reader.word()), Overflow(reader.word())}
+		if err := image.WordFormat.Validate(); err != nil && reader.err == nil {
+			return Image{}, fmt.Errorf("TVM image has an %w", err)
+		}
+	}
+
+	wordBytes := image.WordFormat.imageWordBytes()
+	sectionCount := reader.count()
+	for index := 0; index < sectionCount && reader.err == nil; index++ {
+		section := Section{Name: string(reader.bytes(reader.count()))}
+		section.Start = reader.word()
+		section.Permissions = MemoryPermission(reader.word())
+
+		wordCount := reader.count()
+		if wordCount > len(reader.contents)/wordBytes {
+			return Image{}, fmt.Errorf("TVM image is truncated (section '%v' claims '%v' words)", section.Name, wordCount)
+		}
+
+		section.Words = make([]int, wordCount)
+		for wordIndex := range section.Words {
+			section.Words[wordIndex] = reader.sizedWord(wordBytes)
+		}
+
+		image.Sections = append(image.Sections, section)
+	}
+
+	if version > 2 {
+		image.Debug = reader.debugInfo()
+	}
+
+	if reader.err == nil && len(reader.contents) != 0 {
+		reader.err = fmt.Errorf("TVM image has '%v' trailing bytes", len(reader.contents))
+	}
+
+	if reader.err != nil {
+		return Image{}, reader.err
+	}
+
+	return image, nil
+}
+
+// WriteImage writes the image provided in the sectioned TVM image format (see ReadImage). Returns an error if any
+// word does not fit in the image's word size
+func WriteImage(w io.Writer, image Image) error {
+	if err := image.WordFormat.Validate(); err != nil {
+		return err
+	}
+
+	wordBytes := image.WordFormat.imageWordBytes()
+	buffer := []byte(ImageFileMagic)
+	buffer = binary.LittleEndian.AppendUint32(buffer, imageFileVersion)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(image.WordFormat.Size))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(image.WordFormat.Overflow))
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(image.Sections)))
+
+	for _, section := range image.Sections {
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(section.Name)))
+		buffer = append(buffer, section.Name...)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(section.Start)))
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(section.Permissions))
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(section.Words)))
+
+		for index, word := range section.Words {
+			if !image.WordFormat.fits(word) {
+				return fmt.Errorf("word '%v' at address '%v' does not fit in 32 bits", word, section.Start+index)
+			}
+
+			if wordBytes == 4 {
+				buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(word)))
+			} else {
+				buffer = binary.LittleEndian.AppendUint64(buffer, uint64(int64(word)))
+			}
+		}
+	}
+
+	buffer = appendDebugInfo(buffer, image.Debug)
+	_, err := w.Write(buffer)
+	return err
+}
+
+// appendDebugInfo appends the debug information section of images (see ReadImage) to buffer, which is empty if
+// debug is nil
+func appendDebugInfo(buffer []byte, debug *SourceMap) []byte {
+	if debug == nil {
+		debug = &SourceMap{}
+	}
+
+	files := []string{}
+	fileIndexes := map[string]int{}
+	for _, sourceRange := range debug.Ranges {
+		if _, seen := fileIndexes[sourceRange.Location.File]; !seen {
+			fileIndexes[sourceRange.Location.File] = len(files)
+			files = append(files, sourceRange.Location.File)
+		}
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(files)))
+	for _, file := range files {
+		buffer = appendImageString(buffer, file)
+	}
+
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(debug.Ranges)))
+	for _, sourceRange := range debug.Ranges {
+		for _, value := range []int{sourceRange.Start, sourceRange.End, fileIndexes[sourceRange.Location.File], sourceRange.Location.Line, sourceRange.Location.Column} {
+			buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(value)))
+		}
+	}
+
+	names := make([]string, 0, len(debug.Labels))
+	for name := range debug.Labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(names)))
+	for _, name := range names {
+		buffer = appendImageString(buffer, name)
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(int32(debug.Labels[name])))
+	}
+
+	return buffer
+}
+
+// appendImageString appends a string to buffer as its length in bytes followed by its bytes
+func appendImageString(buffer []byte, value string) []byte {
+	buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(value)))
+	return append(buffer, value...)
+}
+
+// imageReader consumes little-endian 32-bit integers and byte strings from a sectioned image, remembering the
+// first error so that callers can check once at the end
+type imageReader struct {
+	contents []byte
+	err      error
+}
+
+func (i *imageReader) word() int {
+	raw := i.bytes(4)
+	if raw == nil {
+		return 0
+	}
+
+	return int(int32(binary.LittleEndian.Uint32(raw)))
+}
+
+// sizedWord reads a section word of the size provided in bytes (see imageWordBytes)
+func (i *imageReader) sizedWord(size int) int {
+	if size == 4 {
+		return i.word()
+	}
+
+	raw := i.bytes(8)
+	if raw == nil {
+		return 0
+	}
+
+	return int(int64(binary.LittleEndian.Uint64(raw)))
+}
+
+// imageWordBytes returns the number of bytes each section word takes up in images of the word format provided.
+// Images can only hold words that fit in an int, even for WordSizeBig: wider words only arise at runtime
+func (w WordFormat) imageWordBytes() int {
+	if w.Size == WordSize32 {
+		return 4
+	}
+
+	return 8
+}
+
+// debugInfo reads the debug information section of an image (see ReadImage), returning nil if it is empty
+func (i *imageReader) debugInfo() *SourceMap {
+	debug := &SourceMap{}
+	var files []string
+	fileCount := i.count()
+	for index := 0; index < fileCount && i.err == nil; index++ {
+		files = append(files, string(i.bytes(i.count())))
+	}
+
+	rangeCount := i.count()
+	for index := 0; index < rangeCount && i.err == nil; index++ {
+		start, end, file := i.word(), i.word(), i.word()
+		location := SourceLocation{Line: i.word(), Column: i.word()}
+		if file < 0 || file >= len(files) {
+			if i.err == nil {
+				i.err = fmt.Errorf("TVM image has invalid source file index '%v'", file)
+			}
+
+			return nil
+		}
+
+		location.File = files[file]
+		debug.Add(start, end, location)
+	}
+
+	labelCount := i.count()
+	for index := 0; index < labelCount && i.err == nil; index++ {
+		debug.AddLabel(string(i.bytes(i.count())), i.word())
+	}
+
+	if i.err != nil || (len(debug.Ranges) == 0 && len(debug.Labels) == 0) {
+		return nil
+	}
+
+	return debug
+}
+
+// count reads a word that counts something, rejecting negative counts
+func (i *imageReader) count() int {
+	count := i.word()
+	if count < 0 && i.err == nil {
+		i.err = fmt.Errorf("TVM image has invalid count '%v'", count)
+	}
+
+	if i.err != nil {
+		return 0
+	}
+
+	return count
+}
+
+func (i *imageReader) bytes(length int) []byte {
+	if i.err != nil {
+		return nil
+	}
+
+	if length > len(i.contents) {
+		i.err = fmt.Errorf("TVM image is truncated")
+		return nil
+	}
+
+	read := i.contents[:length]
+	i.contents = i.contents[length:]
+	return read
+}
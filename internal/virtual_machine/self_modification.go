@@ -0,0 +1,111 @@
+package virtual_machine
+
+import (
+	"fmt"
+)
+
+// SelfModification records a write into an address that had, at the time of the write, already been executed or
+// decoded as part of an instruction (either its opcode or one of its operands)
+type SelfModification struct {
+	// ProgramCounter is the address of the instruction that made the write
+	ProgramCounter int `json:"programCounter"`
+
+	// Address is the address that was written to
+	Address  int `json:"address"`
+	OldValue int `json:"oldValue"`
+	NewValue int `json:"newValue"`
+
+	// WriterLocation and AddressLocation are the source locations of the writing instruction and of the address
+	// written to, when the machine has a SourceLocator that knows them
+	WriterLocation  *SourceLocation `json:"writerLocation,omitempty"`
+	AddressLocation *SourceLocation `json:"addressLocation,omitempty"`
+}
+
+func (s SelfModification) String() string {
+	writer := fmt.Sprintf("pc %v", s.ProgramCounter)
+	if s.WriterLocation != nil {
+		writer = fmt.Sprintf("%v (%v)", writer, s.WriterLocation)
+	}
+
+	target := fmt.Sprintf("address %v", s.Address)
+	if s.AddressLocation != nil {
+		target = fmt.Sprintf("%v (%v)", target, s.AddressLocation)
+	}
+
+	return fmt.Sprintf("self-modifying write at %v: %v changed from %v to %v", writer, target, s.OldValue, s.NewValue)
+}
+
+// selfModificationDetector remembers which addresses have been decoded as instructions and which writes have
+// landed on them
+type selfModificationDetector struct {
+	decoded       map[int]bool
+	modifications []SelfModification
+}
+
+// clone returns an independent copy of the detector, or nil if detection is off
+func (s *selfModificationDetector) clone() *selfModificationDetector {
+	if s == nil {
+		return nil
+	}
+
+	decoded := make(map[int]bool, len(s.decoded))
+	for address := range s.decoded {
+		decoded[address] = true
+	}
+
+	return &selfModificationDetector{decoded, append([]SelfModification{}, s.modifications...)}
+}
+
+// SetSelfModificationDetection turns self-modifying code detection on or off. While it is on, the machine records
+// every write into an address it has previously executed or decoded (see SelfModifications), and annotates the
+// writing instruction's trace entry with a warning (see SetTraceDepth.) Turning detection off forgets everything
+// recorded so far
+func (t *TsvetokVirtualMachine) SetSelfModificationDetection(enabled bool) {
+	if !enabled {
+		t.selfModification = nil
+		return
+	}
+
+	if t.selfModification == nil {
+		t.selfModification = &selfModificationDetector{decoded: map[int]bool{}}
+	}
+}
+
+// SelfModifications returns every self-modifying write recorded so far, in the order they were made
+func (t *TsvetokVirtualMachine) SelfModifications() []SelfModification {
+	if t.selfModification == nil {
+		return []SelfModification{}
+	}
+
+	return append([]SelfModification{}, t.selfModification.modifications...)
+}
+
+// recordDecode marks the words of the instruction at the current program counter as decoded
+func (t *TsvetokVirtualMachine) recordDecode(length int) {
+	if t.selfModification == nil {
+		return
+	}
+
+	for address := t.programCounter; address < t.programCounter+length && address < len(t.memory); address++ {
+		t.selfModification.decoded[address] = true
+	}
+}
+
+// recordWrite records a self-modification if the address about to be written to has been decoded
+func (t *TsvetokVirtualMachine) recordWrite(address, newValue int) {
+	if t.selfModification == nil || !t.selfModification.decoded[address] {
+		return
+	}
+
+	modification := SelfModification{
+		ProgramCounter:  t.programCounter,
+		Address:         address,
+		OldValue:        t.memory[address],
+		NewValue:        newValue,
+		WriterLocation:  t.locate(t.programCounter),
+		AddressLocation: t.locate(address),
+	}
+
+	t.selfModification.modifications = append(t.selfModification.modifications, modification)
+	t.warnInTrace(modification.String())
+}
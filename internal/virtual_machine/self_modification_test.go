@@ -0,0 +1,72 @@
+package virtual_machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTsvetokVirtualMachine_DetectsWritesIntoDecodedInstructions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []struct {
+			program               []int
+			expectedModifications []SelfModification
+			testName              string
+		}{
+			{
+				program:               []int{1101, 1, 2, 5, 9, 0},
+				expectedModifications: []SelfModification{},
+				testName:              "writes to data are not reported",
+			},
+			{
+				program:               []int{1101, 8, 1, 4, 0},
+				expectedModifications: []SelfModification{},
+				testName:              "writes to code that has not been decoded yet are not reported",
+			},
+			{
+				program:               []int{1101, 7, 2, 1, 9},
+				expectedModifications: []SelfModification{{ProgramCounter: 0, Address: 1, OldValue: 7, NewValue: 9}},
+				testName:              "writes to operands of the current instruction are reported",
+			},
+			{
+				program:               []int{104, 0, 1, 0, 0, 0, 9},
+				expectedModifications: []SelfModification{{ProgramCounter: 2, Address: 0, OldValue: 104, NewValue: 208}},
+				testName:              "writes to previously executed instructions are reported",
+			},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				machine := newMachine(tc.program)
+				machine.SetOutputInterface(&MockOutputInterface{})
+				machine.SetSelfModificationDetection(true)
+				require.NoError(t, machine.Execute())
+
+				assert.Equal(t, tc.expectedModifications, machine.SelfModifications())
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_SelfModificationDetectionIsOffByDefault(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{1101, 7, 2, 1, 9})
+	require.NoError(t, machine.Execute())
+
+	assert.Empty(t, machine.SelfModifications())
+}
+
+func TestSourceMap_LocatesAddressesWithinRanges(t *testing.T) {
+	sourceMap := SourceMap{}
+	sourceMap.Add(4, 6, SourceLocation{"loop.tva", 2, 1})
+	sourceMap.Add(0, 4, SourceLocation{"loop.tva", 1, 0})
+
+	location, found := sourceMap.LocateAddress(5)
+	require.True(t, found)
+	assert.Equal(t, "loop.tva:2:1", location.String())
+
+	location, found = sourceMap.LocateAddress(0)
+	require.True(t, found)
+	assert.Equal(t, "loop.tva:1", location.String())
+
+	_, found = sourceMap.LocateAddress(6)
+	assert.False(t, found)
+}
@@ -1,6 +1,8 @@
 package virtual_machine
 
-import ()
+import (
+	"math/big"
+)
 
 // setIfEqualOperation sets a given memory address to true (1) if the two numbers provided are equal. If they are not
 // equal then the provided address is set to false (0)
@@ -8,42 +10,21 @@ type setIfEqualOperation struct {
 	*TsvetokVirtualMachine
 }
 
+// setIfEqualOperator compares two words for equality
+var setIfEqualOperator = arithmeticOperator{
+	name:   "seq",
+	native: func(a, b int) (int, bool) { return boolToWord(a == b), true },
+	exact:  func(a, b *big.Int) *big.Int { return big.NewInt(int64(boolToWord(a.Cmp(b) == 0))) },
+}
+
 func newSetIfEqualOperation(t *TsvetokVirtualMachine) setIfEqualOperation {
 	return setIfEqualOperation{t}
 }
 
 func (s setIfEqualOperation) Execute() error {
-	leftParam, err := s.getFirstParam()
-	if err != nil {
-		return err
-	}
-
-	rightParam, err := s.getSecondParam()
-	if err != nil {
-		return err
-	}
-
-	outputAddr, err := s.getThirdParam()
-	if err != nil {
-		return err
-	}
-
-	outputVal := 0
-	if leftParam.Value == rightParam.Value {
-		outputVal = 1
-	}
-
-	if outputAddr.Format == ParamFormatAddress {
-		return s.SetValueInMemory(outputAddr.Address, outputVal)
-	}
-
-	if outputAddr.Format == ParamFormatRegister {
-		return s.SetValueInRegisterFile(outputAddr.Address, outputVal)
-	}
-
-	return InvalidOutputParamErr{"seq"}
+	return s.executeArithmetic(setIfEqualOperator)
 }
 
 func (s setIfEqualOperation) GetNextProgramCounter() int { return s.getProgramCounter() + 4 }
 
-func (s setIfEqualOperation) Halt() bool { return false }
+func (_ setIfEqualOperation) Halt() bool { return false }
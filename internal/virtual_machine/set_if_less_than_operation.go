@@ -1,49 +1,29 @@
 package virtual_machine
 
-import ()
+import (
+	"math/big"
+)
 
 // setIfLessThanOperation sets the output parameter to 1 if the first parameter's value is less than the second
 type setIfLessThanOperation struct {
 	*TsvetokVirtualMachine
 }
 
+// setIfLessThanOperator compares two words for order
+var setIfLessThanOperator = arithmeticOperator{
+	name:   "slt",
+	native: func(a, b int) (int, bool) { return boolToWord(a < b), true },
+	exact:  func(a, b *big.Int) *big.Int { return big.NewInt(int64(boolToWord(a.Cmp(b) < 0))) },
+}
+
 func newSetIfLessThanOperation(t *TsvetokVirtualMachine) setIfLessThanOperation {
 	return setIfLessThanOperation{t}
 }
 
 func (m setIfLessThanOperation) Execute() error {
-	lhs, err := m.getFirstParam()
-	if err != nil {
-		return err
-	}
-
-	rhs, err := m.getSecondParam()
-	if err != nil {
-		return err
-	}
-
-	outAddr, err := m.getThirdParam()
-	if err != nil {
-		return err
-	}
-
-	value := 0
-	if lhs.Value < rhs.Value {
-		value = 1
-	}
-
-	if outAddr.Format == ParamFormatAddress {
-		return m.SetValueInMemory(outAddr.Address, value)
-	}
-
-	if outAddr.Format == ParamFormatRegister {
-		return m.SetValueInRegisterFile(outAddr.Address, value)
-	}
-
-	return InvalidOutputParamErr{"slt"}
+	return m.executeArithmetic(setIfLessThanOperator)
 }
 
 func (m setIfLessThanOperation) GetNextProgramCounter() int { return m.getProgramCounter() + 4 }
 
 func (_ setIfLessThanOperation) Halt() bool { return false }
-
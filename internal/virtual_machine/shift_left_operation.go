@@ -0,0 +1,55 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// shiftLeftOperation shifts the first number left by the second number of bits
+type shiftLeftOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// shiftLeftOperator shifts a word left, overflowing just as multiplying by a power of two would
+var shiftLeftOperator = arithmeticOperator{
+	name: "shl",
+	native: func(a, b int) (int, bool) {
+		if b >= 63 {
+			return 0, a == 0
+		}
+
+		shifted := a << b
+		return shifted, shifted>>b == a
+	},
+	exact:    func(a, b *big.Int) *big.Int { return new(big.Int).Lsh(a, uint(b.Int64())) },
+	validate: validateShiftAmount,
+}
+
+func newShiftLeftOperation(t *TsvetokVirtualMachine) shiftLeftOperation {
+	return shiftLeftOperation{t}
+}
+
+func (s shiftLeftOperation) Execute() error {
+	return s.executeArithmetic(shiftLeftOperator)
+}
+
+func (s shiftLeftOperation) GetNextProgramCounter() int { return s.getProgramCounter() + 4 }
+
+func (_ shiftLeftOperation) Halt() bool { return false }
+
+// maxBigShift is the limit on shift amounts for WordSizeBig words, which have no width to limit them
+const maxBigShift = 1 << 16
+
+// validateShiftAmount faults with an InvalidShiftErr unless the amount provided is at least 0 and less than the
+// number of bits in a word (or maxBigShift for WordSizeBig words)
+func validateShiftAmount(w WordFormat, amount *big.Int) error {
+	limit := w.bits()
+	if limit == 0 {
+		limit = maxBigShift
+	}
+
+	if amount.Sign() < 0 || amount.Cmp(big.NewInt(int64(limit))) >= 0 {
+		return InvalidShiftErr{amount.String(), limit}
+	}
+
+	return nil
+}
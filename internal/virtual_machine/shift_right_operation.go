@@ -0,0 +1,30 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// shiftRightOperation shifts the first number right by the second number of bits, keeping its sign
+type shiftRightOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// shiftRightOperator shifts a word right arithmetically, rounding towards negative infinity
+var shiftRightOperator = arithmeticOperator{
+	name:     "shr",
+	native:   func(a, b int) (int, bool) { return a >> b, true },
+	exact:    func(a, b *big.Int) *big.Int { return new(big.Int).Rsh(a, uint(b.Int64())) },
+	validate: validateShiftAmount,
+}
+
+func newShiftRightOperation(t *TsvetokVirtualMachine) shiftRightOperation {
+	return shiftRightOperation{t}
+}
+
+func (s shiftRightOperation) Execute() error {
+	return s.executeArithmetic(shiftRightOperator)
+}
+
+func (s shiftRightOperation) GetNextProgramCounter() int { return s.getProgramCounter() + 4 }
+
+func (_ shiftRightOperation) Halt() bool { return false }
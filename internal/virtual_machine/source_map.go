@@ -0,0 +1,197 @@
+package virtual_machine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SourceLocation is a position in the source code a program was assembled from. Line and Column start at 1; a
+// Column of 0 means only the line is known
+type SourceLocation struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+// String returns the location in the usual "file:line:column" notation, leaving out whatever is unknown
+func (s SourceLocation) String() string {
+	location := fmt.Sprintf("line %v", s.Line)
+	if s.File != "" {
+		location = fmt.Sprintf("%v:%v", s.File, s.Line)
+	}
+
+	if s.Column > 0 {
+		location = fmt.Sprintf("%v:%v", location, s.Column)
+	}
+
+	return location
+}
+
+// SourceLocator resolves addresses of a program back to the source code they were assembled from
+type SourceLocator interface {
+	// LocateAddress returns the source location of the address provided, or false if it is unknown
+	LocateAddress(address int) (SourceLocation, bool)
+}
+
+// SourceRange maps the addresses in [Start, End) to a single location in the source code
+type SourceRange struct {
+	Start    int            `json:"start"`
+	End      int            `json:"end"`
+	Location SourceLocation `json:"location"`
+}
+
+// Symbolizer resolves addresses of a program to the labels they were written at
+type Symbolizer interface {
+	// Symbolize returns the nearest label at or before the address provided, followed by the address's offset from
+	// it if there is one, as in "loop" or "loop+3". Returns false if no label precedes the address
+	Symbolize(address int) (string, bool)
+}
+
+// SourceMap is a SourceLocator and Symbolizer built from non-overlapping address ranges, such as the ones an
+// assembler records for each instruction it emits, and from the addresses of the program's labels. It is the debug
+// information that images carry (see Image)
+type SourceMap struct {
+	Ranges []SourceRange `json:"ranges"`
+
+	// Labels holds the address of every label of the program
+	Labels map[string]int `json:"labels,omitempty"`
+}
+
+// Add maps the addresses in [start, end) to the location provided. Ranges may be added in any order
+func (s *SourceMap) Add(start, end int, location SourceLocation) {
+	s.Ranges = append(s.Ranges, SourceRange{start, end, location})
+
+	if count := len(s.Ranges); count > 1 && s.Ranges[count-2].Start > start {
+		sort.Slice(s.Ranges, func(i, j int) bool { return s.Ranges[i].Start < s.Ranges[j].Start })
+	}
+}
+
+// AddLabel records the address of a label
+func (s *SourceMap) AddLabel(name string, address int) {
+	if s.Labels == nil {
+		s.Labels = map[string]int{}
+	}
+
+	s.Labels[name] = address
+}
+
+func (s SourceMap) LocateAddress(address int) (SourceLocation, bool) {
+	index := sort.Search(len(s.Ranges), func(i int) bool { return s.Ranges[i].End > address })
+	if index < len(s.Ranges) && s.Ranges[index].Start <= address {
+		return s.Ranges[index].Location, true
+	}
+
+	return SourceLocation{}, false
+}
+
+func (s SourceMap) Symbolize(address int) (string, bool) {
+	best, bestAddress := "", -1
+	for name, labelAddress := range s.Labels {
+		if labelAddress > address || labelAddress < bestAddress {
+			continue
+		}
+
+		// Of the labels at the same address, prefer the ones written in the source over those renamed within
+		// macro expansions, such as loop@2
+		if labelAddress == bestAddress && (strings.Contains(name, "@") && !strings.Contains(best, "@") ||
+			strings.Contains(name, "@") == strings.Contains(best, "@") && name > best) {
+			continue
+		}
+
+		best, bestAddress = name, labelAddress
+	}
+
+	if bestAddress < 0 {
+		return "", false
+	}
+
+	if offset := address - bestAddress; offset > 0 {
+		return fmt.Sprintf("%v+%v", best, offset), true
+	}
+
+	return best, true
+}
+
+// Describe describes the address provided by its source location and symbol, as in "loop.tva:12:5 in loop+3",
+// or returns an empty string if neither is known
+func (s SourceMap) Describe(address int) string {
+	return describeAddress(s, s, address)
+}
+
+// describeAddress is Describe for any source locator and symbolizer, either of which may be nil
+func describeAddress(locator SourceLocator, symbolizer Symbolizer, address int) string {
+	var parts []string
+	if locator != nil {
+		if location, found := locator.LocateAddress(address); found {
+			parts = append(parts, location.String())
+		}
+	}
+
+	if symbolizer != nil {
+		if symbol, found := symbolizer.Symbolize(address); found {
+			parts = append(parts, symbol)
+		}
+	}
+
+	return strings.Join(parts, " in ")
+}
+
+// SetSourceLocator gives the machine a way to resolve addresses back to source code, which it uses to annotate
+// its reports: its errors, its trace (see SetTraceDepth), its core dumps and its self-modification reports. A
+// locator that is also a Symbolizer, such as a SourceMap, lets the machine name the labels addresses belong to as
+// well
+func (t *TsvetokVirtualMachine) SetSourceLocator(locator SourceLocator) {
+	t.sourceLocator = locator
+}
+
+// locate resolves an address through the machine's source locator, if it has one
+func (t *TsvetokVirtualMachine) locate(address int) *SourceLocation {
+	if t.sourceLocator == nil {
+		return nil
+	}
+
+	if location, found := t.sourceLocator.LocateAddress(address); found {
+		return &location
+	}
+
+	return nil
+}
+
+// symbolize resolves an address to a label through the machine's source locator, if it is also a Symbolizer
+func (t *TsvetokVirtualMachine) symbolize(address int) string {
+	if symbolizer, isSymbolizer := t.sourceLocator.(Symbolizer); isSymbolizer {
+		if symbol, found := symbolizer.Symbolize(address); found {
+			return symbol
+		}
+	}
+
+	return ""
+}
+
+// locateFault attaches the source location and symbol of the program counter to an error the machine faulted
+// with, if its source locator knows either
+func (t *TsvetokVirtualMachine) locateFault(err error) error {
+	if err == nil || t.sourceLocator == nil {
+		return err
+	}
+
+	fault := SourceFaultErr{ProgramCounter: t.programCounter, Location: t.locate(t.programCounter), Symbol: t.symbolize(t.programCounter), Err: err}
+	if fault.Location == nil && fault.Symbol == "" {
+		return err
+	}
+
+	return fault
+}
+
+// debugInfo returns the machine's source locator if it is a SourceMap, for core dumps to carry
+func (t *TsvetokVirtualMachine) debugInfo() *SourceMap {
+	switch locator := t.sourceLocator.(type) {
+	case SourceMap:
+		return &locator
+	case *SourceMap:
+		return locator
+	default:
+		return nil
+	}
+}
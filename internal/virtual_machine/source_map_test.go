@@ -0,0 +1,115 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// divisionSourceMap maps the program `start: add 0, 1, r0 / loop: div 1, 0, r0 / hlt` back to loop.tva
+func divisionSourceMap() SourceMap {
+	sourceMap := SourceMap{}
+	sourceMap.Add(0, 4, SourceLocation{"loop.tva", 1, 8})
+	sourceMap.Add(4, 8, SourceLocation{"loop.tva", 2, 7})
+	sourceMap.Add(8, 9, SourceLocation{"loop.tva", 3, 1})
+	sourceMap.AddLabel("start", 0)
+	sourceMap.AddLabel("loop@1", 4)
+	sourceMap.AddLabel("loop", 4)
+	return sourceMap
+}
+
+func TestSourceMap_SymbolizesAddressesByTheNearestLabel(t *testing.T) {
+	sourceMap := divisionSourceMap()
+
+	for address, expected := range map[int]string{0: "start", 3: "start+3", 4: "loop", 8: "loop+4"} {
+		symbol, found := sourceMap.Symbolize(address)
+		require.True(t, found, address)
+		assert.Equal(t, expected, symbol, address)
+	}
+
+	_, found := sourceMap.Symbolize(-1)
+	assert.False(t, found)
+	assert.Equal(t, "loop.tva:2:7 in loop+2", sourceMap.Describe(6))
+	assert.Equal(t, "loop+16", sourceMap.Describe(20))
+}
+
+func TestTsvetokVirtualMachine_LocatesFaultsInTheSource(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{21101, 0, 1, 0, 21110, 1, 0, 0, 9})
+		machine.SetSourceLocator(divisionSourceMap())
+
+		err := machine.Execute()
+		assert.EqualError(t, err, "loop.tva:2:7: attempted to divide by zero (pc 4 in loop)")
+		assert.True(t, errors.Is(err, DivisionByZeroErr{}))
+	})
+}
+
+func TestTsvetokVirtualMachine_LocatesFaultsInInterpretedInstructionsOnce(t *testing.T) {
+	// The instruction at address 4 cannot be compiled, so the compiled engine interprets it
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{21101, 0, 1, 0, 42, 0, 0, 0, 9})
+		machine.SetSourceLocator(divisionSourceMap())
+
+		assert.EqualError(t, machine.Execute(), "loop.tva:2:7: no operation found for opcode \"42\" (pc 4 in loop)")
+	})
+}
+
+func TestTsvetokVirtualMachine_LeavesFaultsAloneWithoutASourceLocator(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{21110, 1, 0, 0})
+
+	assert.Equal(t, DivisionByZeroErr{}, machine.Execute())
+}
+
+func TestTsvetokVirtualMachine_LocatesTracedInstructions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{21101, 0, 1, 0, 21110, 1, 0, 0, 9})
+		machine.SetTraceDepth(4)
+		machine.SetSourceLocator(divisionSourceMap())
+		fault := machine.Execute()
+
+		trace := machine.Trace()
+		require.Len(t, trace, 2)
+		assert.Equal(t, &SourceLocation{"loop.tva", 1, 8}, trace[0].Location)
+		assert.Equal(t, "start", trace[0].Symbol)
+		assert.Equal(t, "loop", trace[1].Symbol)
+
+		core := machine.CoreDump(fault)
+		require.NotNil(t, core.Debug)
+		assert.Equal(t, divisionSourceMap(), *core.Debug)
+	})
+}
+
+func TestImage_RoundTripsDebugInfo(t *testing.T) {
+	debug := divisionSourceMap()
+	debug.Add(9, 10, SourceLocation{"lib.tva", 4, 0})
+	image := Image{
+		Sections: []Section{{"program", 0, MemoryPermissionAll, []int{21101, 0, 1, 0, 21110, 1, 0, 0, 9, 9}}},
+		Debug:    &debug,
+	}
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteImage(buffer, image))
+	encoded := buffer.Bytes()
+
+	decoded, err := ReadImage(bytes.NewReader(encoded))
+	require.NoError(t, err)
+	assert.Equal(t, image, decoded)
+
+	machine, err := NewTsvetokVirtualMachineFromImage(decoded)
+	require.NoError(t, err)
+	assert.EqualError(t, machine.Execute(), "loop.tva:2:7: attempted to divide by zero (pc 4 in loop)")
+
+	withoutDebug := &bytes.Buffer{}
+	require.NoError(t, WriteImage(withoutDebug, Image{Sections: image.Sections}))
+
+	// A version 2 image is a version 3 image without the debug information at the end
+	version2 := append([]byte{}, withoutDebug.Bytes()[:withoutDebug.Len()-12]...)
+	version2[len(ImageFileMagic)] = 2
+
+	decoded, err = ReadImage(bytes.NewReader(version2))
+	require.NoError(t, err)
+	assert.Equal(t, Image{Sections: image.Sections}, decoded)
+}
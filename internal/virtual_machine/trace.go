@@ -0,0 +1,109 @@
+package virtual_machine
+
+import ()
+
+// TraceEntry records a single instruction the machine executed: where it was and the words that made it up
+// (the raw opcode followed by its operands) at the time it was executed
+type TraceEntry struct {
+	ProgramCounter int   `json:"programCounter"`
+	Instruction    []int `json:"instruction"`
+
+	// Location and Symbol are the source location and label of the instruction, when the machine has a source
+	// locator that knows them (see SetSourceLocator)
+	Location *SourceLocation `json:"location,omitempty"`
+	Symbol   string          `json:"symbol,omitempty"`
+
+	// Warnings are noteworthy things the instruction did, such as modifying code (see SetSelfModificationDetection)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// instructionTrace is a fixed-size ring buffer of the most recently executed instructions
+type instructionTrace struct {
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+// SetTraceDepth makes the machine remember the last depth instructions it executed (see Trace.) A depth of 0
+// turns tracing off, which is the default
+func (t *TsvetokVirtualMachine) SetTraceDepth(depth int) {
+	if depth <= 0 {
+		t.trace = nil
+		return
+	}
+
+	t.trace = &instructionTrace{entries: make([]TraceEntry, depth)}
+}
+
+// Trace returns the most recently executed instructions, oldest first. The instruction that faulted, if any,
+// is the last entry
+func (t *TsvetokVirtualMachine) Trace() []TraceEntry {
+	if t.trace == nil {
+		return []TraceEntry{}
+	}
+
+	if !t.trace.full {
+		return append([]TraceEntry{}, t.trace.entries[:t.trace.next]...)
+	}
+
+	return append(append([]TraceEntry{}, t.trace.entries[t.trace.next:]...), t.trace.entries[:t.trace.next]...)
+}
+
+// recordTrace adds the instruction at the current program counter to the trace, if tracing is on
+func (t *TsvetokVirtualMachine) recordTrace() {
+	if t.trace == nil {
+		return
+	}
+
+	end := t.programCounter + instructionLength(t.memory[t.programCounter]%100)
+	if end > len(t.memory) {
+		end = len(t.memory)
+	}
+
+	t.trace.entries[t.trace.next] = TraceEntry{
+		ProgramCounter: t.programCounter,
+		Instruction:    append([]int{}, t.memory[t.programCounter:end]...),
+		Location:       t.locate(t.programCounter),
+		Symbol:         t.symbolize(t.programCounter),
+	}
+	t.trace.next = (t.trace.next + 1) % len(t.trace.entries)
+	if t.trace.next == 0 {
+		t.trace.full = true
+	}
+}
+
+// warnInTrace attaches a warning to the most recently traced instruction, if tracing is on
+func (t *TsvetokVirtualMachine) warnInTrace(warning string) {
+	if t.trace == nil {
+		return
+	}
+
+	last := (t.trace.next + len(t.trace.entries) - 1) % len(t.trace.entries)
+	t.trace.entries[last].Warnings = append(t.trace.entries[last].Warnings, warning)
+}
+
+// instructionLength returns the number of words (opcode included) taken up by an instruction with the opcode
+// provided. Unknown opcodes are one word long
+func instructionLength(opCode int) int {
+	switch opCode {
+	case 1, 2, 5, 7, 10, 11, 12, 13, 14, 16, 17:
+		return 4
+	case 6, 15:
+		return 3
+	case 3, 4:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// clone returns an independent copy of the trace, or nil if tracing is off
+func (i *instructionTrace) clone() *instructionTrace {
+	if i == nil {
+		return nil
+	}
+
+	clone := *i
+	clone.entries = append([]TraceEntry{}, i.entries...)
+	return &clone
+}
@@ -50,49 +50,141 @@ const (
 	RegisterLastAddress = 13
 )
 
+// registerNames are the assembly names of each register, indexed by register number
+var registerNames = []string{"r0", "r1", "r2", "r3", "r4", "t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7", "la"}
+
+// RegisterName returns the assembly name of the register provided (e.g. "t0" for RegisterTemporary0), or an
+// empty string if no such register exists
+func RegisterName(register int) string {
+	if register < 0 || register >= len(registerNames) {
+		return ""
+	}
+
+	return registerNames[register]
+}
+
 // TsvetokVirtualMachine is an implementation of the Tsvetok Virtual Machine Intcode machine (or TVM.)
 type TsvetokVirtualMachine struct {
 	memory         []int
 	registerFile   []int
 	programCounter int
+	limits         Limits
+	usage          UsageCounters
+	trace          *instructionTrace
+	regions        []MemoryRegion
+	wordFormat     WordFormat
+	wide           *wideWords
+
+	selfModification *selfModificationDetector
+	convention       *conventionChecker
+	sourceLocator    SourceLocator
+
+	// decodeCache holds the decoding of the instruction at each address (see decodeCurrentInstruction), and
+	// currentInstruction points at the decoding of the instruction being executed
+	decodeCache         []decodedInstruction
+	decodeCacheDisabled bool
+	scratchDecode       decodedInstruction
+	currentInstruction  *decodedInstruction
+
+	engine   Engine
+	compiled *compiledCode
 	InputInterface
 	OutputInterface
 }
 
+// registerFileSize is the number of registers in every TVM's register file
+const registerFileSize = 14
+
 func NewTsvetokVirtualMachine(program []int) *TsvetokVirtualMachine {
 	return &TsvetokVirtualMachine{
 		memory:         program,
-		registerFile:   make([]int, 14),
+		registerFile:   make([]int, registerFileSize),
 		programCounter: 0,
 	}
 }
 
+// Execute runs the machine from its current program counter until it halts, faults, or exceeds one of its
+// limits (see SetLimits)
 func (t *TsvetokVirtualMachine) Execute() error {
-	for {
-		currentOperation := t.getCurrentOperation()
-		if currentOperation == nil {
-			return fmt.Errorf(`no operation found for opcode "%v"`, t.memory[t.programCounter])
-		}
+	if err := t.checkMemoryLimit(len(t.memory)); err != nil {
+		return err
+	}
 
-		err := currentOperation.Execute()
+	if t.engine == EngineCompiled {
+		return t.locateFault(t.executeCompiled())
+	}
+
+	return t.locateFault(t.executeInterpreted())
+}
+
+// executeInterpreted is Execute for EngineInterpreter
+func (t *TsvetokVirtualMachine) executeInterpreted() error {
+	for {
+		halted, err := t.step()
 		if err != nil {
 			return err
 		}
 
-		if currentOperation.Halt() {
-			break
+		if halted {
+			return nil
 		}
-
-		t.programCounter = currentOperation.GetNextProgramCounter()
 	}
+}
 
-	return nil
+// Step executes the single instruction at the current program counter and reports whether that instruction
+// halted the machine. A halted machine leaves its program counter on the halt instruction, so stepping it
+// again simply halts again. Errors name the source location of the faulting instruction when the machine has a
+// source locator (see SetSourceLocator)
+func (t *TsvetokVirtualMachine) Step() (bool, error) {
+	halted, err := t.step()
+	return halted, t.locateFault(err)
 }
 
-func (t *TsvetokVirtualMachine) getCurrentOperation() TVMOperation {
-	rawOpcode := t.memory[t.programCounter]
-	opCode := rawOpcode % 100
+// step is Step without the source location of errors
+func (t *TsvetokVirtualMachine) step() (bool, error) {
+	if err := t.checkInstructionLimits(); err != nil {
+		return false, err
+	}
+
+	if t.programCounter < 0 || t.programCounter >= len(t.memory) {
+		return false, fmt.Errorf("program counter '%v' is outside of memory (memory is of size '%v')", t.programCounter, len(t.memory))
+	}
+
+	if wide := t.wideAt(ParamFormatAddress, t.programCounter); wide != nil {
+		return false, WideWordErr{"opcode fetch", wide.String()}
+	}
+
+	t.checkConventionJump()
+	t.recordTrace()
+	t.checkConvention()
+	t.currentInstruction = t.decodeCurrentInstruction()
+	if err := t.checkExecutable(t.currentInstruction.length); err != nil {
+		return false, err
+	}
+
+	t.recordDecode(t.currentInstruction.length)
+
+	currentOperation := t.currentInstruction.operation
+	if currentOperation == nil {
+		return false, fmt.Errorf(`no operation found for opcode "%v"`, t.memory[t.programCounter])
+	}
+
+	t.usage.InstructionsExecuted++
+	err := currentOperation.Execute()
+	if err != nil {
+		return false, err
+	}
 
+	if currentOperation.Halt() {
+		return true, nil
+	}
+
+	t.programCounter = currentOperation.GetNextProgramCounter()
+	return false, nil
+}
+
+// newOperation returns the operation for the opcode provided, or nil if no such operation exists
+func (t *TsvetokVirtualMachine) newOperation(opCode int) TVMOperation {
 	switch opCode {
 	case 1:
 		return newAddOperation(t)
@@ -110,6 +202,22 @@ func (t *TsvetokVirtualMachine) getCurrentOperation() TVMOperation {
 		return newSetIfLessThanOperation(t)
 	case 9:
 		return newHaltOperation(t)
+	case 10:
+		return newDivideOperation(t)
+	case 11:
+		return newModuloOperation(t)
+	case 12:
+		return newAndOperation(t)
+	case 13:
+		return newOrOperation(t)
+	case 14:
+		return newXorOperation(t)
+	case 15:
+		return newNotOperation(t)
+	case 16:
+		return newShiftLeftOperation(t)
+	case 17:
+		return newShiftRightOperation(t)
 	default:
 		return nil
 	}
@@ -121,17 +229,33 @@ func (t *TsvetokVirtualMachine) getMemory() []int {
 	return t.memory
 }
 
+// GetValueInMemory reads the word at the address provided. Reads are subject to memory protection (see
+// AddMemoryRegion)
 func (t *TsvetokVirtualMachine) GetValueInMemory(address int) (int, error) {
 	if address >= 0 && address < len(t.memory) {
+		if err := t.checkAccess(address, MemoryPermissionRead); err != nil {
+			return -1, err
+		}
+
 		return t.memory[address], nil
 	}
 
 	return -1, fmt.Errorf("cannot lookup memory at address '%v' (memory is of size '%v')", address, len(t.memory))
 }
 
+// SetValueInMemory writes the word provided to the address provided. Writes are subject to memory protection
+// (see AddMemoryRegion)
 func (t *TsvetokVirtualMachine) SetValueInMemory(address, value int) error {
 	if address >= 0 && address < len(t.memory) {
+		if err := t.checkAccess(address, MemoryPermissionWrite); err != nil {
+			return err
+		}
+
+		t.recordWrite(address, value)
+		t.forgetWide(ParamFormatAddress, address)
 		t.memory[address] = value
+		t.invalidateDecode(address)
+		t.invalidateCompiled(address)
 		return nil
 	}
 
@@ -152,6 +276,7 @@ func (t *TsvetokVirtualMachine) SetValueInRegisterFile(address, value int) error
 	}
 
 	if address >= 0 && address < len(t.registerFile) {
+		t.forgetWide(ParamFormatRegister, address)
 		t.registerFile[address] = value
 		return nil
 	}
@@ -159,26 +284,11 @@ func (t *TsvetokVirtualMachine) SetValueInRegisterFile(address, value int) error
 	return fmt.Errorf("cannot write to register file at address '%v' (register file is of size '%v')", address, len(t.registerFile))
 }
 
-func (t *TsvetokVirtualMachine) getFirstParam() (operationParam, error) {
-	rawOpcode := t.memory[t.programCounter]
-	paramFormat := (rawOpcode / 100) % 10
-
-	return newOperationParam(t, paramFormat, t.programCounter+1)
-}
-
-func (t *TsvetokVirtualMachine) getSecondParam() (operationParam, error) {
-	rawOpcode := t.memory[t.programCounter]
-	paramFormat := (rawOpcode / 1000) % 10
+func (t *TsvetokVirtualMachine) getFirstParam() (operationParam, error) { return t.getParam(0) }
 
-	return newOperationParam(t, paramFormat, t.programCounter+2)
-}
+func (t *TsvetokVirtualMachine) getSecondParam() (operationParam, error) { return t.getParam(1) }
 
-func (t *TsvetokVirtualMachine) getThirdParam() (operationParam, error) {
-	rawOpcode := t.memory[t.programCounter]
-	paramFormat := rawOpcode / 10000
-
-	return newOperationParam(t, paramFormat, t.programCounter+3)
-}
+func (t *TsvetokVirtualMachine) getThirdParam() (operationParam, error) { return t.getParam(2) }
 
 func (t *TsvetokVirtualMachine) getProgramCounter() int {
 	return t.programCounter
@@ -1,7 +1,9 @@
 package virtual_machine
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,188 +18,506 @@ type executionTestCase struct {
 }
 
 func TestTsvetokVirtualMachine_HaltsProperly(t *testing.T) {
-	err := NewTsvetokVirtualMachine([]int{9}).Execute()
-	require.NoError(t, err)
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		err := newMachine([]int{9}).Execute()
+		require.NoError(t, err)
+	})
 }
 
 func TestTsvetokVirtualMachine_AddsProperlyInMemoryMode(t *testing.T) {
-	program := []int{1, 0, 0, 0, 9}
-	machine := NewTsvetokVirtualMachine(program)
-	err := machine.Execute()
-	require.NoError(t, err)
-
-	result := machine.CopyMemory()
-	assert.Equal(t, 2, result[0])
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{1, 0, 0, 0, 9}
+		machine := newMachine(program)
+		err := machine.Execute()
+		require.NoError(t, err)
+
+		result := machine.CopyMemory()
+		assert.Equal(t, 2, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_MultipliesProperlyInMemoryMode(t *testing.T) {
-	program := []int{2, 0, 0, 0, 9}
-	machine := NewTsvetokVirtualMachine(program)
-	err := machine.Execute()
-	require.NoError(t, err)
-
-	result := machine.CopyMemory()
-	assert.Equal(t, 4, result[0])
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{2, 0, 0, 0, 9}
+		machine := newMachine(program)
+		err := machine.Execute()
+		require.NoError(t, err)
+
+		result := machine.CopyMemory()
+		assert.Equal(t, 4, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_GivesErrorForInvalidOpcode(t *testing.T) {
-	machine := NewTsvetokVirtualMachine([]int{-1234})
-	require.Error(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{-1234})
+		require.Error(t, machine.Execute())
+	})
 }
 
 func TestTsvetokVirtualMachine_HandlesInputCorrectly(t *testing.T) {
-	program := []int{3, 0, 9}
-	machine := NewTsvetokVirtualMachine(program)
-	machine.SetInputInterface(MockInputInterface{-1})
-	require.NoError(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{3, 0, 9}
+		machine := newMachine(program)
+		machine.SetInputInterface(MockInputInterface{-1})
+		require.NoError(t, machine.Execute())
 
-	result := machine.CopyMemory()
-	assert.Equal(t, -1, result[0])
+		result := machine.CopyMemory()
+		assert.Equal(t, -1, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_HandlesOutputCorrectly(t *testing.T) {
-	mockOutput := &MockOutputInterface{}
-	machine := NewTsvetokVirtualMachine([]int{4, 0, 9})
-	machine.SetOutputInterface(mockOutput)
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		mockOutput := &MockOutputInterface{}
+		machine := newMachine([]int{4, 0, 9})
+		machine.SetOutputInterface(mockOutput)
 
-	require.NoError(t, machine.Execute())
-	require.NotNil(t, mockOutput.LastNumberReceived)
-	assert.Equal(t, 4, *mockOutput.LastNumberReceived)
+		require.NoError(t, machine.Execute())
+		require.NotNil(t, mockOutput.LastNumberReceived)
+		assert.Equal(t, 4, *mockOutput.LastNumberReceived)
+	})
 }
 
 func TestTsvetokVirtualMachine_SetIfEqualSetsIfEqualInMemoryMode(t *testing.T) {
-	program := []int{5, 0, 0, 0, 9}
-	machine := NewTsvetokVirtualMachine(program)
-	require.NoError(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{5, 0, 0, 0, 9}
+		machine := newMachine(program)
+		require.NoError(t, machine.Execute())
 
-	result := machine.CopyMemory()
-	assert.Equal(t, 1, result[0])
+		result := machine.CopyMemory()
+		assert.Equal(t, 1, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_SetIfEqualSetsToFalseIfNotEqualInMemoryMode(t *testing.T) {
-	program := []int{5, 0, 1, 0, 9}
-	machine := NewTsvetokVirtualMachine(program)
-	require.NoError(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{5, 0, 1, 0, 9}
+		machine := newMachine(program)
+		require.NoError(t, machine.Execute())
 
-	result := machine.CopyMemory()
-	assert.Equal(t, 0, result[0])
+		result := machine.CopyMemory()
+		assert.Equal(t, 0, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_JumpIfTrueDoesItsNamesake(t *testing.T) {
-	program := []int{6, 0, 8, 1, 0, 0, 0, 9, 7}
-	machine := NewTsvetokVirtualMachine(program)
-	require.NoError(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{6, 0, 8, 1, 0, 0, 0, 9, 7}
+		machine := newMachine(program)
+		require.NoError(t, machine.Execute())
 
-	result := machine.CopyMemory()
-	assert.Equal(t, 6, result[0])
+		result := machine.CopyMemory()
+		assert.Equal(t, 6, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_JumpIfTrueDoesNotJumpIfFalse(t *testing.T) {
-	program := []int{6, 4, 8, 1, 0, 0, 0, 9, 7}
-	machine := NewTsvetokVirtualMachine(program)
-	require.NoError(t, machine.Execute())
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		program := []int{6, 4, 8, 1, 0, 0, 0, 9, 7}
+		machine := newMachine(program)
+		require.NoError(t, machine.Execute())
 
-	result := machine.CopyMemory()
-	assert.Equal(t, 12, result[0])
+		result := machine.CopyMemory()
+		assert.Equal(t, 12, result[0])
+	})
 }
 
 func TestTsvetokVirtualMachine_AllInputParamsSupportImmediateMode(t *testing.T) {
-	for _, tc := range []executionTestCase{
-		{program: []int{101, 10, 2, 0, 9}, expectedAddress: 0, expectedValue: 12, testName: "add first param immediate"},
-		{program: []int{1001, 4, 10, 0, 9}, expectedAddress: 0, expectedValue: 19, testName: "add second param immediate"},
-		{program: []int{1102, 1, 0, 0, 9}, expectedAddress: 0, expectedValue: 0, testName: "mlt both params immediate"},
-		{program: []int{104, 100, 9}, expectedAddress: -1, expectedValue: 100, testName: "out one immediate parameter"},
-		{program: []int{1105, 1105, 1105, 0, 9}, expectedAddress: 0, expectedValue: 1, testName: "seq first param immediate"},
-		{program: []int{106, 1, 8, 0, 0, 0, 1, 9, 7}, expectedAddress: 1, expectedValue: 1, testName: "jit first param immediate"},
-		{program: []int{1006, 1, 7, 0, 0, 0, 1, 9, 7}, expectedAddress: 1, expectedValue: 1, testName: "jit second param immediate"},
-	} {
-		t.Run(tc.testName, func(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []executionTestCase{
+			{program: []int{101, 10, 2, 0, 9}, expectedAddress: 0, expectedValue: 12, testName: "add first param immediate"},
+			{program: []int{1001, 4, 10, 0, 9}, expectedAddress: 0, expectedValue: 19, testName: "add second param immediate"},
+			{program: []int{1102, 1, 0, 0, 9}, expectedAddress: 0, expectedValue: 0, testName: "mlt both params immediate"},
+			{program: []int{104, 100, 9}, expectedAddress: -1, expectedValue: 100, testName: "out one immediate parameter"},
+			{program: []int{1105, 1105, 1105, 0, 9}, expectedAddress: 0, expectedValue: 1, testName: "seq first param immediate"},
+			{program: []int{106, 1, 8, 0, 0, 0, 1, 9, 7}, expectedAddress: 1, expectedValue: 1, testName: "jit first param immediate"},
+			{program: []int{1006, 1, 7, 0, 0, 0, 1, 9, 7}, expectedAddress: 1, expectedValue: 1, testName: "jit second param immediate"},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				mockOutput := &MockOutputInterface{}
+				machine := newMachine(tc.program)
+				machine.SetOutputInterface(mockOutput)
+
+				require.NoError(t, machine.Execute())
+
+				memory := machine.CopyMemory()
+				if memory[0]%10 == 4 { // We're testing output
+					assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived)
+				} else {
+					assert.Equal(t, tc.expectedValue, memory[tc.expectedAddress])
+				}
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_NoOutputParamSupportsImmediateMode(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []executionTestCase{
+			{program: []int{10001, 0, 0, 12, 9}, testName: "add output param immediate"},
+			{program: []int{10002, 0, 0, -69, 9}, testName: "mlt output param immediate"},
+			{program: []int{103, -1, 9}, testName: "in output param immediate"},
+			{program: []int{10005, 0, 0, 420, 9}, testName: "seq output param immediate"},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				machine := newMachine(tc.program)
+				machine.SetInputInterface(MockInputInterface{0})
+				err := machine.Execute()
+				require.Error(t, err)
+
+				_, isInvalidParamErr := err.(InvalidOutputParamErr)
+				require.True(t, isInvalidParamErr, "error provided must be InvalidOutputParamErr")
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_RegisterModeIsSupportedEverywhere(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []executionTestCase{
+			{program: []int{21201, 0, 1, 0, 9}, expectedRegister: 0, expectedValue: 1, testName: "add registers most params"},
+			{program: []int{21102, 2, 2, 0, 9}, expectedRegister: 0, expectedValue: 4, testName: "mlt registers most params"},
+			{program: []int{203, 0, 9}, expectedRegister: 0, expectedValue: -12, testName: "in register input param"},
+			{program: []int{203, 1, 204, 1, 9}, expectedRegister: -1, expectedValue: -12, testName: "out register param"},
+			{program: []int{22105, 0, 11, 2, 9}, expectedRegister: 2, expectedValue: 1, testName: "seq register param"},
+			{program: []int{21101, 0, 11, 3, 2106, 1, 3, 21101, 1, 0, 3, 9}, expectedRegister: 3, expectedValue: 11, testName: "jit register param"},
+		} {
 			mockOutput := &MockOutputInterface{}
-			machine := NewTsvetokVirtualMachine(tc.program)
+			mockInput := MockInputInterface{-12}
+			machine := newMachine(tc.program)
 			machine.SetOutputInterface(mockOutput)
+			machine.SetInputInterface(mockInput)
 
 			require.NoError(t, machine.Execute())
 
-			memory := machine.CopyMemory()
-			if memory[0]%10 == 4 { // We're testing output
+			if tc.expectedRegister < 0 { // asserting output instruction
+				require.NotNil(t, mockOutput.LastNumberReceived)
 				assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived)
 			} else {
-				assert.Equal(t, tc.expectedValue, memory[tc.expectedAddress])
+				actualValue, err := machine.GetValueInRegisterFile(tc.expectedRegister)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedValue, actualValue)
 			}
-		})
-	}
+		}
+	})
 }
 
-func TestTsvetokVirtualMachine_NoOutputParamSupportsImmediateMode(t *testing.T) {
-	for _, tc := range []executionTestCase{
-		{program: []int{10001, 0, 0, 12, 9}, testName: "add output param immediate"},
-		{program: []int{10002, 0, 0, -69, 9}, testName: "mlt output param immediate"},
-		{program: []int{103, -1, 9}, testName: "in output param immediate"},
-		{program: []int{10005, 0, 0, 420, 9}, testName: "seq output param immediate"},
-	} {
-		t.Run(tc.testName, func(t *testing.T) {
-			machine := NewTsvetokVirtualMachine(tc.program)
-			machine.SetInputInterface(MockInputInterface{0})
-			err := machine.Execute()
-			require.Error(t, err)
+func TestTsvetokVirtualMachine_JumpIfTrueSetsTheLastAddressRegister(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1106, 1, 3, 9})
+		require.NoError(t, machine.Execute())
 
-			_, isInvalidParamErr := err.(InvalidOutputParamErr)
-			require.True(t, isInvalidParamErr, "error provided must be InvalidOutputParamErr")
-		})
-	}
+		val, err := machine.GetValueInRegisterFile(13)
+		require.NoError(t, err)
+		assert.Equal(t, 3, val)
+	})
 }
 
-func TestTsvetokVirtualMachine_RegisterModeIsSupportedEverywhere(t *testing.T) {
-	for _, tc := range []executionTestCase{
-		{program: []int{21201, 0, 1, 0, 9}, expectedRegister: 0, expectedValue: 1, testName: "add registers most params"},
-		{program: []int{21102, 2, 2, 0, 9}, expectedRegister: 0, expectedValue: 4, testName: "mlt registers most params"},
-		{program: []int{203, 0, 9}, expectedRegister: 0, expectedValue: -12, testName: "in register input param"},
-		{program: []int{203, 1, 204, 1, 9}, expectedRegister: -1, expectedValue: -12, testName: "out register param"},
-		{program: []int{22105, 0, 11, 2, 9}, expectedRegister: 2, expectedValue: 1, testName: "seq register param"},
-		{program: []int{21101, 0, 11, 3, 2106, 1, 3, 21101, 1, 0, 3, 9}, expectedRegister: 3, expectedValue: 11, testName: "jit register param"},
-	} {
+func TestTsvetokVirtualMachine_SettingLastAddressRegisterReturnsError(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{})
+	err := machine.SetValueInRegisterFile(RegisterLastAddress, -12)
+	require.Error(t, err)
+
+	_, isAttemptedLastAddressWriteErr := err.(AttemptedLastAddressWriteErr)
+	assert.True(t, isAttemptedLastAddressWriteErr)
+}
+
+func TestTsvetokVirtualMachine_SetIfLessThanWorks(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1107, 1, 3, 0, 9})
+		require.NoError(t, machine.Execute())
+
+		val, err := machine.GetValueInMemory(0)
+		require.NoError(t, err)
+		assert.Equal(t, 1, val)
+	})
+}
+
+func TestTsvetokVirtualMachine_StopsAtInstructionLimit(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1106, 1, 0})
+		machine.SetLimits(Limits{MaxInstructions: 50})
+
+		err := machine.Execute()
+		require.Error(t, err)
+		assert.Equal(t, InstructionLimitExceededErr{50}, err)
+		assert.Equal(t, 50, machine.InstructionsExecuted())
+	})
+}
+
+func TestTsvetokVirtualMachine_StopsAtDeadline(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1106, 1, 0})
+		deadline := time.Now().Add(10 * time.Millisecond)
+		machine.SetLimits(Limits{Deadline: deadline})
+
+		err := machine.Execute()
+		require.Error(t, err)
+		assert.Equal(t, DeadlineExceededErr{deadline}, err)
+	})
+}
+
+func TestTsvetokVirtualMachine_RefusesMemoryLargerThanLimit(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{1, 0, 0, 0, 9})
+	machine.SetLimits(Limits{MaxMemoryWords: 4})
+
+	err := machine.Execute()
+	require.Error(t, err)
+	assert.Equal(t, MemoryLimitExceededErr{Limit: 4, Size: 5}, err)
+	assert.Equal(t, 0, machine.InstructionsExecuted())
+}
+
+func TestTsvetokVirtualMachine_StopsAtOutputLimit(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
 		mockOutput := &MockOutputInterface{}
-		mockInput := MockInputInterface{-12}
-		machine := NewTsvetokVirtualMachine(tc.program)
+		machine := newMachine([]int{104, 7, 1106, 1, 0})
 		machine.SetOutputInterface(mockOutput)
-		machine.SetInputInterface(mockInput)
+		machine.SetLimits(Limits{MaxOutputs: 3})
 
-		require.NoError(t, machine.Execute())
+		err := machine.Execute()
+		require.Error(t, err)
+		assert.Equal(t, OutputLimitExceededErr{3}, err)
+	})
+}
+
+func TestTsvetokVirtualMachine_StopsAtInputLimit(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{203, 0, 1106, 1, 0})
+		machine.SetInputInterface(MockInputInterface{NumberToReturn: 1})
+		machine.SetLimits(Limits{MaxInputReads: 2})
+
+		err := machine.Execute()
+		require.Error(t, err)
+		assert.Equal(t, InputLimitExceededErr{2}, err)
+	})
+}
+
+func TestTsvetokVirtualMachine_GivesErrorWhenProgramCounterLeavesMemory(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{1106, 1, 100})
+		require.Error(t, machine.Execute())
+	})
+}
+
+// binaryOperationTestCase is a computation that an instruction taking two parameters should perform
+type binaryOperationTestCase struct {
+	left     int
+	right    int
+	expected int
+}
+
+// assertComputesInEveryMode runs the opcode provided over each test case with its parameters in memory, immediate
+// and register mode, checking the result written to address 0 (or r0)
+func assertComputesInEveryMode(t *testing.T, opCode int, cases []binaryOperationTestCase) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range cases {
+			// op $5, $6, $0 with the parameters at addresses 5 and 6
+			machine := newMachine([]int{opCode, 5, 6, 0, 9, tc.left, tc.right})
+			require.NoError(t, machine.Execute())
+			assert.Equal(t, tc.expected, machine.CopyMemory()[0], "memory mode: %v, %v", tc.left, tc.right)
 
-		if tc.expectedRegister < 0 { // asserting output instruction
-			require.NotNil(t, mockOutput.LastNumberReceived)
-			assert.Equal(t, tc.expectedValue, *mockOutput.LastNumberReceived)
-		} else {
-			actualValue, err := machine.GetValueInRegisterFile(tc.expectedRegister)
+			// op left, right, $0
+			machine = newMachine([]int{1100 + opCode, tc.left, tc.right, 0, 9})
+			require.NoError(t, machine.Execute())
+			assert.Equal(t, tc.expected, machine.CopyMemory()[0], "immediate mode: %v, %v", tc.left, tc.right)
+
+			// add left, 0, r0; add right, 0, r1; op r0, r1, r0
+			machine = newMachine([]int{21101, tc.left, 0, 0, 21101, tc.right, 0, 1, 22200 + opCode, 0, 1, 0, 9})
+			require.NoError(t, machine.Execute())
+			value, err := machine.GetValueInRegisterFile(0)
 			require.NoError(t, err)
-			assert.Equal(t, tc.expectedValue, actualValue)
+			assert.Equal(t, tc.expected, value, "register mode: %v, %v", tc.left, tc.right)
 		}
-	}
+	})
 }
 
-func TestTsvetokVirtualMachine_JumpIfTrueSetsTheLastAddressRegister(t *testing.T) {
-	machine := NewTsvetokVirtualMachine([]int{1106, 1, 3, 9})
-	require.NoError(t, machine.Execute())
+func TestTsvetokVirtualMachine_DividesProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 10, []binaryOperationTestCase{
+		{7, 2, 3},
+		{-7, 2, -3},
+		{7, -2, -3},
+		{0, 5, 0},
+		{math.MinInt32, -1, math.MinInt32},
+	})
+}
 
-	val, err := machine.GetValueInRegisterFile(13)
-	require.NoError(t, err)
-	assert.Equal(t, 3, val)
+func TestTsvetokVirtualMachine_TakesTheModuloProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 11, []binaryOperationTestCase{
+		{7, 2, 1},
+		{-7, 2, -1},
+		{7, -2, 1},
+		{6, 3, 0},
+	})
 }
 
-func TestTsvetokVirtualMachine_SettingLastAddressRegisterReturnsError(t *testing.T) {
-	machine := NewTsvetokVirtualMachine([]int{})
-	err := machine.SetValueInRegisterFile(RegisterLastAddress, -12)
-	require.Error(t, err)
+func TestTsvetokVirtualMachine_AndsProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 12, []binaryOperationTestCase{
+		{12, 10, 8},
+		{-1, 10, 10},
+		{-4, -7, -8},
+	})
+}
 
-	_, isAttemptedLastAddressWriteErr := err.(AttemptedLastAddressWriteErr)
-	assert.True(t, isAttemptedLastAddressWriteErr)
+func TestTsvetokVirtualMachine_OrsProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 13, []binaryOperationTestCase{
+		{12, 10, 14},
+		{-8, 3, -5},
+		{0, 0, 0},
+	})
 }
 
-func TestTsvetokVirtualMachine_SetIfLessThanWorks(t *testing.T) {
-	machine := NewTsvetokVirtualMachine([]int{1107, 1, 3, 0, 9})
+func TestTsvetokVirtualMachine_XorsProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 14, []binaryOperationTestCase{
+		{12, 10, 6},
+		{-1, 5, -6},
+		{7, 7, 0},
+	})
+}
+
+func TestTsvetokVirtualMachine_ShiftsLeftProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 16, []binaryOperationTestCase{
+		{3, 4, 48},
+		{-3, 1, -6},
+		{5, 0, 5},
+		{1, 31, math.MinInt32},
+		{3, 31, math.MinInt32},
+	})
+}
+
+func TestTsvetokVirtualMachine_ShiftsRightProperlyInEveryMode(t *testing.T) {
+	assertComputesInEveryMode(t, 17, []binaryOperationTestCase{
+		{48, 4, 3},
+		{-7, 1, -4},
+		{math.MinInt32, 31, -1},
+	})
+}
+
+func TestTsvetokVirtualMachine_NotsProperlyInEveryMode(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []executionTestCase{
+			{program: []int{15, 4, 0, 9, 5}, expectedAddress: 0, expectedRegister: -1, expectedValue: -6, testName: "memory mode"},
+			{program: []int{115, -1, 0, 9}, expectedAddress: 0, expectedRegister: -1, expectedValue: 0, testName: "immediate mode"},
+			{program: []int{21101, 5, 0, 0, 2215, 0, 1, 9}, expectedRegister: 1, expectedValue: -6, testName: "register mode"},
+		} {
+			t.Run(tc.testName, func(t *testing.T) {
+				machine := newMachine(tc.program)
+				require.NoError(t, machine.Execute())
+
+				if tc.expectedRegister < 0 {
+					assert.Equal(t, tc.expectedValue, machine.CopyMemory()[tc.expectedAddress])
+				} else {
+					value, err := machine.GetValueInRegisterFile(tc.expectedRegister)
+					require.NoError(t, err)
+					assert.Equal(t, tc.expectedValue, value)
+				}
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_NoNewOutputParamSupportsImmediateMode(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, program := range [][]int{
+			{11110, 1, 1, 0, 9},
+			{11111, 1, 1, 0, 9},
+			{11112, 1, 1, 0, 9},
+			{11113, 1, 1, 0, 9},
+			{11114, 1, 1, 0, 9},
+			{1115, 1, 0, 9},
+			{11116, 1, 1, 0, 9},
+			{11117, 1, 1, 0, 9},
+		} {
+			err := newMachine(program).Execute()
+			assert.IsType(t, InvalidOutputParamErr{}, err, "program: %v", program)
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_DividingByZeroFaults(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, program := range [][]int{
+			{1110, 7, 0, 0, 9},
+			{1111, 7, 0, 0, 9},
+		} {
+			machine := newMachine(program)
+			err := machine.Execute()
+			require.Error(t, err)
+			assert.Equal(t, DivisionByZeroErr{}, err)
+			assert.Equal(t, program, machine.CopyMemory(), "the output must not be written")
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_ShiftingByInvalidAmountsFaults(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []struct {
+			program []int
+			format  WordFormat
+			err     string
+		}{
+			{[]int{1116, 1, -1, 0, 9}, WordFormat{}, "cannot shift by '-1' bits (expected 0 to 31)"},
+			{[]int{1117, 1, 32, 0, 9}, WordFormat{}, "cannot shift by '32' bits (expected 0 to 31)"},
+			{[]int{1116, 1, 64, 0, 9}, WordFormat{Size: WordSize64}, "cannot shift by '64' bits (expected 0 to 63)"},
+			{[]int{1116, 1, 65536, 0, 9}, WordFormat{Size: WordSizeBig}, "cannot shift by '65536' bits (expected 0 to 65535)"},
+		} {
+			machine := newMachine(tc.program)
+			require.NoError(t, machine.SetWordFormat(tc.format))
+			assert.EqualError(t, machine.Execute(), tc.err)
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_NewOperationsRespectTheOverflowMode(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		for _, tc := range []struct {
+			program  []int
+			overflow Overflow
+			expected int
+			err      string
+		}{
+			{[]int{1110, math.MinInt32, -1, 0, 9}, OverflowSaturate, math.MaxInt32, ""},
+			{[]int{1110, math.MinInt32, -1, 0, 9}, OverflowFault, 0, "div overflowed a 32-bit word with '2147483648'"},
+			{[]int{1116, 3, 30, 0, 9}, OverflowWrap, math.MinInt32 + 1<<30, ""},
+			{[]int{1116, -3, 30, 0, 9}, OverflowSaturate, math.MinInt32, ""},
+			{[]int{1116, 3, 30, 0, 9}, OverflowFault, 0, "shl overflowed a 32-bit word with '3221225472'"},
+		} {
+			machine := newMachine(tc.program)
+			require.NoError(t, machine.SetWordFormat(WordFormat{Overflow: tc.overflow}))
+			err := machine.Execute()
+
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, machine.CopyMemory()[0])
+			}
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_NewOperationsComputeWithBigWords(t *testing.T) {
+	// shl 1, 100, r0; shr r0, 98, r1; div r0, r1, r2; not r2, r3; mod r0, 7, r4; and r0, r0, t0; or r4, 1, t1;
+	// xor t1, 1, t2
+	machine := NewTsvetokVirtualMachine([]int{
+		21116, 1, 100, 0, 21217, 0, 98, 1, 22210, 0, 1, 2, 2215, 2, 3, 21211, 0, 7, 4, 22212, 0, 0, 5,
+		21213, 4, 1, 6, 21214, 6, 1, 7, 9,
+	})
+	require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
 	require.NoError(t, machine.Execute())
 
-	val, err := machine.GetValueInMemory(0)
-	require.NoError(t, err)
-	assert.Equal(t, 1, val)
+	for register, expected := range map[int]string{
+		0: "1267650600228229401496703205376",
+		1: "4",
+		2: "316912650057057350374175801344",
+		3: "-316912650057057350374175801345",
+		4: "2",
+		5: "1267650600228229401496703205376",
+		6: "3",
+		7: "2",
+	} {
+		value, err := machine.GetBigValueInRegisterFile(register)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value.String(), "register %v", register)
+	}
 }
@@ -0,0 +1,150 @@
+package virtual_machine
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// wideWords holds the words of a WordSizeBig machine that are too wide for an int, by memory address and by
+// register. Memory and the register file hold 0 in their place, and any ordinary write to the same address or
+// register forgets the wide word
+type wideWords struct {
+	memory    map[int]*big.Int
+	registers map[int]*big.Int
+}
+
+// wideAt returns the wide word at the address provided (in memory for ParamFormatAddress, in the register file for
+// ParamFormatRegister), or nil if the word there fits in an int
+func (t *TsvetokVirtualMachine) wideAt(format, address int) *big.Int {
+	if t.wide == nil {
+		return nil
+	}
+
+	if format == ParamFormatRegister {
+		return t.wide.registers[address]
+	}
+
+	return t.wide.memory[address]
+}
+
+// forgetWide forgets the wide word at the address provided, if any
+func (t *TsvetokVirtualMachine) forgetWide(format, address int) {
+	if t.wide == nil {
+		return
+	}
+
+	if format == ParamFormatRegister {
+		delete(t.wide.registers, address)
+	} else {
+		delete(t.wide.memory, address)
+	}
+
+	if len(t.wide.memory) == 0 && len(t.wide.registers) == 0 {
+		t.wide = nil
+	}
+}
+
+// setWide writes a word too wide for an int to the address provided, subject to the same checks as an ordinary
+// write there
+func (t *TsvetokVirtualMachine) setWide(format, address int, value *big.Int) error {
+	var err error
+	if format == ParamFormatRegister {
+		err = t.SetValueInRegisterFile(address, 0)
+	} else {
+		err = t.SetValueInMemory(address, 0)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if t.wide == nil {
+		t.wide = &wideWords{map[int]*big.Int{}, map[int]*big.Int{}}
+	}
+
+	if format == ParamFormatRegister {
+		t.wide.registers[address] = new(big.Int).Set(value)
+	} else {
+		t.wide.memory[address] = new(big.Int).Set(value)
+	}
+
+	return nil
+}
+
+// GetBigValueInMemory reads the word at the address provided as an arbitrary-precision integer, which is the only
+// way to read words too wide for an int (see WordSizeBig)
+func (t *TsvetokVirtualMachine) GetBigValueInMemory(address int) (*big.Int, error) {
+	value, err := t.GetValueInMemory(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if wide := t.wideAt(ParamFormatAddress, address); wide != nil {
+		return new(big.Int).Set(wide), nil
+	}
+
+	return big.NewInt(int64(value)), nil
+}
+
+// GetBigValueInRegisterFile reads the register provided as an arbitrary-precision integer (see GetBigValueInMemory)
+func (t *TsvetokVirtualMachine) GetBigValueInRegisterFile(address int) (*big.Int, error) {
+	value, err := t.GetValueInRegisterFile(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if wide := t.wideAt(ParamFormatRegister, address); wide != nil {
+		return new(big.Int).Set(wide), nil
+	}
+
+	return big.NewInt(int64(value)), nil
+}
+
+// copyWideWords returns a copy of the wide words provided, or nil if there are none
+func copyWideWords(words map[int]*big.Int) map[int]*big.Int {
+	if len(words) == 0 {
+		return nil
+	}
+
+	copied := make(map[int]*big.Int, len(words))
+	for address, word := range words {
+		copied[address] = new(big.Int).Set(word)
+	}
+
+	return copied
+}
+
+// restoreWideWords replaces the machine's wide words with copies of the ones provided
+func (t *TsvetokVirtualMachine) restoreWideWords(memory, registers map[int]*big.Int) error {
+	t.wide = nil
+	if len(memory) == 0 && len(registers) == 0 {
+		return nil
+	}
+
+	if t.wordFormat.Size != WordSizeBig {
+		return fmt.Errorf("machine state has words wider than an int but its word size is '%v'", t.wordFormat.Size)
+	}
+
+	for address, word := range memory {
+		if word == nil || address < 0 || address >= len(t.memory) {
+			return fmt.Errorf("machine state has an invalid wide word at address '%v'", address)
+		}
+	}
+
+	for register, word := range registers {
+		if word == nil || register < 0 || register >= len(t.registerFile) {
+			return fmt.Errorf("machine state has an invalid wide word in register '%v'", register)
+		}
+	}
+
+	t.wide = &wideWords{copyWideWords(memory), copyWideWords(registers)}
+	if t.wide.memory == nil {
+		t.wide.memory = map[int]*big.Int{}
+	}
+
+	if t.wide.registers == nil {
+		t.wide.registers = map[int]*big.Int{}
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package virtual_machine
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// WordSize is the width of every word in a TsvetokVirtualMachine's memory and register file
+type WordSize int
+
+const (
+	// WordSize32 words are signed 32-bit integers, the width of a word in TVM program files. This is the default
+	WordSize32 WordSize = iota
+
+	// WordSize64 words are signed 64-bit integers
+	WordSize64
+
+	// WordSizeBig words are arbitrary-precision integers. Arithmetic never overflows, so the overflow mode is
+	// ignored. Words that fit in an int are stored as such; wider ones are kept aside (see wideWords) and may only
+	// be used as data: using one as an opcode, address, jump target or output (unless the OutputInterface is a
+	// BigOutputInterface) faults with a WideWordErr
+	WordSizeBig
+)
+
+// wordSizeNames are the names of every word size, as accepted by ParseWordSize
+var wordSizeNames = map[WordSize]string{WordSize32: "32", WordSize64: "64", WordSizeBig: "big"}
+
+func (w WordSize) String() string {
+	if name, exists := wordSizeNames[w]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("WordSize(%d)", int(w))
+}
+
+// ParseWordSize parses a word size written as "32", "64" or "big"
+func ParseWordSize(size string) (WordSize, error) {
+	for wordSize, name := range wordSizeNames {
+		if name == size {
+			return wordSize, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid word size '%v' (expected 32, 64 or big)", size)
+}
+
+func (w WordSize) MarshalText() ([]byte, error) {
+	if _, exists := wordSizeNames[w]; !exists {
+		return nil, fmt.Errorf("invalid word size '%v'", int(w))
+	}
+
+	return []byte(w.String()), nil
+}
+
+func (w *WordSize) UnmarshalText(text []byte) error {
+	size, err := ParseWordSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*w = size
+	return nil
+}
+
+// Overflow selects what happens when a value does not fit in a word
+type Overflow int
+
+const (
+	// OverflowWrap keeps the value's lowest bits, as two's complement hardware does. This is the default
+	OverflowWrap Overflow = iota
+
+	// OverflowSaturate clamps the value to the largest or smallest word
+	OverflowSaturate
+
+	// OverflowFault stops the machine with a WordOverflowErr
+	OverflowFault
+)
+
+// overflowNames are the names of every overflow mode, as accepted by ParseOverflow
+var overflowNames = map[Overflow]string{OverflowWrap: "wrap", OverflowSaturate: "saturate", OverflowFault: "fault"}
+
+func (o Overflow) String() string {
+	if name, exists := overflowNames[o]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("Overflow(%d)", int(o))
+}
+
+// ParseOverflow parses an overflow mode written as "wrap", "saturate" or "fault"
+func ParseOverflow(overflow string) (Overflow, error) {
+	for mode, name := range overflowNames {
+		if name == overflow {
+			return mode, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid overflow mode '%v' (expected wrap, saturate or fault)", overflow)
+}
+
+func (o Overflow) MarshalText() ([]byte, error) {
+	if _, exists := overflowNames[o]; !exists {
+		return nil, fmt.Errorf("invalid overflow mode '%v'", int(o))
+	}
+
+	return []byte(o.String()), nil
+}
+
+func (o *Overflow) UnmarshalText(text []byte) error {
+	mode, err := ParseOverflow(string(text))
+	if err != nil {
+		return err
+	}
+
+	*o = mode
+	return nil
+}
+
+// WordFormat describes the words a TsvetokVirtualMachine computes with: how wide they are, and what happens to
+// values that do not fit. The zero WordFormat is 32-bit words that wrap around. Before word formats existed,
+// machines computed with 64-bit words, so programs that relied on that must ask for WordSize64
+type WordFormat struct {
+	Size     WordSize `json:"size"`
+	Overflow Overflow `json:"overflow"`
+}
+
+func (w WordFormat) String() string {
+	if w.Size == WordSizeBig {
+		return "big"
+	}
+
+	return fmt.Sprintf("%v/%v", w.Size, w.Overflow)
+}
+
+// Validate returns an error if the word size or overflow mode is unknown
+func (w WordFormat) Validate() error {
+	if _, exists := wordSizeNames[w.Size]; !exists {
+		return fmt.Errorf("invalid word size '%v'", int(w.Size))
+	}
+
+	if _, exists := overflowNames[w.Overflow]; !exists {
+		return fmt.Errorf("invalid overflow mode '%v'", int(w.Overflow))
+	}
+
+	return nil
+}
+
+// bits returns the number of bits in a word, or 0 for WordSizeBig
+func (w WordFormat) bits() int {
+	switch w.Size {
+	case WordSize32:
+		return 32
+	case WordSize64:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// fits returns true if the value provided fits in a word without overflowing
+func (w WordFormat) fits(value int) bool {
+	return w.Size != WordSize32 || (value >= math.MinInt32 && value <= math.MaxInt32)
+}
+
+// Fit returns the value provided as it is stored in a word, applying the overflow mode if it does not fit. The
+// error is a WordOverflowErr naming the operation provided, and is only returned by OverflowFault
+func (w WordFormat) Fit(operation string, value int) (int, error) {
+	if w.fits(value) {
+		return value, nil
+	}
+
+	fitted, _, err := w.fitExact(operation, big.NewInt(int64(value)))
+	return fitted, err
+}
+
+// FitLiteral checks that a literal written in a program, such as an assembler immediate, can be stored in a word,
+// and returns the word it is stored as. Literals must fit as signed integers, except that when words wrap they may
+// also be written as the unsigned bit pattern of the word (e.g. 4294967295 is -1 in a 32-bit word.) Unlike Fit, a
+// literal that does not fit is always an error, whatever the overflow mode
+func (w WordFormat) FitLiteral(value int) (int, error) {
+	if w.fits(value) {
+		return value, nil
+	}
+
+	if w.Size == WordSize32 && w.Overflow == OverflowWrap && value > 0 && value <= math.MaxUint32 {
+		return int(int32(uint32(value))), nil
+	}
+
+	return 0, fmt.Errorf("literal '%v' does not fit in a %v-bit word", value, w.Size)
+}
+
+// fitExact returns the exact value provided as it is stored in a word. For WordSizeBig, values too wide for an int
+// are returned as a big.Int instead (and the int is 0)
+func (w WordFormat) fitExact(operation string, exact *big.Int) (int, *big.Int, error) {
+	if w.Size == WordSizeBig {
+		if exact.IsInt64() {
+			return int(exact.Int64()), nil, nil
+		}
+
+		return 0, exact, nil
+	}
+
+	bits := uint(w.bits())
+	minimum := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), bits-1))
+	maximum := new(big.Int).Sub(new(big.Int).Neg(minimum), big.NewInt(1))
+	if exact.Cmp(minimum) >= 0 && exact.Cmp(maximum) <= 0 {
+		return int(exact.Int64()), nil, nil
+	}
+
+	switch w.Overflow {
+	case OverflowSaturate:
+		if exact.Sign() < 0 {
+			return int(minimum.Int64()), nil, nil
+		}
+
+		return int(maximum.Int64()), nil, nil
+	case OverflowFault:
+		return 0, nil, WordOverflowErr{operation, exact.String(), w.Size}
+	default:
+		modulus := new(big.Int).Lsh(big.NewInt(1), bits)
+		wrapped := new(big.Int).Mod(exact, modulus)
+		if wrapped.Cmp(maximum) > 0 {
+			wrapped.Sub(wrapped, modulus)
+		}
+
+		return int(wrapped.Int64()), nil, nil
+	}
+}
+
+// arithmeticOperator is the computation an arithmetic instruction performs on its two parameters. native computes
+// it with ints, reporting false if the result overflowed an int, in which case exact computes it again without
+// overflowing. validate, if set, rejects second parameters the operator is undefined for (such as dividing by zero)
+// before either is called. Unary operators ignore their second parameter, which is always 0, and write their
+// result to the parameter after their first
+type arithmeticOperator struct {
+	name     string
+	native   func(a, b int) (int, bool)
+	exact    func(a, b *big.Int) *big.Int
+	validate func(w WordFormat, right *big.Int) error
+	unary    bool
+}
+
+// apply computes the operator over the values provided and fits the result in a word. Results too wide for an int,
+// which only exist with WordSizeBig, are returned as a big.Int instead (and the int is 0)
+func (w WordFormat) apply(operator arithmeticOperator, left, right int) (int, *big.Int, error) {
+	if operator.validate != nil {
+		if err := operator.validate(w, big.NewInt(int64(right))); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if result, ok := operator.native(left, right); ok && w.fits(result) {
+		return result, nil, nil
+	}
+
+	return w.fitExact(operator.name, operator.exact(big.NewInt(int64(left)), big.NewInt(int64(right))))
+}
+
+// arithmeticOperators are the operators of the arithmetic instructions, by opcode
+var arithmeticOperators = map[int]arithmeticOperator{
+	1:  addOperator,
+	2:  multiplyOperator,
+	5:  setIfEqualOperator,
+	7:  setIfLessThanOperator,
+	10: divideOperator,
+	11: moduloOperator,
+	12: andOperator,
+	13: orOperator,
+	14: xorOperator,
+	15: notOperator,
+	16: shiftLeftOperator,
+	17: shiftRightOperator,
+}
+
+// Compute returns the word the arithmetic instruction with the opcode provided writes for the parameters provided,
+// exactly as a machine with words of this format computes it, or the error the machine faults with. Results too
+// wide for an int, which only WordSizeBig words hold, are a WideWordErr. Unary instructions ignore right
+func (w WordFormat) Compute(opCode, left, right int) (int, error) {
+	operator, isArithmetic := arithmeticOperators[opCode]
+	if !isArithmetic {
+		return 0, fmt.Errorf("'%v' is not the opcode of an arithmetic instruction", opCode)
+	}
+
+	if operator.unary {
+		right = 0
+	}
+
+	result, wide, err := w.apply(operator, left, right)
+	if wide != nil {
+		return 0, WideWordErr{operator.name, wide.String()}
+	}
+
+	return result, err
+}
+
+// SetWordFormat changes the width of the machine's words and what happens when values overflow them. Words
+// already in memory and registers that no longer fit are fitted as the new overflow mode dictates, just as the
+// words of a program are when it is loaded; with OverflowFault, the machine is left unchanged and the first word
+// that does not fit is reported
+func (t *TsvetokVirtualMachine) SetWordFormat(format WordFormat) error {
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	memory, err := fitWords(format, "load of address", t.memory)
+	if err != nil {
+		return err
+	}
+
+	registers, err := fitWords(format, "load of register", t.registerFile)
+	if err != nil {
+		return err
+	}
+
+	if format.Size != WordSizeBig && t.wide != nil {
+		return fmt.Errorf("cannot narrow words to %v bits while some are wider than an int", format.Size)
+	}
+
+	copy(t.memory, memory)
+	copy(t.registerFile, registers)
+	t.wordFormat = format
+	t.decodeCache = nil
+	t.compiled = nil
+	return nil
+}
+
+// GetWordFormat returns the width of the machine's words and what happens when values overflow them
+func (t *TsvetokVirtualMachine) GetWordFormat() WordFormat {
+	return t.wordFormat
+}
+
+// fitWords returns the words provided fitted in the word format provided, without modifying them
+func fitWords(format WordFormat, operation string, words []int) ([]int, error) {
+	fitted := make([]int, len(words))
+	for address, word := range words {
+		value, err := format.Fit(fmt.Sprintf("%v '%v'", operation, address), word)
+		if err != nil {
+			return nil, err
+		}
+
+		fitted[address] = value
+	}
+
+	return fitted, nil
+}
@@ -0,0 +1,286 @@
+package virtual_machine
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordFormat_FitsValuesAccordingToItsOverflowMode(t *testing.T) {
+	for _, tc := range []struct {
+		format   WordFormat
+		value    int
+		expected int
+	}{
+		{WordFormat{WordSize32, OverflowWrap}, math.MaxInt32 + 1, math.MinInt32},
+		{WordFormat{WordSize32, OverflowWrap}, 1 << 40, 0},
+		{WordFormat{WordSize32, OverflowWrap}, -1 << 40, 0},
+		{WordFormat{WordSize32, OverflowSaturate}, math.MaxInt32 + 1, math.MaxInt32},
+		{WordFormat{WordSize32, OverflowSaturate}, math.MinInt32 - 1, math.MinInt32},
+		{WordFormat{WordSize64, OverflowFault}, math.MaxInt64, math.MaxInt64},
+		{WordFormat{WordSizeBig, OverflowFault}, math.MinInt64, math.MinInt64},
+	} {
+		fitted, err := tc.format.Fit("add", tc.value)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, fitted, "%v of %v", tc.format, tc.value)
+	}
+
+	_, err := WordFormat{WordSize32, OverflowFault}.Fit("add", math.MaxInt32+1)
+	assert.Equal(t, WordOverflowErr{"add", "2147483648", WordSize32}, err)
+	assert.EqualError(t, err, "add overflowed a 32-bit word with '2147483648'")
+}
+
+func TestWordFormat_ComputesAsTheMachineDoes(t *testing.T) {
+	sum, err := WordFormat{}.Compute(1, math.MaxInt32, 1)
+	require.NoError(t, err)
+	assert.Equal(t, math.MinInt32, sum)
+
+	product, err := WordFormat{WordSize64, OverflowSaturate}.Compute(2, math.MaxInt64, 2)
+	require.NoError(t, err)
+	assert.Equal(t, math.MaxInt64, product)
+
+	_, err = WordFormat{Overflow: OverflowFault}.Compute(1, math.MaxInt32, 1)
+	assert.Equal(t, WordOverflowErr{"add", "2147483648", WordSize32}, err)
+
+	_, err = WordFormat{Size: WordSizeBig}.Compute(2, math.MaxInt64, 2)
+	assert.Equal(t, WideWordErr{"mlt", "18446744073709551614"}, err)
+
+	_, err = WordFormat{}.Compute(16, 1, -1)
+	assert.Error(t, err)
+
+	_, err = WordFormat{}.Compute(9, 0, 0)
+	assert.Error(t, err, "only arithmetic opcodes compute")
+}
+
+func TestWordFormat_ChecksTheRangeOfLiterals(t *testing.T) {
+	literal, err := WordFormat{}.FitLiteral(math.MaxUint32)
+	require.NoError(t, err)
+	assert.Equal(t, -1, literal, "wrapping words accept unsigned bit patterns")
+
+	_, err = WordFormat{Overflow: OverflowSaturate}.FitLiteral(math.MaxUint32)
+	assert.EqualError(t, err, "literal '4294967295' does not fit in a 32-bit word")
+
+	_, err = WordFormat{}.FitLiteral(math.MaxUint32 + 1)
+	assert.Error(t, err)
+
+	_, err = WordFormat{}.FitLiteral(math.MinInt32 - 1)
+	assert.Error(t, err)
+
+	literal, err = WordFormat{Size: WordSize64}.FitLiteral(math.MinInt64)
+	require.NoError(t, err)
+	assert.Equal(t, math.MinInt64, literal)
+}
+
+func TestWordFormat_ParsesAndMarshals(t *testing.T) {
+	size, err := ParseWordSize("64")
+	require.NoError(t, err)
+	assert.Equal(t, WordSize64, size)
+
+	overflow, err := ParseOverflow("saturate")
+	require.NoError(t, err)
+	assert.Equal(t, OverflowSaturate, overflow)
+
+	_, err = ParseWordSize("16")
+	assert.EqualError(t, err, "invalid word size '16' (expected 32, 64 or big)")
+
+	_, err = ParseOverflow("explode")
+	assert.Error(t, err)
+
+	encoded, err := json.Marshal(WordFormat{WordSizeBig, OverflowFault})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"size": "big", "overflow": "fault"}`, string(encoded))
+
+	var decoded WordFormat
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, WordFormat{WordSizeBig, OverflowFault}, decoded)
+	assert.Error(t, WordFormat{Size: 7}.Validate())
+}
+
+func TestTsvetokVirtualMachine_AppliesTheWordFormatToArithmetic(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		// r0 = 2147483647 + 1, r1 = -2147483648 * -1, r2 = 3037000500 * 3037000500
+		program := []int{21101, math.MaxInt32, 1, 0, 21102, math.MinInt32, -1, 1, 21102, 3037000500, 3037000500, 2, 9}
+
+		for _, tc := range []struct {
+			format   WordFormat
+			expected []int
+			err      string
+		}{
+			{WordFormat{WordSize32, OverflowWrap}, []int{math.MinInt32, math.MinInt32, 145474192}, ""},
+			{WordFormat{WordSize32, OverflowSaturate}, []int{math.MaxInt32, math.MaxInt32, math.MaxInt32}, ""},
+			{WordFormat{WordSize32, OverflowFault}, []int{0, 0, 0}, "add overflowed a 32-bit word with '2147483648'"},
+			{WordFormat{WordSize64, OverflowWrap}, []int{math.MaxInt32 + 1, -math.MinInt32, -9223372036709301616}, ""},
+			{WordFormat{WordSize64, OverflowSaturate}, []int{math.MaxInt32 + 1, -math.MinInt32, math.MaxInt64}, ""},
+			{WordFormat{WordSize64, OverflowFault}, []int{math.MaxInt32 + 1, -math.MinInt32, 0}, "mlt overflowed a 64-bit word with '9223372037000250000'"},
+		} {
+			t.Run(tc.format.String(), func(t *testing.T) {
+				// The operands of the last instruction do not fit in 32 bits, so they are not loaded through SetWordFormat
+				machine := newMachine(append([]int{}, program...))
+				machine.wordFormat = tc.format
+
+				err := machine.Execute()
+				if tc.err != "" {
+					assert.EqualError(t, err, tc.err)
+				} else {
+					require.NoError(t, err)
+				}
+
+				assert.Equal(t, tc.expected, machine.registerFile[:3])
+			})
+		}
+	})
+}
+
+func TestTsvetokVirtualMachine_AppliesTheWordFormatToInput(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, newMachine machineConstructor) {
+		machine := newMachine([]int{203, 0, 9})
+		machine.SetInputInterface(MockInputInterface{math.MaxInt32 + 2})
+		require.NoError(t, machine.Execute())
+		assert.Equal(t, math.MinInt32+1, machine.registerFile[0])
+
+		machine = newMachine([]int{203, 0, 9})
+		machine.SetInputInterface(MockInputInterface{math.MaxInt32 + 2})
+		require.NoError(t, machine.SetWordFormat(WordFormat{WordSize32, OverflowFault}))
+		assert.EqualError(t, machine.Execute(), "in overflowed a 32-bit word with '2147483649'")
+	})
+}
+
+func TestTsvetokVirtualMachine_FitsExistingWordsWhenTheFormatChanges(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{9, math.MaxInt32 + 1})
+	require.NoError(t, machine.SetWordFormat(WordFormat{WordSize64, OverflowWrap}))
+	assert.Equal(t, []int{9, math.MaxInt32 + 1}, machine.CopyMemory())
+
+	err := machine.SetWordFormat(WordFormat{WordSize32, OverflowFault})
+	assert.EqualError(t, err, "load of address '1' overflowed a 32-bit word with '2147483648'")
+	assert.Equal(t, WordFormat{WordSize64, OverflowWrap}, machine.GetWordFormat(), "a failed change leaves the machine alone")
+
+	require.NoError(t, machine.SetWordFormat(WordFormat{WordSize32, OverflowSaturate}))
+	assert.Equal(t, []int{9, math.MaxInt32}, machine.CopyMemory())
+}
+
+// factorialProgram reads n and outputs n!, keeping the running product in r1
+var factorialProgram = []int{203, 0, 21101, 1, 0, 1, 22202, 1, 0, 1, 21201, 0, -1, 0, 22107, 0, 0, 5, 1206, 5, 6, 204, 1, 9}
+
+func TestTsvetokVirtualMachine_ComputesWithArbitraryPrecisionWords(t *testing.T) {
+	out := &bytes.Buffer{}
+	machine := NewTsvetokVirtualMachine(append([]int{}, factorialProgram...))
+	require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
+	machine.SetInputInterface(MockInputInterface{30})
+	machine.SetOutputInterface(NewWriterOutputInterface(out))
+
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, "265252859812191058636308480000000\n", out.String())
+
+	product, err := machine.GetBigValueInRegisterFile(RegisterReserved1)
+	require.NoError(t, err)
+	assert.Equal(t, "265252859812191058636308480000000", product.String())
+	assert.Equal(t, 0, machine.registerFile[RegisterReserved1])
+}
+
+func TestTsvetokVirtualMachine_ForgetsWideWordsWhenOverwritten(t *testing.T) {
+	machine := NewTsvetokVirtualMachine([]int{22202, 0, 0, 0, 22202, 0, 0, 0, 21101, 0, 7, 0, 204, 0, 9})
+	require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
+	machine.registerFile[0] = math.MaxInt64
+	mockOutput := &MockOutputInterface{}
+	machine.SetOutputInterface(mockOutput)
+
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, 7, *mockOutput.LastNumberReceived)
+	assert.Nil(t, machine.wide)
+}
+
+func TestTsvetokVirtualMachine_FaultsWhenWideWordsAreNotUsedAsData(t *testing.T) {
+	// r0 = (2^62)^2, then uses r0 as described
+	square := []int{21102, 1 << 62, 1 << 62, 0}
+
+	for _, tc := range []struct {
+		name    string
+		program []int
+		err     string
+	}{
+		{"output", []int{204, 0, 9}, "out cannot use '21267647932558653966460912964485513216' since it does not fit in 64 bits"},
+		{"jump target", []int{2106, 1, 0, 9}, "jit cannot use '21267647932558653966460912964485513216' since it does not fit in 64 bits"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			machine := NewTsvetokVirtualMachine(append(append([]int{}, square...), tc.program...))
+			require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
+			machine.SetOutputInterface(&MockOutputInterface{})
+
+			assert.EqualError(t, machine.Execute(), tc.err)
+		})
+	}
+
+	// Wide words are still true, and still compare
+	program := append(append([]int{}, square...), 22107, 0, 0, 1, 22205, 0, 0, 2, 1206, 0, 16, 9, 9)
+	machine := NewTsvetokVirtualMachine(program)
+	require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, []int{0, 1, 1}, machine.registerFile[:3])
+	assert.Equal(t, 15, machine.registerFile[RegisterLastAddress])
+}
+
+func TestTsvetokVirtualMachine_RoundTripsWideWordsThroughMachineStates(t *testing.T) {
+	machine := NewTsvetokVirtualMachine(append([]int{}, factorialProgram...))
+	require.NoError(t, machine.SetWordFormat(WordFormat{Size: WordSizeBig}))
+	machine.SetInputInterface(MockInputInterface{25})
+	machine.SetOutputInterface(NewWriterOutputInterface(&bytes.Buffer{}))
+	require.NoError(t, machine.Execute())
+
+	state := machine.Snapshot()
+	require.Len(t, state.WideRegisters, 1)
+
+	for _, format := range []MachineStateFormat{MachineStateFormatBinary, MachineStateFormatJSON} {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, WriteMachineState(buffer, state, format))
+
+		decoded, err := ReadMachineState(buffer)
+		require.NoError(t, err)
+		assert.Equal(t, state.WordFormat, decoded.WordFormat)
+		assert.Equal(t, "15511210043330985984000000", decoded.WideRegisters[RegisterReserved1].String())
+
+		restored, err := NewTsvetokVirtualMachineFromState(decoded)
+		require.NoError(t, err)
+		product, err := restored.GetBigValueInRegisterFile(RegisterReserved1)
+		require.NoError(t, err)
+		assert.Equal(t, "15511210043330985984000000", product.String())
+	}
+
+	state.WordFormat = WordFormat{}
+	_, err := NewTsvetokVirtualMachineFromState(state)
+	assert.Error(t, err, "only machines with arbitrary-precision words can hold wide words")
+}
+
+func TestImage_CarriesTheWordFormat(t *testing.T) {
+	image := Image{
+		Sections:   []Section{{"program", 0, MemoryPermissionAll, []int{21101, math.MaxInt32, 1, 0, 9, math.MinInt64}}},
+		WordFormat: WordFormat{WordSize64, OverflowFault},
+	}
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteImage(buffer, image))
+
+	decoded, err := ReadImage(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, image, decoded)
+
+	machine, err := NewTsvetokVirtualMachineFromImage(decoded)
+	require.NoError(t, err)
+	require.NoError(t, machine.Execute())
+	assert.Equal(t, math.MaxInt32+1, machine.registerFile[0])
+
+	image.WordFormat = WordFormat{}
+	err = WriteImage(&bytes.Buffer{}, image)
+	assert.EqualError(t, err, "word '-9223372036854775808' at address '5' does not fit in 32 bits")
+}
+
+func TestImage_ReadsVersion1Images(t *testing.T) {
+	version1 := []byte("TVX\x01\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00p\x00\x00\x00\x00\x07\x00\x00\x00\x01\x00\x00\x00\x09\x00\x00\x00")
+
+	image, err := ReadImage(bytes.NewReader(version1))
+	require.NoError(t, err)
+	assert.Equal(t, Image{Sections: []Section{{"p", 0, MemoryPermissionAll, []int{9}}}}, image)
+}
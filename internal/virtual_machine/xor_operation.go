@@ -0,0 +1,29 @@
+package virtual_machine
+
+import (
+	"math/big"
+)
+
+// xorOperation sets the output parameter to the bitwise exclusive or of two numbers
+type xorOperation struct {
+	*TsvetokVirtualMachine
+}
+
+// xorOperator computes the bitwise exclusive or of two words, as two's complement integers
+var xorOperator = arithmeticOperator{
+	name:   "xor",
+	native: func(a, b int) (int, bool) { return a ^ b, true },
+	exact:  func(a, b *big.Int) *big.Int { return new(big.Int).Xor(a, b) },
+}
+
+func newXorOperation(t *TsvetokVirtualMachine) xorOperation {
+	return xorOperation{t}
+}
+
+func (x xorOperation) Execute() error {
+	return x.executeArithmetic(xorOperator)
+}
+
+func (x xorOperation) GetNextProgramCounter() int { return x.getProgramCounter() + 4 }
+
+func (_ xorOperation) Halt() bool { return false }